@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/migration"
+	"jiaxun/internal/repository"
+)
+
+const usage = `Usage: migrate <command>
+
+Commands:
+  up            Apply all pending migrations
+  down [steps]  Roll back the last applied migration(s), 1 by default
+  status        List migrations and whether they have been applied`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	// Load configuration from environment variables or a config file
+	cfg, err := config.LoadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	// Validate the loaded configuration
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	db, err := repository.OpenDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+
+	migrator, err := migration.New(db)
+	if err != nil {
+		log.Fatalf("Error loading migrations: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			log.Printf("Applied %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			log.Println("Database schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps: %s", os.Args[2])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, m := range reverted {
+			log.Printf("Rolled back %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatalf("Error reading migration status: %v", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Unknown {
+				state += " (unknown to this binary)"
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,329 @@
+// Command mockidp is a minimal OpenID Connect provider for trying out and
+// testing OIDC login locally. It must never be exposed to real users.
+//
+// With -email set, every login is approved at once as that user, which
+// suits scripted tests; otherwise a form asks who to log in as.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"jiaxun/internal/keyring"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// codeTTL is how long an authorization code can be redeemed
+const codeTTL = time.Minute
+
+// identity is the user a login is approved as
+type identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+	Groups        []string
+}
+
+// grant is an issued authorization code
+type grant struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	user          identity
+	expiresAt     time.Time
+}
+
+type provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	auto         *identity
+	keys         *keyring.Keyring
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><body>
+<h1>Mock identity provider</h1>
+<form method="post">
+{{range $k, $v := .Query}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">
+{{end}}<p><label>Email <input name="email" value="student@example.edu"></label></p>
+<p><label>Email verified <input type="checkbox" name="email_verified" value="true" checked></label></p>
+<p><label>Name <input name="name" value="Test Student"></label></p>
+<p><label>Username <input name="preferred_username" value="student"></label></p>
+<p><label>Groups <input name="groups" value="students"></label> (comma-separated)</p>
+<p><button>Log in</button></p>
+</form>
+</body></html>`))
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9400", "address to listen on")
+	issuer := flag.String("issuer", "http://127.0.0.1:9400", "issuer URL, as configured in jiaxun")
+	clientID := flag.String("client-id", "jiaxun", "accepted client ID")
+	clientSecret := flag.String("client-secret", "secret", "accepted client secret")
+	email := flag.String("email", "", "approve every login as this email instead of showing a form")
+	name := flag.String("name", "", "name of the automatic user")
+	username := flag.String("username", "", "preferred username of the automatic user")
+	groups := flag.String("groups", "", "comma-separated groups of the automatic user")
+	unverified := flag.Bool("unverified", false, "report the automatic user's email as unverified")
+	flag.Parse()
+
+	keys, err := newKeyring()
+	if err != nil {
+		log.Fatalf("Error generating key: %v", err)
+	}
+
+	p := &provider{
+		issuer:       strings.TrimSuffix(*issuer, "/"),
+		clientID:     *clientID,
+		clientSecret: *clientSecret,
+		keys:         keys,
+		codes:        map[string]grant{},
+	}
+	if *email != "" {
+		p.auto = &identity{
+			Subject:       subjectOf(*email),
+			Email:         *email,
+			EmailVerified: !*unverified,
+			Name:          *name,
+			Username:      *username,
+			Groups:        splitList(*groups),
+		}
+	}
+
+	http.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	http.HandleFunc("/jwks", p.jwks)
+	http.HandleFunc("/authorize", p.authorize)
+	http.HandleFunc("/token", p.token)
+
+	log.Printf("Mock identity provider %s listening on %s", p.issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+// newKeyring generates a fresh RSA signing key. Each key gets its own ID,
+// so that relying parties refetch the key set after a restart.
+func newKeyring() (*keyring.Keyring, error) {
+	kid := randomString()[:8]
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keyring.ParsePEM(kid, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return nil, err
+	}
+	return keyring.New(kid, key)
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.keys.JWKS())
+}
+
+// authorize approves a login and sends the browser back with a code
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.Form
+
+	if q.Get("response_type") != "code" || q.Get("client_id") != p.clientID || q.Get("redirect_uri") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	var user identity
+	switch {
+	case p.auto != nil:
+		user = *p.auto
+	case r.Method == http.MethodPost:
+		user = identity{
+			Subject:       subjectOf(q.Get("email")),
+			Email:         q.Get("email"),
+			EmailVerified: q.Get("email_verified") == "true",
+			Name:          q.Get("name"),
+			Username:      q.Get("preferred_username"),
+			Groups:        splitList(q.Get("groups")),
+		}
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = loginForm.Execute(w, map[string]interface{}{"Query": r.URL.Query()})
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = grant{
+		clientID:      q.Get("client_id"),
+		redirectURI:   q.Get("redirect_uri"),
+		codeChallenge: q.Get("code_challenge"),
+		nonce:         q.Get("nonce"),
+		user:          user,
+		expiresAt:     time.Now().Add(codeTTL),
+	}
+	p.mu.Unlock()
+
+	target, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	values := target.Query()
+	values.Set("code", code)
+	values.Set("state", q.Get("state"))
+	target.RawQuery = values.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// token redeems an authorization code for an ID token
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.clientID || clientSecret != p.clientSecret {
+		tokenError(w, "invalid_client", "unknown client or wrong secret")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "only authorization_code is supported")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	g, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	if !ok || time.Now().After(g.expiresAt) || g.clientID != clientID || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant", "unknown, expired or mismatched code")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		tokenError(w, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            g.user.Subject,
+		"aud":            clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"email":          g.user.Email,
+		"email_verified": g.user.EmailVerified,
+		"groups":         g.user.Groups,
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	if g.user.Name != "" {
+		claims["name"] = g.user.Name
+	}
+	if g.user.Username != "" {
+		claims["preferred_username"] = g.user.Username
+	}
+
+	idToken, err := p.keys.Sign(claims)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// subjectOf derives a stable subject from an email address, so that the
+// same user logs in as the same account every time
+func subjectOf(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(sum[:8])
+}
+
+func splitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Error generating random value: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
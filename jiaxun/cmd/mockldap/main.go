@@ -0,0 +1,50 @@
+// Command mockldap is a minimal in-memory LDAP server for trying out and
+// testing LDAP login locally. It supports simple binds and searches, keeps
+// passwords in plain text and must never be exposed to real users.
+//
+// Without -data it serves a sample directory below dc=example,dc=edu with
+// the search account cn=reader,dc=example,dc=edu (password "reader") and
+// the users alice (group staff) and bob (group students), whose passwords
+// are "password". A data file holds a JSON list of entries:
+//
+//	[{"dn": "uid=carol,ou=people,dc=example,dc=edu",
+//	  "attributes": {"uid": ["carol"], "userPassword": ["secret"]}}]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net"
+	"os"
+
+	"jiaxun/internal/ldap/ldaptest"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:3389", "address to listen on")
+	data := flag.String("data", "", "JSON file with the directory entries, instead of the sample directory")
+	flag.Parse()
+
+	directory := ldaptest.SampleDirectory()
+	if *data != "" {
+		raw, err := os.ReadFile(*data)
+		if err != nil {
+			log.Fatalf("Error reading directory: %v", err)
+		}
+		directory = nil
+		if err := json.Unmarshal(raw, &directory); err != nil {
+			log.Fatalf("Error parsing directory: %v", err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("Error listening: %v", err)
+	}
+	log.Printf("Mock LDAP server with %d entries listening on %s", len(directory), *addr)
+	server := &ldaptest.Server{Directory: directory, Logger: log.Default()}
+	if err := server.Serve(listener); err != nil {
+		log.Fatalf("Error accepting connection: %v", err)
+	}
+}
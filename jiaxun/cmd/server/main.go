@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"jiaxun/internal/config"
 	"jiaxun/internal/handler"
+	"jiaxun/internal/judge"
+	"jiaxun/internal/keyring"
+	"jiaxun/internal/mailer"
 	"jiaxun/internal/middleware"
 	"jiaxun/internal/repository"
 	"jiaxun/internal/service"
@@ -47,7 +53,7 @@ func main() {
 	}
 
 	// Initialize DB connection using GORM
-	db, err := repository.InitDB(cfg.Database.Driver, cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name)
+	db, err := repository.InitDB(cfg.Database)
 	if err != nil {
 		log.Fatalf("Error initializing database: %v", err)
 	}
@@ -55,6 +61,11 @@ func main() {
 	// Create Gin router
 	r := gin.Default()
 
+	// Only believe forwarded client addresses from known proxies
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+
 	// Apply CORS middleware globally
 	r.Use(middleware.CORSMiddleware())
 
@@ -65,10 +76,117 @@ func main() {
 	// NOTE: We're NOT applying this globally to avoid blocking Swagger docs and public routes
 	// r.Use(middleware.AuthMiddleware())
 
+	// Load the keys access tokens are signed with
+	keys, err := keyring.Load(cfg.Auth.JWT, cfg.Application.Secret)
+	if err != nil {
+		log.Fatalf("Error loading JWT keys: %v", err)
+	}
+	middleware.SetKeyring(keys)
+	handler.NewJWKSHandler(r, keys)
+
 	// Initialize repositories, services, and handlers
 	userRepository := repository.NewUserRepository(db)
 	userService := service.NewUserService(*userRepository)
-	handler.NewUserHandler(r, userService)
+
+	tokenRepository := repository.NewTokenRepository(db)
+	authService := service.NewAuthService(tokenRepository, userService, cfg.Auth.AccessTokenTTL(), cfg.Auth.RefreshTokenTTL())
+	middleware.SetRevocationList(authService)
+	go purgeExpiredTokens(authService)
+
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Error initializing mailer: %v", err)
+	}
+	registrationService := service.NewRegistrationService(userService, mail, cfg.Registration, cfg.Application)
+	passwordResetService := service.NewPasswordResetService(tokenRepository, userService, authService, mail, cfg.Auth.PasswordResetTTL(), cfg.Application.FrontendURL)
+
+	roleRepository := repository.NewRoleRepository(db)
+	rbacService := service.NewRBACService(roleRepository, userService)
+	middleware.SetPermissionResolver(rbacService)
+
+	mfaRepository := repository.NewMFARepository(db)
+	mfaService := service.NewMFAService(mfaRepository, userService, rbacService, cfg.Application.Secret, cfg.Auth.RequireMFAForPrivileged)
+	go purgeMFAChallenges(mfaService)
+
+	accessTokenRepository := repository.NewAccessTokenRepository(db)
+	accessTokenService := service.NewAccessTokenService(accessTokenRepository, rbacService, cfg.Auth.PersonalAccessTokenMaxTTL())
+	middleware.SetAccessTokenAuthenticator(accessTokenService)
+
+	loginAttemptRepository := repository.NewLoginAttemptRepository(db)
+	var loginAttemptStore service.LoginAttemptStore = service.NewMemoryLoginAttemptStore()
+	if cfg.LoginThrottle.Store == config.ThrottleStoreDatabase {
+		loginAttemptStore = loginAttemptRepository
+	}
+	loginThrottle := service.NewLoginThrottleService(loginAttemptStore, loginAttemptRepository, userService, cfg.LoginThrottle)
+	go purgeLoginAttempts(loginThrottle)
+
+	loginEventRepository := repository.NewLoginEventRepository(db)
+	loginHistory := service.NewLoginHistoryService(loginEventRepository, userService, cfg.Auth.LoginHistoryRetention())
+	go purgeLoginHistory(loginHistory)
+
+	// Check passwords against local hashes and LDAP directories, in the configured order
+	identityRepository := repository.NewIdentityRepository(db)
+	userService.SetAuthenticators(authenticators(cfg, identityRepository, userService)...)
+
+	handler.NewUserHandler(r, userService, authService, mfaService, registrationService, loginThrottle, loginHistory)
+	handler.NewAuthHandler(r, authService, registrationService, passwordResetService)
+	handler.NewMFAHandler(r, mfaService, authService, loginThrottle, loginHistory)
+	handler.NewRoleHandler(r, rbacService)
+	handler.NewAccessTokenHandler(r, accessTokenService)
+	handler.NewLockoutHandler(r, loginThrottle)
+	handler.NewSessionHandler(r, authService, loginHistory, userService)
+
+	userImportService := service.NewUserImportService(*userRepository, rbacService, passwordResetService, cfg.Auth.InvitationTTL())
+	handler.NewUserImportHandler(r, userImportService)
+
+	oidcRepository := repository.NewOIDCRepository(db)
+	oidcService := service.NewOIDCService(oidcRepository, identityRepository, userService, cfg.OIDC, cfg.Application)
+	go purgeOIDCStates(oidcService)
+	oidcRedirectURL := cfg.OIDC.RedirectURL
+	if oidcRedirectURL == "" {
+		oidcRedirectURL = strings.TrimSuffix(cfg.Application.FrontendURL, "/") + "/login/oidc"
+	}
+	handler.NewOIDCHandler(r, oidcService, authService, mfaService, loginHistory, oidcRedirectURL)
+
+	impersonationRepository := repository.NewImpersonationRepository(db)
+	impersonationService := service.NewImpersonationService(impersonationRepository, userService, rbacService, mail, cfg.Auth.ImpersonationMaxTTL())
+	middleware.SetImpersonationAuditor(impersonationService)
+	handler.NewImpersonationHandler(r, impersonationService)
+
+	contestRepository := repository.NewContestRepository(db)
+	teamRepository := repository.NewTeamRepository(db)
+	contestService := service.NewContestService(contestRepository, teamRepository, userService)
+	handler.NewContestHandler(r, contestService)
+
+	teamService := service.NewTeamService(teamRepository, userService, cfg.Team.MaxSize)
+	handler.NewTeamHandler(r, teamService)
+
+	trainingPlanRepository := repository.NewTrainingPlanRepository(db)
+	trainingService := service.NewTrainingService(trainingPlanRepository, userService, teamService)
+	handler.NewTrainingHandler(r, trainingService)
+
+	trashService := service.NewTrashService(userRepository, teamRepository, contestRepository, trainingPlanRepository, userService, cfg.Trash.Retention())
+	go purgeTrash(trashService)
+	handler.NewTrashHandler(r, trashService)
+
+	judgeVerifiers, err := judge.New(cfg.Judge, nil)
+	if err != nil {
+		log.Fatalf("Failed to configure judges: %v", err)
+	}
+	judgeAccountRepository := repository.NewJudgeAccountRepository(db)
+	judgeAccountService := service.NewJudgeAccountService(judgeAccountRepository, judgeVerifiers, cfg.Judge.ChallengeTTL())
+	handler.NewJudgeAccountHandler(r, judgeAccountService, userService)
+
+	submissionRepository := repository.NewSubmissionRepository(db)
+	submissionService := service.NewSubmissionService(submissionRepository, judgeAccountRepository, judge.Sources(judgeVerifiers))
+	if interval := cfg.Judge.SyncInterval(); interval > 0 {
+		go syncSubmissions(submissionService, interval)
+	}
+	handler.NewSubmissionHandler(r, submissionService, userService)
+
+	problemRepository := repository.NewProblemRepository(db)
+	problemService := service.NewProblemService(problemRepository)
+	handler.NewProblemHandler(r, problemService)
 
 	// Start the server on the configured port
 	port := fmt.Sprintf(":%d", cfg.Server.Port)
@@ -78,3 +196,86 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// purgeExpiredTokens periodically removes expired sessions, refresh tokens and revocation entries
+func purgeExpiredTokens(authService *service.AuthService) {
+	for range time.Tick(time.Hour) {
+		if err := authService.PurgeExpired(); err != nil {
+			log.Printf("Failed to purge expired tokens: %v", err)
+		}
+	}
+}
+
+// purgeMFAChallenges periodically removes second login steps that were never completed
+func purgeMFAChallenges(mfaService *service.MFAService) {
+	for range time.Tick(time.Hour) {
+		if err := mfaService.PurgeExpired(); err != nil {
+			log.Printf("Failed to purge two-factor challenges: %v", err)
+		}
+	}
+}
+
+// purgeLoginAttempts periodically forgets failed login counters that have expired
+func purgeLoginAttempts(loginThrottle *service.LoginThrottleService) {
+	for range time.Tick(time.Hour) {
+		if err := loginThrottle.PurgeExpired(); err != nil {
+			log.Printf("Failed to purge login attempts: %v", err)
+		}
+	}
+}
+
+// purgeLoginHistory periodically removes login events past their retention
+func purgeLoginHistory(loginHistory *service.LoginHistoryService) {
+	for range time.Tick(time.Hour) {
+		if err := loginHistory.PurgeExpired(); err != nil {
+			log.Printf("Failed to purge login history: %v", err)
+		}
+	}
+}
+
+// authenticators builds the configured authenticator chain
+func authenticators(cfg *config.Config, identities *repository.IdentityRepository, userService *service.UserService) []service.Authenticator {
+	directories := map[string]config.LDAPDirectoryConfig{}
+	for _, d := range cfg.LDAP.Directories {
+		directories[d.ID] = d
+	}
+
+	var chain []service.Authenticator
+	for _, name := range cfg.Auth.Authenticators {
+		if name == config.AuthenticatorLocal {
+			chain = append(chain, service.NewLocalAuthenticator(userService))
+			continue
+		}
+		chain = append(chain, service.NewLDAPAuthenticator(directories[name], identities, userService))
+	}
+	return chain
+}
+
+// purgeOIDCStates periodically removes OIDC logins that were never completed
+func purgeOIDCStates(oidcService *service.OIDCService) {
+	for range time.Tick(time.Hour) {
+		if err := oidcService.PurgeExpired(); err != nil {
+			log.Printf("Failed to purge OIDC login states: %v", err)
+		}
+	}
+}
+
+// purgeTrash periodically purges deleted entities past their retention
+func purgeTrash(trashService *service.TrashService) {
+	for range time.Tick(time.Hour) {
+		if err := trashService.PurgeExpired(); err != nil {
+			log.Printf("Failed to purge the trash: %v", err)
+		}
+	}
+}
+
+// syncSubmissions periodically syncs the submissions of verified judge accounts
+func syncSubmissions(submissionService *service.SubmissionService, interval time.Duration) {
+	for range time.Tick(interval) {
+		synced, err := submissionService.SyncAll(context.Background())
+		if err != nil {
+			log.Printf("Failed to sync some judge accounts: %v", err)
+		}
+		log.Printf("Synced the submissions of %d judge accounts", synced)
+	}
+}
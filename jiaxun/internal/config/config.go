@@ -5,28 +5,490 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Server      ServerConfig      `json:"server"`
-	Database    DatabaseConfig    `json:"database"`
-	Logging     LoggingConfig     `json:"logging"`
-	Application ApplicationConfig `json:"application"`
+	Server        ServerConfig        `json:"server"`
+	Database      DatabaseConfig      `json:"database"`
+	Logging       LoggingConfig       `json:"logging"`
+	Application   ApplicationConfig   `json:"application"`
+	Team          TeamConfig          `json:"team"`
+	Trash         TrashConfig         `json:"trash"`
+	Judge         JudgeConfig         `json:"judge"`
+	Auth          AuthConfig          `json:"auth"`
+	Registration  RegistrationConfig  `json:"registration"`
+	Mail          MailConfig          `json:"mail"`
+	LoginThrottle LoginThrottleConfig `json:"login_throttle"`
+	OIDC          OIDCConfig          `json:"oidc"`
+	LDAP          LDAPConfig          `json:"ldap"`
 }
 
 // ServerConfig holds server-related configuration
 type ServerConfig struct {
 	Host string `json:"host"`
 	Port int    `json:"port"`
+	// TrustedProxies lists the proxies whose X-Forwarded-For header is
+	// believed when determining client addresses; empty trusts none
+	TrustedProxies []string `json:"trusted_proxies"`
 }
 
+// Application modes
+const (
+	ModeDevelopment = "development"
+	ModeProduction  = "production"
+)
+
+// DefaultSecret is the placeholder application secret shipped by earlier
+// versions, only accepted in development mode. No secret is shipped any
+// more, so that every deployment has to pick its own.
+const DefaultSecret = "mysecret"
+
 // ApplicationConfig holds application-related configuration
 type ApplicationConfig struct {
+	// Mode is "production" or "development"; development relaxes safety checks
+	Mode   string `json:"mode"`
 	Secret string `json:"secret"`
+	// BaseURL is the externally reachable address used in emailed links
+	BaseURL string `json:"base_url"`
+	// FrontendURL is the address of the web frontend, used for links that open a page
+	FrontendURL string `json:"frontend_url"`
+}
+
+// AuthConfig holds authentication-related configuration
+type AuthConfig struct {
+	AccessTokenTTLMinutes int `json:"access_token_ttl_minutes"`
+	RefreshTokenTTLHours  int `json:"refresh_token_ttl_hours"`
+	// PasswordResetTTLMinutes is how long an emailed password reset link stays valid
+	PasswordResetTTLMinutes int `json:"password_reset_ttl_minutes"`
+	// InvitationTTLHours is how long the link emailed to imported users to
+	// choose their password stays valid
+	InvitationTTLHours int `json:"invitation_ttl_hours"`
+	// RequireMFAForPrivileged restricts teacher and admin sessions without
+	// two-factor authentication to setting it up
+	RequireMFAForPrivileged bool `json:"require_mfa_for_privileged"`
+	// PersonalAccessTokenMaxTTLDays caps the lifetime users may give their access tokens
+	PersonalAccessTokenMaxTTLDays int `json:"personal_access_token_max_ttl_days"`
+	// LoginHistoryRetentionDays is how long login events are kept
+	LoginHistoryRetentionDays int `json:"login_history_retention_days"`
+	// ImpersonationMaxMinutes caps how long an administrator may act as another user
+	ImpersonationMaxMinutes int `json:"impersonation_max_minutes"`
+	// JWT holds the keys access tokens are signed with
+	JWT JWTConfig `json:"jwt"`
+	// Authenticators lists where passwords are checked, in order: "local"
+	// for passwords stored by jiaxun, or the ID of an LDAP directory
+	Authenticators []string `json:"authenticators"`
+}
+
+// AuthenticatorLocal names the authenticator for passwords stored by jiaxun
+const AuthenticatorLocal = "local"
+
+// JWTConfig holds the asymmetric keys access tokens are signed and verified
+// with. Without keys, tokens are signed with HS256 using the application secret.
+//
+// To rotate keys, add the new key and make it the signing key; keep the old
+// key until the access tokens it signed have expired, then remove it.
+type JWTConfig struct {
+	// SigningKeyID is the kid of the key new tokens are signed with
+	SigningKeyID string `json:"signing_key_id"`
+	// Keys are the keys tokens are verified with, published at /.well-known/jwks.json
+	Keys []JWTKeyConfig `json:"keys"`
+}
+
+// JWTKeyConfig identifies a PEM-encoded RSA or Ed25519 key. The signing key
+// must be a private key; retired keys may be public keys.
+type JWTKeyConfig struct {
+	ID   string `json:"kid"`
+	File string `json:"file"`
+}
+
+// Validate validates the key configuration
+func (j JWTConfig) Validate() error {
+	if len(j.Keys) == 0 {
+		if j.SigningKeyID != "" {
+			return fmt.Errorf("JWT signing key %q is not configured", j.SigningKeyID)
+		}
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, key := range j.Keys {
+		if key.ID == "" || key.File == "" {
+			return fmt.Errorf("JWT keys need a kid and a file")
+		}
+		if seen[key.ID] {
+			return fmt.Errorf("duplicate JWT key ID: %s", key.ID)
+		}
+		seen[key.ID] = true
+	}
+	if !seen[j.SigningKeyID] {
+		return fmt.Errorf("JWT signing key %q is not configured", j.SigningKeyID)
+	}
+	return nil
+}
+
+// AccessTokenTTL returns the lifetime of access tokens
+func (a AuthConfig) AccessTokenTTL() time.Duration {
+	return time.Duration(a.AccessTokenTTLMinutes) * time.Minute
+}
+
+// RefreshTokenTTL returns the lifetime of refresh tokens
+func (a AuthConfig) RefreshTokenTTL() time.Duration {
+	return time.Duration(a.RefreshTokenTTLHours) * time.Hour
+}
+
+// PersonalAccessTokenMaxTTL returns the longest allowed lifetime of personal access tokens
+func (a AuthConfig) PersonalAccessTokenMaxTTL() time.Duration {
+	return time.Duration(a.PersonalAccessTokenMaxTTLDays) * 24 * time.Hour
+}
+
+// LoginHistoryRetention returns how long login events are kept
+func (a AuthConfig) LoginHistoryRetention() time.Duration {
+	return time.Duration(a.LoginHistoryRetentionDays) * 24 * time.Hour
+}
+
+// RegistrationConfig holds self-service signup configuration
+type RegistrationConfig struct {
+	Enabled bool `json:"enabled"`
+	// AllowedDomains restricts signup to these email domains; empty allows any domain
+	AllowedDomains       []string `json:"allowed_domains"`
+	VerificationTTLHours int      `json:"verification_ttl_hours"`
+}
+
+// VerificationTTL returns how long an email verification link stays valid
+func (r RegistrationConfig) VerificationTTL() time.Duration {
+	return time.Duration(r.VerificationTTLHours) * time.Hour
+}
+
+// Supported mail backends
+const (
+	MailBackendLog  = "log"
+	MailBackendFile = "file"
+	MailBackendSMTP = "smtp"
+)
+
+// MailConfig holds outgoing mail configuration
+type MailConfig struct {
+	Backend string `json:"backend"`
+	From    string `json:"from"`
+	// Dir is the directory the file backend writes messages to
+	Dir  string     `json:"dir"`
+	SMTP SMTPConfig `json:"smtp"`
+}
+
+// SMTPConfig holds the settings of the SMTP mail backend
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Validate validates the mail configuration for its backend
+func (m MailConfig) Validate() error {
+	switch m.Backend {
+	case MailBackendLog:
+	case MailBackendFile:
+		if m.Dir == "" {
+			return fmt.Errorf("mail directory is required for the file backend")
+		}
+	case MailBackendSMTP:
+		if m.SMTP.Host == "" || m.SMTP.Port <= 0 {
+			return fmt.Errorf("SMTP host and port are required for the smtp backend")
+		}
+	default:
+		return fmt.Errorf("unsupported mail backend: %s", m.Backend)
+	}
+	if m.From == "" {
+		return fmt.Errorf("mail sender address is required")
+	}
+	return nil
+}
+
+// ImpersonationMaxTTL returns the longest allowed impersonation
+func (a AuthConfig) ImpersonationMaxTTL() time.Duration {
+	return time.Duration(a.ImpersonationMaxMinutes) * time.Minute
+}
+
+// PasswordResetTTL returns the lifetime of password reset tokens
+func (a AuthConfig) PasswordResetTTL() time.Duration {
+	return time.Duration(a.PasswordResetTTLMinutes) * time.Minute
 }
 
+// InvitationTTL returns the lifetime of invitation links
+func (a AuthConfig) InvitationTTL() time.Duration {
+	return time.Duration(a.InvitationTTLHours) * time.Hour
+}
+
+// OIDCConfig holds the OpenID Connect providers users can log in with
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig `json:"providers"`
+	// RedirectURL is where the browser is sent after an OIDC login, with the
+	// tokens or the error in the URL fragment; defaults to {frontend_url}/login/oidc
+	RedirectURL string `json:"redirect_url"`
+}
+
+// OIDCProviderConfig describes an OpenID Connect identity provider. Its
+// callback URL is {base_url}/api/auth/oidc/{id}/callback.
+type OIDCProviderConfig struct {
+	// ID names the provider in URLs; Name is shown to users
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	// AutoProvision creates accounts for unknown users with a verified email
+	AutoProvision bool `json:"auto_provision"`
+	// RoleClaim names a claim holding a group or role, or a list of them;
+	// RoleMapping maps its values to jiaxun roles, the first match winning
+	RoleClaim   string            `json:"role_claim"`
+	RoleMapping map[string]string `json:"role_mapping"`
+	// DefaultRole is given to provisioned users no mapping matches
+	DefaultRole string `json:"default_role"`
+	// SyncRoles reapplies the role mapping on every login, not only when
+	// the account is provisioned
+	SyncRoles bool `json:"sync_roles"`
+}
+
+// Validate validates the OIDC providers
+func (o OIDCConfig) Validate() error {
+	seen := map[string]bool{}
+	for _, p := range o.Providers {
+		if p.ID == "" || p.Issuer == "" || p.ClientID == "" {
+			return fmt.Errorf("OIDC providers need an id, issuer and client_id")
+		}
+		if seen[p.ID] {
+			return fmt.Errorf("duplicate OIDC provider ID: %s", p.ID)
+		}
+		seen[p.ID] = true
+	}
+	return nil
+}
+
+// LDAPConfig holds the LDAP or Active Directory servers passwords can be
+// checked against. A directory is only used once listed in auth.authenticators.
+type LDAPConfig struct {
+	Directories []LDAPDirectoryConfig `json:"directories"`
+}
+
+// LDAPDirectoryConfig describes an LDAP directory. Users are looked up with
+// the search account, then authenticated by binding as their own entry.
+type LDAPDirectoryConfig struct {
+	ID string `json:"id"`
+	// URL is an ldap:// or ldaps:// URL; StartTLS upgrades ldap:// connections
+	URL                string `json:"url"`
+	StartTLS           bool   `json:"start_tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	TimeoutSeconds     int    `json:"timeout_seconds"`
+	// BindDN and BindPassword are the search account; empty searches anonymously
+	BindDN       string `json:"bind_dn"`
+	BindPassword string `json:"bind_password"`
+	// UserFilter finds a user below UserBaseDN, with {login} replaced by
+	// what they typed; defaults to (uid={login})
+	UserBaseDN string `json:"user_base_dn"`
+	UserFilter string `json:"user_filter"`
+	// IDAttribute holds a value that never changes for an entry, such as
+	// entryUUID or objectGUID; empty uses the entry's DN
+	IDAttribute       string `json:"id_attribute"`
+	UsernameAttribute string `json:"username_attribute"`
+	EmailAttribute    string `json:"email_attribute"`
+	NameAttribute     string `json:"name_attribute"`
+	// GroupAttribute lists the DNs of the user's groups, like memberOf.
+	// Directories without it can search GroupBaseDN with GroupFilter, with
+	// {dn} replaced by the user's DN, e.g. (member={dn}).
+	GroupAttribute string `json:"group_attribute"`
+	GroupBaseDN    string `json:"group_base_dn"`
+	GroupFilter    string `json:"group_filter"`
+	// RoleMapping maps group DNs or common names to jiaxun roles, the first
+	// match winning; DefaultRole is given to provisioned users none matches
+	RoleMapping map[string]string `json:"role_mapping"`
+	DefaultRole string            `json:"default_role"`
+	// SyncRoles reapplies the role mapping on every login, not only when
+	// the account is provisioned
+	SyncRoles bool `json:"sync_roles"`
+}
+
+// Validate validates the LDAP directories
+func (l LDAPConfig) Validate() error {
+	seen := map[string]bool{}
+	for _, d := range l.Directories {
+		if d.ID == "" || d.URL == "" || d.UserBaseDN == "" {
+			return fmt.Errorf("LDAP directories need an id, url and user_base_dn")
+		}
+		if d.ID == AuthenticatorLocal {
+			return fmt.Errorf("LDAP directory ID %q is reserved", d.ID)
+		}
+		if seen[d.ID] {
+			return fmt.Errorf("duplicate LDAP directory ID: %s", d.ID)
+		}
+		seen[d.ID] = true
+		if !strings.HasPrefix(d.URL, "ldap://") && !strings.HasPrefix(d.URL, "ldaps://") {
+			return fmt.Errorf("LDAP directory %s: URL must start with ldap:// or ldaps://", d.ID)
+		}
+		if d.StartTLS && strings.HasPrefix(d.URL, "ldaps://") {
+			return fmt.Errorf("LDAP directory %s: start_tls cannot be used with ldaps://", d.ID)
+		}
+		if d.TimeoutSeconds < 0 {
+			return fmt.Errorf("LDAP directory %s: invalid timeout: %d seconds", d.ID, d.TimeoutSeconds)
+		}
+	}
+	return nil
+}
+
+// validateAuthenticators checks that the authenticator chain names local
+// passwords or configured directories, each at most once
+func (c *Config) validateAuthenticators() error {
+	if len(c.Auth.Authenticators) == 0 {
+		return fmt.Errorf("at least one authenticator is required")
+	}
+	directories := map[string]bool{}
+	for _, d := range c.LDAP.Directories {
+		directories[d.ID] = true
+	}
+	// Directories and OIDC providers share the namespace of linked accounts
+	for _, p := range c.OIDC.Providers {
+		if directories[p.ID] {
+			return fmt.Errorf("ID %q is used by both an OIDC provider and an LDAP directory", p.ID)
+		}
+	}
+	seen := map[string]bool{}
+	for _, name := range c.Auth.Authenticators {
+		if name != AuthenticatorLocal && !directories[name] {
+			return fmt.Errorf("unknown authenticator: %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate authenticator: %q", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// Supported login attempt stores
+const (
+	ThrottleStoreMemory   = "memory"
+	ThrottleStoreDatabase = "database"
+)
+
+// LoginThrottleConfig holds brute-force protection settings for logins.
+// Failed attempts are counted per account and per client address. Once an
+// account or address used up its free attempts, each further attempt must
+// wait BaseDelaySeconds, doubling with every failure up to MaxDelaySeconds;
+// reaching a lockout threshold locks the account or address for
+// LockoutMinutes. Failures older than WindowMinutes are forgotten.
+type LoginThrottleConfig struct {
+	Enabled bool `json:"enabled"`
+	// Store is "memory" for a single instance or "database" to share
+	// attempt counters between instances
+	Store                   string `json:"store"`
+	AccountFreeAttempts     int    `json:"account_free_attempts"`
+	AccountLockoutThreshold int    `json:"account_lockout_threshold"`
+	// Addresses get more attempts than accounts since many users may
+	// share one, e.g. behind a campus NAT
+	IPFreeAttempts     int `json:"ip_free_attempts"`
+	IPLockoutThreshold int `json:"ip_lockout_threshold"`
+	BaseDelaySeconds   int `json:"base_delay_seconds"`
+	MaxDelaySeconds    int `json:"max_delay_seconds"`
+	LockoutMinutes     int `json:"lockout_minutes"`
+	WindowMinutes      int `json:"window_minutes"`
+}
+
+// Validate validates the login throttle configuration
+func (l LoginThrottleConfig) Validate() error {
+	if !l.Enabled {
+		return nil
+	}
+	if l.Store != ThrottleStoreMemory && l.Store != ThrottleStoreDatabase {
+		return fmt.Errorf("unsupported login attempt store: %s", l.Store)
+	}
+	if l.AccountFreeAttempts < 1 || l.IPFreeAttempts < 1 || l.BaseDelaySeconds < 1 || l.MaxDelaySeconds < l.BaseDelaySeconds {
+		return fmt.Errorf("invalid login backoff settings")
+	}
+	if l.AccountLockoutThreshold <= l.AccountFreeAttempts || l.IPLockoutThreshold <= l.IPFreeAttempts {
+		return fmt.Errorf("lockout thresholds must exceed the free attempts")
+	}
+	if l.LockoutMinutes < 1 || l.WindowMinutes < 1 {
+		return fmt.Errorf("invalid login lockout duration or window")
+	}
+	return nil
+}
+
+// BaseDelay returns the wait imposed after the first failure beyond the free attempts
+func (l LoginThrottleConfig) BaseDelay() time.Duration {
+	return time.Duration(l.BaseDelaySeconds) * time.Second
+}
+
+// MaxDelay returns the longest wait imposed between attempts
+func (l LoginThrottleConfig) MaxDelay() time.Duration {
+	return time.Duration(l.MaxDelaySeconds) * time.Second
+}
+
+// LockoutDuration returns how long an account or address stays locked
+func (l LoginThrottleConfig) LockoutDuration() time.Duration {
+	return time.Duration(l.LockoutMinutes) * time.Minute
+}
+
+// Window returns how long failed attempts are remembered
+func (l LoginThrottleConfig) Window() time.Duration {
+	return time.Duration(l.WindowMinutes) * time.Minute
+}
+
+// TeamConfig holds team-related configuration
+type TeamConfig struct {
+	MaxSize int `json:"max_size"`
+}
+
+// TrashConfig holds the configuration of deleted users, teams, contests and
+// training plans, which are kept in the trash for a while before being purged
+type TrashConfig struct {
+	// RetentionDays is how long deleted entities can be restored
+	RetentionDays int `json:"retention_days"`
+}
+
+// Retention returns how long deleted entities are kept in the trash
+func (t TrashConfig) Retention() time.Duration {
+	return time.Duration(t.RetentionDays) * 24 * time.Hour
+}
+
+// JudgeConfig holds the configuration of the online judge accounts users
+// link and verify
+type JudgeConfig struct {
+	// ChallengeTTLMinutes is how long users have to put a verification
+	// challenge on their profile
+	ChallengeTTLMinutes int `json:"challenge_ttl_minutes"`
+	// BaseURLs overrides the address of platforms, keyed by platform
+	BaseURLs map[string]string `json:"base_urls"`
+	// RequestIntervalsMs overrides the time to wait between two requests to
+	// a platform, in milliseconds keyed by platform
+	RequestIntervalsMs map[string]int `json:"request_intervals_ms"`
+	// SyncIntervalMinutes is how often the submissions of verified handles
+	// are synced; 0 disables syncing
+	SyncIntervalMinutes int `json:"sync_interval_minutes"`
+}
+
+// ChallengeTTL returns how long verification challenges are valid
+func (j JudgeConfig) ChallengeTTL() time.Duration {
+	return time.Duration(j.ChallengeTTLMinutes) * time.Minute
+}
+
+// SyncInterval returns how often submissions are synced, zero if never
+func (j JudgeConfig) SyncInterval() time.Duration {
+	return time.Duration(j.SyncIntervalMinutes) * time.Minute
+}
+
+// Supported database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite3"
+)
+
+// SQLiteInMemory is the SQLite path of a transient in-memory database
+const SQLiteInMemory = ":memory:"
+
 // DatabaseConfig holds database-related configuration
 type DatabaseConfig struct {
 	Driver   string `json:"driver"`
@@ -35,6 +497,22 @@ type DatabaseConfig struct {
 	User     string `json:"user"`
 	Password string `json:"password"`
 	Name     string `json:"name"`
+	// Path is the SQLite database file, or ":memory:".
+	// Defaults to "<name>.db" when empty.
+	Path string `json:"path"`
+}
+
+// SQLitePath returns the SQLite database file to open
+func (d DatabaseConfig) SQLitePath() string {
+	if d.Path != "" {
+		return d.Path
+	}
+	return fmt.Sprintf("%s.db", d.Name)
+}
+
+// IsInMemory reports whether the database is a transient in-memory SQLite database
+func (d DatabaseConfig) IsInMemory() bool {
+	return d.Driver == DriverSQLite && d.SQLitePath() == SQLiteInMemory
 }
 
 // LoggingConfig holds logging-related configuration
@@ -60,7 +538,7 @@ func LoadConfig(configFile string) (*Config, error) {
 				Port: 8080,
 			},
 			Database: DatabaseConfig{
-				Driver:   "postgres",
+				Driver:   DriverPostgres,
 				Host:     "localhost",
 				Port:     5432,
 				User:     "postgres",
@@ -72,7 +550,53 @@ func LoadConfig(configFile string) (*Config, error) {
 				Format: "text",
 			},
 			Application: ApplicationConfig{
-				Secret: "mysecret",
+				Mode:        ModeProduction,
+				BaseURL:     "http://localhost:8080",
+				FrontendURL: "http://localhost:3000",
+			},
+			Team: TeamConfig{
+				MaxSize: 3,
+			},
+			Trash: TrashConfig{
+				RetentionDays: 30,
+			},
+			Judge: JudgeConfig{
+				ChallengeTTLMinutes: 60,
+				SyncIntervalMinutes: 360,
+			},
+			Auth: AuthConfig{
+				AccessTokenTTLMinutes:         15,
+				RefreshTokenTTLHours:          24 * 30,
+				PasswordResetTTLMinutes:       60,
+				InvitationTTLHours:            168,
+				PersonalAccessTokenMaxTTLDays: 365,
+				LoginHistoryRetentionDays:     90,
+				ImpersonationMaxMinutes:       60,
+				Authenticators:                []string{AuthenticatorLocal},
+			},
+			Registration: RegistrationConfig{
+				Enabled:              false,
+				VerificationTTLHours: 48,
+			},
+			Mail: MailConfig{
+				Backend: MailBackendLog,
+				From:    "noreply@jiaxun.example.com",
+				Dir:     "mail",
+				SMTP: SMTPConfig{
+					Port: 587,
+				},
+			},
+			LoginThrottle: LoginThrottleConfig{
+				Enabled:                 true,
+				Store:                   ThrottleStoreMemory,
+				AccountFreeAttempts:     3,
+				AccountLockoutThreshold: 10,
+				IPFreeAttempts:          20,
+				IPLockoutThreshold:      100,
+				BaseDelaySeconds:        1,
+				MaxDelaySeconds:         60,
+				LockoutMinutes:          15,
+				WindowMinutes:           15,
 			},
 		}
 
@@ -137,6 +661,9 @@ func overrideFromEnv(cfg *Config) {
 			cfg.Server.Port = p
 		}
 	}
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		cfg.Server.TrustedProxies = strings.Split(proxies, ",")
+	}
 
 	// Database configuration
 	if driver := os.Getenv("DB_DRIVER"); driver != "" {
@@ -159,6 +686,9 @@ func overrideFromEnv(cfg *Config) {
 	if name := os.Getenv("DB_NAME"); name != "" {
 		cfg.Database.Name = name
 	}
+	if path := os.Getenv("DB_PATH"); path != "" {
+		cfg.Database.Path = path
+	}
 
 	// Logging configuration
 	if level := os.Getenv("LOG_LEVEL"); level != "" {
@@ -167,6 +697,181 @@ func overrideFromEnv(cfg *Config) {
 	if format := os.Getenv("LOG_FORMAT"); format != "" {
 		cfg.Logging.Format = format
 	}
+
+	// Team configuration
+	if size := os.Getenv("TEAM_MAX_SIZE"); size != "" {
+		if s, err := strconv.Atoi(size); err == nil {
+			cfg.Team.MaxSize = s
+		}
+	}
+
+	// Trash configuration
+	if days := os.Getenv("TRASH_RETENTION_DAYS"); days != "" {
+		if d, err := strconv.Atoi(days); err == nil {
+			cfg.Trash.RetentionDays = d
+		}
+	}
+
+	// Judge configuration
+	if ttl := os.Getenv("JUDGE_CHALLENGE_TTL_MINUTES"); ttl != "" {
+		if t, err := strconv.Atoi(ttl); err == nil {
+			cfg.Judge.ChallengeTTLMinutes = t
+		}
+	}
+	if interval := os.Getenv("JUDGE_SYNC_INTERVAL_MINUTES"); interval != "" {
+		if i, err := strconv.Atoi(interval); err == nil {
+			cfg.Judge.SyncIntervalMinutes = i
+		}
+	}
+
+	// Auth configuration
+	if ttl := os.Getenv("ACCESS_TOKEN_TTL_MINUTES"); ttl != "" {
+		if t, err := strconv.Atoi(ttl); err == nil {
+			cfg.Auth.AccessTokenTTLMinutes = t
+		}
+	}
+	if ttl := os.Getenv("REFRESH_TOKEN_TTL_HOURS"); ttl != "" {
+		if t, err := strconv.Atoi(ttl); err == nil {
+			cfg.Auth.RefreshTokenTTLHours = t
+		}
+	}
+	if require := os.Getenv("REQUIRE_MFA_FOR_PRIVILEGED"); require != "" {
+		if r, err := strconv.ParseBool(require); err == nil {
+			cfg.Auth.RequireMFAForPrivileged = r
+		}
+	}
+	if ttl := os.Getenv("PERSONAL_ACCESS_TOKEN_MAX_TTL_DAYS"); ttl != "" {
+		if t, err := strconv.Atoi(ttl); err == nil {
+			cfg.Auth.PersonalAccessTokenMaxTTLDays = t
+		}
+	}
+	if days := os.Getenv("LOGIN_HISTORY_RETENTION_DAYS"); days != "" {
+		if d, err := strconv.Atoi(days); err == nil {
+			cfg.Auth.LoginHistoryRetentionDays = d
+		}
+	}
+	if minutes := os.Getenv("IMPERSONATION_MAX_MINUTES"); minutes != "" {
+		if m, err := strconv.Atoi(minutes); err == nil {
+			cfg.Auth.ImpersonationMaxMinutes = m
+		}
+	}
+	if kid := os.Getenv("JWT_SIGNING_KEY_ID"); kid != "" {
+		cfg.Auth.JWT.SigningKeyID = kid
+	}
+	// JWT_KEYS lists keys as kid=file pairs separated by commas
+	if keys := os.Getenv("JWT_KEYS"); keys != "" {
+		cfg.Auth.JWT.Keys = nil
+		for _, pair := range strings.Split(keys, ",") {
+			kid, file, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			cfg.Auth.JWT.Keys = append(cfg.Auth.JWT.Keys, JWTKeyConfig{ID: kid, File: file})
+		}
+	}
+
+	// Application configuration
+	if mode := os.Getenv("APP_MODE"); mode != "" {
+		cfg.Application.Mode = mode
+	}
+	if secret := os.Getenv("APP_SECRET"); secret != "" {
+		cfg.Application.Secret = secret
+	}
+	if baseURL := os.Getenv("APP_BASE_URL"); baseURL != "" {
+		cfg.Application.BaseURL = baseURL
+	}
+	if frontendURL := os.Getenv("APP_FRONTEND_URL"); frontendURL != "" {
+		cfg.Application.FrontendURL = frontendURL
+	}
+
+	// Registration configuration
+	if enabled := os.Getenv("REGISTRATION_ENABLED"); enabled != "" {
+		if e, err := strconv.ParseBool(enabled); err == nil {
+			cfg.Registration.Enabled = e
+		}
+	}
+	if domains := os.Getenv("REGISTRATION_ALLOWED_DOMAINS"); domains != "" {
+		cfg.Registration.AllowedDomains = strings.Split(domains, ",")
+	}
+
+	// Mail configuration
+	if backend := os.Getenv("MAIL_BACKEND"); backend != "" {
+		cfg.Mail.Backend = backend
+	}
+	if from := os.Getenv("MAIL_FROM"); from != "" {
+		cfg.Mail.From = from
+	}
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		cfg.Mail.Dir = dir
+	}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		cfg.Mail.SMTP.Host = host
+	}
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			cfg.Mail.SMTP.Port = p
+		}
+	}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		cfg.Mail.SMTP.Username = username
+	}
+	if password := os.Getenv("SMTP_PASSWORD"); password != "" {
+		cfg.Mail.SMTP.Password = password
+	}
+
+	// Login throttle configuration
+	if enabled := os.Getenv("LOGIN_THROTTLE_ENABLED"); enabled != "" {
+		if e, err := strconv.ParseBool(enabled); err == nil {
+			cfg.LoginThrottle.Enabled = e
+		}
+	}
+	if store := os.Getenv("LOGIN_THROTTLE_STORE"); store != "" {
+		cfg.LoginThrottle.Store = store
+	}
+	if threshold := os.Getenv("LOGIN_ACCOUNT_LOCKOUT_THRESHOLD"); threshold != "" {
+		if t, err := strconv.Atoi(threshold); err == nil {
+			cfg.LoginThrottle.AccountLockoutThreshold = t
+		}
+	}
+	if attempts := os.Getenv("LOGIN_ACCOUNT_FREE_ATTEMPTS"); attempts != "" {
+		if a, err := strconv.Atoi(attempts); err == nil {
+			cfg.LoginThrottle.AccountFreeAttempts = a
+		}
+	}
+	if attempts := os.Getenv("LOGIN_IP_FREE_ATTEMPTS"); attempts != "" {
+		if a, err := strconv.Atoi(attempts); err == nil {
+			cfg.LoginThrottle.IPFreeAttempts = a
+		}
+	}
+	if threshold := os.Getenv("LOGIN_IP_LOCKOUT_THRESHOLD"); threshold != "" {
+		if t, err := strconv.Atoi(threshold); err == nil {
+			cfg.LoginThrottle.IPLockoutThreshold = t
+		}
+	}
+	if minutes := os.Getenv("LOGIN_LOCKOUT_MINUTES"); minutes != "" {
+		if m, err := strconv.Atoi(minutes); err == nil {
+			cfg.LoginThrottle.LockoutMinutes = m
+		}
+	}
+
+	// OIDC configuration; client secrets are named after the provider,
+	// e.g. OIDC_CLIENT_SECRET_CAMPUS for provider "campus"
+	if redirectURL := os.Getenv("OIDC_REDIRECT_URL"); redirectURL != "" {
+		cfg.OIDC.RedirectURL = redirectURL
+	}
+	for i, p := range cfg.OIDC.Providers {
+		if secret := os.Getenv("OIDC_CLIENT_SECRET_" + strings.ToUpper(p.ID)); secret != "" {
+			cfg.OIDC.Providers[i].ClientSecret = secret
+		}
+	}
+
+	// LDAP configuration; search account passwords are named after the
+	// directory, e.g. LDAP_BIND_PASSWORD_CAMPUS for directory "campus"
+	if authenticators := os.Getenv("AUTHENTICATORS"); authenticators != "" {
+		cfg.Auth.Authenticators = strings.Split(authenticators, ",")
+	}
+	for i, d := range cfg.LDAP.Directories {
+		if password := os.Getenv("LDAP_BIND_PASSWORD_" + strings.ToUpper(d.ID)); password != "" {
+			cfg.LDAP.Directories[i].BindPassword = password
+		}
+	}
 }
 
 // Validate validates the configuration
@@ -174,17 +879,108 @@ func (c *Config) Validate() error {
 	if c.Server.Port <= 0 || c.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port: %d", c.Server.Port)
 	}
-	if c.Database.Host == "" {
-		return fmt.Errorf("database host is required")
+	if err := c.Database.Validate(); err != nil {
+		return err
 	}
-	if c.Database.User == "" {
-		return fmt.Errorf("database user is required")
+	switch c.Application.Mode {
+	case ModeProduction:
+		if c.Application.Secret == DefaultSecret {
+			return fmt.Errorf("the default application secret may only be used in %s mode", ModeDevelopment)
+		}
+	case ModeDevelopment:
+	default:
+		return fmt.Errorf("unsupported application mode: %q", c.Application.Mode)
 	}
-	if c.Database.Password == "" {
-		return fmt.Errorf("database password is required")
+	if c.Application.Secret == "" {
+		return fmt.Errorf("application secret is required: set application.secret or APP_SECRET")
 	}
-	if c.Database.Name == "" {
-		return fmt.Errorf("database name is required")
+	if c.Auth.AccessTokenTTLMinutes < 1 {
+		return fmt.Errorf("invalid access token TTL: %d minutes", c.Auth.AccessTokenTTLMinutes)
+	}
+	if c.Auth.RefreshTokenTTLHours < 1 {
+		return fmt.Errorf("invalid refresh token TTL: %d hours", c.Auth.RefreshTokenTTLHours)
+	}
+	if c.Auth.PasswordResetTTLMinutes < 1 {
+		return fmt.Errorf("invalid password reset TTL: %d minutes", c.Auth.PasswordResetTTLMinutes)
+	}
+	if c.Auth.InvitationTTLHours < 1 {
+		return fmt.Errorf("invalid invitation TTL: %d hours", c.Auth.InvitationTTLHours)
+	}
+	if c.Auth.PersonalAccessTokenMaxTTLDays < 1 {
+		return fmt.Errorf("invalid personal access token max TTL: %d days", c.Auth.PersonalAccessTokenMaxTTLDays)
+	}
+	if c.Auth.LoginHistoryRetentionDays < 1 {
+		return fmt.Errorf("invalid login history retention: %d days", c.Auth.LoginHistoryRetentionDays)
+	}
+	if c.Auth.ImpersonationMaxMinutes < 1 {
+		return fmt.Errorf("invalid impersonation max duration: %d minutes", c.Auth.ImpersonationMaxMinutes)
+	}
+	if err := c.Auth.JWT.Validate(); err != nil {
+		return err
+	}
+	if c.Team.MaxSize < 1 {
+		return fmt.Errorf("invalid team max size: %d", c.Team.MaxSize)
+	}
+	if c.Trash.RetentionDays < 1 {
+		return fmt.Errorf("invalid trash retention: %d days", c.Trash.RetentionDays)
+	}
+	if c.Judge.ChallengeTTLMinutes < 1 {
+		return fmt.Errorf("invalid judge challenge TTL: %d minutes", c.Judge.ChallengeTTLMinutes)
+	}
+	if c.Judge.SyncIntervalMinutes < 0 {
+		return fmt.Errorf("invalid judge sync interval: %d minutes", c.Judge.SyncIntervalMinutes)
+	}
+	for platform, ms := range c.Judge.RequestIntervalsMs {
+		if ms < 0 {
+			return fmt.Errorf("invalid request interval for %s: %d ms", platform, ms)
+		}
+	}
+	if c.Registration.Enabled && c.Registration.VerificationTTLHours < 1 {
+		return fmt.Errorf("invalid verification TTL: %d hours", c.Registration.VerificationTTLHours)
+	}
+	if err := c.LoginThrottle.Validate(); err != nil {
+		return err
+	}
+	if err := c.Mail.Validate(); err != nil {
+		return err
+	}
+	if err := c.OIDC.Validate(); err != nil {
+		return err
+	}
+	if err := c.LDAP.Validate(); err != nil {
+		return err
+	}
+	if err := c.validateAuthenticators(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate validates the database configuration for its driver
+func (d DatabaseConfig) Validate() error {
+	switch d.Driver {
+	case DriverSQLite:
+		if d.Path == "" && d.Name == "" {
+			return fmt.Errorf("database path or name is required for %s", d.Driver)
+		}
+	case DriverPostgres:
+		if d.Host == "" {
+			return fmt.Errorf("database host is required")
+		}
+		if d.Port <= 0 || d.Port > 65535 {
+			return fmt.Errorf("invalid database port: %d", d.Port)
+		}
+		if d.User == "" {
+			return fmt.Errorf("database user is required")
+		}
+		if d.Password == "" {
+			return fmt.Errorf("database password is required")
+		}
+		if d.Name == "" {
+			return fmt.Errorf("database name is required")
+		}
+	default:
+		return fmt.Errorf("unsupported database driver: %q", d.Driver)
 	}
 	return nil
 }
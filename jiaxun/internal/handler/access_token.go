@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessTokenHandler handles HTTP requests related to personal access tokens
+type AccessTokenHandler struct {
+	accessTokenService *service.AccessTokenService
+}
+
+// NewAccessTokenHandler creates a new access token handler and registers routes
+func NewAccessTokenHandler(r *gin.Engine, accessTokenService *service.AccessTokenService) *AccessTokenHandler {
+	handler := &AccessTokenHandler{
+		accessTokenService: accessTokenService,
+	}
+
+	tokens := r.Group("/api/auth/tokens")
+	tokens.Use(middleware.AuthMiddleware())
+	{
+		tokens.GET("", handler.ListTokens)
+		tokens.POST("", handler.CreateToken)
+		tokens.DELETE("/:id", middleware.RequireSession(), handler.RevokeToken)
+	}
+
+	return handler
+}
+
+// respondAccessTokenError writes the HTTP response for an access token error
+func respondAccessTokenError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrAccessTokenNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Access token not found"})
+	case errors.Is(err, service.ErrInvalidAccessTokenTTL):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry exceeds the maximum token lifetime"})
+	case errors.Is(err, service.ErrUnknownPermission):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrScopeNotGranted):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary List personal access tokens
+// @Description Returns the personal access tokens of the current user. Token values are never returned.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} object{tokens=[]model.PersonalAccessToken} "List of tokens"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/tokens [get]
+// @id ListAccessTokens
+func (h *AccessTokenHandler) ListTokens(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	tokens, err := h.accessTokenService.List(userID.(uint))
+	if err != nil {
+		respondAccessTokenError(c, err, "Failed to list access tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// @Summary Create a personal access token
+// @Description Creates a token that authenticates as the current user with the given scopes, which must be permissions of the user's role. The token value is only returned in this response. Tokens cannot be created with another personal access token. A token only acts with its scopes: it cannot act on what users may change by themselves, such as their profile, teams or two-factor settings, and never changes passwords or emails.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body object{name=string,scopes=[]string,expires_in_days=integer} true "Token name, scopes and lifetime"
+// @Success 201 {object} object{token=string,access_token=model.PersonalAccessToken} "Created token"
+// @Failure 400 {object} object{error=string} "Invalid input or unknown scope"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Scope not granted or authenticated with an access token"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/tokens [post]
+// @id CreateAccessToken
+func (h *AccessTokenHandler) CreateToken(c *gin.Context) {
+	if middleware.ViaAccessToken(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access tokens cannot be created with an access token"})
+		return
+	}
+
+	var request struct {
+		Name          string   `json:"name" binding:"required,max=100"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+	role := c.GetString("role")
+
+	ttl := time.Duration(request.ExpiresInDays) * 24 * time.Hour
+	token, value, err := h.accessTokenService.Create(userID.(uint), role, request.Name, request.Scopes, ttl)
+	if err != nil {
+		respondAccessTokenError(c, err, "Failed to create access token")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": value, "access_token": token})
+}
+
+// @Summary Revoke a personal access token
+// @Description Revokes one of the current user's personal access tokens. Tokens cannot be revoked with another personal access token.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param id path integer true "Token ID"
+// @Success 200 {object} object{message=string} "Token revoked successfully"
+// @Failure 400 {object} object{error=string} "Invalid token ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 404 {object} object{error=string} "Token not found or already revoked"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/tokens/{id} [delete]
+// @id RevokeAccessToken
+func (h *AccessTokenHandler) RevokeToken(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	if err := h.accessTokenService.Revoke(userID.(uint), uint(id)); err != nil {
+		respondAccessTokenError(c, err, "Failed to revoke access token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked successfully"})
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"jiaxun/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ownerToken authenticates a single personal access token of user 1
+type ownerToken struct{}
+
+func (ownerToken) AuthenticateAccessToken(token string) (uint, []string, error) {
+	if token != middleware.PersonalAccessTokenPrefix+"secret" {
+		return 0, nil, middleware.ErrInvalidAccessToken
+	}
+	return 1, nil, nil
+}
+
+func TestRevokeTokenRequiresSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	middleware.SetAccessTokenAuthenticator(ownerToken{})
+	t.Cleanup(func() { middleware.SetAccessTokenAuthenticator(nil) })
+
+	r := gin.New()
+	// The service is never reached: a stolen token cannot revoke the others
+	NewAccessTokenHandler(r, nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/auth/tokens/2", nil)
+	req.Header.Set("Authorization", "Bearer "+middleware.PersonalAccessTokenPrefix+"secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("DELETE /api/auth/tokens/2 with an access token = %d %s, want 403", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthHandler handles HTTP requests related to token sessions
+type AuthHandler struct {
+	authService          *service.AuthService
+	registrationService  *service.RegistrationService
+	passwordResetService *service.PasswordResetService
+}
+
+// NewAuthHandler creates a new auth handler and registers routes
+func NewAuthHandler(r *gin.Engine, authService *service.AuthService, registrationService *service.RegistrationService, passwordResetService *service.PasswordResetService) *AuthHandler {
+	handler := &AuthHandler{
+		authService:          authService,
+		registrationService:  registrationService,
+		passwordResetService: passwordResetService,
+	}
+
+	auth := r.Group("/api/auth")
+	{
+		// Public routes
+		auth.POST("/refresh", handler.Refresh)
+		auth.POST("/register", handler.Register)
+		auth.GET("/verify-email", handler.VerifyEmail)
+		auth.GET("/confirm-email", handler.ConfirmEmail)
+		auth.POST("/resend-verification", handler.ResendVerification)
+		auth.POST("/forgot-password", handler.ForgotPassword)
+		auth.POST("/reset-password", handler.ResetPassword)
+
+		// Routes that require a valid access token
+		auth.POST("/logout", middleware.AuthMiddleware(), handler.Logout)
+	}
+
+	return handler
+}
+
+// @Summary Refresh tokens
+// @Description Exchanges a refresh token for a new access token and refresh token. Each refresh token can be used once; reusing one revokes the whole session.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body object{refresh_token=string} true "Refresh token"
+// @Success 200 {object} object{token=string,refresh_token=string,expires_at=string,session_id=string} "New tokens"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Invalid, expired or reused refresh token"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/refresh [post]
+// @id RefreshToken
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.authService.Refresh(request.RefreshToken, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used; session revoked"})
+		case errors.Is(err, service.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// @Summary Log out
+// @Description Revokes the current session: the access token used for this request and every refresh token issued with it
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} object{message=string} "Logged out"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/logout [post]
+// @id Logout
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims, _ := c.Get("claims") // This will always exist due to auth middleware
+
+	if err := h.authService.Logout(claims.(*middleware.JWTClaims)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// @Summary Sign up
+// @Description Creates a pending account and emails a verification link. Login is refused until the email is verified. Only available when self-service registration is enabled.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body object{username=string,email=string,password=string,full_name=string} true "Account information"
+// @Success 201 {object} object{user=model.User,message=string} "Account created, verification pending"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 403 {object} object{error=string} "Registration disabled or email domain not allowed"
+// @Failure 409 {object} object{error=string} "User already exists"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/register [post]
+// @id SignUp
+func (h *AuthHandler) Register(c *gin.Context) {
+	var request struct {
+		Username string `json:"username" binding:"required"`
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required,min=6"`
+		FullName string `json:"full_name"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := &model.User{
+		Username: request.Username,
+		Email:    request.Email,
+		Password: request.Password,
+		FullName: request.FullName,
+	}
+
+	if err := h.registrationService.Register(user); err != nil {
+		switch {
+		case errors.Is(err, service.ErrRegistrationDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled"})
+		case errors.Is(err, service.ErrEmailDomainNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email domain is not allowed"})
+		case errors.Is(err, service.ErrUserAlreadyExists), errors.Is(err, service.ErrEmailAlreadyExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		}
+		return
+	}
+
+	// Don't return the password
+	user.Password = ""
+
+	c.JSON(http.StatusCreated, gin.H{
+		"user":    user,
+		"message": "Check your email to verify your account",
+	})
+}
+
+// @Summary Verify email address
+// @Description Activates a pending account using the token from the emailed verification link
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} object{message=string} "Email verified"
+// @Failure 400 {object} object{error=string} "Invalid or expired link"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/verify-email [get]
+// @id VerifyEmail
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification token is required"})
+		return
+	}
+
+	if _, err := h.registrationService.VerifyEmail(token); err != nil {
+		if errors.Is(err, service.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully, you can now log in"})
+}
+
+// @Summary Confirm email change
+// @Description Moves an account to the new email address it asked for, using the token from the link emailed to that address. The link no longer works once the address has changed.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token query string true "Email change token"
+// @Success 200 {object} object{message=string} "Email changed"
+// @Failure 400 {object} object{error=string} "Invalid or expired link"
+// @Failure 403 {object} object{error=string} "Email domain not allowed"
+// @Failure 409 {object} object{error=string} "Email already in use"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/confirm-email [get]
+// @id ConfirmEmail
+func (h *AuthHandler) ConfirmEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirmation token is required"})
+		return
+	}
+
+	if _, err := h.registrationService.ConfirmEmailChange(token); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidVerificationToken):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation link"})
+		case errors.Is(err, service.ErrEmailDomainNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email domain is not allowed"})
+		case errors.Is(err, service.ErrEmailAlreadyExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use by another user"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email address changed successfully"})
+}
+
+// @Summary Resend verification email
+// @Description Sends a new verification link if the address belongs to a pending account. The response is the same whether or not it does.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body object{email=string} true "Email address"
+// @Success 200 {object} object{message=string} "Request accepted"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 403 {object} object{error=string} "Registration disabled"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/resend-verification [post]
+// @id ResendVerification
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.registrationService.ResendVerification(request.Email); err != nil {
+		if errors.Is(err, service.ErrRegistrationDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the address belongs to an unverified account, a new link has been sent"})
+}
+
+// @Summary Request a password reset
+// @Description Emails a single-use password reset link if the address belongs to an account. The response is the same whether or not it does.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body object{email=string} true "Email address"
+// @Success 200 {object} object{message=string} "Request accepted"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/forgot-password [post]
+// @id ForgotPassword
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.passwordResetService.ForgotPassword(request.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the address belongs to an account, a reset link has been sent"})
+}
+
+// @Summary Reset password
+// @Description Sets a new password using a token from a password reset email. The token can be used once, and all existing sessions of the account are ended.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body object{token=string,password=string} true "Reset token and new password"
+// @Success 200 {object} object{message=string} "Password reset"
+// @Failure 400 {object} object{error=string} "Invalid input or invalid/expired token"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/reset-password [post]
+// @id ResetPassword
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var request struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.passwordResetService.ResetPassword(request.Token, request.Password); err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in again"})
+}
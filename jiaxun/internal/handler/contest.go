@@ -0,0 +1,432 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/policy"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContestHandler handles HTTP requests related to contests
+type ContestHandler struct {
+	contestService *service.ContestService
+}
+
+// NewContestHandler creates a new contest handler and registers routes
+func NewContestHandler(r *gin.Engine, contestService *service.ContestService) *ContestHandler {
+	handler := &ContestHandler{
+		contestService: contestService,
+	}
+
+	contests := r.Group("/api/contests")
+	contests.Use(middleware.AuthMiddleware())
+	{
+		// Routes for all authenticated users
+		contests.GET("", handler.ListContests)
+		contests.GET("/:id", handler.GetContest)
+		contests.GET("/:id/registrations", handler.ListRegistrations)
+		contests.POST("/:id/register", middleware.RequireSession(), handler.RegisterSelf)
+		contests.POST("/:id/register-team", handler.RegisterTeam)
+
+		// Organizer or contest manager routes, checked by the contest service
+		contests.PUT("/:id", handler.UpdateContest)
+		contests.DELETE("/:id", handler.DeleteContest)
+
+		// Routes for contest managers
+		adminGroup := contests.Group("")
+		adminGroup.Use(middleware.RequirePermission(model.PermContestsManage))
+		{
+			adminGroup.POST("", handler.CreateContest)
+		}
+	}
+
+	return handler
+}
+
+// @Summary Create a contest
+// @Description Creates a new contest organized by the current user (requires contests:manage)
+// @Tags contests
+// @Accept json
+// @Produce json
+// @Param body body object{name=string,start_time=string,end_time=string,is_team_based=boolean,organizer=string} true "Contest information"
+// @Success 201 {object} object{contest=model.Contest} "Created contest"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 409 {object} object{error=string} "Contest already exists"
+// @Failure 500 {object} object{error=string} "Server error"
+// @id CreateContest
+// @Router /contests [post]
+func (h *ContestHandler) CreateContest(c *gin.Context) {
+	var request struct {
+		Name        string    `json:"name" binding:"required,max=100"`
+		StartTime   time.Time `json:"start_time" binding:"required"`
+		EndTime     time.Time `json:"end_time" binding:"required"`
+		IsTeamBased bool      `json:"is_team_based"`
+		Organizer   string    `json:"organizer" binding:"max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+	organizerID := userID.(uint)
+
+	contest := &model.Contest{
+		Name:        request.Name,
+		StartTime:   request.StartTime,
+		EndTime:     request.EndTime,
+		IsTeamBased: request.IsTeamBased,
+		Organizer:   request.Organizer,
+		CreatedBy:   &organizerID,
+	}
+
+	if err := h.contestService.CreateContest(contest); err != nil {
+		if errors.Is(err, service.ErrInvalidContestTime) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "End time must be after start time"})
+			return
+		}
+		if errors.Is(err, service.ErrContestAlreadyExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Contest already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create contest"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"contest": contest})
+}
+
+// @Summary List contests
+// @Description Returns a paginated list of contests
+// @Tags contests
+// @Accept json
+// @Produce json
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Success 200 {object} object{contests=[]model.Contest,pagination=object{total=integer,page=integer,pageSize=integer}} "List of contests"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /contests [get]
+// @id ListContests
+func (h *ContestHandler) ListContests(c *gin.Context) {
+	// Parse pagination parameters
+	pageStr := c.DefaultQuery("page", "1")
+	pageSizeStr := c.DefaultQuery("page_size", "10")
+
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(pageSizeStr)
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	contests, total, err := h.contestService.ListContests(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list contests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"contests": contests,
+		"pagination": gin.H{
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// @Summary Get contest by ID
+// @Description Retrieves a contest by its ID
+// @Tags contests
+// @Accept json
+// @Produce json
+// @Param id path integer true "Contest ID"
+// @Success 200 {object} object{contest=model.Contest} "Contest found"
+// @Failure 400 {object} object{error=string} "Invalid contest ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 404 {object} object{error=string} "Contest not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /contests/{id} [get]
+// @id GetContest
+func (h *ContestHandler) GetContest(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contest ID"})
+		return
+	}
+
+	contest, err := h.contestService.GetContestByID(uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrContestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Contest not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve contest"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"contest": contest})
+}
+
+// @Summary Update contest
+// @Description Updates the given fields of a contest (organizer or contests:manage)
+// @Tags contests
+// @Accept json
+// @Produce json
+// @Param id path integer true "Contest ID"
+// @Param body body object{name=string,start_time=string,end_time=string,is_team_based=boolean,organizer=string} false "Fields to update"
+// @Success 200 {object} object{contest=model.Contest} "Updated contest"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Contest not found"
+// @Failure 409 {object} object{error=string} "Contest kind changed after registrations"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /contests/{id} [put]
+// @id UpdateContest
+func (h *ContestHandler) UpdateContest(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contest ID"})
+		return
+	}
+
+	// Pointer fields distinguish "not provided" from zero values
+	var request struct {
+		Name        *string    `json:"name" binding:"omitempty,min=1,max=100"`
+		StartTime   *time.Time `json:"start_time"`
+		EndTime     *time.Time `json:"end_time"`
+		IsTeamBased *bool      `json:"is_team_based"`
+		Organizer   *string    `json:"organizer" binding:"omitempty,max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	contest, err := h.contestService.UpdateContest(middleware.Subject(c), uint(id), service.ContestUpdate{
+		Name:        request.Name,
+		StartTime:   request.StartTime,
+		EndTime:     request.EndTime,
+		IsTeamBased: request.IsTeamBased,
+		Organizer:   request.Organizer,
+	})
+	if err != nil {
+		if errors.Is(err, policy.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": policy.Message(err)})
+			return
+		}
+		if errors.Is(err, service.ErrContestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Contest not found"})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidContestTime) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "End time must be after start time"})
+			return
+		}
+		if errors.Is(err, service.ErrContestHasRegistrations) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Whether the contest is team-based cannot change once it has registrations"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update contest"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"contest": contest})
+}
+
+// @Summary Delete contest
+// @Description Moves a contest to the trash, from which it can be restored with its registrations until it is purged (organizer or contests:manage)
+// @Tags contests
+// @Accept json
+// @Produce json
+// @Param id path integer true "Contest ID"
+// @Success 200 {object} object{message=string} "Contest deleted successfully"
+// @Failure 400 {object} object{error=string} "Invalid contest ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Contest not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /contests/{id} [delete]
+// @id DeleteContest
+func (h *ContestHandler) DeleteContest(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contest ID"})
+		return
+	}
+
+	if err := h.contestService.DeleteContest(middleware.Subject(c), uint(id)); err != nil {
+		if errors.Is(err, policy.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": policy.Message(err)})
+			return
+		}
+		if errors.Is(err, service.ErrContestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Contest not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete contest"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contest deleted successfully"})
+}
+
+// @Summary List contest registrations
+// @Description Returns all registrations of a contest
+// @Tags contests
+// @Accept json
+// @Produce json
+// @Param id path integer true "Contest ID"
+// @Success 200 {object} object{registrations=[]model.ContestRegistration} "List of registrations"
+// @Failure 400 {object} object{error=string} "Invalid contest ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 404 {object} object{error=string} "Contest not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /contests/{id}/registrations [get]
+// @id ListContestRegistrations
+func (h *ContestHandler) ListRegistrations(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contest ID"})
+		return
+	}
+
+	registrations, err := h.contestService.GetRegistrations(uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrContestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Contest not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list registrations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"registrations": registrations})
+}
+
+// @Summary Register for a contest
+// @Description Registers the currently authenticated user to a contest
+// @Tags contests
+// @Accept json
+// @Produce json
+// @Param id path integer true "Contest ID"
+// @Success 201 {object} object{registration=model.ContestRegistration} "Registration created"
+// @Failure 400 {object} object{error=string} "Invalid contest ID or team-based contest"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 404 {object} object{error=string} "Contest or user not found"
+// @Failure 409 {object} object{error=string} "Already registered"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /contests/{id}/register [post]
+// @id RegisterForContest
+func (h *ContestHandler) RegisterSelf(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contest ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	registration, err := h.contestService.RegisterUserToContest(uint(id), userID.(uint))
+	if err != nil {
+		if errors.Is(err, service.ErrContestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Contest not found"})
+			return
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if errors.Is(err, service.ErrContestIsTeamBased) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This contest only accepts team registrations"})
+			return
+		}
+		if errors.Is(err, service.ErrAlreadyRegistered) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Already registered to this contest"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register for contest"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"registration": registration})
+}
+
+// @Summary Register a team for a contest
+// @Description Registers a team to a team-based contest (team captain or teams:approve)
+// @Tags contests
+// @Accept json
+// @Produce json
+// @Param id path integer true "Contest ID"
+// @Param body body object{team_id=integer} true "Team to register"
+// @Success 201 {object} object{registration=model.ContestRegistration} "Registration created"
+// @Failure 400 {object} object{error=string} "Invalid input or contest is not team-based"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not the team captain"
+// @Failure 404 {object} object{error=string} "Contest or team not found"
+// @Failure 409 {object} object{error=string} "Team or a member already registered"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /contests/{id}/register-team [post]
+// @id RegisterTeamForContest
+func (h *ContestHandler) RegisterTeam(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contest ID"})
+		return
+	}
+
+	var request struct {
+		TeamID uint `json:"team_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	registration, err := h.contestService.RegisterTeamToContest(middleware.Subject(c), uint(id), request.TeamID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrContestNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Contest not found"})
+		case errors.Is(err, service.ErrTeamNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		case errors.Is(err, service.ErrContestNotTeamBased):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This contest only accepts individual registrations"})
+		case errors.Is(err, policy.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": policy.Message(err)})
+		case errors.Is(err, service.ErrAlreadyRegistered):
+			c.JSON(http.StatusConflict, gin.H{"error": "Team already registered to this contest"})
+		case errors.Is(err, service.ErrMemberAlreadyRegistered):
+			c.JSON(http.StatusConflict, gin.H{"error": "A team member is already registered to this contest"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register team for contest"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"registration": registration})
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+
+	"jiaxun/internal/migration"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// openTestDB opens a migrated SQLite database in a temporary file
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=on"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger:         logger.Discard,
+		NamingStrategy: schema.NamingStrategy{SingularTable: true},
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	migrator, err := migration.New(db)
+	if err != nil {
+		t.Fatalf("creating migrator: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return db
+}
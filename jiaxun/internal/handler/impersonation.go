@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImpersonationHandler handles HTTP requests related to impersonation
+type ImpersonationHandler struct {
+	impersonationService *service.ImpersonationService
+}
+
+// NewImpersonationHandler creates a new impersonation handler and registers routes
+func NewImpersonationHandler(r *gin.Engine, impersonationService *service.ImpersonationService) *ImpersonationHandler {
+	handler := &ImpersonationHandler{
+		impersonationService: impersonationService,
+	}
+
+	r.POST("/api/users/:id/impersonate", middleware.AuthMiddleware(), middleware.RequirePermission(model.PermUsersImpersonate), handler.StartImpersonation)
+	r.POST("/api/auth/impersonation/end", middleware.AuthMiddleware(), handler.EndCurrentImpersonation)
+	r.GET("/api/users/me/impersonations", middleware.AuthMiddleware(), handler.ListMyImpersonations)
+
+	// The audit trail, for administrators
+	impersonations := r.Group("/api/impersonations")
+	impersonations.Use(middleware.AuthMiddleware(), middleware.RequirePermission(model.PermUsersImpersonate))
+	{
+		impersonations.GET("", handler.ListImpersonations)
+		impersonations.GET("/:id", handler.GetImpersonation)
+		impersonations.GET("/:id/requests", handler.ListImpersonationRequests)
+		impersonations.POST("/:id/end", handler.EndImpersonation)
+	}
+
+	return handler
+}
+
+// respondImpersonationError writes the HTTP response for an impersonation error
+func respondImpersonationError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrImpersonationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation not found"})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, service.ErrCannotImpersonate):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot impersonate yourself or another administrator"})
+	case errors.Is(err, service.ErrInvalidImpersonationDuration):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Duration exceeds the maximum impersonation length"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary Impersonate a user
+// @Description Issues a short-lived token to act as a user and see what they see (requires users:impersonate). The token is read-only: requests other than GET are refused, except ending the impersonation. It has no refresh token, and every request made with it is recorded. The user is notified by email. Administrators cannot be impersonated, and impersonation cannot be started with a personal access token or another impersonation token.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param body body object{reason=string,duration_minutes=integer} true "Reason shown to the user, and duration (default: 30 minutes)"
+// @Success 201 {object} service.ImpersonationToken "Impersonation token"
+// @Failure 400 {object} object{error=string} "Invalid input or duration"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden or user cannot be impersonated"
+// @Failure 404 {object} object{error=string} "User not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/impersonate [post]
+// @id StartImpersonation
+func (h *ImpersonationHandler) StartImpersonation(c *gin.Context) {
+	if middleware.ViaAccessToken(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Impersonation cannot be started with an access token"})
+		return
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request struct {
+		Reason          string `json:"reason" binding:"required,max=512"`
+		DurationMinutes int    `json:"duration_minutes" binding:"min=0"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+	mfa := false
+	if claims, ok := c.Get("claims"); ok {
+		mfa = claims.(*middleware.JWTClaims).MFA
+	}
+
+	duration := time.Duration(request.DurationMinutes) * time.Minute
+	token, err := h.impersonationService.Start(userID.(uint), mfa, uint(id), request.Reason, duration, clientInfo(c))
+	if err != nil {
+		respondImpersonationError(c, err, "Failed to start impersonation")
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// @Summary End the current impersonation
+// @Description Ends the impersonation whose token authenticates the request, after which the token is rejected
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} object{message=string} "Impersonation ended"
+// @Failure 400 {object} object{error=string} "Not impersonating"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/impersonation/end [post]
+// @id EndCurrentImpersonation
+func (h *ImpersonationHandler) EndCurrentImpersonation(c *gin.Context) {
+	var impersonationID string
+	if claims, ok := c.Get("claims"); ok {
+		impersonationID = claims.(*middleware.JWTClaims).ImpersonationID
+	}
+	if impersonationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not impersonating"})
+		return
+	}
+
+	if err := h.impersonationService.End(impersonationID); err != nil {
+		respondImpersonationError(c, err, "Failed to end impersonation")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended successfully"})
+}
+
+// @Summary List impersonations of me
+// @Description Returns the times administrators acted as the current user, newest first
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Success 200 {object} object{impersonations=[]model.Impersonation,pagination=object{total=integer,page=integer,pageSize=integer}} "List of impersonations"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/me/impersonations [get]
+// @id ListMyImpersonations
+func (h *ImpersonationHandler) ListMyImpersonations(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	h.listImpersonations(c, 0, userID.(uint))
+}
+
+// @Summary List impersonations
+// @Description Returns impersonations, newest first, optionally only those by an administrator or of a user (requires users:impersonate)
+// @Tags impersonations
+// @Accept json
+// @Produce json
+// @Param actor_id query integer false "Only impersonations by this administrator"
+// @Param subject_id query integer false "Only impersonations of this user"
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Success 200 {object} object{impersonations=[]model.Impersonation,pagination=object{total=integer,page=integer,pageSize=integer}} "List of impersonations"
+// @Failure 400 {object} object{error=string} "Invalid user ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /impersonations [get]
+// @id ListImpersonations
+func (h *ImpersonationHandler) ListImpersonations(c *gin.Context) {
+	var ids [2]uint
+	for i, name := range []string{"actor_id", "subject_id"} {
+		if value := c.Query(name); value != "" {
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+				return
+			}
+			ids[i] = uint(id)
+		}
+	}
+
+	h.listImpersonations(c, ids[0], ids[1])
+}
+
+// @Summary Get an impersonation
+// @Description Returns an impersonation (requires users:impersonate)
+// @Tags impersonations
+// @Accept json
+// @Produce json
+// @Param id path string true "Impersonation ID"
+// @Success 200 {object} model.Impersonation "Impersonation"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Impersonation not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /impersonations/{id} [get]
+// @id GetImpersonation
+func (h *ImpersonationHandler) GetImpersonation(c *gin.Context) {
+	impersonation, err := h.impersonationService.Get(c.Param("id"))
+	if err != nil {
+		respondImpersonationError(c, err, "Failed to retrieve impersonation")
+		return
+	}
+
+	c.JSON(http.StatusOK, impersonation)
+}
+
+// @Summary List the requests of an impersonation
+// @Description Returns the requests made with an impersonation token in the order they were made, including those refused because they would change data (requires users:impersonate)
+// @Tags impersonations
+// @Accept json
+// @Produce json
+// @Param id path string true "Impersonation ID"
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Success 200 {object} object{requests=[]model.ImpersonationRequest,pagination=object{total=integer,page=integer,pageSize=integer}} "List of requests"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Impersonation not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /impersonations/{id}/requests [get]
+// @id ListImpersonationRequests
+func (h *ImpersonationHandler) ListImpersonationRequests(c *gin.Context) {
+	page, pageSize := pagination(c)
+
+	requests, total, err := h.impersonationService.ListRequests(c.Param("id"), page, pageSize)
+	if err != nil {
+		respondImpersonationError(c, err, "Failed to list requests")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requests": requests,
+		"pagination": gin.H{
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// @Summary End an impersonation
+// @Description Ends an impersonation, after which its token is rejected (requires users:impersonate)
+// @Tags impersonations
+// @Accept json
+// @Produce json
+// @Param id path string true "Impersonation ID"
+// @Success 200 {object} object{message=string} "Impersonation ended"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Impersonation not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /impersonations/{id}/end [post]
+// @id EndImpersonation
+func (h *ImpersonationHandler) EndImpersonation(c *gin.Context) {
+	if err := h.impersonationService.End(c.Param("id")); err != nil {
+		respondImpersonationError(c, err, "Failed to end impersonation")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended successfully"})
+}
+
+// listImpersonations writes a page of impersonations
+func (h *ImpersonationHandler) listImpersonations(c *gin.Context, actorID, subjectID uint) {
+	page, pageSize := pagination(c)
+
+	impersonations, total, err := h.impersonationService.List(actorID, subjectID, page, pageSize)
+	if err != nil {
+		respondImpersonationError(c, err, "Failed to list impersonations")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"impersonations": impersonations,
+		"pagination": gin.H{
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// pagination parses the page and page_size query parameters
+func pagination(c *gin.Context) (int, int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+	return page, pageSize
+}
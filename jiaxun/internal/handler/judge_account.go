@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JudgeAccountHandler handles HTTP requests related to the online judge
+// accounts of users
+type JudgeAccountHandler struct {
+	judgeAccountService *service.JudgeAccountService
+	userService         *service.UserService
+}
+
+// NewJudgeAccountHandler creates a new judge account handler and registers routes
+func NewJudgeAccountHandler(r *gin.Engine, judgeAccountService *service.JudgeAccountService, userService *service.UserService) *JudgeAccountHandler {
+	handler := &JudgeAccountHandler{
+		judgeAccountService: judgeAccountService,
+		userService:         userService,
+	}
+
+	accounts := r.Group("/api/users/:id/judge-accounts")
+	accounts.Use(middleware.AuthMiddleware())
+	{
+		// Handles are public to every authenticated user
+		accounts.GET("", handler.ListJudgeAccounts)
+
+		// Only the user and user administrators manage them
+		accounts.POST("", middleware.CanModifyUser(), handler.AddJudgeAccount)
+		accounts.DELETE("/:accountId", middleware.CanModifyUser(), handler.RemoveJudgeAccount)
+		accounts.POST("/:accountId/challenge", middleware.CanModifyUser(), handler.IssueJudgeChallenge)
+		accounts.POST("/:accountId/verify", middleware.CanModifyUser(), handler.VerifyJudgeAccount)
+	}
+
+	return handler
+}
+
+// respondJudgeAccountError writes the HTTP response for a judge account error
+func respondJudgeAccountError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrJudgeAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Judge account not found"})
+	case errors.Is(err, service.ErrUnknownJudgePlatform),
+		errors.Is(err, service.ErrInvalidHandle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrJudgeAccountExists),
+		errors.Is(err, service.ErrHandleTaken),
+		errors.Is(err, service.ErrNoChallenge),
+		errors.Is(err, service.ErrChallengeExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrHandleNotFound),
+		errors.Is(err, service.ErrChallengeNotFound):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrJudgeUnavailable):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The judge could not be reached, try again later"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary List a user's judge accounts
+// @Description Returns the handles a user has linked on online judges and whether they are verified
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Success 200 {object} object{judge_accounts=[]model.JudgeAccount} "List of judge accounts"
+// @Failure 400 {object} object{error=string} "Invalid user ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 404 {object} object{error=string} "User not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/judge-accounts [get]
+// @id ListJudgeAccounts
+func (h *JudgeAccountHandler) ListJudgeAccounts(c *gin.Context) {
+	userID, ok := targetUser(c, h.userService)
+	if !ok {
+		return
+	}
+
+	accounts, err := h.judgeAccountService.List(userID)
+	if err != nil {
+		respondJudgeAccountError(c, err, "Failed to list judge accounts")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"judge_accounts": accounts})
+}
+
+// @Summary Link a judge account
+// @Description Links a handle on an online judge (codeforces, atcoder, leetcode or luogu) to a user. The handle stays unverified until the user proves they own it. Only the user or an administrator with users:write can link accounts.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param body body object{platform=string,handle=string} true "Platform and handle"
+// @Success 201 {object} object{judge_account=model.JudgeAccount} "Linked judge account"
+// @Failure 400 {object} object{error=string} "Invalid input or unknown platform"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User not found"
+// @Failure 409 {object} object{error=string} "Platform already linked or handle verified by another user"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/judge-accounts [post]
+// @id AddJudgeAccount
+func (h *JudgeAccountHandler) AddJudgeAccount(c *gin.Context) {
+	userID, ok := targetUser(c, h.userService)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Platform string `json:"platform" binding:"required"`
+		Handle   string `json:"handle" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.judgeAccountService.Add(userID, request.Platform, request.Handle)
+	if err != nil {
+		respondJudgeAccountError(c, err, "Failed to link judge account")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"judge_account": account})
+}
+
+// @Summary Unlink a judge account
+// @Description Removes a judge account from a user. Only the user or an administrator with users:write can unlink accounts.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param accountId path integer true "Judge account ID"
+// @Success 200 {object} object{message=string} "Judge account unlinked"
+// @Failure 400 {object} object{error=string} "Invalid ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User or judge account not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/judge-accounts/{accountId} [delete]
+// @id RemoveJudgeAccount
+func (h *JudgeAccountHandler) RemoveJudgeAccount(c *gin.Context) {
+	userID, accountID, ok := targetAccount(c, h.userService)
+	if !ok {
+		return
+	}
+
+	if err := h.judgeAccountService.Remove(userID, accountID); err != nil {
+		respondJudgeAccountError(c, err, "Failed to unlink judge account")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Judge account unlinked successfully"})
+}
+
+// @Summary Start verifying a judge account
+// @Description Issues a challenge for the user to put on the public profile of the handle, with instructions for the platform. The challenge replaces any earlier one and expires after a while. Only the user or an administrator with users:write can verify accounts.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param accountId path integer true "Judge account ID"
+// @Success 200 {object} service.JudgeChallenge "Verification challenge"
+// @Failure 400 {object} object{error=string} "Invalid ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User or judge account not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/judge-accounts/{accountId}/challenge [post]
+// @id IssueJudgeChallenge
+func (h *JudgeAccountHandler) IssueJudgeChallenge(c *gin.Context) {
+	userID, accountID, ok := targetAccount(c, h.userService)
+	if !ok {
+		return
+	}
+
+	challenge, err := h.judgeAccountService.IssueChallenge(userID, accountID)
+	if err != nil {
+		respondJudgeAccountError(c, err, "Failed to issue challenge")
+		return
+	}
+
+	c.JSON(http.StatusOK, challenge)
+}
+
+// @Summary Verify a judge account
+// @Description Reads the public profile of the handle on its platform and marks the account as verified if it shows the pending challenge. A handle can be verified by a single user. Only the user or an administrator with users:write can verify accounts.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param accountId path integer true "Judge account ID"
+// @Success 200 {object} object{judge_account=model.JudgeAccount} "Verified judge account"
+// @Failure 400 {object} object{error=string} "Invalid ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User or judge account not found"
+// @Failure 409 {object} object{error=string} "No pending challenge or handle verified by another user"
+// @Failure 422 {object} object{error=string} "Handle does not exist or challenge not on the profile"
+// @Failure 502 {object} object{error=string} "Judge unreachable"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/judge-accounts/{accountId}/verify [post]
+// @id VerifyJudgeAccount
+func (h *JudgeAccountHandler) VerifyJudgeAccount(c *gin.Context) {
+	userID, accountID, ok := targetAccount(c, h.userService)
+	if !ok {
+		return
+	}
+
+	account, err := h.judgeAccountService.Verify(c.Request.Context(), userID, accountID)
+	if err != nil {
+		respondJudgeAccountError(c, err, "Failed to verify judge account")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"judge_account": account})
+}
+
+// targetAccount parses the user and judge account IDs of the URL, writing
+// the error response if they are invalid
+func targetAccount(c *gin.Context, userService *service.UserService) (uint, uint, bool) {
+	userID, ok := targetUser(c, userService)
+	if !ok {
+		return 0, 0, false
+	}
+
+	accountID, err := strconv.ParseUint(c.Param("accountId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid judge account ID"})
+		return 0, 0, false
+	}
+	return userID, uint(accountID), true
+}
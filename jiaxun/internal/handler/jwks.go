@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+
+	"jiaxun/internal/keyring"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSHandler publishes the public keys access tokens are signed with
+type JWKSHandler struct {
+	keys *keyring.Keyring
+}
+
+// NewJWKSHandler creates a new JWKS handler and registers routes
+func NewJWKSHandler(r *gin.Engine, keys *keyring.Keyring) *JWKSHandler {
+	handler := &JWKSHandler{
+		keys: keys,
+	}
+
+	// Served at the well-known location rather than under /api so that
+	// standard JWT libraries find it
+	r.GET("/.well-known/jwks.json", handler.GetJWKS)
+
+	return handler
+}
+
+// @Summary Get token verification keys
+// @Description Returns the public keys access tokens are signed with as a JSON Web Key Set, so that other services can verify them. Tokens name their key in the kid header. The set is empty while tokens are signed with a shared secret. Served at /.well-known/jwks.json, outside the API base path.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} keyring.JWKSet "Key set"
+// @Router /.well-known/jwks.json [get]
+// @id GetJWKS
+func (h *JWKSHandler) GetJWKS(c *gin.Context) {
+	// Let verifiers cache the keys, but pick up rotations within the hour
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
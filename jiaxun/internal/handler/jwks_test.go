@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"jiaxun/internal/keyring"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// getJWKS fetches the key set the handler publishes for a keyring
+func getJWKS(t *testing.T, keys *keyring.Keyring) (*httptest.ResponseRecorder, keyring.JWKSet) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	NewJWKSHandler(r, keys)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /.well-known/jwks.json = %d %s", w.Code, w.Body)
+	}
+	var set keyring.JWKSet
+	if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatalf("decoding key set: %v", err)
+	}
+	return w, set
+}
+
+func TestGetJWKS(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("encoding key: %v", err)
+	}
+	key, err := keyring.ParsePEM("2026-01", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParsePEM: %v", err)
+	}
+	keys, err := keyring.New("2026-01", key)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	w, set := getJWKS(t, keys)
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	if len(set.Keys) != 1 {
+		t.Fatalf("key set has %d keys, want 1", len(set.Keys))
+	}
+
+	// Another service verifies tokens with the published key alone
+	jwk := set.Keys[0]
+	if jwk.KeyID != "2026-01" || jwk.KeyType != "RSA" || jwk.Algorithm != "RS256" {
+		t.Fatalf("published key = %+v", jwk)
+	}
+	n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+	e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+	if errN != nil || errE != nil {
+		t.Fatalf("decoding the published key: %v, %v", errN, errE)
+	}
+	published := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	token, err := keys.Sign(jwt.RegisteredClaims{Subject: "42", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	_, err = jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["kid"] != jwk.KeyID {
+			t.Errorf("token kid = %v, want %s", token.Header["kid"], jwk.KeyID)
+		}
+		return published, nil
+	}, jwt.WithValidMethods([]string{jwk.Algorithm}))
+	if err != nil {
+		t.Errorf("verifying with the published key: %v", err)
+	}
+}
+
+func TestGetJWKSHidesSharedSecret(t *testing.T) {
+	w, set := getJWKS(t, keyring.NewHMAC([]byte("secret")))
+	if len(set.Keys) != 0 {
+		t.Errorf("key set has %d keys, want none", len(set.Keys))
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil || string(raw["keys"]) != "[]" {
+		t.Errorf("body = %s, want an empty key list", w.Body)
+	}
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LockoutHandler handles HTTP requests related to login lockouts
+type LockoutHandler struct {
+	loginThrottle *service.LoginThrottleService
+}
+
+// NewLockoutHandler creates a new lockout handler and registers routes
+func NewLockoutHandler(r *gin.Engine, loginThrottle *service.LoginThrottleService) *LockoutHandler {
+	handler := &LockoutHandler{
+		loginThrottle: loginThrottle,
+	}
+
+	lockouts := r.Group("/api/lockouts")
+	lockouts.Use(middleware.AuthMiddleware())
+	{
+		lockouts.GET("", middleware.RequirePermission(model.PermUsersRead), handler.ListLockouts)
+		lockouts.POST("/:id/unlock", middleware.RequirePermission(model.PermUsersWrite), handler.UnlockEvent)
+	}
+
+	users := r.Group("/api/users")
+	users.Use(middleware.AuthMiddleware(), middleware.RequirePermission(model.PermUsersWrite))
+	{
+		users.POST("/:id/unlock", handler.UnlockUser)
+	}
+
+	return handler
+}
+
+// @Summary List login lockouts
+// @Description Returns a paginated list of accounts and addresses locked after too many failed logins (requires users:read)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Param active query boolean false "Only list lockouts still in effect"
+// @Success 200 {object} object{lockouts=[]model.LockoutEvent,pagination=object{total=integer,page=integer,pageSize=integer}} "List of lockouts"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /lockouts [get]
+// @id ListLockouts
+func (h *LockoutHandler) ListLockouts(c *gin.Context) {
+	// Parse pagination parameters
+	pageStr := c.DefaultQuery("page", "1")
+	pageSizeStr := c.DefaultQuery("page_size", "10")
+
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(pageSizeStr)
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	activeOnly, _ := strconv.ParseBool(c.DefaultQuery("active", "false"))
+
+	lockouts, total, err := h.loginThrottle.ListLockouts(page, pageSize, activeOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lockouts": lockouts,
+		"pagination": gin.H{
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// @Summary Lift a login lockout
+// @Description Unlocks the account or address of a lockout event and clears its failed attempts (requires users:write)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "Lockout event ID"
+// @Success 200 {object} object{lockout=model.LockoutEvent} "Lockout lifted"
+// @Failure 400 {object} object{error=string} "Invalid lockout ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Lockout not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /lockouts/{id}/unlock [post]
+// @id UnlockLockout
+func (h *LockoutHandler) UnlockEvent(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lockout ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	event, err := h.loginThrottle.Unlock(uint(id), userID.(uint))
+	if err != nil {
+		if errors.Is(err, service.ErrLockoutEventNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Lockout not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lift lockout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lockout": event})
+}
+
+// @Summary Unlock a user account
+// @Description Lifts a login lockout of the user's account and clears its failed attempts (requires users:write)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Success 200 {object} object{message=string} "Account unlocked"
+// @Failure 400 {object} object{error=string} "Invalid user ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/unlock [post]
+// @id UnlockUser
+func (h *LockoutHandler) UnlockUser(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	if err := h.loginThrottle.UnlockUser(uint(id), userID.(uint)); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+}
@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFAHandler handles HTTP requests related to two-factor authentication
+type MFAHandler struct {
+	mfaService    *service.MFAService
+	authService   *service.AuthService
+	loginThrottle *service.LoginThrottleService
+	loginHistory  *service.LoginHistoryService
+}
+
+// NewMFAHandler creates a new MFA handler and registers routes
+func NewMFAHandler(r *gin.Engine, mfaService *service.MFAService, authService *service.AuthService, loginThrottle *service.LoginThrottleService, loginHistory *service.LoginHistoryService) *MFAHandler {
+	handler := &MFAHandler{
+		mfaService:    mfaService,
+		authService:   authService,
+		loginThrottle: loginThrottle,
+		loginHistory:  loginHistory,
+	}
+
+	mfa := r.Group("/api/auth/2fa")
+	{
+		// Second login step, authenticated by the challenge token
+		mfa.POST("/verify", handler.Verify)
+
+		// Managing the current user's own second factor
+		protected := mfa.Group("")
+		protected.Use(middleware.AuthMiddleware(), middleware.RequireSession())
+		{
+			protected.GET("", handler.GetStatus)
+			protected.POST("/setup", handler.Setup)
+			protected.POST("/enable", handler.Enable)
+			protected.POST("/disable", handler.Disable)
+			protected.POST("/recovery-codes", handler.RegenerateRecoveryCodes)
+		}
+	}
+
+	return handler
+}
+
+// respondMFAError writes the HTTP response for a two-factor error
+func respondMFAError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, service.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	case errors.Is(err, service.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor authentication code"})
+	case errors.Is(err, service.ErrInvalidChallengeToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired two-factor challenge, please log in again"})
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+	case errors.Is(err, service.ErrMFANotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+	case errors.Is(err, service.ErrMFANotSetUp):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication has not been set up"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary Complete two-factor login
+// @Description Exchanges the challenge token returned by /auth/login and a TOTP or recovery code for access and refresh tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body object{challenge_token=string,code=string} true "Challenge token and TOTP or recovery code"
+// @Success 200 {object} object{token=string,refresh_token=string,expires_at=string,session_id=string} "Login successful"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Invalid code or expired challenge"
+// @Failure 429 {object} object{error=string,retry_after=integer} "Too many failed attempts"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/2fa/verify [post]
+// @id VerifyTwoFactor
+func (h *MFAHandler) Verify(c *gin.Context) {
+	var request struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client := clientInfo(c)
+	challenged, err := h.mfaService.ChallengeUser(request.ChallengeToken)
+	if err != nil {
+		respondMFAError(c, err, "Failed to verify code")
+		return
+	}
+
+	// Wrong codes count as failed logins of the account and address, so
+	// they are refused alike while backing off or locked
+	if err := h.loginThrottle.CheckUser(challenged, client.IP); err != nil {
+		respondThrottled(c, err)
+		return
+	}
+
+	user, err := h.mfaService.VerifyChallenge(request.ChallengeToken, request.Code)
+	if err != nil {
+		if user != nil && errors.Is(err, service.ErrInvalidMFACode) {
+			if err := h.loginThrottle.RecordUserFailure(user, client.IP); err != nil {
+				log.Printf("Failed to record failed login: %v", err)
+			}
+			if err := h.loginHistory.RecordUserFailure(user, model.LoginFailureInvalidMFACode, client); err != nil {
+				log.Printf("Failed to record failed login: %v", err)
+			}
+		} else if err := h.loginThrottle.ReleaseUser(challenged, client.IP); err != nil {
+			log.Printf("Failed to release login attempt: %v", err)
+		}
+		respondMFAError(c, err, "Failed to verify code")
+		return
+	}
+
+	if err := h.loginThrottle.RecordSuccess(user, client.IP); err != nil {
+		log.Printf("Failed to reset failed logins: %v", err)
+	}
+
+	tokens, err := h.authService.IssueTokens(user, true, client)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	if err := h.loginHistory.RecordSuccess(user, tokens.SessionID, client); err != nil {
+		log.Printf("Failed to record login: %v", err)
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// @Summary Get two-factor status
+// @Description Returns whether the current user has two-factor authentication enabled and how many recovery codes are left
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} service.MFAStatus "Two-factor status"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/2fa [get]
+// @id GetTwoFactorStatus
+func (h *MFAHandler) GetStatus(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	status, err := h.mfaService.Status(userID.(uint))
+	if err != nil {
+		respondMFAError(c, err, "Failed to retrieve two-factor status")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// @Summary Start two-factor enrollment
+// @Description Generates a new TOTP secret for the current user. The response contains the secret, an otpauth URI and a base64-encoded QR code PNG. Enrollment completes with /auth/2fa/enable.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} service.TOTPSetup "TOTP secret"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 409 {object} object{error=string} "Two-factor authentication already enabled"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/2fa/setup [post]
+// @id SetupTwoFactor
+func (h *MFAHandler) Setup(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	setup, err := h.mfaService.Setup(userID.(uint))
+	if err != nil {
+		respondMFAError(c, err, "Failed to set up two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// @Summary Enable two-factor authentication
+// @Description Confirms enrollment with a code from the authenticator app and returns one-time recovery codes, which are shown only once
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body object{code=string} true "TOTP code"
+// @Success 200 {object} object{recovery_codes=[]string} "Two-factor authentication enabled"
+// @Failure 400 {object} object{error=string} "Invalid input or enrollment not started"
+// @Failure 401 {object} object{error=string} "Invalid code"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 409 {object} object{error=string} "Two-factor authentication already enabled"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/2fa/enable [post]
+// @id EnableTwoFactor
+func (h *MFAHandler) Enable(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.mfaService.Enable(userID.(uint), request.Code)
+	if err != nil {
+		respondMFAError(c, err, "Failed to enable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// @Summary Disable two-factor authentication
+// @Description Turns two-factor authentication off for the current user. Requires the password and a TOTP or recovery code.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body object{password=string,code=string} true "Password and TOTP or recovery code"
+// @Success 200 {object} object{message=string} "Two-factor authentication disabled"
+// @Failure 400 {object} object{error=string} "Invalid input or not enabled"
+// @Failure 401 {object} object{error=string} "Invalid password or code"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/2fa/disable [post]
+// @id DisableTwoFactor
+func (h *MFAHandler) Disable(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	var request struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.mfaService.Disable(userID.(uint), request.Password, request.Code); err != nil {
+		respondMFAError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replaces all recovery codes of the current user after checking a TOTP code. The new codes are shown only once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body object{code=string} true "TOTP code"
+// @Success 200 {object} object{recovery_codes=[]string} "New recovery codes"
+// @Failure 400 {object} object{error=string} "Invalid input or not enabled"
+// @Failure 401 {object} object{error=string} "Invalid code"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /auth/2fa/recovery-codes [post]
+// @id RegenerateRecoveryCodes
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(userID.(uint), request.Code)
+	if err != nil {
+		respondMFAError(c, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
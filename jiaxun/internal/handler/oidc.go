@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie binds a provider login to the browser that started it,
+// so that nobody can complete their own login in someone else's browser
+const oidcStateCookie = "oidc_state"
+
+// OIDCHandler handles HTTP requests related to OpenID Connect login
+type OIDCHandler struct {
+	oidcService  *service.OIDCService
+	authService  *service.AuthService
+	mfaService   *service.MFAService
+	loginHistory *service.LoginHistoryService
+	// redirectURL is the frontend page that receives the login result
+	redirectURL string
+}
+
+// NewOIDCHandler creates a new OIDC handler and registers routes
+func NewOIDCHandler(r *gin.Engine, oidcService *service.OIDCService, authService *service.AuthService, mfaService *service.MFAService, loginHistory *service.LoginHistoryService, redirectURL string) *OIDCHandler {
+	handler := &OIDCHandler{
+		oidcService:  oidcService,
+		authService:  authService,
+		mfaService:   mfaService,
+		loginHistory: loginHistory,
+		redirectURL:  redirectURL,
+	}
+
+	// Public routes, visited by the browser rather than called by the frontend
+	oidc := r.Group("/api/auth/oidc")
+	{
+		oidc.GET("", handler.ListProviders)
+		oidc.GET("/:provider/login", handler.Login)
+		oidc.GET("/:provider/callback", handler.Callback)
+	}
+
+	return handler
+}
+
+// @Summary List identity providers
+// @Description Returns the OpenID Connect providers users can log in with
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} object{providers=[]service.OIDCProviderInfo} "List of providers"
+// @Router /auth/oidc [get]
+// @id ListOIDCProviders
+func (h *OIDCHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.oidcService.Providers()})
+}
+
+// @Summary Log in with an identity provider
+// @Description Redirects the browser to the provider's login page, using the authorization code flow with PKCE. The provider sends the browser back to /auth/oidc/{provider}/callback.
+// @Tags auth
+// @Param provider path string true "Provider ID"
+// @Success 302 "Redirect to the provider; sets a cookie binding the login to the browser"
+// @Failure 404 {object} object{error=string} "Unknown provider"
+// @Failure 502 {object} object{error=string} "Provider unavailable"
+// @Router /auth/oidc/{provider}/login [get]
+// @id OIDCLogin
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, state, err := h.oidcService.Begin(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, service.ErrOIDCProviderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+			return
+		}
+		log.Printf("Failed to start OIDC login: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(service.OIDCStateTTL.Seconds()), "/api/auth/oidc", "", secure, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// @Summary Complete an identity provider login
+// @Description Called by the provider after the user logged in. Links the provider account to the user with the same verified email, or provisions an account if the provider allows it, then redirects the browser to the frontend. The URL fragment carries either the tokens (token, refresh_token, expires_at, session_id, mfa_setup_required), a two-factor challenge (mfa_required, challenge_token, expires_at) to complete at /auth/2fa/verify, or an error.
+// @Tags auth
+// @Param provider path string true "Provider ID"
+// @Param code query string false "Authorization code"
+// @Param state query string true "Login state"
+// @Param error query string false "Error reported by the provider"
+// @Success 302 "Redirect to the frontend"
+// @Router /auth/oidc/{provider}/callback [get]
+// @id OIDCCallback
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	// The state can be used once, so the cookie is no longer needed
+	cookie, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/api/auth/oidc", "", false, true)
+
+	if reason := c.Query("error"); reason != "" {
+		h.finish(c, url.Values{"error": {"The identity provider refused the login: " + reason}})
+		return
+	}
+	if cookie == "" || cookie != c.Query("state") {
+		h.finish(c, url.Values{"error": {"The login was started in another browser, please try again"}})
+		return
+	}
+
+	user, err := h.oidcService.Complete(c.Request.Context(), c.Param("provider"), c.Query("state"), c.Query("code"))
+	if err != nil {
+		var message string
+		switch {
+		case errors.Is(err, service.ErrOIDCProviderNotFound):
+			message = "Identity provider not found"
+		case errors.Is(err, service.ErrInvalidOIDCState):
+			message = "The login has expired, please try again"
+		case errors.Is(err, service.ErrOIDCEmailNotVerified):
+			message = "The identity provider did not confirm your email address"
+		case errors.Is(err, service.ErrOIDCAccountNotFound):
+			message = "No account matches your identity"
+		default:
+			log.Printf("Failed to complete OIDC login: %v", err)
+			message = "Login with the identity provider failed"
+		}
+		h.finish(c, url.Values{"error": {message}})
+		return
+	}
+
+	// Accounts with two-factor authentication continue at /auth/2fa/verify
+	if h.mfaService.IsEnabled(user) {
+		challenge, expiresAt, err := h.mfaService.NewChallenge(user)
+		if err != nil {
+			h.finish(c, url.Values{"error": {"Failed to generate token"}})
+			return
+		}
+		h.finish(c, url.Values{
+			"mfa_required":    {"true"},
+			"challenge_token": {challenge},
+			"expires_at":      {expiresAt.Format(time.RFC3339)},
+		})
+		return
+	}
+
+	setupRequired, err := h.mfaService.SetupRequired(user)
+	if err != nil {
+		h.finish(c, url.Values{"error": {"Authentication failed"}})
+		return
+	}
+
+	// Start a new session
+	client := clientInfo(c)
+	tokens, err := h.authService.IssueTokens(user, false, client)
+	if err != nil {
+		h.finish(c, url.Values{"error": {"Failed to generate token"}})
+		return
+	}
+	if err := h.loginHistory.RecordSuccess(user, tokens.SessionID, client); err != nil {
+		log.Printf("Failed to record login: %v", err)
+	}
+
+	h.finish(c, url.Values{
+		"token":              {tokens.AccessToken},
+		"refresh_token":      {tokens.RefreshToken},
+		"expires_at":         {tokens.ExpiresAt.Format(time.RFC3339)},
+		"session_id":         {tokens.SessionID},
+		"mfa_setup_required": {strconv.FormatBool(setupRequired)},
+	})
+}
+
+// finish redirects the browser to the frontend with the result in the URL
+// fragment, which browsers do not send to servers
+func (h *OIDCHandler) finish(c *gin.Context, result url.Values) {
+	c.Redirect(http.StatusFound, h.redirectURL+"#"+result.Encode())
+}
@@ -0,0 +1,360 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemHandler handles HTTP requests related to the problem bank
+type ProblemHandler struct {
+	problemService *service.ProblemService
+}
+
+// NewProblemHandler creates a new problem handler and registers routes
+func NewProblemHandler(r *gin.Engine, problemService *service.ProblemService) *ProblemHandler {
+	handler := &ProblemHandler{
+		problemService: problemService,
+	}
+
+	problems := r.Group("/api/problems")
+	problems.Use(middleware.AuthMiddleware())
+	{
+		// Routes for all authenticated users
+		problems.GET("", handler.ListProblems)
+		problems.GET("/:id", handler.GetProblem)
+
+		// Routes for problem managers
+		adminGroup := problems.Group("")
+		adminGroup.Use(middleware.RequirePermission(model.PermProblemsManage))
+		{
+			adminGroup.POST("", handler.CreateProblem)
+			adminGroup.POST("/import", handler.ImportProblems)
+			adminGroup.PUT("/:id", handler.UpdateProblem)
+			adminGroup.DELETE("/:id", handler.DeleteProblem)
+		}
+	}
+
+	return handler
+}
+
+// respondProblemError writes the HTTP response for a problem error
+func respondProblemError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrProblemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Problem not found"})
+	case errors.Is(err, service.ErrInvalidProblem),
+		errors.Is(err, service.ErrInvalidRatingRange),
+		errors.Is(err, service.ErrInvalidSortField),
+		errors.Is(err, service.ErrInvalidImportFile),
+		errors.Is(err, service.ErrUnknownTableFormat):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTooManyImportRows):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d problems can be imported at once", service.MaxProblemImportRows)})
+	case errors.Is(err, service.ErrProblemAlreadyExists),
+		errors.Is(err, service.ErrProblemHasSubmissions):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary List and search problems
+// @Description Returns a paginated list of the problems of the bank matching all the given filters
+// @Tags problems
+// @Accept json
+// @Produce json
+// @Param q query string false "Part of the name or external ID, ignoring case"
+// @Param platform query string false "Only problems from this judge or source"
+// @Param tag query []string false "Only problems with all of these tags" collectionFormat(multi)
+// @Param rating_min query integer false "Only problems rated at least this"
+// @Param rating_max query integer false "Only problems rated at most this"
+// @Param sort query string false "Comma-separated fields among id, platform, external_id, name, rating and created_at, each prefixed with - for descending order (default: id)"
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Success 200 {object} object{problems=[]model.Problem,pagination=object{total=integer,page=integer,pageSize=integer}} "List of problems"
+// @Failure 400 {object} object{error=string} "Invalid filter or sort field"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /problems [get]
+// @id ListProblems
+func (h *ProblemHandler) ListProblems(c *gin.Context) {
+	page, pageSize := pagination(c)
+
+	query := service.ProblemQuery{
+		Q:        c.Query("q"),
+		Platform: c.Query("platform"),
+		Tags:     c.QueryArray("tag"),
+		Sort:     c.Query("sort"),
+	}
+	for name, rating := range map[string]**int{
+		"rating_min": &query.RatingMin,
+		"rating_max": &query.RatingMax,
+	} {
+		if value := c.Query(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+				return
+			}
+			*rating = &parsed
+		}
+	}
+
+	problems, total, err := h.problemService.Search(query, page, pageSize)
+	if err != nil {
+		respondProblemError(c, err, "Failed to list problems")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"problems": problems,
+		"pagination": gin.H{
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// @Summary Get a problem
+// @Description Returns a problem of the bank
+// @Tags problems
+// @Accept json
+// @Produce json
+// @Param id path integer true "Problem ID"
+// @Success 200 {object} object{problem=model.Problem} "Problem"
+// @Failure 400 {object} object{error=string} "Invalid problem ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 404 {object} object{error=string} "Problem not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /problems/{id} [get]
+// @id GetProblem
+func (h *ProblemHandler) GetProblem(c *gin.Context) {
+	id, ok := problemID(c)
+	if !ok {
+		return
+	}
+
+	problem, err := h.problemService.Get(id)
+	if err != nil {
+		respondProblemError(c, err, "Failed to retrieve problem")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"problem": problem})
+}
+
+// @Summary Add a problem
+// @Description Adds a problem to the bank (requires problems:manage). A problem is identified by its platform, such as codeforces, and its ID there; the same problem cannot be added twice. Tags are lowercased.
+// @Tags problems
+// @Accept json
+// @Produce json
+// @Param body body object{platform=string,external_id=string,name=string,url=string,rating=integer,tags=[]string} true "Problem"
+// @Success 201 {object} object{problem=model.Problem} "Created problem"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 409 {object} object{error=string} "Problem already in the bank"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /problems [post]
+// @id CreateProblem
+func (h *ProblemHandler) CreateProblem(c *gin.Context) {
+	var request struct {
+		Platform   string   `json:"platform" binding:"required"`
+		ExternalID string   `json:"external_id" binding:"required"`
+		Name       string   `json:"name" binding:"required"`
+		URL        string   `json:"url"`
+		Rating     *int     `json:"rating"`
+		Tags       []string `json:"tags"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	problem, err := h.problemService.Create(service.ProblemInput{
+		Platform:   request.Platform,
+		ExternalID: request.ExternalID,
+		Name:       request.Name,
+		URL:        request.URL,
+		Rating:     request.Rating,
+		Tags:       request.Tags,
+	})
+	if err != nil {
+		respondProblemError(c, err, "Failed to create problem")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"problem": problem})
+}
+
+// @Summary Update a problem
+// @Description Updates the given fields of a problem (requires problems:manage). Its platform and external ID cannot change. A rating of 0 removes the rating; tags replace the current ones.
+// @Tags problems
+// @Accept json
+// @Produce json
+// @Param id path integer true "Problem ID"
+// @Param body body object{name=string,url=string,rating=integer,tags=[]string} false "Fields to update"
+// @Success 200 {object} object{problem=model.Problem} "Updated problem"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Problem not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /problems/{id} [put]
+// @id UpdateProblem
+func (h *ProblemHandler) UpdateProblem(c *gin.Context) {
+	id, ok := problemID(c)
+	if !ok {
+		return
+	}
+
+	// Pointer fields distinguish "not provided" from zero values
+	var request struct {
+		Name   *string   `json:"name"`
+		URL    *string   `json:"url"`
+		Rating *int      `json:"rating"`
+		Tags   *[]string `json:"tags"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	problem, err := h.problemService.Update(id, service.ProblemUpdate{
+		Name:   request.Name,
+		URL:    request.URL,
+		Rating: request.Rating,
+		Tags:   request.Tags,
+	})
+	if err != nil {
+		respondProblemError(c, err, "Failed to update problem")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"problem": problem})
+}
+
+// @Summary Delete a problem
+// @Description Removes a problem from the bank (requires problems:manage). Problems with synced submissions cannot be deleted.
+// @Tags problems
+// @Accept json
+// @Produce json
+// @Param id path integer true "Problem ID"
+// @Success 200 {object} object{message=string} "Problem deleted"
+// @Failure 400 {object} object{error=string} "Invalid problem ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Problem not found"
+// @Failure 409 {object} object{error=string} "Problem has submissions"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /problems/{id} [delete]
+// @id DeleteProblem
+func (h *ProblemHandler) DeleteProblem(c *gin.Context) {
+	id, ok := problemID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.problemService.Delete(id); err != nil {
+		respondProblemError(c, err, "Failed to delete problem")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Problem deleted successfully"})
+}
+
+// @Summary Import problems
+// @Description Adds problems to the bank from a JSON array of problems, with the fields of a new problem, or from a CSV or XLSX file whose first row names the columns: platform, external_id and name are required; url, rating and tags, separated by commas or semicolons, are optional (requires problems:manage).
+// @Description Problems already in the bank, by platform and external ID, are updated; their URL, rating and tags only change when given. Every problem is checked first, and problems are only saved if all are valid, in a single transaction. With dry_run, nothing is saved and the checked problems are returned.
+// @Tags problems
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "JSON, CSV or XLSX file, at most 5 MB and 5000 problems"
+// @Param format formData string false "json, csv or xlsx (default: from the file name)"
+// @Param dry_run formData boolean false "Only validate the problems"
+// @Success 200 {object} service.ProblemImportResult "Validated problems (dry run)"
+// @Success 201 {object} service.ProblemImportResult "Saved problems"
+// @Failure 400 {object} object{error=string} "Invalid file or parameters"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 422 {object} object{error=string,rows=[]service.ProblemImportRow} "Some problems are invalid; nothing was saved"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /problems/import [post]
+// @id ImportProblems
+func (h *ProblemHandler) ImportProblems(c *gin.Context) {
+	// Leave room for the rest of the form around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize+(1<<20))
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The import file is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An import file is required"})
+		return
+	}
+	if header.Size > maxImportFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The import file is too large"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the import file"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the import file"})
+		return
+	}
+
+	format := strings.ToLower(c.PostForm("format"))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	}
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", "false"))
+
+	result, err := h.problemService.Import(format, data, dryRun)
+	if errors.Is(err, service.ErrInvalidImportRows) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Some problems are invalid; no problem was saved", "rows": result.Rows})
+		return
+	}
+	if err != nil {
+		respondProblemError(c, err, "Failed to import problems")
+		return
+	}
+
+	if dryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+// problemID parses the problem ID of the URL, writing the error response
+// if it is invalid
+func problemID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid problem ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
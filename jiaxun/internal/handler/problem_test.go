@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"jiaxun/internal/keyring"
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// problemManager grants every user the management of the problem bank
+type problemManager struct{}
+
+func (problemManager) ResolvePermissions(userID uint) (string, []string, error) {
+	return model.RoleTeacher, []string{model.PermProblemsManage}, nil
+}
+
+// upload posts a file to the problem import
+func upload(t *testing.T, r http.Handler, name string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	token, err := middleware.GenerateToken(&middleware.JWTClaims{UserID: 1, MFA: true}, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/problems/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestImportProblemsUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	middleware.SetKeyring(keyring.NewHMAC([]byte("test secret")))
+	middleware.SetPermissionResolver(problemManager{})
+	t.Cleanup(func() {
+		middleware.SetKeyring(nil)
+		middleware.SetPermissionResolver(nil)
+	})
+	db := openTestDB(t)
+	r := gin.New()
+	NewProblemHandler(r, service.NewProblemService(repository.NewProblemRepository(db)))
+
+	csv := "platform,external_id,name,rating,tags\ncodeforces,1A,Theatre Square,1000,math\n"
+	w := upload(t, r, "problems.csv", []byte(csv))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("importing a CSV file = %d %s, want 201", w.Code, w.Body)
+	}
+	var result service.ProblemImportResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if result.Created != 1 || len(result.Rows) != 1 || result.Rows[0].ProblemID == 0 {
+		t.Errorf("result = %+v, want one problem created", result)
+	}
+
+	// Files over the limit are refused, whether the form reports their
+	// size or the request body runs over
+	padding := "\n" + strings.Repeat(" ", maxImportFileSize)
+	for name, data := range map[string][]byte{
+		"file over the limit":         []byte(csv + padding),
+		"request body over the limit": []byte(csv + padding + strings.Repeat(" ", 2<<20)),
+	} {
+		w := upload(t, r, "problems.csv", data)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "too large") {
+			t.Errorf("%s = %d %s, want 400 too large", name, w.Code, w.Body)
+		}
+	}
+
+	w = upload(t, r, "problems.txt", []byte(csv))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format = %d %s, want 400", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleHandler handles HTTP requests related to roles and permissions
+type RoleHandler struct {
+	rbacService *service.RBACService
+}
+
+// NewRoleHandler creates a new role handler and registers routes
+func NewRoleHandler(r *gin.Engine, rbacService *service.RBACService) *RoleHandler {
+	handler := &RoleHandler{
+		rbacService: rbacService,
+	}
+
+	// All routes require the roles:manage permission
+	manage := []gin.HandlerFunc{middleware.AuthMiddleware(), middleware.RequirePermission(model.PermRolesManage)}
+
+	r.GET("/api/permissions", append(manage, handler.ListPermissions)...)
+
+	roles := r.Group("/api/roles")
+	roles.Use(manage...)
+	{
+		roles.GET("", handler.ListRoles)
+		roles.POST("", handler.CreateRole)
+		roles.GET("/:name", handler.GetRole)
+		roles.PUT("/:name", handler.UpdateRole)
+		roles.DELETE("/:name", handler.DeleteRole)
+	}
+
+	users := r.Group("/api/users")
+	users.Use(manage...)
+	{
+		users.PUT("/:id/role", handler.AssignRole)
+	}
+
+	return handler
+}
+
+// respondRoleError maps RBAC service errors to HTTP responses
+func respondRoleError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, service.ErrRoleAlreadyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+	case errors.Is(err, service.ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is still assigned to users"})
+	case errors.Is(err, service.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot take the admin role from the last admin"})
+	case errors.Is(err, service.ErrBuiltinRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in roles cannot be deleted"})
+	case errors.Is(err, service.ErrAdminRoleImmutable):
+		c.JSON(http.StatusForbidden, gin.H{"error": "The admin role cannot be modified"})
+	case errors.Is(err, service.ErrInvalidRoleName), errors.Is(err, service.ErrUnknownPermission):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary List permissions
+// @Description Returns every permission that can be granted to a role, with a description (requires roles:manage)
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Success 200 {object} object{permissions=map[string]string} "Known permissions"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Router /permissions [get]
+// @id ListPermissions
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": h.rbacService.ListPermissions()})
+}
+
+// @Summary List roles
+// @Description Returns all roles with their permissions (requires roles:manage)
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Success 200 {object} object{roles=[]service.RoleInfo} "List of roles"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /roles [get]
+// @id ListRoles
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.rbacService.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// @Summary Get role
+// @Description Retrieves a role with its permissions (requires roles:manage)
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param name path string true "Role name"
+// @Success 200 {object} object{role=service.RoleInfo} "Role found"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Role not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /roles/{name} [get]
+// @id GetRole
+func (h *RoleHandler) GetRole(c *gin.Context) {
+	role, err := h.rbacService.GetRole(c.Param("name"))
+	if err != nil {
+		respondRoleError(c, err, "Failed to retrieve role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role": role})
+}
+
+// @Summary Create role
+// @Description Creates a custom role with the given permissions (requires roles:manage)
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param body body object{name=string,description=string,permissions=[]string} true "Role information"
+// @Success 201 {object} object{role=service.RoleInfo} "Created role"
+// @Failure 400 {object} object{error=string} "Invalid input or unknown permission"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 409 {object} object{error=string} "Role already exists"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /roles [post]
+// @id CreateRole
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var request struct {
+		Name        string   `json:"name" binding:"required"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := h.rbacService.CreateRole(request.Name, request.Description, request.Permissions)
+	if err != nil {
+		respondRoleError(c, err, "Failed to create role")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"role": role})
+}
+
+// @Summary Update role
+// @Description Changes the description and/or replaces the permissions of a role. The admin role cannot be modified. (requires roles:manage)
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param name path string true "Role name"
+// @Param body body object{description=string,permissions=[]string} false "Fields to update"
+// @Success 200 {object} object{role=service.RoleInfo} "Updated role"
+// @Failure 400 {object} object{error=string} "Invalid input or unknown permission"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Role not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /roles/{name} [put]
+// @id UpdateRole
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	var request struct {
+		Description *string   `json:"description"`
+		Permissions *[]string `json:"permissions"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := h.rbacService.UpdateRole(c.Param("name"), service.RoleUpdate{
+		Description: request.Description,
+		Permissions: request.Permissions,
+	})
+	if err != nil {
+		respondRoleError(c, err, "Failed to update role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role": role})
+}
+
+// @Summary Delete role
+// @Description Removes a custom role that is not assigned to any user (requires roles:manage)
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param name path string true "Role name"
+// @Success 200 {object} object{message=string} "Role deleted successfully"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden or built-in role"
+// @Failure 404 {object} object{error=string} "Role not found"
+// @Failure 409 {object} object{error=string} "Role still assigned to users"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /roles/{name} [delete]
+// @id DeleteRole
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	if err := h.rbacService.DeleteRole(c.Param("name")); err != nil {
+		respondRoleError(c, err, "Failed to delete role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// @Summary Assign role
+// @Description Changes the role of a user. The change applies to the user's next request. (requires roles:manage)
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param body body object{role=string} true "New role"
+// @Success 200 {object} object{user=model.User} "Updated user"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User or role not found"
+// @Failure 409 {object} object{error=string} "Last admin"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/role [put]
+// @id AssignRole
+func (h *RoleHandler) AssignRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.rbacService.AssignRole(uint(id), request.Role)
+	if err != nil {
+		respondRoleError(c, err, "Failed to assign role")
+		return
+	}
+
+	// Don't return the password
+	user.Password = ""
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
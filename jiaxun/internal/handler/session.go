@@ -0,0 +1,335 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionHandler handles HTTP requests related to sessions and login history
+type SessionHandler struct {
+	authService  *service.AuthService
+	loginHistory *service.LoginHistoryService
+	userService  *service.UserService
+}
+
+// NewSessionHandler creates a new session handler and registers routes
+func NewSessionHandler(r *gin.Engine, authService *service.AuthService, loginHistory *service.LoginHistoryService, userService *service.UserService) *SessionHandler {
+	handler := &SessionHandler{
+		authService:  authService,
+		loginHistory: loginHistory,
+		userService:  userService,
+	}
+
+	// The current user's own sessions
+	me := r.Group("/api/users/me")
+	me.Use(middleware.AuthMiddleware())
+	{
+		me.GET("/sessions", handler.ListMySessions)
+		me.DELETE("/sessions", middleware.RequireSession(), handler.RevokeMySessions)
+		me.DELETE("/sessions/:session", middleware.RequireSession(), handler.RevokeMySession)
+		me.GET("/logins", handler.ListMyLogins)
+	}
+
+	// Any user's sessions, for user administrators
+	users := r.Group("/api/users/:id")
+	users.Use(middleware.AuthMiddleware())
+	{
+		users.GET("/sessions", middleware.RequirePermission(model.PermUsersRead), handler.ListUserSessions)
+		users.DELETE("/sessions", middleware.RequirePermission(model.PermUsersWrite), handler.RevokeUserSessions)
+		users.DELETE("/sessions/:session", middleware.RequirePermission(model.PermUsersWrite), handler.RevokeUserSession)
+		users.GET("/logins", middleware.RequirePermission(model.PermUsersRead), handler.ListUserLogins)
+	}
+
+	return handler
+}
+
+// clientInfo returns the address and user agent of the client of a request
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// respondSessionError writes the HTTP response for a session error
+func respondSessionError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary List my sessions
+// @Description Returns the active sessions of the current user with the address and user agent of the client that last used each. The session of this request is marked as current.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Success 200 {object} object{sessions=[]model.Session} "List of sessions"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/me/sessions [get]
+// @id ListMySessions
+func (h *SessionHandler) ListMySessions(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	sessions, err := h.authService.ListSessions(userID.(uint), currentSessionID(c))
+	if err != nil {
+		respondSessionError(c, err, "Failed to list sessions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// @Summary Revoke one of my sessions
+// @Description Signs the current user out of one session, revoking its refresh and access tokens
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param session path string true "Session ID"
+// @Success 200 {object} object{message=string} "Session revoked"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 404 {object} object{error=string} "Session not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/me/sessions/{session} [delete]
+// @id RevokeMySession
+func (h *SessionHandler) RevokeMySession(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	if err := h.authService.RevokeSession(userID.(uint), c.Param("session")); err != nil {
+		respondSessionError(c, err, "Failed to revoke session")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// @Summary Revoke all my sessions
+// @Description Signs the current user out everywhere, including the session of this request
+// @Tags users
+// @Accept json
+// @Produce json
+// @Success 200 {object} object{message=string} "Sessions revoked"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/me/sessions [delete]
+// @id RevokeMySessions
+func (h *SessionHandler) RevokeMySessions(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	if err := h.authService.RevokeAllSessions(userID.(uint)); err != nil {
+		respondSessionError(c, err, "Failed to revoke sessions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked successfully"})
+}
+
+// @Summary List my login history
+// @Description Returns the successful and failed logins of the current user, newest first
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Success 200 {object} object{logins=[]model.LoginEvent,pagination=object{total=integer,page=integer,pageSize=integer}} "Login history"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/me/logins [get]
+// @id ListMyLogins
+func (h *SessionHandler) ListMyLogins(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	h.listLogins(c, userID.(uint))
+}
+
+// @Summary List a user's sessions
+// @Description Returns the active sessions of a user (requires users:read)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Success 200 {object} object{sessions=[]model.Session} "List of sessions"
+// @Failure 400 {object} object{error=string} "Invalid user ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/sessions [get]
+// @id ListUserSessions
+func (h *SessionHandler) ListUserSessions(c *gin.Context) {
+	id, ok := targetUser(c, h.userService)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(id, currentSessionID(c))
+	if err != nil {
+		respondSessionError(c, err, "Failed to list sessions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// @Summary Revoke a user's session
+// @Description Signs a user out of one session (requires users:write)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param session path string true "Session ID"
+// @Success 200 {object} object{message=string} "Session revoked"
+// @Failure 400 {object} object{error=string} "Invalid user ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User or session not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/sessions/{session} [delete]
+// @id RevokeUserSession
+func (h *SessionHandler) RevokeUserSession(c *gin.Context) {
+	id, ok := targetUser(c, h.userService)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.RevokeSession(id, c.Param("session")); err != nil {
+		respondSessionError(c, err, "Failed to revoke session")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// @Summary Revoke all of a user's sessions
+// @Description Signs a user out everywhere (requires users:write)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Success 200 {object} object{message=string} "Sessions revoked"
+// @Failure 400 {object} object{error=string} "Invalid user ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/sessions [delete]
+// @id RevokeUserSessions
+func (h *SessionHandler) RevokeUserSessions(c *gin.Context) {
+	id, ok := targetUser(c, h.userService)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.RevokeAllSessions(id); err != nil {
+		respondSessionError(c, err, "Failed to revoke sessions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked successfully"})
+}
+
+// @Summary List a user's login history
+// @Description Returns the successful and failed logins of a user, newest first (requires users:read)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Success 200 {object} object{logins=[]model.LoginEvent,pagination=object{total=integer,page=integer,pageSize=integer}} "Login history"
+// @Failure 400 {object} object{error=string} "Invalid user ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/logins [get]
+// @id ListUserLogins
+func (h *SessionHandler) ListUserLogins(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	h.listLogins(c, uint(id))
+}
+
+// listLogins writes a page of a user's login history
+func (h *SessionHandler) listLogins(c *gin.Context, userID uint) {
+	// Parse pagination parameters
+	pageStr := c.DefaultQuery("page", "1")
+	pageSizeStr := c.DefaultQuery("page_size", "10")
+
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(pageSizeStr)
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	logins, total, err := h.loginHistory.List(userID, page, pageSize)
+	if err != nil {
+		respondSessionError(c, err, "Failed to list logins")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logins": logins,
+		"pagination": gin.H{
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// targetUser parses the user ID of the URL and checks that the user exists,
+// writing the error response if not
+func targetUser(c *gin.Context, userService *service.UserService) (uint, bool) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+
+	exists, err := userService.Exists(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return 0, false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// currentSessionID returns the session of the request, which is empty for
+// requests made with a personal access token
+func currentSessionID(c *gin.Context) string {
+	if claims, ok := c.Get("claims"); ok {
+		if claims, ok := claims.(*middleware.JWTClaims); ok {
+			return claims.SessionID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"jiaxun/internal/keyring"
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSessionsOfOtherUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := openTestDB(t)
+	userService := service.NewUserService(*repository.NewUserRepository(db))
+	rbacService := service.NewRBACService(repository.NewRoleRepository(db), userService)
+	authService := service.NewAuthService(repository.NewTokenRepository(db), userService, 15*time.Minute, 24*time.Hour)
+	loginHistory := service.NewLoginHistoryService(repository.NewLoginEventRepository(db), userService, 24*time.Hour)
+	middleware.SetKeyring(keyring.NewHMAC([]byte("test secret")))
+	middleware.SetPermissionResolver(rbacService)
+	middleware.SetRevocationList(authService)
+	t.Cleanup(func() {
+		middleware.SetKeyring(nil)
+		middleware.SetPermissionResolver(nil)
+		middleware.SetRevocationList(nil)
+	})
+
+	r := gin.New()
+	NewSessionHandler(r, authService, loginHistory, userService)
+
+	admin := &model.User{Username: "root", Email: "root@example.org", Password: "password", Role: model.RoleAdmin}
+	ada := &model.User{Username: "ada", Email: "ada@example.org", Password: "password", Role: model.RoleStudent}
+	grace := &model.User{Username: "grace", Email: "grace@example.org", Password: "password", Role: model.RoleStudent}
+	sessions := map[*model.User]*service.TokenPair{}
+	for _, user := range []*model.User{admin, ada, grace} {
+		if err := userService.Create(user); err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		tokens, err := authService.IssueTokens(user, true, service.ClientInfo{IP: "192.0.2.1"})
+		if err != nil {
+			t.Fatalf("IssueTokens: %v", err)
+		}
+		sessions[user] = tokens
+	}
+
+	send := func(t *testing.T, as *model.User, method, target string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer "+sessions[as].AccessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	graceSessions := fmt.Sprintf("/api/users/%d/sessions", grace.ID)
+	graceSession := graceSessions + "/" + sessions[grace].SessionID
+
+	t.Run("without permission", func(t *testing.T) {
+		for _, request := range []struct{ method, target string }{
+			{http.MethodGet, graceSessions},
+			{http.MethodDelete, graceSessions},
+			{http.MethodDelete, graceSession},
+		} {
+			if w := send(t, ada, request.method, request.target); w.Code != http.StatusForbidden {
+				t.Errorf("%s %s = %d %s, want 403", request.method, request.target, w.Code, w.Body)
+			}
+		}
+		// Sessions of others are not found among one's own
+		target := "/api/users/me/sessions/" + sessions[grace].SessionID
+		if w := send(t, ada, http.MethodDelete, target); w.Code != http.StatusNotFound {
+			t.Errorf("DELETE %s = %d %s, want 404", target, w.Code, w.Body)
+		}
+		w := send(t, ada, http.MethodGet, "/api/users/me/sessions")
+		var body struct {
+			Sessions []model.Session `json:"sessions"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if len(body.Sessions) != 1 || body.Sessions[0].ID != sessions[ada].SessionID {
+			t.Errorf("own sessions = %+v, want the session of ada only", body.Sessions)
+		}
+		if w := send(t, grace, http.MethodGet, "/api/users/me/sessions"); w.Code != http.StatusOK {
+			t.Errorf("session of grace stopped working: %d %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("with permission", func(t *testing.T) {
+		if w := send(t, admin, http.MethodGet, graceSessions); w.Code != http.StatusOK {
+			t.Errorf("GET %s = %d %s, want 200", graceSessions, w.Code, w.Body)
+		}
+		if w := send(t, admin, http.MethodDelete, graceSession); w.Code != http.StatusOK {
+			t.Errorf("DELETE %s = %d %s, want 200", graceSession, w.Code, w.Body)
+		}
+		if w := send(t, grace, http.MethodGet, "/api/users/me/sessions"); w.Code != http.StatusUnauthorized {
+			t.Errorf("revoked session of grace = %d %s, want 401", w.Code, w.Body)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubmissionHandler handles HTTP requests related to the submissions synced
+// from online judges
+type SubmissionHandler struct {
+	submissionService *service.SubmissionService
+	userService       *service.UserService
+}
+
+// NewSubmissionHandler creates a new submission handler and registers routes
+func NewSubmissionHandler(r *gin.Engine, submissionService *service.SubmissionService, userService *service.UserService) *SubmissionHandler {
+	handler := &SubmissionHandler{
+		submissionService: submissionService,
+		userService:       userService,
+	}
+
+	users := r.Group("/api/users/:id")
+	users.Use(middleware.AuthMiddleware())
+	{
+		users.GET("/submissions", handler.ListSubmissions)
+		users.POST("/judge-accounts/:accountId/sync", middleware.CanModifyUser(), handler.SyncJudgeAccount)
+	}
+
+	return handler
+}
+
+// respondSubmissionError writes the HTTP response for a submission error
+func respondSubmissionError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrUnknownJudgePlatform),
+		errors.Is(err, service.ErrInvalidVerdict):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrJudgeAccountNotVerified),
+		errors.Is(err, service.ErrSyncNotSupported):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondJudgeAccountError(c, err, fallback)
+	}
+}
+
+// @Summary List a user's submissions
+// @Description Returns the submissions synced from the verified judge accounts of a user, newest first, with their problems
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param platform query string false "Only submissions on this judge (codeforces, atcoder, leetcode or luogu)"
+// @Param verdict query string false "Only submissions with this verdict (accepted, wrong_answer, time_limit_exceeded, memory_limit_exceeded, runtime_error, compilation_error or other)"
+// @Param submitted_after query string false "Only submissions made at or after this time (RFC 3339 or YYYY-MM-DD)"
+// @Param submitted_before query string false "Only submissions made before this time (RFC 3339 or YYYY-MM-DD)"
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Success 200 {object} object{submissions=[]model.Submission,pagination=object{total=integer,page=integer,pageSize=integer}} "List of submissions"
+// @Failure 400 {object} object{error=string} "Invalid user ID or filter"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 404 {object} object{error=string} "User not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/submissions [get]
+// @id ListSubmissions
+func (h *SubmissionHandler) ListSubmissions(c *gin.Context) {
+	userID, ok := targetUser(c, h.userService)
+	if !ok {
+		return
+	}
+	page, pageSize := pagination(c)
+
+	query := service.SubmissionQuery{
+		Platform: c.Query("platform"),
+		Verdict:  c.Query("verdict"),
+	}
+	for name, at := range map[string]**time.Time{
+		"submitted_after":  &query.SubmittedAfter,
+		"submitted_before": &query.SubmittedBefore,
+	} {
+		if value := c.Query(name); value != "" {
+			parsed, err := parseTimeParam(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + ": use RFC 3339 or YYYY-MM-DD"})
+				return
+			}
+			*at = &parsed
+		}
+	}
+
+	submissions, total, err := h.submissionService.Search(userID, query, page, pageSize)
+	if err != nil {
+		respondSubmissionError(c, err, "Failed to list submissions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"submissions": submissions,
+		"pagination": gin.H{
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// @Summary Sync a judge account
+// @Description Fetches the submissions made with a verified judge account since its last sync, without waiting for the periodic sync. Only the user or an administrator with users:write can sync accounts.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param accountId path integer true "Judge account ID"
+// @Success 200 {object} object{judge_account=model.JudgeAccount,fetched=integer} "Synced judge account and number of submissions fetched"
+// @Failure 400 {object} object{error=string} "Invalid ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User or judge account not found"
+// @Failure 409 {object} object{error=string} "Account not verified or platform not supported"
+// @Failure 422 {object} object{error=string} "Handle does not exist"
+// @Failure 502 {object} object{error=string} "Judge unreachable"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/judge-accounts/{accountId}/sync [post]
+// @id SyncJudgeAccount
+func (h *SubmissionHandler) SyncJudgeAccount(c *gin.Context) {
+	userID, accountID, ok := targetAccount(c, h.userService)
+	if !ok {
+		return
+	}
+
+	account, fetched, err := h.submissionService.Sync(c.Request.Context(), userID, accountID)
+	if err != nil {
+		respondSubmissionError(c, err, "Failed to sync judge account")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"judge_account": account, "fetched": fetched})
+}
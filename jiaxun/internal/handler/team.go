@@ -0,0 +1,538 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/policy"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TeamHandler handles HTTP requests related to teams
+type TeamHandler struct {
+	teamService *service.TeamService
+}
+
+// NewTeamHandler creates a new team handler and registers routes
+func NewTeamHandler(r *gin.Engine, teamService *service.TeamService) *TeamHandler {
+	handler := &TeamHandler{
+		teamService: teamService,
+	}
+
+	teams := r.Group("/api/teams")
+	teams.Use(middleware.AuthMiddleware())
+	{
+		teams.POST("", middleware.RequireSession(), handler.CreateTeam)
+		teams.GET("", handler.ListTeams)
+		teams.GET("/mine", handler.ListMyTeams)
+		teams.GET("/invitations", handler.ListMyInvitations)
+		teams.POST("/requests/:requestId/accept", middleware.RequireSession(), handler.AcceptRequest)
+		teams.POST("/requests/:requestId/decline", middleware.RequireSession(), handler.DeclineRequest)
+
+		teams.GET("/:id", handler.GetTeam)
+		teams.DELETE("/:id", handler.DeleteTeam)
+		teams.POST("/:id/join", middleware.RequireSession(), handler.RequestToJoin)
+		teams.POST("/:id/leave", middleware.RequireSession(), handler.LeaveTeam)
+
+		// Captain or team approver routes, checked by the team service
+		teams.GET("/:id/requests", handler.ListTeamRequests)
+		teams.POST("/:id/invitations", handler.InviteUser)
+		teams.DELETE("/:id/members/:userId", handler.RemoveMember)
+		teams.POST("/:id/transfer", handler.TransferCaptain)
+	}
+
+	return handler
+}
+
+// respondTeamError maps team service errors to HTTP responses
+func respondTeamError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrTeamNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, service.ErrTeamRequestNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+	case errors.Is(err, policy.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": policy.Message(err)})
+	case errors.Is(err, service.ErrNotTeamRequestHandler):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot respond to this request"})
+	case errors.Is(err, service.ErrNotTeamMember):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is not a member of the team"})
+	case errors.Is(err, service.ErrCaptainCannotLeave):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Captain must transfer captaincy before leaving"})
+	case errors.Is(err, service.ErrAlreadyTeamMember):
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of the team"})
+	case errors.Is(err, service.ErrTeamFull):
+		c.JSON(http.StatusConflict, gin.H{"error": "Team is full"})
+	case errors.Is(err, service.ErrTeamRequestPending):
+		c.JSON(http.StatusConflict, gin.H{"error": "A pending request already exists"})
+	case errors.Is(err, service.ErrTeamRequestClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": "Request has already been answered"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary Create a team
+// @Description Creates a new team with the current user as captain
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param body body object{team_name=string} true "Team information"
+// @Success 201 {object} object{team=model.Team} "Created team"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams [post]
+// @id CreateTeam
+func (h *TeamHandler) CreateTeam(c *gin.Context) {
+	var request struct {
+		TeamName string `json:"team_name" binding:"required,max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	team, err := h.teamService.CreateTeam(request.TeamName, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create team"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"team": team})
+}
+
+// @Summary List teams
+// @Description Returns a paginated list of teams
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Success 200 {object} object{teams=[]model.Team,pagination=object{total=integer,page=integer,pageSize=integer}} "List of teams"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams [get]
+// @id ListTeams
+func (h *TeamHandler) ListTeams(c *gin.Context) {
+	// Parse pagination parameters
+	pageStr := c.DefaultQuery("page", "1")
+	pageSizeStr := c.DefaultQuery("page_size", "10")
+
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(pageSizeStr)
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	teams, total, err := h.teamService.ListTeams(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list teams"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"teams": teams,
+		"pagination": gin.H{
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// @Summary List my teams
+// @Description Returns the teams the current user is a member of
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Success 200 {object} object{teams=[]model.Team} "List of teams"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/mine [get]
+// @id ListMyTeams
+func (h *TeamHandler) ListMyTeams(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	teams, err := h.teamService.ListTeamsByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list teams"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"teams": teams})
+}
+
+// @Summary Get team by ID
+// @Description Retrieves a team and its members
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path integer true "Team ID"
+// @Success 200 {object} object{team=model.Team,members=[]model.TeamMembership} "Team found"
+// @Failure 400 {object} object{error=string} "Invalid team ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 404 {object} object{error=string} "Team not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/{id} [get]
+// @id GetTeam
+func (h *TeamHandler) GetTeam(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	team, err := h.teamService.GetTeam(uint(id))
+	if err != nil {
+		respondTeamError(c, err, "Failed to retrieve team")
+		return
+	}
+
+	members, err := h.teamService.GetMembers(uint(id))
+	if err != nil {
+		respondTeamError(c, err, "Failed to retrieve team members")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"team": team, "members": members})
+}
+
+// @Summary Invite a user
+// @Description Invites a user to join the team (captain or teams:approve)
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path integer true "Team ID"
+// @Param body body object{user_id=integer} true "User to invite"
+// @Success 201 {object} object{request=model.TeamRequest} "Invitation created"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed to manage the team"
+// @Failure 404 {object} object{error=string} "Team or user not found"
+// @Failure 409 {object} object{error=string} "Already a member, team full or invitation pending"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/{id}/invitations [post]
+// @id InviteToTeam
+func (h *TeamHandler) InviteUser(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	var request struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := h.teamService.Invite(middleware.Subject(c), uint(id), request.UserID)
+	if err != nil {
+		respondTeamError(c, err, "Failed to invite user")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"request": invitation})
+}
+
+// @Summary Request to join a team
+// @Description Asks the team captain to accept the current user as a member
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path integer true "Team ID"
+// @Success 201 {object} object{request=model.TeamRequest} "Join request created"
+// @Failure 400 {object} object{error=string} "Invalid team ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 404 {object} object{error=string} "Team not found"
+// @Failure 409 {object} object{error=string} "Already a member, team full or request pending"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/{id}/join [post]
+// @id RequestToJoinTeam
+func (h *TeamHandler) RequestToJoin(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	joinRequest, err := h.teamService.RequestToJoin(uint(id), userID.(uint))
+	if err != nil {
+		respondTeamError(c, err, "Failed to request to join team")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"request": joinRequest})
+}
+
+// @Summary List team requests
+// @Description Returns the pending invitations and join requests of a team (captain or teams:approve)
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path integer true "Team ID"
+// @Success 200 {object} object{requests=[]model.TeamRequest} "Pending requests"
+// @Failure 400 {object} object{error=string} "Invalid team ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed to manage the team"
+// @Failure 404 {object} object{error=string} "Team not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/{id}/requests [get]
+// @id ListTeamRequests
+func (h *TeamHandler) ListTeamRequests(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	requests, err := h.teamService.ListTeamRequests(middleware.Subject(c), uint(id))
+	if err != nil {
+		respondTeamError(c, err, "Failed to list team requests")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+// @Summary List my invitations
+// @Description Returns the pending team invitations of the current user
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Success 200 {object} object{requests=[]model.TeamRequest} "Pending invitations"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/invitations [get]
+// @id ListMyTeamInvitations
+func (h *TeamHandler) ListMyInvitations(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	invitations, err := h.teamService.ListInvitations(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requests": invitations})
+}
+
+// @Summary Accept a team request
+// @Description Accepts an invitation (invited user) or a join request (team captain or teams:approve)
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param requestId path integer true "Request ID"
+// @Success 200 {object} object{request=model.TeamRequest} "Request accepted"
+// @Failure 400 {object} object{error=string} "Invalid request ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Cannot respond to this request"
+// @Failure 404 {object} object{error=string} "Request not found"
+// @Failure 409 {object} object{error=string} "Request already answered or team full"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/requests/{requestId}/accept [post]
+// @id AcceptTeamRequest
+func (h *TeamHandler) AcceptRequest(c *gin.Context) {
+	h.respondToRequest(c, true)
+}
+
+// @Summary Decline a team request
+// @Description Declines an invitation (invited user) or a join request (team captain or teams:approve)
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param requestId path integer true "Request ID"
+// @Success 200 {object} object{request=model.TeamRequest} "Request declined"
+// @Failure 400 {object} object{error=string} "Invalid request ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Cannot respond to this request"
+// @Failure 404 {object} object{error=string} "Request not found"
+// @Failure 409 {object} object{error=string} "Request already answered"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/requests/{requestId}/decline [post]
+// @id DeclineTeamRequest
+func (h *TeamHandler) DeclineRequest(c *gin.Context) {
+	h.respondToRequest(c, false)
+}
+
+func (h *TeamHandler) respondToRequest(c *gin.Context, accept bool) {
+	idStr := c.Param("requestId")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	request, err := h.teamService.RespondToRequest(middleware.Subject(c), uint(id), accept)
+	if err != nil {
+		respondTeamError(c, err, "Failed to respond to request")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"request": request})
+}
+
+// @Summary Leave a team
+// @Description Removes the current user from a team; a sole captain disbands it, moving it to the trash
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path integer true "Team ID"
+// @Success 200 {object} object{message=string} "Left team successfully"
+// @Failure 400 {object} object{error=string} "Not a member or captain must transfer first"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 404 {object} object{error=string} "Team not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/{id}/leave [post]
+// @id LeaveTeam
+func (h *TeamHandler) LeaveTeam(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	if err := h.teamService.Leave(uint(id), userID.(uint)); err != nil {
+		respondTeamError(c, err, "Failed to leave team")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Left team successfully"})
+}
+
+// @Summary Delete a team
+// @Description Moves a team to the trash, from which it can be restored with its members until it is purged (teams:approve)
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path integer true "Team ID"
+// @Success 200 {object} object{message=string} "Team deleted successfully"
+// @Failure 400 {object} object{error=string} "Invalid team ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed to delete the team"
+// @Failure 404 {object} object{error=string} "Team not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/{id} [delete]
+// @id DeleteTeam
+func (h *TeamHandler) DeleteTeam(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	if err := h.teamService.DeleteTeam(middleware.Subject(c), uint(id)); err != nil {
+		respondTeamError(c, err, "Failed to delete team")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
+}
+
+// @Summary Remove a member
+// @Description Removes a member from the team (captain or teams:approve)
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path integer true "Team ID"
+// @Param userId path integer true "User ID"
+// @Success 200 {object} object{message=string} "Member removed successfully"
+// @Failure 400 {object} object{error=string} "Invalid ID or user is not a member"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed to manage the team"
+// @Failure 404 {object} object{error=string} "Team not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/{id}/members/{userId} [delete]
+// @id RemoveTeamMember
+func (h *TeamHandler) RemoveMember(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	memberIDStr := c.Param("userId")
+	memberID, err := strconv.ParseUint(memberIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.teamService.RemoveMember(middleware.Subject(c), uint(id), uint(memberID)); err != nil {
+		respondTeamError(c, err, "Failed to remove member")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// @Summary Transfer captaincy
+// @Description Hands the captaincy over to another member (captain or teams:approve)
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path integer true "Team ID"
+// @Param body body object{user_id=integer} true "New captain"
+// @Success 200 {object} object{message=string} "Captaincy transferred successfully"
+// @Failure 400 {object} object{error=string} "Invalid input or user is not a member"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed to manage the team"
+// @Failure 404 {object} object{error=string} "Team not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /teams/{id}/transfer [post]
+// @id TransferTeamCaptain
+func (h *TeamHandler) TransferCaptain(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	var request struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.teamService.TransferCaptain(middleware.Subject(c), uint(id), request.UserID); err != nil {
+		respondTeamError(c, err, "Failed to transfer captaincy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Captaincy transferred successfully"})
+}
@@ -0,0 +1,456 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/policy"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrainingHandler handles HTTP requests related to training plans
+type TrainingHandler struct {
+	trainingService *service.TrainingService
+}
+
+// NewTrainingHandler creates a new training handler and registers routes
+func NewTrainingHandler(r *gin.Engine, trainingService *service.TrainingService) *TrainingHandler {
+	handler := &TrainingHandler{
+		trainingService: trainingService,
+	}
+
+	plans := r.Group("/api/training-plans")
+	plans.Use(middleware.AuthMiddleware())
+	{
+		// Routes for all authenticated users
+		plans.GET("", handler.ListPlans)
+		plans.GET("/active", handler.ListActivePlans)
+		plans.GET("/:id", handler.GetPlan)
+		plans.GET("/:id/participants", handler.ListParticipants)
+		plans.POST("/:id/join", middleware.RequireSession(), handler.JoinPlan)
+
+		// Author or training manager routes, checked by the training service
+		plans.PUT("/:id", handler.UpdatePlan)
+		plans.DELETE("/:id", handler.DeletePlan)
+		plans.POST("/:id/participants", handler.AddParticipant)
+		plans.DELETE("/:id/participants/:participationId", handler.RemoveParticipant)
+
+		// Routes for training managers
+		adminGroup := plans.Group("")
+		adminGroup.Use(middleware.RequirePermission(model.PermTrainingManage))
+		{
+			adminGroup.POST("", handler.CreatePlan)
+		}
+	}
+
+	return handler
+}
+
+// respondTrainingError maps training service errors to HTTP responses
+func respondTrainingError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, policy.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": policy.Message(err)})
+	case errors.Is(err, service.ErrTrainingPlanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Training plan not found"})
+	case errors.Is(err, service.ErrParticipationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Participation not found"})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, service.ErrTeamNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+	case errors.Is(err, service.ErrInvalidTrainingDates):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "End date must be after start date"})
+	case errors.Is(err, service.ErrTrainingPlanEnded):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Training plan has already ended"})
+	case errors.Is(err, service.ErrAlreadyEnrolled):
+		c.JSON(http.StatusConflict, gin.H{"error": "Already enrolled in this training plan"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary Create a training plan
+// @Description Creates a new training plan authored by the current user (requires training:manage)
+// @Tags training
+// @Accept json
+// @Produce json
+// @Param body body object{title=string,description=string,start_date=string,end_date=string} true "Training plan information"
+// @Success 201 {object} object{training_plan=model.TrainingPlan} "Created training plan"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /training-plans [post]
+// @id CreateTrainingPlan
+func (h *TrainingHandler) CreatePlan(c *gin.Context) {
+	var request struct {
+		Title       string    `json:"title" binding:"required,max=100"`
+		Description string    `json:"description"`
+		StartDate   time.Time `json:"start_date" binding:"required"`
+		EndDate     time.Time `json:"end_date" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+	authorID := userID.(uint)
+
+	plan := &model.TrainingPlan{
+		Title:       request.Title,
+		Description: request.Description,
+		StartDate:   request.StartDate,
+		EndDate:     request.EndDate,
+		CreatedBy:   &authorID,
+	}
+
+	if err := h.trainingService.CreatePlan(plan); err != nil {
+		respondTrainingError(c, err, "Failed to create training plan")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"training_plan": plan})
+}
+
+// @Summary List training plans
+// @Description Returns a paginated list of training plans
+// @Tags training
+// @Accept json
+// @Produce json
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Success 200 {object} object{training_plans=[]model.TrainingPlan,pagination=object{total=integer,page=integer,pageSize=integer}} "List of training plans"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /training-plans [get]
+// @id ListTrainingPlans
+func (h *TrainingHandler) ListPlans(c *gin.Context) {
+	// Parse pagination parameters
+	pageStr := c.DefaultQuery("page", "1")
+	pageSizeStr := c.DefaultQuery("page_size", "10")
+
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(pageSizeStr)
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	plans, total, err := h.trainingService.ListPlans(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list training plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"training_plans": plans,
+		"pagination": gin.H{
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// @Summary List my active training plans
+// @Description Returns the running training plans the current user takes part in, individually or through a team
+// @Tags training
+// @Accept json
+// @Produce json
+// @Success 200 {object} object{training_plans=[]model.TrainingPlan} "Active training plans"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /training-plans/active [get]
+// @id ListActiveTrainingPlans
+func (h *TrainingHandler) ListActivePlans(c *gin.Context) {
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	plans, err := h.trainingService.ListActivePlans(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list training plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"training_plans": plans})
+}
+
+// @Summary Get training plan by ID
+// @Description Retrieves a training plan by its ID
+// @Tags training
+// @Accept json
+// @Produce json
+// @Param id path integer true "Training plan ID"
+// @Success 200 {object} object{training_plan=model.TrainingPlan} "Training plan found"
+// @Failure 400 {object} object{error=string} "Invalid training plan ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 404 {object} object{error=string} "Training plan not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /training-plans/{id} [get]
+// @id GetTrainingPlan
+func (h *TrainingHandler) GetPlan(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid training plan ID"})
+		return
+	}
+
+	plan, err := h.trainingService.GetPlan(uint(id))
+	if err != nil {
+		respondTrainingError(c, err, "Failed to retrieve training plan")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"training_plan": plan})
+}
+
+// @Summary Update training plan
+// @Description Updates the given fields of a training plan (author or training:manage)
+// @Tags training
+// @Accept json
+// @Produce json
+// @Param id path integer true "Training plan ID"
+// @Param body body object{title=string,description=string,start_date=string,end_date=string} false "Fields to update"
+// @Success 200 {object} object{training_plan=model.TrainingPlan} "Updated training plan"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Training plan not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /training-plans/{id} [put]
+// @id UpdateTrainingPlan
+func (h *TrainingHandler) UpdatePlan(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid training plan ID"})
+		return
+	}
+
+	// Pointer fields distinguish "not provided" from zero values
+	var request struct {
+		Title       *string    `json:"title" binding:"omitempty,min=1,max=100"`
+		Description *string    `json:"description"`
+		StartDate   *time.Time `json:"start_date"`
+		EndDate     *time.Time `json:"end_date"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, err := h.trainingService.UpdatePlan(middleware.Subject(c), uint(id), service.TrainingPlanUpdate{
+		Title:       request.Title,
+		Description: request.Description,
+		StartDate:   request.StartDate,
+		EndDate:     request.EndDate,
+	})
+	if err != nil {
+		respondTrainingError(c, err, "Failed to update training plan")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"training_plan": plan})
+}
+
+// @Summary Delete training plan
+// @Description Moves a training plan to the trash, from which it can be restored with its participations until it is purged (author or training:manage)
+// @Tags training
+// @Accept json
+// @Produce json
+// @Param id path integer true "Training plan ID"
+// @Success 200 {object} object{message=string} "Training plan deleted successfully"
+// @Failure 400 {object} object{error=string} "Invalid training plan ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Training plan not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /training-plans/{id} [delete]
+// @id DeleteTrainingPlan
+func (h *TrainingHandler) DeletePlan(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid training plan ID"})
+		return
+	}
+
+	if err := h.trainingService.DeletePlan(middleware.Subject(c), uint(id)); err != nil {
+		respondTrainingError(c, err, "Failed to delete training plan")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Training plan deleted successfully"})
+}
+
+// @Summary List training plan participants
+// @Description Returns all participations of a training plan
+// @Tags training
+// @Accept json
+// @Produce json
+// @Param id path integer true "Training plan ID"
+// @Success 200 {object} object{participations=[]model.TrainingParticipation} "List of participations"
+// @Failure 400 {object} object{error=string} "Invalid training plan ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 404 {object} object{error=string} "Training plan not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /training-plans/{id}/participants [get]
+// @id ListTrainingParticipants
+func (h *TrainingHandler) ListParticipants(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid training plan ID"})
+		return
+	}
+
+	participations, err := h.trainingService.GetParticipations(uint(id))
+	if err != nil {
+		respondTrainingError(c, err, "Failed to list participants")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"participations": participations})
+}
+
+// @Summary Join a training plan
+// @Description Enrolls the current user in a training plan that has not ended yet
+// @Tags training
+// @Accept json
+// @Produce json
+// @Param id path integer true "Training plan ID"
+// @Success 201 {object} object{participation=model.TrainingParticipation} "Participation created"
+// @Failure 400 {object} object{error=string} "Invalid ID or training plan has ended"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Not allowed with an access token"
+// @Failure 404 {object} object{error=string} "Training plan not found"
+// @Failure 409 {object} object{error=string} "Already enrolled"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /training-plans/{id}/join [post]
+// @id JoinTrainingPlan
+func (h *TrainingHandler) JoinPlan(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid training plan ID"})
+		return
+	}
+
+	userID, _ := c.Get("userID") // This will always exist due to auth middleware
+
+	participation, err := h.trainingService.EnrollUser(uint(id), userID.(uint))
+	if err != nil {
+		respondTrainingError(c, err, "Failed to join training plan")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"participation": participation})
+}
+
+// @Summary Add a training plan participant
+// @Description Enrolls a user or a whole team in a training plan (author or training:manage)
+// @Tags training
+// @Accept json
+// @Produce json
+// @Param id path integer true "Training plan ID"
+// @Param body body object{user_id=integer,team_id=integer} true "Exactly one of user_id or team_id"
+// @Success 201 {object} object{participation=model.TrainingParticipation} "Participation created"
+// @Failure 400 {object} object{error=string} "Invalid input or training plan has ended"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Training plan, user or team not found"
+// @Failure 409 {object} object{error=string} "Already enrolled"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /training-plans/{id}/participants [post]
+// @id AddTrainingParticipant
+func (h *TrainingHandler) AddParticipant(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid training plan ID"})
+		return
+	}
+
+	var request struct {
+		UserID *uint `json:"user_id"`
+		TeamID *uint `json:"team_id"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (request.UserID == nil) == (request.TeamID == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of user_id or team_id is required"})
+		return
+	}
+
+	if _, err := h.trainingService.AuthorizePlan(middleware.Subject(c), policy.ActionManage, uint(id)); err != nil {
+		respondTrainingError(c, err, "Failed to add participant")
+		return
+	}
+
+	var participation *model.TrainingParticipation
+	if request.UserID != nil {
+		participation, err = h.trainingService.EnrollUser(uint(id), *request.UserID)
+	} else {
+		participation, err = h.trainingService.EnrollTeam(uint(id), *request.TeamID)
+	}
+	if err != nil {
+		respondTrainingError(c, err, "Failed to add participant")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"participation": participation})
+}
+
+// @Summary Remove a training plan participant
+// @Description Removes a participation from a training plan (author or training:manage)
+// @Tags training
+// @Accept json
+// @Produce json
+// @Param id path integer true "Training plan ID"
+// @Param participationId path integer true "Participation ID"
+// @Success 200 {object} object{message=string} "Participant removed successfully"
+// @Failure 400 {object} object{error=string} "Invalid ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Training plan or participation not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /training-plans/{id}/participants/{participationId} [delete]
+// @id RemoveTrainingParticipant
+func (h *TrainingHandler) RemoveParticipant(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid training plan ID"})
+		return
+	}
+
+	participationIDStr := c.Param("participationId")
+	participationID, err := strconv.ParseUint(participationIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid participation ID"})
+		return
+	}
+
+	if err := h.trainingService.RemoveParticipation(middleware.Subject(c), uint(id), uint(participationID)); err != nil {
+		respondTrainingError(c, err, "Failed to remove participant")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Participant removed successfully"})
+}
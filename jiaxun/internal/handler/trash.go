@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrashHandler handles HTTP requests related to deleted entities
+type TrashHandler struct {
+	trashService *service.TrashService
+}
+
+// NewTrashHandler creates a new trash handler and registers routes
+func NewTrashHandler(r *gin.Engine, trashService *service.TrashService) *TrashHandler {
+	handler := &TrashHandler{
+		trashService: trashService,
+	}
+
+	trash := r.Group("/api/trash")
+	trash.Use(middleware.AuthMiddleware(), middleware.RequirePermission(model.PermTrashManage))
+	{
+		trash.GET("/:kind", handler.ListTrash)
+		trash.POST("/:kind/:id/restore", handler.RestoreFromTrash)
+		trash.DELETE("/:kind/:id", handler.PurgeFromTrash)
+	}
+
+	return handler
+}
+
+// respondTrashError writes the HTTP response for a trash error
+func respondTrashError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrUnknownTrashKind):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown kind of deleted entity"})
+	case errors.Is(err, service.ErrNotInTrash):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found in the trash"})
+	case errors.Is(err, service.ErrUserAlreadyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken by another user"})
+	case errors.Is(err, service.ErrEmailAlreadyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use by another user"})
+	case errors.Is(err, service.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot purge the last admin"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary List deleted entities
+// @Description Returns the users, teams, contests or training plans in the trash, most recently deleted first, along with how many days they are kept before being purged (requires trash:manage)
+// @Tags trash
+// @Accept json
+// @Produce json
+// @Param kind path string true "Kind of entities" Enums(users, teams, contests, training-plans)
+// @Param page query integer false "Page number (default: 1)"
+// @Param page_size query integer false "Page size (default: 10, max: 100)"
+// @Success 200 {object} object{items=[]object,retention_days=integer,pagination=object{total=integer,page=integer,pageSize=integer}} "List of deleted entities"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Unknown kind"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /trash/{kind} [get]
+// @id ListTrash
+func (h *TrashHandler) ListTrash(c *gin.Context) {
+	page, pageSize := pagination(c)
+
+	items, total, err := h.trashService.List(c.Param("kind"), page, pageSize)
+	if err != nil {
+		respondTrashError(c, err, "Failed to list deleted entities")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":          items,
+		"retention_days": int(h.trashService.Retention().Hours() / 24),
+		"pagination": gin.H{
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// @Summary Restore a deleted entity
+// @Description Takes a user, team, contest or training plan out of the trash, together with its memberships, registrations and participations. A user cannot be restored while their username or email belongs to another user (requires trash:manage)
+// @Tags trash
+// @Accept json
+// @Produce json
+// @Param kind path string true "Kind of entity" Enums(users, teams, contests, training-plans)
+// @Param id path integer true "Entity ID"
+// @Success 200 {object} object{message=string} "Restored"
+// @Failure 400 {object} object{error=string} "Invalid ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Unknown kind or not in the trash"
+// @Failure 409 {object} object{error=string} "Username or email taken by another user"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /trash/{kind}/{id}/restore [post]
+// @id RestoreFromTrash
+func (h *TrashHandler) RestoreFromTrash(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := h.trashService.Restore(c.Param("kind"), uint(id)); err != nil {
+		respondTrashError(c, err, "Failed to restore")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Restored successfully"})
+}
+
+// @Summary Purge a deleted entity
+// @Description Permanently deletes a user, team, contest or training plan in the trash, together with its memberships, registrations and participations, without waiting for the retention period to end (requires trash:manage). An admin cannot be purged while no other admin is left.
+// @Tags trash
+// @Accept json
+// @Produce json
+// @Param kind path string true "Kind of entity" Enums(users, teams, contests, training-plans)
+// @Param id path integer true "Entity ID"
+// @Success 200 {object} object{message=string} "Purged"
+// @Failure 400 {object} object{error=string} "Invalid ID"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "Unknown kind or not in the trash"
+// @Failure 409 {object} object{error=string} "Last admin"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /trash/{kind}/{id} [delete]
+// @id PurgeFromTrash
+func (h *TrashHandler) PurgeFromTrash(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := h.trashService.Purge(c.Param("kind"), uint(id)); err != nil {
+		respondTrashError(c, err, "Failed to purge")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Purged successfully"})
+}
@@ -2,8 +2,12 @@ package handler
 
 import (
 	"errors"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"jiaxun/internal/middleware"
 	"jiaxun/internal/model"
@@ -14,13 +18,23 @@ import (
 
 // UserHandler handles HTTP requests related to users
 type UserHandler struct {
-	userService *service.UserService
+	userService         *service.UserService
+	authService         *service.AuthService
+	mfaService          *service.MFAService
+	registrationService *service.RegistrationService
+	loginThrottle       *service.LoginThrottleService
+	loginHistory        *service.LoginHistoryService
 }
 
 // NewUserHandler creates a new user handler and registers routes
-func NewUserHandler(r *gin.Engine, userService *service.UserService) *UserHandler {
+func NewUserHandler(r *gin.Engine, userService *service.UserService, authService *service.AuthService, mfaService *service.MFAService, registrationService *service.RegistrationService, loginThrottle *service.LoginThrottleService, loginHistory *service.LoginHistoryService) *UserHandler {
 	handler := &UserHandler{
-		userService: userService,
+		userService:         userService,
+		authService:         authService,
+		mfaService:          mfaService,
+		registrationService: registrationService,
+		loginThrottle:       loginThrottle,
+		loginHistory:        loginHistory,
 	}
 
 	// Public routes
@@ -37,29 +51,30 @@ func NewUserHandler(r *gin.Engine, userService *service.UserService) *UserHandle
 		users.GET("/me", handler.GetCurrentUser)
 		users.GET("/:id", handler.GetUser)
 
-		// These routes are accessible only to self and to teachers
+		// These routes are accessible only to self and to user administrators
 		userOwnerGroup := users.Group("/:id")
 		userOwnerGroup.Use(middleware.CanModifyUser())
 		{
 			userOwnerGroup.PUT("", handler.UpdateUser)
 			userOwnerGroup.DELETE("", handler.DeleteUser)
-		}
 
-		// Admin (teacher)-only routes
-		adminGroup := users.Group("")
-		adminGroup.Use(middleware.TeacherRequired())
-		{
-			adminGroup.GET("", handler.ListUsers)
-			adminGroup.POST("", handler.Register)
+			// The password and email of others are only set by user
+			// administrators, never with an access token
+			userOwnerGroup.PUT("/password", middleware.RequirePermission(model.PermUsersWrite), middleware.RequireSession(), handler.SetUserPassword)
+			userOwnerGroup.PUT("/email", middleware.RequirePermission(model.PermUsersWrite), middleware.RequireSession(), handler.SetUserEmail)
 		}
 
+		// Routes for user administrators
+		users.GET("", middleware.RequirePermission(model.PermUsersRead), handler.ListUsers)
+		users.POST("", middleware.RequirePermission(model.PermUsersWrite), handler.Register)
+
 	}
 
 	return handler
 }
 
 // @Summary Register a new user
-// @Description Creates a new user account (admin only)
+// @Description Creates a new user account (requires users:write)
 // @Tags users
 // @Accept json
 // @Produce json
@@ -108,14 +123,19 @@ func (h *UserHandler) Register(c *gin.Context) {
 }
 
 // @Summary User login
-// @Description Authenticates a user and returns a JWT token
+// @Description Authenticates a user and returns a short-lived access token together with a refresh token.
+// @Description The password is checked against each configured authenticator in turn: passwords stored by jiaxun, and LDAP directories whose users get an account on their first login.
+// @Description If the account has two-factor authentication enabled, no tokens are issued; instead a challenge token is returned that must be completed at /auth/2fa/verify.
+// @Description Repeated failures for an account or from an address slow down further attempts and eventually lock them temporarily.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param body body object{username=string,password=string} true "Login credentials"
-// @Success 200 {object} object{token=string,user=object{id=integer,username=string,email=string,fullName=string,role=string}} "Login successful"
+// @Success 200 {object} object{token=string,refresh_token=string,expires_at=string,session_id=string,mfa_setup_required=boolean,mfa_required=boolean,challenge_token=string,user=object{id=integer,username=string,email=string,fullName=string,role=string}} "Login successful or second factor required"
 // @Failure 400 {object} object{error=string} "Invalid input"
 // @Failure 401 {object} object{error=string} "Invalid credentials"
+// @Failure 403 {object} object{error=string} "Email address not verified"
+// @Failure 429 {object} object{error=string,retry_after=integer} "Too many failed attempts"
 // @Failure 500 {object} object{error=string} "Server error"
 // @id Login
 // @Router /auth/login [post]
@@ -130,25 +150,81 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Refuse attempts while the account or address is backing off or locked
+	client := clientInfo(c)
+	if err := h.loginThrottle.Check(request.Username, client.IP); err != nil {
+		respondThrottled(c, err)
+		return
+	}
+
 	user, err := h.userService.Authenticate(request.Username, request.Password)
 	if err != nil {
 		if errors.Is(err, service.ErrInvalidCredentials) {
+			if err := h.loginThrottle.RecordFailure(request.Username, client.IP); err != nil {
+				log.Printf("Failed to record failed login: %v", err)
+			}
+			h.recordFailure(request.Username, model.LoginFailureInvalidCredentials, client)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
+		// The attempt was not a wrong guess, so it no longer counts
+		if err := h.loginThrottle.Release(request.Username, client.IP); err != nil {
+			log.Printf("Failed to release login attempt: %v", err)
+		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			h.recordFailure(request.Username, model.LoginFailureEmailNotVerified, client)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email address has not been verified"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	// Accounts with two-factor authentication continue at /auth/2fa/verify,
+	// where failed logins are reset once the second factor is checked too
+	if h.mfaService.IsEnabled(user) {
+		if err := h.loginThrottle.Release(request.Username, client.IP); err != nil {
+			log.Printf("Failed to release login attempt: %v", err)
+		}
+		challenge, expiresAt, err := h.mfaService.NewChallenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+			"expires_at":      expiresAt,
+		})
+		return
+	}
+
+	if err := h.loginThrottle.RecordSuccess(user, client.IP); err != nil {
+		log.Printf("Failed to reset failed logins: %v", err)
+	}
+
+	setupRequired, err := h.mfaService.SetupRequired(user)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
 		return
 	}
 
-	// Generate JWT token
-	token, err := middleware.GenerateToken(user.ID, user.Email, user.Role)
+	// Start a new session
+	tokens, err := h.authService.IssueTokens(user, false, client)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
+	if err := h.loginHistory.RecordSuccess(user, tokens.SessionID, client); err != nil {
+		log.Printf("Failed to record login: %v", err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
+		"token":              tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_at":         tokens.ExpiresAt,
+		"session_id":         tokens.SessionID,
+		"mfa_setup_required": setupRequired,
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
@@ -159,6 +235,33 @@ func (h *UserHandler) Login(c *gin.Context) {
 	})
 }
 
+// respondThrottled writes the HTTP response for a login attempt refused by
+// the login throttle
+func respondThrottled(c *gin.Context, err error) {
+	var throttled *service.ThrottledError
+	if errors.As(err, &throttled) {
+		message := "Too many failed login attempts, please try again later"
+		if throttled.Locked {
+			message = "Login is temporarily locked after too many failed attempts"
+		}
+		retryAfter := int(math.Ceil(throttled.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       message,
+			"retry_after": retryAfter,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
+}
+
+// recordFailure adds a failed login to the login history
+func (h *UserHandler) recordFailure(login, reason string, client service.ClientInfo) {
+	if err := h.loginHistory.RecordFailure(login, reason, client); err != nil {
+		log.Printf("Failed to record failed login: %v", err)
+	}
+}
+
 // @Summary Get user by ID
 // @Description Retrieves a user's profile by their ID
 // @Tags users
@@ -227,17 +330,19 @@ func (h *UserHandler) GetCurrentUser(c *gin.Context) {
 }
 
 // @Summary Update user
-// @Description Updates a user's profile information
+// @Description Updates a user's profile information. Users may update themselves, administrators with users:write anyone whose role grants nothing they lack; with an access token, only users:write applies and the password and email cannot be changed.
+// @Description Only users change their own password and email here; administrators set those of others through /users/{id}/password and /users/{id}/email. Without users:write, a new email address must be in an allowed domain and only replaces the current one once the link emailed to it has been followed (see /auth/confirm-email).
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path integer true "User ID"
 // @Param body body object{email=string,password=string,full_name=string} false "Fields to update"
-// @Success 200 {object} object{user=model.User} "Updated user"
+// @Success 200 {object} object{user=model.User,pending_email=string} "Updated user, with the address awaiting confirmation if any"
 // @Failure 400 {object} object{error=string} "Invalid input"
 // @Failure 401 {object} object{error=string} "Unauthorized"
-// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 403 {object} object{error=string} "Forbidden or email domain not allowed"
 // @Failure 404 {object} object{error=string} "User not found"
+// @Failure 409 {object} object{error=string} "Email already in use"
 // @Failure 500 {object} object{error=string} "Server error"
 // @Router /users/{id} [put]
 // @id UpdateUser
@@ -251,7 +356,7 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	}
 
 	var request struct {
-		Email    string `json:"email"`
+		Email    string `json:"email" binding:"omitempty,email"`
 		Password string `json:"password"`
 		FullName string `json:"full_name"`
 	}
@@ -261,6 +366,18 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// A leaked token must not be enough to take over an account
+	if middleware.ViaAccessToken(c) && (request.Email != "" || request.Password != "") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The password and email cannot be changed with an access token"})
+		return
+	}
+
+	// Taking over another account goes through the dedicated routes
+	if userID, _ := c.Get("userID"); userID != uint(id) && (request.Email != "" || request.Password != "") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The password and email of another user are set through their own routes"})
+		return
+	}
+
 	// Get existing user
 	user, err := h.userService.GetByID(uint(id))
 	if err != nil {
@@ -272,6 +389,26 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// Users must prove they control a new address before it replaces the
+	// current one; user administrators set it directly
+	pendingEmail := ""
+	if request.Email != "" && !strings.EqualFold(request.Email, user.Email) &&
+		!model.HasPermission(middleware.Permissions(c), model.PermUsersWrite) {
+		if err := h.registrationService.RequestEmailChange(user, request.Email); err != nil {
+			switch {
+			case errors.Is(err, service.ErrEmailDomainNotAllowed):
+				c.JSON(http.StatusForbidden, gin.H{"error": "Email domain is not allowed"})
+			case errors.Is(err, service.ErrEmailAlreadyExists):
+				c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use by another user"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send the confirmation email"})
+			}
+			return
+		}
+		pendingEmail = request.Email
+		request.Email = ""
+	}
+
 	// Update fields if provided
 	if request.Email != "" {
 		user.Email = request.Email
@@ -284,6 +421,10 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	}
 
 	if err := h.userService.Update(user); err != nil {
+		if errors.Is(err, service.ErrEmailAlreadyExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use by another user"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
@@ -291,11 +432,15 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	// Don't return the password
 	user.Password = ""
 
+	if pendingEmail != "" {
+		c.JSON(http.StatusOK, gin.H{"user": user, "pending_email": pendingEmail})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
 // @Summary Delete user
-// @Description Removes a user account
+// @Description Moves a user account to the trash and ends its sessions. It can be restored with its memberships, registrations and participations until it is purged. The last admin cannot be deleted.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -305,6 +450,7 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 // @Failure 401 {object} object{error=string} "Unauthorized"
 // @Failure 403 {object} object{error=string} "Forbidden"
 // @Failure 404 {object} object{error=string} "User not found"
+// @Failure 409 {object} object{error=string} "Last admin"
 // @Failure 500 {object} object{error=string} "Server error"
 // @Router /users/{id} [delete]
 // @id DeleteUser
@@ -322,21 +468,151 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
+		if errors.Is(err, service.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot delete the last admin"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
 
+	// A restored user signs in again rather than resuming old sessions
+	if err := h.authService.RevokeAllSessions(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end the user's sessions"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
-// @Summary List users
-// @Description Returns a paginated list of users (teachers only)
+// @Summary Set a user's password
+// @Description Sets the password of a user and ends their sessions (requires users:write, and a role granting everything the user's role does). Not available with an access token.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param body body object{password=string} true "New password"
+// @Success 200 {object} object{message=string} "Password set"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User not found"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/password [put]
+// @id SetUserPassword
+func (h *UserHandler) SetUserPassword(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request struct {
+		Password string `json:"password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.GetByID(uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+	if err := h.userService.SetPassword(user, request.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set the password"})
+		return
+	}
+
+	// Whoever knew the old password signs in again
+	if err := h.authService.RevokeAllSessions(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end the user's sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password set"})
+}
+
+// @Summary Set a user's email
+// @Description Sets the email address of a user directly, as verified (requires users:write, and a role granting everything the user's role does). Not available with an access token.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "User ID"
+// @Param body body object{email=string} true "New email address"
+// @Success 200 {object} object{user=model.User} "Updated user"
+// @Failure 400 {object} object{error=string} "Invalid input"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 404 {object} object{error=string} "User not found"
+// @Failure 409 {object} object{error=string} "Email already in use"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/{id}/email [put]
+// @id SetUserEmail
+func (h *UserHandler) SetUserEmail(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.GetByID(uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+	if err := h.userService.SetEmail(user, request.Email); err != nil {
+		if errors.Is(err, service.ErrEmailAlreadyExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use by another user"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set the email"})
+		return
+	}
+
+	// Don't return the password
+	user.Password = ""
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// @Summary List and search users
+// @Description Returns a paginated list of users matching all the given filters (requires users:read)
 // @Tags users
 // @Accept json
 // @Produce json
+// @Param q query string false "Part of the username, email or full name, ignoring case"
+// @Param role query []string false "Only users with one of these roles" collectionFormat(multi)
+// @Param status query string false "Only users with this status (active or pending)"
+// @Param team_id query integer false "Only members of this team"
+// @Param contest_id query integer false "Only users registered for this contest, themselves or through a team"
+// @Param training_plan_id query integer false "Only users enrolled in this training plan, themselves or through a team"
+// @Param handle query string false "Part of the handle of one of the user's judge accounts, ignoring case"
+// @Param platform query string false "Only match handles on this judge (codeforces, atcoder, leetcode or luogu); alone, only users with an account there"
+// @Param created_after query string false "Only users created at or after this time (RFC 3339 or YYYY-MM-DD)"
+// @Param created_before query string false "Only users created before this time (RFC 3339 or YYYY-MM-DD)"
+// @Param sort query string false "Comma-separated fields among id, username, email, full_name, role and created_at, each prefixed with - for descending order (default: id)"
 // @Param page query integer false "Page number (default: 1)"
 // @Param page_size query integer false "Page size (default: 10, max: 100)"
-// @Success 200 {object} array{User} "List of users"
+// @Success 200 {object} object{users=[]model.User,pagination=object{total=integer,page=integer,pageSize=integer}} "List of users"
+// @Failure 400 {object} object{error=string} "Invalid filter, platform or sort field"
 // @Failure 401 {object} object{error=string} "Unauthorized"
 // @Failure 403 {object} object{error=string} "Forbidden"
 // @Failure 500 {object} object{error=string} "Server error"
@@ -357,15 +633,56 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 		pageSize = 10
 	}
 
-	users, total, err := h.userService.List(page, pageSize)
+	// Parse the filters
+	query := service.UserQuery{
+		Q:        c.Query("q"),
+		Roles:    c.QueryArray("role"),
+		Status:   c.Query("status"),
+		Handle:   c.Query("handle"),
+		Platform: c.Query("platform"),
+		Sort:     c.Query("sort"),
+	}
+	for name, id := range map[string]*uint{
+		"team_id":          &query.TeamID,
+		"contest_id":       &query.ContestID,
+		"training_plan_id": &query.TrainingPlanID,
+	} {
+		if value := c.Query(name); value != "" {
+			parsed, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+				return
+			}
+			*id = uint(parsed)
+		}
+	}
+	for name, at := range map[string]**time.Time{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+	} {
+		if value := c.Query(name); value != "" {
+			parsed, err := parseTimeParam(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + ": use RFC 3339 or YYYY-MM-DD"})
+				return
+			}
+			*at = &parsed
+		}
+	}
+
+	users, total, err := h.userService.Search(query, page, pageSize)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidSortField) || errors.Is(err, service.ErrUnknownJudgePlatform) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
 		return
 	}
 
 	// Remove passwords from response
-	for _, user := range users {
-		user.Password = ""
+	for i := range users {
+		users[i].Password = ""
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -377,3 +694,12 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 		},
 	})
 }
+
+// parseTimeParam parses a time given as RFC 3339 or as a date, which means
+// midnight UTC
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportFileSize caps the size of uploaded import files
+const maxImportFileSize = 5 << 20
+
+// Content types of exported tables
+var tableContentTypes = map[string]string{
+	service.TableFormatCSV:  "text/csv; charset=utf-8",
+	service.TableFormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// UserImportHandler handles HTTP requests for importing and exporting users
+type UserImportHandler struct {
+	userImportService *service.UserImportService
+}
+
+// NewUserImportHandler creates a new user import handler and registers routes
+func NewUserImportHandler(r *gin.Engine, userImportService *service.UserImportService) *UserImportHandler {
+	handler := &UserImportHandler{
+		userImportService: userImportService,
+	}
+
+	users := r.Group("/api/users")
+	users.Use(middleware.AuthMiddleware())
+	{
+		users.POST("/import", middleware.RequirePermission(model.PermUsersWrite), handler.ImportUsers)
+		users.GET("/export", middleware.RequirePermission(model.PermUsersRead), handler.ExportUsers)
+	}
+
+	return handler
+}
+
+// respondUserImportError writes the HTTP response for an import error
+func respondUserImportError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidImportFile),
+		errors.Is(err, service.ErrUnknownTableFormat),
+		errors.Is(err, service.ErrUnknownPasswordMode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTooManyImportRows):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d users can be imported at once", service.MaxImportRows)})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary Import users
+// @Description Creates users from a CSV or XLSX file (requires users:write). The first row names the columns: username and email are required; full_name, role and password are optional, and other columns are ignored, so an export can be imported elsewhere. Setting roles other than student requires roles:manage.
+// @Description Every row is checked first, and users are only created if all rows are valid, in a single transaction. With dry_run, nothing is created and the checked rows are returned.
+// @Description Rows without a password get a random one: with password_mode=generate it is returned once in the response, with password_mode=invite the user is emailed a link to choose their own.
+// @Tags users
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV or XLSX file, at most 5 MB and 500 users"
+// @Param format formData string false "csv or xlsx (default: from the file name)"
+// @Param dry_run formData boolean false "Only validate the rows"
+// @Param password_mode formData string false "generate or invite (default: generate)"
+// @Success 200 {object} service.UserImportResult "Validated rows (dry run)"
+// @Success 201 {object} service.UserImportResult "Created users"
+// @Failure 400 {object} object{error=string} "Invalid file or parameters"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 422 {object} object{error=string,rows=[]service.UserImportRow} "Some rows are invalid; nothing was created"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/import [post]
+// @id ImportUsers
+func (h *UserImportHandler) ImportUsers(c *gin.Context) {
+	// Leave room for the rest of the form around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize+(1<<20))
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An import file is required"})
+		return
+	}
+	if header.Size > maxImportFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The import file is too large"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the import file"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the import file"})
+		return
+	}
+
+	format := strings.ToLower(c.PostForm("format"))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	}
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", "false"))
+
+	result, err := h.userImportService.Import(format, data, service.UserImportOptions{
+		DryRun:         dryRun,
+		PasswordMode:   c.PostForm("password_mode"),
+		CanAssignRoles: model.HasPermission(middleware.Permissions(c), model.PermRolesManage),
+	})
+	if errors.Is(err, service.ErrInvalidImportRows) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Some rows are invalid; no user was created", "rows": result.Rows})
+		return
+	}
+	if err != nil {
+		respondUserImportError(c, err, "Failed to import users")
+		return
+	}
+
+	if dryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+// @Summary Export users
+// @Description Downloads every user as a CSV or XLSX file, without passwords (requires users:read)
+// @Tags users
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param format query string false "csv or xlsx (default: csv)"
+// @Success 200 {file} file "User table"
+// @Failure 400 {object} object{error=string} "Unknown format"
+// @Failure 401 {object} object{error=string} "Unauthorized"
+// @Failure 403 {object} object{error=string} "Forbidden"
+// @Failure 500 {object} object{error=string} "Server error"
+// @Router /users/export [get]
+// @id ExportUsers
+func (h *UserImportHandler) ExportUsers(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", service.TableFormatCSV))
+	contentType, ok := tableContentTypes[format]
+	if !ok {
+		respondUserImportError(c, service.ErrUnknownTableFormat, "")
+		return
+	}
+
+	// The table is built before anything is written, so that errors can
+	// still be reported as JSON
+	var buf bytes.Buffer
+	if err := h.userImportService.Export(&buf, format); err != nil {
+		respondUserImportError(c, err, "Failed to export users")
+		return
+	}
+
+	filename := fmt.Sprintf("users-%s.%s", time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
@@ -0,0 +1,35 @@
+package judge
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AtCoder verifies handles on their AtCoder profile page, which shows the
+// affiliation users set. AtCoder has no public API for profiles.
+type AtCoder struct {
+	BaseURL string
+	Client  *http.Client
+	Limiter *Limiter
+}
+
+// Instructions tells users where to put the challenge on their profile
+func (a *AtCoder) Instructions() string {
+	return "Set your affiliation at " + a.BaseURL + "/settings to the challenge, then verify. You can change it back afterwards."
+}
+
+// Verify reports whether the profile of a handle shows the challenge
+func (a *AtCoder) Verify(ctx context.Context, handle, challenge string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.BaseURL+"/users/"+url.PathEscape(handle), nil)
+	if err != nil {
+		return false, err
+	}
+	page, err := fetch(a.Client, a.Limiter, req)
+	if err != nil {
+		return false, err
+	}
+	// Challenges are plain letters, digits and dashes, which HTML leaves alone
+	return strings.Contains(string(page), challenge), nil
+}
@@ -0,0 +1,247 @@
+package judge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"jiaxun/internal/model"
+)
+
+// codeforcesPageSize is how many submissions are fetched per request
+const codeforcesPageSize = 500
+
+// codeforcesRetries is how many times a call refused for exceeding the
+// rate limit is retried
+const codeforcesRetries = 3
+
+// errCallLimitExceeded is returned for calls refused for exceeding the
+// rate limit
+var errCallLimitExceeded = errors.New("codeforces: call limit exceeded")
+
+// Codeforces verifies handles and fetches their submissions through the
+// Codeforces API, which returns the names and organization users set in
+// their profile
+type Codeforces struct {
+	BaseURL string
+	Client  *http.Client
+	Limiter *Limiter
+	// PageSize is how many submissions are fetched per request,
+	// codeforcesPageSize if zero
+	PageSize int
+}
+
+// Instructions tells users where to put the challenge on their profile
+func (c *Codeforces) Instructions() string {
+	return "Set your first name, last name or organization at " + c.BaseURL + "/settings/social to the challenge, then verify. You can change it back afterwards."
+}
+
+// Verify reports whether the profile of a handle shows the challenge
+func (c *Codeforces) Verify(ctx context.Context, handle, challenge string) (bool, error) {
+	var users []struct {
+		Handle       string `json:"handle"`
+		FirstName    string `json:"firstName"`
+		LastName     string `json:"lastName"`
+		Organization string `json:"organization"`
+	}
+	if err := c.call(ctx, "user.info", url.Values{"handles": {handle}}, &users); err != nil {
+		return false, err
+	}
+	if len(users) != 1 {
+		return false, ErrHandleNotFound
+	}
+
+	user := users[0]
+	return anyContains(challenge, user.FirstName, user.LastName, user.Organization), nil
+}
+
+// codeforcesSubmission is a submission as returned by user.status
+type codeforcesSubmission struct {
+	ID                  int64  `json:"id"`
+	CreationTimeSeconds int64  `json:"creationTimeSeconds"`
+	ProgrammingLanguage string `json:"programmingLanguage"`
+	Verdict             string `json:"verdict"`
+	Problem             struct {
+		ContestID      int      `json:"contestId"`
+		ProblemsetName string   `json:"problemsetName"`
+		Index          string   `json:"index"`
+		Name           string   `json:"name"`
+		Rating         int      `json:"rating"`
+		Tags           []string `json:"tags"`
+	} `json:"problem"`
+}
+
+// Submissions returns the judged submissions of a handle made since the
+// cursor, which is the ID of the last submission synced. Submissions are
+// listed newest first, so pages are fetched until the cursor is reached;
+// submissions made meanwhile shift the pages, so the same submission may be
+// listed twice.
+func (c *Codeforces) Submissions(ctx context.Context, handle, cursor string) ([]Submission, string, error) {
+	var after int64
+	if cursor != "" {
+		var err error
+		if after, err = strconv.ParseInt(cursor, 10, 64); err != nil {
+			return nil, "", fmt.Errorf("codeforces: invalid cursor %q", cursor)
+		}
+	}
+
+	pageSize := c.PageSize
+	if pageSize <= 0 {
+		pageSize = codeforcesPageSize
+	}
+
+	var submissions []Submission
+	seen := make(map[int64]bool)
+	newest, judging := after, int64(0)
+	for from, done := 1, false; !done; from += pageSize {
+		var page []codeforcesSubmission
+		params := url.Values{
+			"handle": {handle},
+			"from":   {strconv.Itoa(from)},
+			"count":  {strconv.Itoa(pageSize)},
+		}
+		if err := c.call(ctx, "user.status", params, &page); err != nil {
+			return nil, "", err
+		}
+
+		done = len(page) < pageSize
+		for _, s := range page {
+			if s.ID <= after {
+				done = true
+				break
+			}
+			if seen[s.ID] {
+				continue
+			}
+			seen[s.ID] = true
+			if s.ID > newest {
+				newest = s.ID
+			}
+			verdict, judged := codeforcesVerdict(s.Verdict)
+			if !judged {
+				judging = s.ID
+				continue
+			}
+			submissions = append(submissions, Submission{
+				ExternalID:  strconv.FormatInt(s.ID, 10),
+				Problem:     c.problem(s),
+				Verdict:     verdict,
+				Language:    s.ProgrammingLanguage,
+				SubmittedAt: time.Unix(s.CreationTimeSeconds, 0),
+			})
+		}
+	}
+
+	// Oldest first
+	for i, j := 0, len(submissions)-1; i < j; i, j = i+1, j-1 {
+		submissions[i], submissions[j] = submissions[j], submissions[i]
+	}
+	// Resume before the oldest submission still being judged
+	if judging != 0 {
+		newest = judging - 1
+	}
+	return submissions, strconv.FormatInt(newest, 10), nil
+}
+
+// problem returns the problem of a submission. Problems outside contests
+// belong to a problemset instead.
+func (c *Codeforces) problem(s codeforcesSubmission) Problem {
+	p := Problem{
+		Name:   s.Problem.Name,
+		Rating: s.Problem.Rating,
+		Tags:   s.Problem.Tags,
+	}
+	switch {
+	case s.Problem.ContestID == 0:
+		p.ExternalID = s.Problem.ProblemsetName + "/" + s.Problem.Index
+		p.URL = fmt.Sprintf("%s/problemsets/%s/problem/99999/%s", c.BaseURL, s.Problem.ProblemsetName, s.Problem.Index)
+	case s.Problem.ContestID >= 100000:
+		p.ExternalID = strconv.Itoa(s.Problem.ContestID) + s.Problem.Index
+		p.URL = fmt.Sprintf("%s/gym/%d/problem/%s", c.BaseURL, s.Problem.ContestID, s.Problem.Index)
+	default:
+		p.ExternalID = strconv.Itoa(s.Problem.ContestID) + s.Problem.Index
+		p.URL = fmt.Sprintf("%s/contest/%d/problem/%s", c.BaseURL, s.Problem.ContestID, s.Problem.Index)
+	}
+	return p
+}
+
+// codeforcesVerdict normalizes a verdict, reporting false for submissions
+// still being judged
+func codeforcesVerdict(verdict string) (string, bool) {
+	switch verdict {
+	case "", "TESTING", "SUBMITTED":
+		return "", false
+	case "OK":
+		return model.VerdictAccepted, true
+	case "WRONG_ANSWER":
+		return model.VerdictWrongAnswer, true
+	case "TIME_LIMIT_EXCEEDED", "IDLENESS_LIMIT_EXCEEDED":
+		return model.VerdictTimeLimitExceeded, true
+	case "MEMORY_LIMIT_EXCEEDED":
+		return model.VerdictMemoryLimitExceeded, true
+	case "RUNTIME_ERROR":
+		return model.VerdictRuntimeError, true
+	case "COMPILATION_ERROR":
+		return model.VerdictCompilationError, true
+	default:
+		return model.VerdictOther, true
+	}
+}
+
+// call calls an API method and decodes its result. Calls refused for
+// exceeding the rate limit are retried after backing off.
+func (c *Codeforces) call(ctx context.Context, method string, params url.Values, result interface{}) error {
+	for refusals := 1; ; refusals++ {
+		err := c.callOnce(ctx, method, params, result)
+		if !errors.Is(err, errCallLimitExceeded) || refusals > codeforcesRetries {
+			return err
+		}
+		c.Limiter.Backoff(refusals)
+	}
+}
+
+// callOnce calls an API method once. Failures are answered with 400 Bad
+// Request and explained in a comment, except for calls exceeding the rate
+// limit, which are answered with 503 Service Unavailable.
+func (c *Codeforces) callOnce(ctx context.Context, method string, params url.Values, result interface{}) error {
+	if err := c.Limiter.Wait(ctx); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/"+method+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "jiaxun")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status  string          `json:"status"`
+		Comment string          `json:"comment"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&body); err != nil {
+		return fmt.Errorf("codeforces: %s: %w", resp.Status, err)
+	}
+	if body.Status != "OK" {
+		if strings.Contains(body.Comment, "not found") {
+			return ErrHandleNotFound
+		}
+		if strings.Contains(body.Comment, "Call limit exceeded") {
+			return errCallLimitExceeded
+		}
+		return fmt.Errorf("codeforces: %s: %s", resp.Status, body.Comment)
+	}
+	return json.Unmarshal(body.Result, result)
+}
@@ -0,0 +1,195 @@
+// Package judge talks to online judges: it checks that users own their
+// handles and fetches the submissions made with them.
+//
+// A user proves ownership by putting a challenge string on the public
+// profile of their handle, where only its owner can write; each platform
+// has a Verifier that reads the profile back. Platforms with a public
+// submission history also implement SubmissionSource. Both talk to the
+// platform at a configurable base URL, so that they can be pointed at a
+// mirror or at a test server, and space out their requests to honor the
+// platform's rate limit.
+package judge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/model"
+)
+
+// ErrHandleNotFound is returned for handles that do not exist on the platform
+var ErrHandleNotFound = errors.New("judge: handle not found")
+
+// maxResponseSize bounds the size of the profiles that are read
+const maxResponseSize = 2 << 20
+
+// Verifier reads the public profile of handles on one platform
+type Verifier interface {
+	// Instructions tells users where to put the challenge on their profile
+	Instructions() string
+	// Verify reports whether the profile of a handle shows the challenge
+	Verify(ctx context.Context, handle, challenge string) (bool, error)
+}
+
+// Default addresses of the platforms
+var defaultBaseURLs = map[string]string{
+	model.JudgePlatformCodeforces: "https://codeforces.com",
+	model.JudgePlatformAtCoder:    "https://atcoder.jp",
+	model.JudgePlatformLeetCode:   "https://leetcode.com",
+	model.JudgePlatformLuogu:      "https://www.luogu.com.cn",
+}
+
+// Default time between two requests to a platform, within the rate limits
+// the platforms publish or enforce
+var defaultRequestIntervals = map[string]time.Duration{
+	model.JudgePlatformCodeforces: 2 * time.Second,
+	model.JudgePlatformAtCoder:    time.Second,
+	model.JudgePlatformLeetCode:   time.Second,
+	model.JudgePlatformLuogu:      time.Second,
+}
+
+// New returns a verifier for every supported platform, at the base URLs
+// configured or else at the platforms' own addresses. Verifiers that can
+// also fetch submissions implement SubmissionSource and share the rate
+// limit of their platform.
+func New(cfg config.JudgeConfig, client *http.Client) (map[string]Verifier, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	for platform := range cfg.BaseURLs {
+		if !model.IsJudgePlatform(platform) {
+			return nil, fmt.Errorf("judge: unknown platform %q", platform)
+		}
+	}
+	for platform := range cfg.RequestIntervalsMs {
+		if !model.IsJudgePlatform(platform) {
+			return nil, fmt.Errorf("judge: unknown platform %q", platform)
+		}
+	}
+	baseURL := func(platform string) string {
+		if u := cfg.BaseURLs[platform]; u != "" {
+			return strings.TrimSuffix(u, "/")
+		}
+		return defaultBaseURLs[platform]
+	}
+	limiter := func(platform string) *Limiter {
+		if ms, ok := cfg.RequestIntervalsMs[platform]; ok {
+			return NewLimiter(time.Duration(ms) * time.Millisecond)
+		}
+		return NewLimiter(defaultRequestIntervals[platform])
+	}
+
+	return map[string]Verifier{
+		model.JudgePlatformCodeforces: &Codeforces{BaseURL: baseURL(model.JudgePlatformCodeforces), Client: client, Limiter: limiter(model.JudgePlatformCodeforces)},
+		model.JudgePlatformAtCoder:    &AtCoder{BaseURL: baseURL(model.JudgePlatformAtCoder), Client: client, Limiter: limiter(model.JudgePlatformAtCoder)},
+		model.JudgePlatformLeetCode:   &LeetCode{BaseURL: baseURL(model.JudgePlatformLeetCode), Client: client, Limiter: limiter(model.JudgePlatformLeetCode)},
+		model.JudgePlatformLuogu:      &Luogu{BaseURL: baseURL(model.JudgePlatformLuogu), Client: client, Limiter: limiter(model.JudgePlatformLuogu)},
+	}, nil
+}
+
+// Limiter spaces out the requests made to a platform. A nil Limiter does
+// not limit anything.
+type Limiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+}
+
+// NewLimiter returns a limiter letting one request through per interval
+func NewLimiter(interval time.Duration) *Limiter {
+	return &Limiter{interval: interval}
+}
+
+// Wait blocks until the next request may be made or the context is done
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil || l.interval <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	if wait := time.Until(at); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Backoff holds back the next request after the platform refused one for
+// exceeding its rate limit, for twice as long after each refusal in a row
+func (l *Limiter) Backoff(refusals int) {
+	if l == nil || l.interval <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if at := time.Now().Add(l.interval << refusals); at.After(l.next) {
+		l.next = at
+	}
+}
+
+// fetch sends a request once the limiter lets it through and returns the
+// response body. Not Found is reported as ErrHandleNotFound.
+func fetch(client *http.Client, limiter *Limiter, req *http.Request) ([]byte, error) {
+	if err := limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "jiaxun")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrHandleNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL.Redacted(), resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+// getJSON fetches and decodes a JSON document
+func getJSON(ctx context.Context, client *http.Client, limiter *Limiter, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	data, err := fetch(client, limiter, req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// anyContains reports whether one of the fields contains the challenge
+func anyContains(challenge string, fields ...string) bool {
+	for _, field := range fields {
+		if strings.Contains(field, challenge) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package judge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// leetCodeProfileQuery reads the public profile of a user
+const leetCodeProfileQuery = `query userProfile($username: String!) {
+  matchedUser(username: $username) {
+    profile {
+      realName
+      aboutMe
+    }
+  }
+}`
+
+// LeetCode verifies handles through the GraphQL API behind leetcode.com,
+// which returns the name and summary users set in their profile
+type LeetCode struct {
+	BaseURL string
+	Client  *http.Client
+	Limiter *Limiter
+}
+
+// Instructions tells users where to put the challenge on their profile
+func (l *LeetCode) Instructions() string {
+	return "Add the challenge to the summary of your profile at " + l.BaseURL + "/profile/, then verify. You can remove it afterwards."
+}
+
+// Verify reports whether the profile of a handle shows the challenge
+func (l *LeetCode) Verify(ctx context.Context, handle, challenge string) (bool, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"query":     leetCodeProfileQuery,
+		"variables": map[string]string{"username": handle},
+	})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.BaseURL+"/graphql", bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Referer", l.BaseURL)
+	data, err := fetch(l.Client, l.Limiter, req)
+	if err != nil {
+		return false, err
+	}
+
+	var body struct {
+		Data struct {
+			MatchedUser *struct {
+				Profile struct {
+					RealName string `json:"realName"`
+					AboutMe  string `json:"aboutMe"`
+				} `json:"profile"`
+			} `json:"matchedUser"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return false, fmt.Errorf("leetcode: %w", err)
+	}
+	// Unknown users come back as a null user, sometimes with an error
+	if body.Data.MatchedUser == nil {
+		if len(body.Errors) > 0 && !isLeetCodeUnknownUser(body.Errors[0].Message) {
+			return false, fmt.Errorf("leetcode: %s", body.Errors[0].Message)
+		}
+		return false, ErrHandleNotFound
+	}
+
+	profile := body.Data.MatchedUser.Profile
+	return anyContains(challenge, profile.RealName, profile.AboutMe), nil
+}
+
+// isLeetCodeUnknownUser reports whether a GraphQL error is about a user
+// that does not exist
+func isLeetCodeUnknownUser(message string) bool {
+	return strings.Contains(strings.ToLower(message), "does not exist")
+}
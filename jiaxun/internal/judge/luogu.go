@@ -0,0 +1,44 @@
+package judge
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Luogu verifies handles through the user search of Luogu, which returns
+// the signature users set in their profile
+type Luogu struct {
+	BaseURL string
+	Client  *http.Client
+	Limiter *Limiter
+}
+
+// Instructions tells users where to put the challenge on their profile
+func (l *Luogu) Instructions() string {
+	return "Set your personal signature at " + l.BaseURL + "/user/setting to the challenge, then verify. You can change it back afterwards."
+}
+
+// Verify reports whether the profile of a handle shows the challenge
+func (l *Luogu) Verify(ctx context.Context, handle, challenge string) (bool, error) {
+	var body struct {
+		Users []*struct {
+			UID    int    `json:"uid"`
+			Name   string `json:"name"`
+			Slogan string `json:"slogan"`
+		} `json:"users"`
+	}
+	target := l.BaseURL + "/api/user/search?" + url.Values{"keyword": {handle}}.Encode()
+	if err := getJSON(ctx, l.Client, l.Limiter, target, &body); err != nil {
+		return false, err
+	}
+
+	// The search matches names exactly but also returns null entries
+	for _, user := range body.Users {
+		if user != nil && strings.EqualFold(user.Name, handle) {
+			return anyContains(challenge, user.Slogan), nil
+		}
+	}
+	return false, ErrHandleNotFound
+}
@@ -0,0 +1,51 @@
+package judge
+
+import (
+	"context"
+	"time"
+)
+
+// Problem is a problem on an online judge
+type Problem struct {
+	// ExternalID identifies the problem on its platform
+	ExternalID string
+	Name       string
+	URL        string
+	// Rating is the difficulty of the problem, zero if unrated
+	Rating int
+	Tags   []string
+}
+
+// Submission is a judged submission on an online judge, normalized across
+// platforms
+type Submission struct {
+	// ExternalID identifies the submission on its platform
+	ExternalID string
+	Problem    Problem
+	// Verdict is one of the model.Verdict constants
+	Verdict     string
+	Language    string
+	SubmittedAt time.Time
+}
+
+// SubmissionSource fetches the submissions of handles on one platform
+type SubmissionSource interface {
+	// Submissions returns the judged submissions of a handle made since the
+	// cursor, oldest first, and the cursor to resume from next time. An
+	// empty cursor fetches every submission. Submissions still being judged
+	// are left for a later sync, so the same submission may be returned
+	// more than once.
+	Submissions(ctx context.Context, handle, cursor string) ([]Submission, string, error)
+}
+
+// Sources returns the verifiers that can also fetch submissions, keyed by
+// platform
+func Sources(verifiers map[string]Verifier) map[string]SubmissionSource {
+	sources := make(map[string]SubmissionSource)
+	for platform, verifier := range verifiers {
+		if source, ok := verifier.(SubmissionSource); ok {
+			sources[platform] = source
+		}
+	}
+	return sources
+}
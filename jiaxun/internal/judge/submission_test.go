@@ -0,0 +1,203 @@
+package judge
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"jiaxun/internal/model"
+)
+
+// recordedPageSize is the page size the user.status pages were recorded with
+const recordedPageSize = 3
+
+// routeUserStatus serves the recorded user.status pages of tourist, which
+// list submissions 1009 (still being judged) down to 1003. Submission 1007
+// is listed on the first two pages, as it is when a submission is made
+// while paging.
+func routeUserStatus(t *testing.T, r *http.Request) response {
+	query := r.URL.Query()
+	if r.URL.Path != "/api/user.status" || query.Get("handle") != "tourist" {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		return response{status: http.StatusNotFound}
+	}
+	if count := query.Get("count"); count != "3" {
+		t.Errorf("requested %s submissions, want 3", count)
+	}
+	switch from := query.Get("from"); from {
+	case "1", "4", "7":
+		return response{http.StatusOK, "codeforces/user.status_" + from + ".json"}
+	default:
+		t.Errorf("requested the page from %s", from)
+		return response{http.StatusOK, "codeforces/user.status_7.json"}
+	}
+}
+
+func TestCodeforcesSubmissions(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+		// want lists the IDs of the submissions returned
+		want       []string
+		wantCursor string
+		wantPages  []string
+	}{
+		{
+			name:       "first sync",
+			want:       []string{"1003", "1004", "1005", "1006", "1007", "1008"},
+			wantCursor: "1008",
+			wantPages:  []string{"1", "4", "7"},
+		},
+		{
+			name:       "stops at the cursor",
+			cursor:     "1005",
+			want:       []string{"1006", "1007", "1008"},
+			wantCursor: "1008",
+			wantPages:  []string{"1", "4"},
+		},
+		{
+			name:       "waits for the submission being judged",
+			cursor:     "1008",
+			wantCursor: "1008",
+			wantPages:  []string{"1"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var pages []string
+			server := serveRecorded(t, func(t *testing.T, r *http.Request) response {
+				mu.Lock()
+				pages = append(pages, r.URL.Query().Get("from"))
+				mu.Unlock()
+				return routeUserStatus(t, r)
+			})
+			cf := &Codeforces{BaseURL: server.URL, Client: http.DefaultClient, PageSize: recordedPageSize}
+
+			submissions, cursor, err := cf.Submissions(context.Background(), "tourist", tc.cursor)
+			if err != nil {
+				t.Fatalf("Submissions: %v", err)
+			}
+			var got []string
+			for _, s := range submissions {
+				got = append(got, s.ExternalID)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Submissions returned %v, want %v", got, tc.want)
+			}
+			if cursor != tc.wantCursor {
+				t.Errorf("cursor = %q, want %q", cursor, tc.wantCursor)
+			}
+			if !reflect.DeepEqual(pages, tc.wantPages) {
+				t.Errorf("fetched the pages from %v, want %v", pages, tc.wantPages)
+			}
+		})
+	}
+}
+
+func TestCodeforcesSubmissionsNormalized(t *testing.T) {
+	server := serveRecorded(t, routeUserStatus)
+	cf := &Codeforces{BaseURL: server.URL, Client: http.DefaultClient, PageSize: recordedPageSize}
+
+	submissions, _, err := cf.Submissions(context.Background(), "tourist", "")
+	if err != nil {
+		t.Fatalf("Submissions: %v", err)
+	}
+	byID := make(map[string]Submission)
+	for _, s := range submissions {
+		byID[s.ExternalID] = s
+	}
+
+	tests := []struct {
+		id          string
+		verdict     string
+		problemID   string
+		problemURL  string
+		rating      int
+		submittedAt int64
+	}{
+		{"1003", model.VerdictCompilationError, "4A", "/contest/4/problem/A", 800, 1760000300},
+		{"1004", model.VerdictAccepted, "104114C", "/gym/104114/problem/C", 0, 1760000400},
+		{"1005", model.VerdictTimeLimitExceeded, "4A", "/contest/4/problem/A", 800, 1760000500},
+		{"1006", model.VerdictAccepted, "acmsguru/100", "/problemsets/acmsguru/problem/99999/100", 0, 1760000600},
+		{"1007", model.VerdictWrongAnswer, "1825A", "/contest/1825/problem/A", 800, 1760000700},
+	}
+	for _, tc := range tests {
+		s, ok := byID[tc.id]
+		if !ok {
+			t.Errorf("submission %s missing", tc.id)
+			continue
+		}
+		if s.Verdict != tc.verdict {
+			t.Errorf("submission %s verdict = %s, want %s", tc.id, s.Verdict, tc.verdict)
+		}
+		if s.Problem.ExternalID != tc.problemID || s.Problem.URL != server.URL+tc.problemURL || s.Problem.Rating != tc.rating {
+			t.Errorf("submission %s problem = %s at %s rated %d, want %s at %s rated %d",
+				tc.id, s.Problem.ExternalID, s.Problem.URL, s.Problem.Rating, tc.problemID, server.URL+tc.problemURL, tc.rating)
+		}
+		if !s.SubmittedAt.Equal(time.Unix(tc.submittedAt, 0)) {
+			t.Errorf("submission %s submitted at %v, want %v", tc.id, s.SubmittedAt, time.Unix(tc.submittedAt, 0))
+		}
+	}
+}
+
+func TestCodeforcesBacksOffWhenRateLimited(t *testing.T) {
+	const interval = 20 * time.Millisecond
+
+	tests := []struct {
+		name string
+		// refusals is how many calls in a row exceed the rate limit
+		refusals int
+		wantErr  bool
+	}{
+		{name: "retries after backing off", refusals: 2},
+		{name: "gives up", refusals: codeforcesRetries + 1, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []time.Time
+			server := serveRecorded(t, func(t *testing.T, r *http.Request) response {
+				mu.Lock()
+				defer mu.Unlock()
+				requests = append(requests, time.Now())
+				if len(requests) <= tc.refusals {
+					return response{http.StatusServiceUnavailable, "codeforces/call_limit_exceeded.json"}
+				}
+				return response{http.StatusOK, "codeforces/user.status_7.json"}
+			})
+			cf := &Codeforces{BaseURL: server.URL, Client: http.DefaultClient, Limiter: NewLimiter(interval), PageSize: recordedPageSize}
+
+			submissions, _, err := cf.Submissions(context.Background(), "tourist", "")
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "call limit exceeded") {
+					t.Fatalf("Submissions = %v, want the call limit error", err)
+				}
+				if len(requests) != codeforcesRetries+1 {
+					t.Errorf("made %d requests, want %d", len(requests), codeforcesRetries+1)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Submissions: %v", err)
+				}
+				if len(submissions) != 2 || len(requests) != tc.refusals+1 {
+					t.Errorf("got %d submissions in %d requests, want 2 in %d", len(submissions), len(requests), tc.refusals+1)
+				}
+			}
+
+			// Each refusal doubles the wait before the next request
+			for i := 1; i < len(requests); i++ {
+				want := interval << i
+				if gap := requests[i].Sub(requests[i-1]); gap < want {
+					t.Errorf("request %d made %v after the refused one, want at least %v", i+1, gap, want)
+				}
+			}
+		})
+	}
+}
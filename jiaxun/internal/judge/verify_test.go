@@ -0,0 +1,195 @@
+package judge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Challenges shown on the recorded profiles, and one that is not
+const (
+	recordedChallenge = "jiaxun-5f2c9a1e0b7d4c38"
+	otherChallenge    = "jiaxun-0000000000000000"
+)
+
+// Handles the test platforms know about: the recorded profile, an unknown
+// handle and one whose lookup fails on the platform's side
+const (
+	unknownHandle = "nosuchuser"
+	brokenHandle  = "broken"
+)
+
+// response is a recorded response, or an empty one if file is empty
+type response struct {
+	status int
+	file   string
+}
+
+// serveRecorded starts a test platform answering each request with the
+// recorded response its route picks from testdata
+func serveRecorded(t *testing.T, route func(t *testing.T, r *http.Request) response) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := route(t, r)
+		w.WriteHeader(resp.status)
+		if resp.file == "" {
+			return
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", resp.file))
+		if err != nil {
+			t.Errorf("reading recorded response: %v", err)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// verifierCase describes the test platform of one adapter
+type verifierCase struct {
+	name string
+	// handle has the recorded profile
+	handle      string
+	newVerifier func(baseURL string) Verifier
+	route       func(t *testing.T, r *http.Request) response
+}
+
+var verifierCases = []verifierCase{
+	{
+		name:   "codeforces",
+		handle: "tourist",
+		newVerifier: func(baseURL string) Verifier {
+			return &Codeforces{BaseURL: baseURL, Client: http.DefaultClient}
+		},
+		route: func(t *testing.T, r *http.Request) response {
+			if r.URL.Path != "/api/user.info" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL)
+				return response{status: http.StatusNotFound}
+			}
+			switch r.URL.Query().Get("handles") {
+			case "tourist":
+				return response{http.StatusOK, "codeforces/user.info.json"}
+			case brokenHandle:
+				return response{status: http.StatusServiceUnavailable}
+			default:
+				return response{http.StatusBadRequest, "codeforces/user.info_not_found.json"}
+			}
+		},
+	},
+	{
+		name:   "atcoder",
+		handle: "tourist",
+		newVerifier: func(baseURL string) Verifier {
+			return &AtCoder{BaseURL: baseURL, Client: http.DefaultClient}
+		},
+		route: func(t *testing.T, r *http.Request) response {
+			switch r.URL.Path {
+			case "/users/tourist":
+				return response{http.StatusOK, "atcoder/users.html"}
+			case "/users/" + brokenHandle:
+				return response{status: http.StatusInternalServerError}
+			default:
+				return response{status: http.StatusNotFound}
+			}
+		},
+	},
+	{
+		name:   "leetcode",
+		handle: "ada",
+		newVerifier: func(baseURL string) Verifier {
+			return &LeetCode{BaseURL: baseURL, Client: http.DefaultClient}
+		},
+		route: func(t *testing.T, r *http.Request) response {
+			var body struct {
+				Query     string            `json:"query"`
+				Variables map[string]string `json:"variables"`
+			}
+			if r.Method != http.MethodPost || r.URL.Path != "/graphql" || json.NewDecoder(r.Body).Decode(&body) != nil {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL)
+				return response{status: http.StatusBadRequest}
+			}
+			if !strings.Contains(body.Query, "matchedUser") {
+				t.Errorf("unexpected query %s", body.Query)
+			}
+			switch body.Variables["username"] {
+			case "ada":
+				return response{http.StatusOK, "leetcode/graphql.json"}
+			case brokenHandle:
+				return response{status: http.StatusBadGateway}
+			default:
+				return response{http.StatusOK, "leetcode/graphql_not_found.json"}
+			}
+		},
+	},
+	{
+		name:   "luogu",
+		handle: "kkksc03",
+		newVerifier: func(baseURL string) Verifier {
+			return &Luogu{BaseURL: baseURL, Client: http.DefaultClient}
+		},
+		route: func(t *testing.T, r *http.Request) response {
+			if r.URL.Path != "/api/user/search" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL)
+				return response{status: http.StatusNotFound}
+			}
+			switch r.URL.Query().Get("keyword") {
+			case "kkksc03":
+				return response{http.StatusOK, "luogu/search.json"}
+			case brokenHandle:
+				return response{status: http.StatusInternalServerError}
+			default:
+				return response{http.StatusOK, "luogu/search_not_found.json"}
+			}
+		},
+	},
+}
+
+func TestVerify(t *testing.T) {
+	for _, vc := range verifierCases {
+		t.Run(vc.name, func(t *testing.T) {
+			server := serveRecorded(t, vc.route)
+			verifier := vc.newVerifier(server.URL)
+
+			tests := []struct {
+				name      string
+				handle    string
+				challenge string
+				want      bool
+				wantErr   error
+				// wantFailure is set when the platform itself fails
+				wantFailure bool
+			}{
+				{name: "challenge on the profile", handle: vc.handle, challenge: recordedChallenge, want: true},
+				{name: "wrong challenge", handle: vc.handle, challenge: otherChallenge, want: false},
+				{name: "unknown handle", handle: unknownHandle, challenge: recordedChallenge, wantErr: ErrHandleNotFound},
+				{name: "platform failure", handle: brokenHandle, challenge: recordedChallenge, wantFailure: true},
+			}
+			for _, tc := range tests {
+				t.Run(tc.name, func(t *testing.T) {
+					got, err := verifier.Verify(context.Background(), tc.handle, tc.challenge)
+					switch {
+					case tc.wantErr != nil:
+						if !errors.Is(err, tc.wantErr) {
+							t.Fatalf("Verify = %v, %v; want %v", got, err, tc.wantErr)
+						}
+					case tc.wantFailure:
+						if err == nil || errors.Is(err, ErrHandleNotFound) {
+							t.Fatalf("Verify = %v, %v; want a platform error", got, err)
+						}
+					case err != nil:
+						t.Fatalf("Verify: %v", err)
+					case got != tc.want:
+						t.Errorf("Verify = %v, want %v", got, tc.want)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+// Package keyring holds the keys access tokens are signed and verified with.
+//
+// Tokens are signed with a single signing key and carry its ID in the kid
+// header. Any key in the keyring verifies the tokens it signed, so a key
+// can be rotated out without invalidating tokens that are still in use.
+// Asymmetric keys are published as a JSON Web Key Set for other services.
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"jiaxun/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA modulus accepted
+const minRSABits = 2048
+
+// ErrUnknownKey is returned when verifying a token signed by a key that
+// is not in the keyring
+var ErrUnknownKey = errors.New("token signed with an unknown key")
+
+// Key is a signing or verification key
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// private signs tokens; it is nil for keys that only verify
+	private crypto.PrivateKey
+	// public verifies tokens; for HMAC it is the shared secret
+	public interface{}
+}
+
+// CanSign reports whether the key can sign tokens
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// Keyring is a set of keys with one designated for signing
+type Keyring struct {
+	signing *Key
+	keys    map[string]*Key
+	// order keeps the configured order for publishing
+	order []*Key
+}
+
+// New creates a keyring of the given keys that signs with the key signingID
+func New(signingID string, keys ...*Key) (*Keyring, error) {
+	k := &Keyring{keys: map[string]*Key{}}
+	for _, key := range keys {
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID: %s", key.ID)
+		}
+		k.keys[key.ID] = key
+		k.order = append(k.order, key)
+	}
+
+	signing, ok := k.keys[signingID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q is not in the keyring", signingID)
+	}
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("signing key %q is not a private key", signingID)
+	}
+	k.signing = signing
+	return k, nil
+}
+
+// NewHMAC creates a keyring that signs with HS256 using a shared secret.
+// Its key has no ID, matching tokens issued before keys were introduced.
+func NewHMAC(secret []byte) *Keyring {
+	key := &Key{Method: jwt.SigningMethodHS256, private: secret, public: secret}
+	k, _ := New("", key)
+	return k
+}
+
+// Load creates the keyring described by the configuration, reading keys
+// from their PEM files. Without configured keys it falls back to HS256
+// with the application secret.
+func Load(cfg config.JWTConfig, secret string) (*Keyring, error) {
+	if len(cfg.Keys) == 0 {
+		return NewHMAC([]byte(secret)), nil
+	}
+
+	keys := make([]*Key, 0, len(cfg.Keys))
+	for _, kc := range cfg.Keys {
+		data, err := os.ReadFile(kc.File)
+		if err != nil {
+			return nil, fmt.Errorf("reading key %s: %w", kc.ID, err)
+		}
+		key, err := ParsePEM(kc.ID, data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing key %s: %w", kc.ID, err)
+		}
+		keys = append(keys, key)
+	}
+	return New(cfg.SigningKeyID, keys...)
+}
+
+// ParsePEM parses a PEM-encoded RSA or Ed25519 key. Private keys may be in
+// PKCS#1 or PKCS#8 form, public keys in PKCS#1 or PKIX form. RSA keys are
+// used with RS256 and Ed25519 keys with EdDSA.
+func ParsePEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	if pub, ok := key.public.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA keys must have at least %d bits", minRSABits)
+	}
+	return key, nil
+}
+
+// Sign signs claims with the signing key, naming it in the kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	if k.signing.ID != "" {
+		token.Header["kid"] = k.signing.ID
+	}
+	return token.SignedString(k.signing.private)
+}
+
+// Keyfunc returns the key that verifies a token, chosen by its kid header.
+// The token's algorithm must be the one of the key, so that a public key
+// can never be used as an HMAC secret.
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
+// Methods returns the algorithms of the keys in the keyring
+func (k *Keyring) Methods() []string {
+	seen := map[string]bool{}
+	methods := []string{}
+	for _, key := range k.order {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// JWK is a public key in JSON Web Key form
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 curve and public key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the keyring. Shared HMAC secrets are
+// never included.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.order {
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
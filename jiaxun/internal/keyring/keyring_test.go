@@ -0,0 +1,476 @@
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"jiaxun/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Test keys, generated once since RSA keys are slow to generate
+var (
+	rsaKey     = mustRSAKey(minRSABits)
+	otherRSA   = mustRSAKey(minRSABits)
+	ed25519Key = mustEd25519Key()
+)
+
+func mustRSAKey(bits int) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustEd25519Key() ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// encodePEM encodes DER bytes as a PEM block of the given type
+func encodePEM(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+// pkcs8 encodes a private key in PKCS#8 form
+func pkcs8(t *testing.T, key interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	return encodePEM("PRIVATE KEY", der)
+}
+
+// pkix encodes a public key in PKIX form
+func pkix(t *testing.T, key interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	return encodePEM("PUBLIC KEY", der)
+}
+
+// mustParse parses a PEM key the test relies on
+func mustParse(t *testing.T, id string, data []byte) *Key {
+	t.Helper()
+	key, err := ParsePEM(id, data)
+	if err != nil {
+		t.Fatalf("ParsePEM(%s): %v", id, err)
+	}
+	return key
+}
+
+// mustNew creates a keyring the test relies on
+func mustNew(t *testing.T, signingID string, keys ...*Key) *Keyring {
+	t.Helper()
+	k, err := New(signingID, keys...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return k
+}
+
+// testClaims are the claims of the tokens signed in the tests
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Subject:   "42",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+}
+
+// verify parses a token the way AuthMiddleware does
+func verify(k *Keyring, token string) error {
+	_, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, k.Keyfunc, jwt.WithValidMethods(k.Methods()))
+	return err
+}
+
+func TestParsePEM(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating EC key: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantMethod jwt.SigningMethod
+		wantSign   bool
+		wantErr    string
+	}{
+		{name: "RSA PKCS#1 private key", data: encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), wantMethod: jwt.SigningMethodRS256, wantSign: true},
+		{name: "RSA PKCS#8 private key", data: pkcs8(t, rsaKey), wantMethod: jwt.SigningMethodRS256, wantSign: true},
+		{name: "RSA PKCS#1 public key", data: encodePEM("RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)), wantMethod: jwt.SigningMethodRS256},
+		{name: "RSA PKIX public key", data: pkix(t, &rsaKey.PublicKey), wantMethod: jwt.SigningMethodRS256},
+		{name: "Ed25519 private key", data: pkcs8(t, ed25519Key), wantMethod: jwt.SigningMethodEdDSA, wantSign: true},
+		{name: "Ed25519 public key", data: pkix(t, ed25519Key.Public()), wantMethod: jwt.SigningMethodEdDSA},
+		{name: "short RSA key", data: encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(mustRSAKey(1024))), wantErr: "at least 2048 bits"},
+		{name: "EC key", data: pkcs8(t, ecKey), wantErr: "unsupported key type"},
+		{name: "certificate", data: encodePEM("CERTIFICATE", []byte{0x30}), wantErr: "unsupported PEM block type"},
+		{name: "not PEM", data: []byte("-----not a key-----"), wantErr: "no PEM data"},
+		{name: "corrupt key", data: encodePEM("PRIVATE KEY", []byte("garbage")), wantErr: "asn1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := ParsePEM("k1", tc.data)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("ParsePEM = %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePEM: %v", err)
+			}
+			if key.ID != "k1" || key.Method != tc.wantMethod || key.CanSign() != tc.wantSign {
+				t.Errorf("ParsePEM = %s %s, can sign %v; want k1 %s, can sign %v",
+					key.ID, key.Method.Alg(), key.CanSign(), tc.wantMethod.Alg(), tc.wantSign)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	private := mustParse(t, "a", pkcs8(t, rsaKey))
+	public := mustParse(t, "b", pkix(t, ed25519Key.Public()))
+
+	tests := []struct {
+		name      string
+		signingID string
+		keys      []*Key
+		wantErr   string
+	}{
+		{name: "signing key in the keyring", signingID: "a", keys: []*Key{private, public}},
+		{name: "missing signing key", signingID: "c", keys: []*Key{private, public}, wantErr: "not in the keyring"},
+		{name: "public signing key", signingID: "b", keys: []*Key{private, public}, wantErr: "not a private key"},
+		{name: "duplicate key ID", signingID: "a", keys: []*Key{private, mustParse(t, "a", pkcs8(t, ed25519Key))}, wantErr: "duplicate key ID"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.signingID, tc.keys...)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("New: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("New = %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []byte
+		alg  string
+	}{
+		{"RSA", pkcs8(t, rsaKey), "RS256"},
+		{"Ed25519", pkcs8(t, ed25519Key), "EdDSA"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k := mustNew(t, "k1", mustParse(t, "k1", tc.key))
+			token, err := k.Sign(testClaims())
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified: %v", err)
+			}
+			if parsed.Header["kid"] != "k1" || parsed.Header["alg"] != tc.alg {
+				t.Errorf("header = %v, want kid k1 and alg %s", parsed.Header, tc.alg)
+			}
+			if err := verify(k, token); err != nil {
+				t.Errorf("verifying: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyfuncChoosesKeyByKID(t *testing.T) {
+	rsaA := mustParse(t, "a", pkcs8(t, rsaKey))
+	rsaB := mustParse(t, "b", pkcs8(t, otherRSA))
+	edC := mustParse(t, "c", pkcs8(t, ed25519Key))
+	k := mustNew(t, "a", rsaA, rsaB, edC)
+
+	signedBy := map[string]*Keyring{
+		"a": k,
+		"b": mustNew(t, "b", rsaB),
+		"c": mustNew(t, "c", edC),
+	}
+	for kid, signer := range signedBy {
+		token, err := signer.Sign(testClaims())
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		if err := verify(k, token); err != nil {
+			t.Errorf("token signed by %s: %v", kid, err)
+		}
+	}
+
+	// A token naming another key than the one that signed it is rejected
+	token, err := signedBy["b"].Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := verify(k, relabel(t, token, "a")); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Errorf("token of b relabeled as a = %v, want an invalid signature", err)
+	}
+	if err := verify(k, relabel(t, token, "c")); err == nil {
+		t.Error("token of b relabeled as the EdDSA key c was accepted")
+	}
+	for _, kid := range []string{"unknown", ""} {
+		if err := verify(k, relabel(t, token, kid)); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("token with kid %q = %v, want ErrUnknownKey", kid, err)
+		}
+	}
+}
+
+// relabel rewrites the kid header of a token, keeping its signature
+func relabel(t *testing.T, token, kid string) string {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		t.Fatalf("decoding header: %v", err)
+	}
+	header := map[string]interface{}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		t.Fatalf("decoding header: %v", err)
+	}
+	if kid == "" {
+		delete(header, "kid")
+	} else {
+		header["kid"] = kid
+	}
+	if data, err = json.Marshal(header); err != nil {
+		t.Fatalf("encoding header: %v", err)
+	}
+	parts[0] = base64.RawURLEncoding.EncodeToString(data)
+	return strings.Join(parts, ".")
+}
+
+func TestVerifyAfterRotation(t *testing.T) {
+	oldKey := mustParse(t, "2025", pkcs8(t, rsaKey))
+	newKey := mustParse(t, "2026", pkcs8(t, ed25519Key))
+
+	before := mustNew(t, "2025", oldKey)
+	oldToken, err := before.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	// The retired key only verifies, from its public half
+	retired := mustParse(t, "2025", pkix(t, &rsaKey.PublicKey))
+	after := mustNew(t, "2026", newKey, retired)
+	newToken, err := after.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	if err := verify(after, oldToken); err != nil {
+		t.Errorf("token of the retired key: %v", err)
+	}
+	if err := verify(after, newToken); err != nil {
+		t.Errorf("token of the new key: %v", err)
+	}
+	if err := verify(before, newToken); err == nil {
+		t.Error("a keyring from before the rotation accepted a token of the new key")
+	}
+
+	// Once the retired key is dropped, its tokens are rejected, even if
+	// another key of the same algorithm remains
+	dropped := mustNew(t, "2026", newKey, mustParse(t, "2027", pkix(t, &otherRSA.PublicKey)))
+	if err := verify(dropped, oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token of a dropped key = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestRejectsAlgorithmConfusion(t *testing.T) {
+	k := mustNew(t, "rsa", mustParse(t, "rsa", pkcs8(t, rsaKey)))
+
+	// An attacker knowing the public key signs with it as an HMAC secret
+	for name, secret := range map[string][]byte{
+		"PEM public key": pkix(t, &rsaKey.PublicKey),
+		"DER public key": x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey),
+	} {
+		t.Run("HS256 with the "+name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+			token.Header["kid"] = "rsa"
+			signed, err := token.SignedString(secret)
+			if err != nil {
+				t.Fatalf("SignedString: %v", err)
+			}
+			if err := verify(k, signed); err == nil {
+				t.Fatal("HS256 token signed with the public key was accepted")
+			}
+			// Even a parser accepting any algorithm gets no key
+			if key, err := keyFor(t, k, signed); err == nil {
+				t.Fatalf("Keyfunc returned %T for an HS256 token", key)
+			}
+		})
+	}
+
+	t.Run("alg none", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims())
+		token.Header["kid"] = "rsa"
+		signed, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		if err := verify(k, signed); err == nil {
+			t.Fatal("unsigned token was accepted")
+		}
+		if key, err := keyFor(t, k, signed); err == nil {
+			t.Fatalf("Keyfunc returned %T for an unsigned token", key)
+		}
+	})
+
+	t.Run("alg none with the HMAC keyring", func(t *testing.T) {
+		hmac := NewHMAC([]byte("secret"))
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims())
+		signed, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		if err := verify(hmac, signed); err == nil {
+			t.Fatal("unsigned token was accepted")
+		}
+	})
+}
+
+// keyFor returns the key the keyring picks for a token, before any
+// signature or algorithm check
+func keyFor(t *testing.T, k *Keyring, token string) (interface{}, error) {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	return k.Keyfunc(parsed)
+}
+
+func TestHMAC(t *testing.T) {
+	k := NewHMAC([]byte("secret"))
+	token, err := k.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := verify(k, token); err != nil {
+		t.Errorf("verifying: %v", err)
+	}
+	if err := verify(NewHMAC([]byte("other secret")), token); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Errorf("token of another secret = %v, want an invalid signature", err)
+	}
+	if keys := k.JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS publishes %d keys of an HMAC keyring, want none", len(keys))
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+		return path
+	}
+	current := write("current.pem", pkcs8(t, ed25519Key))
+	retired := write("retired.pem", pkix(t, &rsaKey.PublicKey))
+
+	k, err := Load(config.JWTConfig{
+		SigningKeyID: "current",
+		Keys:         []config.JWTKeyConfig{{ID: "current", File: current}, {ID: "retired", File: retired}},
+	}, "secret")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if methods := k.Methods(); len(methods) != 2 || methods[0] != "EdDSA" || methods[1] != "RS256" {
+		t.Errorf("Methods = %v, want [EdDSA RS256]", methods)
+	}
+
+	fallback, err := Load(config.JWTConfig{}, "secret")
+	if err != nil {
+		t.Fatalf("Load without keys: %v", err)
+	}
+	token, err := NewHMAC([]byte("secret")).Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := verify(fallback, token); err != nil {
+		t.Errorf("fallback keyring rejects tokens signed with the secret: %v", err)
+	}
+
+	_, err = Load(config.JWTConfig{
+		SigningKeyID: "missing",
+		Keys:         []config.JWTKeyConfig{{ID: "missing", File: filepath.Join(dir, "missing.pem")}},
+	}, "secret")
+	if err == nil || !strings.Contains(err.Error(), "reading key missing") {
+		t.Errorf("Load with a missing file = %v, want a read error", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	k := mustNew(t, "ed",
+		mustParse(t, "ed", pkcs8(t, ed25519Key)),
+		mustParse(t, "rsa", pkix(t, &rsaKey.PublicKey)),
+	)
+
+	keys := k.JWKS().Keys
+	if len(keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(keys))
+	}
+
+	ed := keys[0]
+	if ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.KeyID != "ed" || ed.Algorithm != "EdDSA" || ed.Use != "sig" {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+	if x, err := base64.RawURLEncoding.DecodeString(ed.X); err != nil || !ed25519Key.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+		t.Errorf("Ed25519 JWK x does not decode to the public key (%v)", err)
+	}
+
+	pub := keys[1]
+	if pub.KeyType != "RSA" || pub.KeyID != "rsa" || pub.Algorithm != "RS256" || pub.Use != "sig" {
+		t.Errorf("RSA JWK = %+v", pub)
+	}
+	n, errN := base64.RawURLEncoding.DecodeString(pub.N)
+	e, errE := base64.RawURLEncoding.DecodeString(pub.E)
+	if errN != nil || errE != nil {
+		t.Fatalf("decoding the RSA JWK: %v, %v", errN, errE)
+	}
+	if new(big.Int).SetBytes(n).Cmp(rsaKey.N) != 0 || int(new(big.Int).SetBytes(e).Int64()) != rsaKey.E {
+		t.Error("RSA JWK does not hold the public key")
+	}
+	if pub.X != "" || ed.N != "" {
+		t.Error("JWKs hold fields of another key type")
+	}
+}
@@ -0,0 +1,215 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// BER tag classes and the constructed bit, combined with a tag number
+// into the identifier byte of an element
+const (
+	ClassUniversal   byte = 0x00
+	ClassApplication byte = 0x40
+	ClassContext     byte = 0x80
+	Constructed      byte = 0x20
+)
+
+// Universal tags used by LDAP
+const (
+	TagBoolean     byte = 0x01
+	TagInteger     byte = 0x02
+	TagOctetString byte = 0x04
+	TagNull        byte = 0x05
+	TagEnumerated  byte = 0x0a
+	TagSequence    byte = 0x30
+	TagSet         byte = 0x31
+)
+
+// maxElementSize bounds the size of a single message read from the network
+const maxElementSize = 16 << 20
+
+// ErrMalformed is returned for data that is not valid BER as used by LDAP
+var ErrMalformed = errors.New("ldap: malformed message")
+
+// Element is a BER element. Only the single-byte identifiers and definite
+// lengths LDAP uses are supported.
+type Element struct {
+	Tag   byte
+	Value []byte
+}
+
+// Constructed reports whether the element contains other elements
+func (e Element) Constructed() bool {
+	return e.Tag&Constructed != 0
+}
+
+// Children decodes the elements contained in a constructed element
+func (e Element) Children() ([]Element, error) {
+	var children []Element
+	rest := e.Value
+	for len(rest) > 0 {
+		child, n, err := parseElement(rest)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+		rest = rest[n:]
+	}
+	return children, nil
+}
+
+// String returns the value of an octet string
+func (e Element) String() string {
+	return string(e.Value)
+}
+
+// Int returns the value of an integer or enumerated element
+func (e Element) Int() (int64, error) {
+	if len(e.Value) == 0 || len(e.Value) > 8 {
+		return 0, ErrMalformed
+	}
+	n := new(big.Int).SetBytes(e.Value)
+	if e.Value[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(e.Value)*8)))
+	}
+	return n.Int64(), nil
+}
+
+// Bool returns the value of a boolean element
+func (e Element) Bool() bool {
+	return len(e.Value) == 1 && e.Value[0] != 0
+}
+
+// Encode returns the BER encoding of the element
+func (e Element) Encode() []byte {
+	out := []byte{e.Tag}
+	out = append(out, encodeLength(len(e.Value))...)
+	return append(out, e.Value...)
+}
+
+// NewConstructed builds a constructed element from its children
+func NewConstructed(tag byte, children ...Element) Element {
+	var value []byte
+	for _, child := range children {
+		value = append(value, child.Encode()...)
+	}
+	return Element{Tag: tag | Constructed, Value: value}
+}
+
+// NewSequence builds a universal sequence
+func NewSequence(children ...Element) Element {
+	return NewConstructed(TagSequence, children...)
+}
+
+// NewString builds an octet string, or a primitive element with another tag
+func NewString(tag byte, s string) Element {
+	return Element{Tag: tag, Value: []byte(s)}
+}
+
+// NewInt builds an integer or enumerated element
+func NewInt(tag byte, n int64) Element {
+	// Minimal two's complement encoding
+	var value []byte
+	for {
+		value = append([]byte{byte(n)}, value...)
+		if (n < 0x80 && n >= -0x80) || len(value) == 8 {
+			break
+		}
+		n >>= 8
+	}
+	return Element{Tag: tag, Value: value}
+}
+
+// NewBool builds a boolean element
+func NewBool(b bool) Element {
+	if b {
+		return Element{Tag: TagBoolean, Value: []byte{0xff}}
+	}
+	return Element{Tag: TagBoolean, Value: []byte{0x00}}
+}
+
+// ReadElement reads one element from r
+func ReadElement(r *bufio.Reader) (Element, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return Element{}, err
+	}
+	length, err := readLength(r)
+	if err != nil {
+		return Element{}, err
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return Element{}, err
+	}
+	return Element{Tag: tag, Value: value}, nil
+}
+
+func readLength(r *bufio.Reader) (int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if first < 0x80 {
+		return int(first), nil
+	}
+	// Indefinite lengths (0x80) are not allowed in LDAP
+	n := int(first & 0x7f)
+	if n == 0 || n > 4 {
+		return 0, ErrMalformed
+	}
+	length := 0
+	for i := 0; i < n; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+	if length > maxElementSize {
+		return 0, fmt.Errorf("ldap: message of %d bytes is too large", length)
+	}
+	return length, nil
+}
+
+// parseElement decodes the element at the start of b and returns it with
+// the number of bytes it took up
+func parseElement(b []byte) (Element, int, error) {
+	if len(b) < 2 {
+		return Element{}, 0, ErrMalformed
+	}
+	tag := b[0]
+	length, offset := int(b[1]), 2
+	if length >= 0x80 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(b) < 2+n {
+			return Element{}, 0, ErrMalformed
+		}
+		length = 0
+		for _, c := range b[2 : 2+n] {
+			length = length<<8 | int(c)
+		}
+		offset += n
+	}
+	if length < 0 || len(b)-offset < length {
+		return Element{}, 0, ErrMalformed
+	}
+	return Element{Tag: tag, Value: b[offset : offset+length]}, offset + length, nil
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var digits []byte
+	for ; n > 0; n >>= 8 {
+		digits = append([]byte{byte(n)}, digits...)
+	}
+	return append([]byte{0x80 | byte(len(digits))}, digits...)
+}
@@ -0,0 +1,205 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Filter choices of a search request (RFC 4511 section 4.5.1.7)
+const (
+	FilterAnd            byte = ClassContext | Constructed | 0
+	FilterOr             byte = ClassContext | Constructed | 1
+	FilterNot            byte = ClassContext | Constructed | 2
+	FilterEqualityMatch  byte = ClassContext | Constructed | 3
+	FilterSubstrings     byte = ClassContext | Constructed | 4
+	FilterGreaterOrEqual byte = ClassContext | Constructed | 5
+	FilterLessOrEqual    byte = ClassContext | Constructed | 6
+	FilterPresent        byte = ClassContext | 7
+	FilterApproxMatch    byte = ClassContext | Constructed | 8
+)
+
+// Parts of a substrings filter
+const (
+	SubstringInitial byte = ClassContext | 0
+	SubstringAny     byte = ClassContext | 1
+	SubstringFinal   byte = ClassContext | 2
+)
+
+// EscapeFilter escapes a value for use in a filter string, so that user
+// input cannot change the filter's meaning
+func EscapeFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// CompileFilter encodes a filter in its string representation (RFC 4515),
+// e.g. "(&(objectClass=person)(uid=alice))"
+func CompileFilter(filter string) (Element, error) {
+	p := &filterParser{s: filter}
+	e, err := p.filter()
+	if err != nil {
+		return Element{}, err
+	}
+	if p.pos != len(p.s) {
+		return Element{}, p.errorf("unexpected text after filter")
+	}
+	return e, nil
+}
+
+type filterParser struct {
+	s   string
+	pos int
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("ldap: invalid filter %q at %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *filterParser) filter() (Element, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+		return Element{}, p.errorf("expected (")
+	}
+	p.pos++
+	if p.pos >= len(p.s) {
+		return Element{}, p.errorf("unexpected end")
+	}
+
+	var e Element
+	var err error
+	switch p.s[p.pos] {
+	case '&':
+		p.pos++
+		e, err = p.list(FilterAnd)
+	case '|':
+		p.pos++
+		e, err = p.list(FilterOr)
+	case '!':
+		p.pos++
+		var inner Element
+		inner, err = p.filter()
+		e = NewConstructed(FilterNot, inner)
+	default:
+		e, err = p.item()
+	}
+	if err != nil {
+		return Element{}, err
+	}
+
+	if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+		return Element{}, p.errorf("expected )")
+	}
+	p.pos++
+	return e, nil
+}
+
+func (p *filterParser) list(tag byte) (Element, error) {
+	var children []Element
+	for p.pos < len(p.s) && p.s[p.pos] == '(' {
+		child, err := p.filter()
+		if err != nil {
+			return Element{}, err
+		}
+		children = append(children, child)
+	}
+	if len(children) == 0 {
+		return Element{}, p.errorf("empty filter list")
+	}
+	return NewConstructed(tag, children...), nil
+}
+
+// item parses a simple, presence or substrings filter up to its closing paren
+func (p *filterParser) item() (Element, error) {
+	end := strings.IndexByte(p.s[p.pos:], ')')
+	if end < 0 {
+		return Element{}, p.errorf("expected )")
+	}
+	item := p.s[p.pos : p.pos+end]
+	eq := strings.IndexByte(item, '=')
+	if eq < 1 {
+		return Element{}, p.errorf("expected attribute=value")
+	}
+	p.pos += end
+
+	attr, value := item[:eq], item[eq+1:]
+	tag := FilterEqualityMatch
+	switch attr[len(attr)-1] {
+	case '>':
+		tag, attr = FilterGreaterOrEqual, attr[:len(attr)-1]
+	case '<':
+		tag, attr = FilterLessOrEqual, attr[:len(attr)-1]
+	case '~':
+		tag, attr = FilterApproxMatch, attr[:len(attr)-1]
+	}
+	if attr == "" {
+		return Element{}, p.errorf("missing attribute")
+	}
+
+	if tag == FilterEqualityMatch && value == "*" {
+		return NewString(FilterPresent, attr), nil
+	}
+	if tag == FilterEqualityMatch && strings.Contains(value, "*") {
+		return p.substrings(attr, value)
+	}
+
+	unescaped, err := unescapeFilter(value)
+	if err != nil {
+		return Element{}, p.errorf("%v", err)
+	}
+	return NewConstructed(tag, NewString(TagOctetString, attr), NewString(TagOctetString, unescaped)), nil
+}
+
+func (p *filterParser) substrings(attr, value string) (Element, error) {
+	parts := strings.Split(value, "*")
+	var subs []Element
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		unescaped, err := unescapeFilter(part)
+		if err != nil {
+			return Element{}, p.errorf("%v", err)
+		}
+		tag := SubstringAny
+		switch i {
+		case 0:
+			tag = SubstringInitial
+		case len(parts) - 1:
+			tag = SubstringFinal
+		}
+		subs = append(subs, NewString(tag, unescaped))
+	}
+	return NewConstructed(FilterSubstrings, NewString(TagOctetString, attr), NewSequence(subs...)), nil
+}
+
+func unescapeFilter(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+		if i+3 > len(value) {
+			return "", fmt.Errorf("truncated escape")
+		}
+		decoded, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape %q", value[i:i+3])
+		}
+		b.Write(decoded)
+		i += 2
+	}
+	return b.String(), nil
+}
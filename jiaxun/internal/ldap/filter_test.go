@@ -0,0 +1,68 @@
+package ldap
+
+import "testing"
+
+func TestEscapeFilter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"alice", "alice"},
+		{"*", `\2a`},
+		{"al*", `al\2a`},
+		{"alice)(uid=*", `alice\29\28uid=\2a`},
+		{`back\slash`, `back\5cslash`},
+		{"nul\x00byte", `nul\00byte`},
+		{"o'brien élève", "o'brien élève"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			got := EscapeFilter(tc.value)
+			if got != tc.want {
+				t.Fatalf("EscapeFilter(%q) = %q, want %q", tc.value, got, tc.want)
+			}
+
+			// The escaped value compiles to an equality match on the
+			// value itself, whatever characters it holds
+			filter, err := CompileFilter("(uid=" + got + ")")
+			if err != nil {
+				t.Fatalf("CompileFilter: %v", err)
+			}
+			if filter.Tag != FilterEqualityMatch {
+				t.Fatalf("filter tag = %#x, want an equality match", filter.Tag)
+			}
+			parts, err := filter.Children()
+			if err != nil || len(parts) != 2 {
+				t.Fatalf("equality match has %d parts (%v), want 2", len(parts), err)
+			}
+			if attr, value := parts[0].String(), parts[1].String(); attr != "uid" || value != tc.value {
+				t.Errorf("filter matches %s=%q, want uid=%q", attr, value, tc.value)
+			}
+		})
+	}
+}
+
+func TestCompileFilterUnescaped(t *testing.T) {
+	// Without escaping, the same input changes the filter's meaning
+	tests := []struct {
+		filter string
+		tag    byte
+	}{
+		{"(uid=*)", FilterPresent},
+		{"(uid=al*)", FilterSubstrings},
+	}
+
+	for _, tc := range tests {
+		filter, err := CompileFilter(tc.filter)
+		if err != nil {
+			t.Fatalf("CompileFilter(%s): %v", tc.filter, err)
+		}
+		if filter.Tag != tc.tag {
+			t.Errorf("CompileFilter(%s) tag = %#x, want %#x", tc.filter, filter.Tag, tc.tag)
+		}
+	}
+	if _, err := CompileFilter("(uid=alice)(uid=*)"); err == nil {
+		t.Error("CompileFilter accepted text after the filter")
+	}
+}
@@ -0,0 +1,364 @@
+// Package ldap implements the small part of an LDAPv3 client (RFC 4511)
+// that password authentication needs: simple binds, searches and StartTLS.
+//
+// The BER types are exported so that test servers can speak the protocol.
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Protocol operations
+const (
+	OpBindRequest           byte = ClassApplication | Constructed | 0
+	OpBindResponse          byte = ClassApplication | Constructed | 1
+	OpUnbindRequest         byte = ClassApplication | 2
+	OpSearchRequest         byte = ClassApplication | Constructed | 3
+	OpSearchResultEntry     byte = ClassApplication | Constructed | 4
+	OpSearchResultDone      byte = ClassApplication | Constructed | 5
+	OpSearchResultReference byte = ClassApplication | Constructed | 19
+	OpExtendedRequest       byte = ClassApplication | Constructed | 23
+	OpExtendedResponse      byte = ClassApplication | Constructed | 24
+)
+
+// Result codes
+const (
+	ResultSuccess            = 0
+	ResultOperationsError    = 1
+	ResultProtocolError      = 2
+	ResultSizeLimitExceeded  = 4
+	ResultNoSuchObject       = 32
+	ResultInvalidCredentials = 49
+	ResultUnwillingToPerform = 53
+)
+
+// Search scopes
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+)
+
+// StartTLSOID names the StartTLS extended operation
+const StartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// ErrEmptyPassword is returned for binds with a name but no password,
+// which servers treat as unauthenticated binds that always succeed
+var ErrEmptyPassword = errors.New("ldap: empty password")
+
+// Error is a result other than success returned by the server
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap: result code %d", e.Code)
+	}
+	return fmt.Sprintf("ldap: result code %d: %s", e.Code, e.Message)
+}
+
+// IsResult reports whether err is a server result with the given code
+func IsResult(err error, code int) bool {
+	var ldapErr *Error
+	return errors.As(err, &ldapErr) && ldapErr.Code == code
+}
+
+// Entry is a directory entry returned by a search. Attribute names are
+// matched case-insensitively.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Values returns every value of an attribute
+func (e *Entry) Values(attr string) []string {
+	return e.Attributes[strings.ToLower(attr)]
+}
+
+// Value returns the first value of an attribute, or "" if it has none
+func (e *Entry) Value(attr string) string {
+	if values := e.Values(attr); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// SearchRequest describes a search
+type SearchRequest struct {
+	BaseDN string
+	Scope  int
+	// Filter is in its string representation, e.g. "(uid=alice)"
+	Filter string
+	// Attributes lists the attributes to return; empty returns all
+	Attributes []string
+	// SizeLimit caps the number of entries returned; 0 means no limit
+	SizeLimit int
+}
+
+// Conn is a connection to an LDAP server. It is not safe for concurrent use.
+type Conn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	host    string
+	timeout time.Duration
+	lastID  int64
+}
+
+// Dial connects to an ldap:// or ldaps:// URL. Each operation on the
+// connection must complete within timeout.
+func Dial(rawURL string, tlsConfig *tls.Config, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid URL: %w", err)
+	}
+
+	host, port := u.Hostname(), u.Port()
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+		conn, err = dialer.Dial("tcp", net.JoinHostPort(host, port))
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), withServerName(tlsConfig, host))
+	default:
+		return nil, fmt.Errorf("ldap: unsupported URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{conn: conn, r: bufio.NewReader(conn), host: host, timeout: timeout}, nil
+}
+
+// StartTLS upgrades the connection to TLS
+func (c *Conn) StartTLS(tlsConfig *tls.Config) error {
+	id, err := c.send(NewConstructed(OpExtendedRequest, NewString(ClassContext|0, StartTLSOID)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.Tag != OpExtendedResponse {
+		return ErrMalformed
+	}
+	if err := parseResult(op); err != nil {
+		return err
+	}
+
+	conn := tls.Client(c.conn, withServerName(tlsConfig, c.host))
+	if err := c.deadline(); err != nil {
+		return err
+	}
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+	return nil
+}
+
+// Bind authenticates the connection with a simple bind. Wrong credentials
+// are reported as an *Error with ResultInvalidCredentials.
+func (c *Conn) Bind(dn, password string) error {
+	if dn != "" && password == "" {
+		return ErrEmptyPassword
+	}
+
+	id, err := c.send(NewConstructed(OpBindRequest,
+		NewInt(TagInteger, 3),
+		NewString(TagOctetString, dn),
+		NewString(ClassContext|0, password),
+	))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.Tag != OpBindResponse {
+		return ErrMalformed
+	}
+	return parseResult(op)
+}
+
+// Search returns the entries matching a search request
+func (c *Conn) Search(req SearchRequest) ([]*Entry, error) {
+	filter, err := CompileFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make([]Element, 0, len(req.Attributes))
+	for _, attr := range req.Attributes {
+		attrs = append(attrs, NewString(TagOctetString, attr))
+	}
+
+	id, err := c.send(NewConstructed(OpSearchRequest,
+		NewString(TagOctetString, req.BaseDN),
+		NewInt(TagEnumerated, int64(req.Scope)),
+		NewInt(TagEnumerated, 0), // never dereference aliases
+		NewInt(TagInteger, int64(req.SizeLimit)),
+		NewInt(TagInteger, int64(c.timeout/time.Second)),
+		NewBool(false),
+		filter,
+		NewSequence(attrs...),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.Tag {
+		case OpSearchResultEntry:
+			entry, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case OpSearchResultReference:
+			// Referrals to other servers are not followed
+		case OpSearchResultDone:
+			if err := parseResult(op); err != nil {
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, ErrMalformed
+		}
+	}
+}
+
+// Close unbinds and closes the connection
+func (c *Conn) Close() error {
+	if _, err := c.send(Element{Tag: OpUnbindRequest}); err != nil {
+		c.conn.Close()
+		return err
+	}
+	return c.conn.Close()
+}
+
+// send writes a request and returns its message ID
+func (c *Conn) send(op Element) (int64, error) {
+	c.lastID++
+	if err := c.deadline(); err != nil {
+		return 0, err
+	}
+	msg := NewSequence(NewInt(TagInteger, c.lastID), op)
+	if _, err := c.conn.Write(msg.Encode()); err != nil {
+		return 0, err
+	}
+	return c.lastID, nil
+}
+
+// receive reads the next response to the request with the given ID
+func (c *Conn) receive(id int64) (Element, error) {
+	for {
+		msg, err := ReadElement(c.r)
+		if err != nil {
+			return Element{}, err
+		}
+		parts, err := msg.Children()
+		if err != nil || msg.Tag != TagSequence || len(parts) < 2 {
+			return Element{}, ErrMalformed
+		}
+		msgID, err := parts[0].Int()
+		if err != nil {
+			return Element{}, err
+		}
+		switch msgID {
+		case id:
+			return parts[1], nil
+		case 0:
+			// Unsolicited notification, sent before the server disconnects
+			if err := parseResult(parts[1]); err != nil {
+				return Element{}, err
+			}
+			return Element{}, ErrMalformed
+		}
+	}
+}
+
+func (c *Conn) deadline() error {
+	if c.timeout <= 0 {
+		return nil
+	}
+	return c.conn.SetDeadline(time.Now().Add(c.timeout))
+}
+
+// parseResult returns the error of an LDAPResult, or nil on success
+func parseResult(op Element) error {
+	parts, err := op.Children()
+	if err != nil || len(parts) < 3 {
+		return ErrMalformed
+	}
+	code, err := parts[0].Int()
+	if err != nil {
+		return err
+	}
+	if code == ResultSuccess {
+		return nil
+	}
+	return &Error{Code: int(code), Message: parts[2].String()}
+}
+
+func parseEntry(op Element) (*Entry, error) {
+	parts, err := op.Children()
+	if err != nil || len(parts) < 2 {
+		return nil, ErrMalformed
+	}
+	entry := &Entry{DN: parts[0].String(), Attributes: map[string][]string{}}
+
+	attrs, err := parts[1].Children()
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range attrs {
+		fields, err := attr.Children()
+		if err != nil || len(fields) < 2 {
+			return nil, ErrMalformed
+		}
+		values, err := fields[1].Children()
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(fields[0].String())
+		for _, value := range values {
+			entry.Attributes[name] = append(entry.Attributes[name], value.String())
+		}
+	}
+	return entry, nil
+}
+
+// withServerName returns a TLS config that verifies the server's host name
+func withServerName(cfg *tls.Config, host string) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName == "" {
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+	return cfg
+}
@@ -0,0 +1,380 @@
+// Package ldaptest provides a minimal in-memory LDAP server for testing
+// LDAP clients, in the spirit of net/http/httptest. It supports simple
+// binds and searches, keeps passwords in plain text and must never be
+// exposed to real users.
+package ldaptest
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"strings"
+
+	"jiaxun/internal/ldap"
+)
+
+// Entry is a directory entry
+type Entry struct {
+	DN         string              `json:"dn"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// values returns the values of an attribute, matching its name case-insensitively
+func (e *Entry) values(attr string) []string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attr) {
+			return values
+		}
+	}
+	return nil
+}
+
+// SampleDirectory returns a directory below dc=example,dc=edu with the
+// search account cn=reader,dc=example,dc=edu (password "reader") and the
+// users alice (group staff) and bob (group students), whose passwords are
+// "password"
+func SampleDirectory() []*Entry {
+	return []*Entry{
+		{DN: "dc=example,dc=edu", Attributes: map[string][]string{
+			"objectClass": {"domain"}, "dc": {"example"},
+		}},
+		{DN: "cn=reader,dc=example,dc=edu", Attributes: map[string][]string{
+			"objectClass": {"person"}, "cn": {"reader"}, "userPassword": {"reader"},
+		}},
+		{DN: "uid=alice,ou=people,dc=example,dc=edu", Attributes: map[string][]string{
+			"objectClass":  {"inetOrgPerson"},
+			"uid":          {"alice"},
+			"cn":           {"Alice Teacher"},
+			"mail":         {"alice@example.edu"},
+			"entryUUID":    {"0b6a1bb6-8c87-4c43-9b1e-2b0f7f0f0a01"},
+			"memberOf":     {"cn=staff,ou=groups,dc=example,dc=edu"},
+			"userPassword": {"password"},
+		}},
+		{DN: "uid=bob,ou=people,dc=example,dc=edu", Attributes: map[string][]string{
+			"objectClass":  {"inetOrgPerson"},
+			"uid":          {"bob"},
+			"cn":           {"Bob Student"},
+			"mail":         {"bob@example.edu"},
+			"entryUUID":    {"0b6a1bb6-8c87-4c43-9b1e-2b0f7f0f0a02"},
+			"memberOf":     {"cn=students,ou=groups,dc=example,dc=edu"},
+			"userPassword": {"password"},
+		}},
+		{DN: "cn=staff,ou=groups,dc=example,dc=edu", Attributes: map[string][]string{
+			"objectClass": {"groupOfNames"}, "cn": {"staff"},
+			"member": {"uid=alice,ou=people,dc=example,dc=edu"},
+		}},
+		{DN: "cn=students,ou=groups,dc=example,dc=edu", Attributes: map[string][]string{
+			"objectClass": {"groupOfNames"}, "cn": {"students"},
+			"member": {"uid=bob,ou=people,dc=example,dc=edu"},
+		}},
+	}
+}
+
+// Server answers LDAP requests from its directory
+type Server struct {
+	Directory []*Entry
+	// Logger receives a line per bind and search; nil keeps the server quiet
+	Logger *log.Logger
+
+	listener net.Listener
+}
+
+// NewServer starts a server for the directory on a loopback address
+func NewServer(directory []*Entry) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{Directory: directory, listener: listener}
+	go s.accept()
+	return s, nil
+}
+
+// URL returns the ldap:// URL of a server started by NewServer
+func (s *Server) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// Close stops accepting connections
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// Serve accepts connections on the listener until it is closed
+func (s *Server) Serve(listener net.Listener) error {
+	s.listener = listener
+	return s.accept()
+}
+
+func (s *Server) accept() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	}
+}
+
+// serve answers the requests of one connection until it unbinds
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		msg, err := ldap.ReadElement(r)
+		if err != nil {
+			if err != io.EOF {
+				s.logf("Error reading request: %v", err)
+			}
+			return
+		}
+		parts, err := msg.Children()
+		if err != nil || len(parts) < 2 {
+			s.logf("Malformed request")
+			return
+		}
+		id, err := parts[0].Int()
+		if err != nil {
+			return
+		}
+		op := parts[1]
+
+		var responses []ldap.Element
+		switch op.Tag {
+		case ldap.OpBindRequest:
+			responses = []ldap.Element{s.bind(op)}
+		case ldap.OpSearchRequest:
+			responses = s.search(op)
+		case ldap.OpExtendedRequest:
+			responses = []ldap.Element{result(ldap.OpExtendedResponse, ldap.ResultProtocolError, "extended operations are not supported")}
+		case ldap.OpUnbindRequest:
+			return
+		default:
+			s.logf("Unsupported operation %#x", op.Tag)
+			return
+		}
+
+		for _, response := range responses {
+			out := ldap.NewSequence(ldap.NewInt(ldap.TagInteger, id), response)
+			if _, err := conn.Write(out.Encode()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) bind(op ldap.Element) ldap.Element {
+	fields, err := op.Children()
+	if err != nil || len(fields) < 3 {
+		return result(ldap.OpBindResponse, ldap.ResultProtocolError, "malformed bind request")
+	}
+	dn, password := fields[1].String(), fields[2].String()
+
+	if dn == "" && password == "" {
+		return result(ldap.OpBindResponse, ldap.ResultSuccess, "")
+	}
+	if e := find(s.Directory, dn); e != nil && password != "" {
+		for _, p := range e.values("userPassword") {
+			if p == password {
+				s.logf("Bound as %s", dn)
+				return result(ldap.OpBindResponse, ldap.ResultSuccess, "")
+			}
+		}
+	}
+	s.logf("Rejected bind as %s", dn)
+	return result(ldap.OpBindResponse, ldap.ResultInvalidCredentials, "invalid credentials")
+}
+
+func (s *Server) search(op ldap.Element) []ldap.Element {
+	fields, err := op.Children()
+	if err != nil || len(fields) < 8 {
+		return []ldap.Element{result(ldap.OpSearchResultDone, ldap.ResultProtocolError, "malformed search request")}
+	}
+	base := normalizeDN(fields[0].String())
+	scope, _ := fields[1].Int()
+	sizeLimit, _ := fields[3].Int()
+	filter := fields[6]
+	attrElements, _ := fields[7].Children()
+	var attrs []string
+	for _, a := range attrElements {
+		attrs = append(attrs, a.String())
+	}
+
+	var responses []ldap.Element
+	for _, e := range s.Directory {
+		if !inScope(normalizeDN(e.DN), base, scope) || !matches(filter, e) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(responses)) == sizeLimit {
+			return append(responses, result(ldap.OpSearchResultDone, ldap.ResultSizeLimitExceeded, ""))
+		}
+		responses = append(responses, searchEntry(e, attrs))
+	}
+	s.logf("Search below %q found %d entries", base, len(responses))
+	return append(responses, result(ldap.OpSearchResultDone, ldap.ResultSuccess, ""))
+}
+
+// searchEntry encodes an entry with the requested attributes, never
+// returning passwords
+func searchEntry(e *Entry, attrs []string) ldap.Element {
+	var list []ldap.Element
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, "userPassword") || !requested(name, attrs) {
+			continue
+		}
+		var vals []ldap.Element
+		for _, v := range values {
+			vals = append(vals, ldap.NewString(ldap.TagOctetString, v))
+		}
+		list = append(list, ldap.NewSequence(
+			ldap.NewString(ldap.TagOctetString, name),
+			ldap.NewConstructed(ldap.TagSet, vals...),
+		))
+	}
+	return ldap.NewConstructed(ldap.OpSearchResultEntry,
+		ldap.NewString(ldap.TagOctetString, e.DN),
+		ldap.NewSequence(list...),
+	)
+}
+
+func requested(name string, attrs []string) bool {
+	if len(attrs) == 0 {
+		return true
+	}
+	for _, a := range attrs {
+		if a == "*" || strings.EqualFold(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches evaluates a search filter against an entry
+func matches(filter ldap.Element, e *Entry) bool {
+	children, _ := filter.Children()
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range children {
+			if !matches(child, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range children {
+			if matches(child, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(children) == 1 && !matches(children[0], e)
+	case ldap.FilterPresent:
+		return len(e.values(filter.String())) > 0
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch, ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		if len(children) != 2 {
+			return false
+		}
+		want := strings.ToLower(children[1].String())
+		for _, v := range e.values(children[0].String()) {
+			v = strings.ToLower(v)
+			switch {
+			case filter.Tag == ldap.FilterGreaterOrEqual && v >= want,
+				filter.Tag == ldap.FilterLessOrEqual && v <= want,
+				v == want:
+				return true
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		if len(children) != 2 {
+			return false
+		}
+		subs, _ := children[1].Children()
+		for _, v := range e.values(children[0].String()) {
+			if matchSubstrings(strings.ToLower(v), subs) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func matchSubstrings(v string, subs []ldap.Element) bool {
+	for _, sub := range subs {
+		part := strings.ToLower(sub.String())
+		switch sub.Tag {
+		case ldap.SubstringInitial:
+			if !strings.HasPrefix(v, part) {
+				return false
+			}
+			v = v[len(part):]
+		case ldap.SubstringAny:
+			i := strings.Index(v, part)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(part):]
+		case ldap.SubstringFinal:
+			if !strings.HasSuffix(v, part) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func inScope(dn, base string, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == base
+	case ldap.ScopeSingleLevel:
+		parent := ""
+		if _, rest, ok := strings.Cut(dn, ","); ok {
+			parent = rest
+		}
+		return parent == base
+	default:
+		return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+	}
+}
+
+func find(directory []*Entry, dn string) *Entry {
+	dn = normalizeDN(dn)
+	for _, e := range directory {
+		if normalizeDN(e.DN) == dn {
+			return e
+		}
+	}
+	return nil
+}
+
+// normalizeDN lower-cases a DN and removes spaces around its separators
+func normalizeDN(dn string) string {
+	if dn == "" {
+		return ""
+	}
+	rdns := strings.Split(strings.ToLower(dn), ",")
+	for i, rdn := range rdns {
+		attr, value, _ := strings.Cut(rdn, "=")
+		rdns[i] = strings.TrimSpace(attr) + "=" + strings.TrimSpace(value)
+	}
+	return strings.Join(rdns, ",")
+}
+
+func result(tag byte, code int, message string) ldap.Element {
+	return ldap.NewConstructed(tag,
+		ldap.NewInt(ldap.TagEnumerated, int64(code)),
+		ldap.NewString(ldap.TagOctetString, ""),
+		ldap.NewString(ldap.TagOctetString, message),
+	)
+}
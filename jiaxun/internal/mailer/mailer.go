@@ -0,0 +1,108 @@
+// Package mailer sends transactional email such as verification links.
+//
+// The backend is chosen by configuration: "smtp" delivers through an SMTP
+// server, while "log" and "file" only record messages for local testing.
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"jiaxun/internal/config"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New creates the mailer selected by the configuration
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Backend {
+	case config.MailBackendLog:
+		return &LogMailer{}, nil
+	case config.MailBackendFile:
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return nil, fmt.Errorf("creating mail directory: %w", err)
+		}
+		return &FileMailer{from: cfg.From, dir: cfg.Dir}, nil
+	case config.MailBackendSMTP:
+		return &SMTPMailer{from: cfg.From, cfg: cfg.SMTP}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mail backend: %s", cfg.Backend)
+	}
+}
+
+// LogMailer writes messages to the application log
+type LogMailer struct{}
+
+// Send logs the message
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes each message to its own .eml file in a directory
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+// Send writes the message to a new file
+func (m *FileMailer) Send(msg Message) error {
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(m.dir, name), format(m.from, msg), 0644)
+}
+
+// SMTPMailer delivers messages through an SMTP server
+type SMTPMailer struct {
+	from string
+	cfg  config.SMTPConfig
+}
+
+// Send delivers the message, authenticating if credentials are configured
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	return smtp.SendMail(addr, auth, m.from, []string{msg.To}, format(m.from, msg))
+}
+
+// format renders a message in RFC 5322 form
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// sanitize makes an address safe to use in a file name
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, s)
+}
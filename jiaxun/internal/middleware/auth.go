@@ -1,9 +1,12 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"fmt"
 	"jiaxun/internal/config"
+	"jiaxun/internal/keyring"
+	"jiaxun/internal/model"
 	"strings"
 	"time"
 
@@ -16,16 +19,127 @@ type JWTClaims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
+	// SessionID identifies the refresh token family the token was issued for
+	SessionID string `json:"sid,omitempty"`
+	// MFA is set when the session was established with a second factor
+	MFA bool `json:"mfa,omitempty"`
+	// ActorID and ImpersonationID are set on impersonation tokens, issued to
+	// ActorID to act as UserID
+	ActorID         uint   `json:"actor_id,omitempty"`
+	ImpersonationID string `json:"imp,omitempty"`
 	jwt.RegisteredClaims
 }
 
+var keys *keyring.Keyring
+
+// SetKeyring installs the keys access tokens are signed and verified with
+func SetKeyring(k *keyring.Keyring) {
+	keys = k
+}
+
+// tokenKeys returns the installed keyring, or one signing with HS256 and
+// the application secret if none was installed
+func tokenKeys() *keyring.Keyring {
+	if keys == nil {
+		return keyring.NewHMAC([]byte(config.GetConfig().Application.Secret))
+	}
+	return keys
+}
+
+// ErrUnknownUser is returned by a PermissionResolver for users that no longer exist
+var ErrUnknownUser = errors.New("user no longer exists")
+
+// PermissionResolver looks up the current role and permissions of a user.
+// The role in the token is only a snapshot taken at login, so the resolver
+// keeps authorization in sync when a user's role or a role's permissions change.
+type PermissionResolver interface {
+	ResolvePermissions(userID uint) (role string, permissions []string, err error)
+}
+
+var permissionResolver PermissionResolver
+
+// SetPermissionResolver installs the resolver consulted by AuthMiddleware
+func SetPermissionResolver(resolver PermissionResolver) {
+	permissionResolver = resolver
+}
+
+// RevocationList reports whether an access token has been revoked before its expiry
+type RevocationList interface {
+	IsRevoked(jti string) (bool, error)
+}
+
+var revocationList RevocationList
+
+// SetRevocationList installs the revocation list consulted by AuthMiddleware
+func SetRevocationList(list RevocationList) {
+	revocationList = list
+}
+
+// PersonalAccessTokenPrefix marks bearer tokens that are personal access
+// tokens rather than JWTs
+const PersonalAccessTokenPrefix = "jxp_"
+
+// ErrInvalidAccessToken is returned by an AccessTokenAuthenticator for
+// unknown, expired or revoked tokens
+var ErrInvalidAccessToken = errors.New("invalid or expired access token")
+
+// AccessTokenAuthenticator resolves personal access tokens to their owner
+// and the scopes they were created with
+type AccessTokenAuthenticator interface {
+	AuthenticateAccessToken(token string) (userID uint, scopes []string, err error)
+}
+
+var accessTokenAuthenticator AccessTokenAuthenticator
+
+// SetAccessTokenAuthenticator installs the authenticator consulted by
+// AuthMiddleware for personal access tokens
+func SetAccessTokenAuthenticator(authenticator AccessTokenAuthenticator) {
+	accessTokenAuthenticator = authenticator
+}
+
+// ImpersonationAuditor keeps track of impersonations: it reports whether
+// one may still be used and records every request made in it
+type ImpersonationAuditor interface {
+	IsActive(impersonationID string) (bool, error)
+	RecordRequest(impersonationID, method, path string, status int, blocked bool)
+}
+
+var impersonationAuditor ImpersonationAuditor
+
+// SetImpersonationAuditor installs the auditor consulted by AuthMiddleware
+// for impersonation tokens
+func SetImpersonationAuditor(auditor ImpersonationAuditor) {
+	impersonationAuditor = auditor
+}
+
+// Paths that change data but are still reachable with an impersonation
+// token, so that the impersonation can be ended
+var impersonationWritePaths = []string{
+	"/api/auth/impersonation/end",
+}
+
 // Public paths that don't require authentication
 var publicPaths = []string{
 	"/api/auth/login",
 	"/api/auth/register",
+	"/api/auth/refresh",
+	"/api/auth/verify-email",
+	"/api/auth/resend-verification",
+	"/api/auth/forgot-password",
+	"/api/auth/reset-password",
+	"/api/auth/2fa/verify",
+	"/api/auth/oidc",
 	"/api/health",
 }
 
+// Paths still reachable by privileged sessions without a second factor when
+// two-factor authentication is mandatory, so that it can be set up
+var mfaSetupPaths = []string{
+	"/api/auth/2fa",
+	"/api/auth/logout",
+	"/api/users/me",
+}
+
 // AuthMiddleware authenticates requests using JWT
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -56,75 +170,242 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := parts[1]
 
-		// Parse and validate the token
-		claims := &JWTClaims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-
-			jwtSecret := []byte(config.GetConfig().Application.Secret) // Get secret key from config
-			return jwtSecret, nil
-		})
-
-		// Handle token validation errors
-		if err != nil {
-			if errors.Is(err, jwt.ErrTokenExpired) {
-				c.JSON(401, gin.H{"error": "Token has expired"})
-			} else if errors.Is(err, jwt.ErrTokenMalformed) {
-				c.JSON(401, gin.H{"error": "Malformed token"})
-			} else if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
-				c.JSON(401, gin.H{"error": "Invalid token signature"})
-			} else {
-				c.JSON(401, gin.H{"error": "Invalid token: " + err.Error()})
-			}
+		// Personal access tokens are looked up in the database, anything
+		// else must be a JWT
+		var claims *JWTClaims
+		var scopes []string
+		var ok bool
+		viaAccessToken := strings.HasPrefix(tokenString, PersonalAccessTokenPrefix)
+		if viaAccessToken {
+			claims, scopes, ok = authenticateAccessToken(c, tokenString)
+		} else {
+			claims, ok = authenticateJWT(c, tokenString)
+		}
+		if !ok {
 			c.Abort()
 			return
 		}
 
-		// Ensure the token is valid
-		if !token.Valid {
-			c.JSON(401, gin.H{"error": "Invalid token"})
+		// Impersonation tokens are read-only and stop working once the
+		// impersonation ends
+		impersonating := claims.ImpersonationID != ""
+		if impersonating && !checkImpersonation(c, claims) {
 			c.Abort()
 			return
 		}
 
+		// Load the user's current role and permissions
+		role := claims.Role
+		var permissions []string
+		if permissionResolver != nil {
+			var err error
+			role, permissions, err = permissionResolver.ResolvePermissions(claims.UserID)
+			if err != nil {
+				if errors.Is(err, ErrUnknownUser) {
+					c.JSON(401, gin.H{"error": "User no longer exists"})
+				} else {
+					c.JSON(500, gin.H{"error": "Failed to load permissions"})
+				}
+				c.Abort()
+				return
+			}
+		}
+
+		// Access tokens only keep the scopes the role still grants
+		if viaAccessToken {
+			permissions = restrictToScopes(permissions, scopes)
+		}
+
+		// Privileged sessions must have used a second factor if required.
+		// Access tokens can only be created from sessions that passed this check.
+		if config.GetConfig().Auth.RequireMFAForPrivileged && len(permissions) > 0 && !claims.MFA && !viaAccessToken {
+			allowed := false
+			for _, p := range mfaSetupPaths {
+				if strings.HasPrefix(path, p) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				c.JSON(403, gin.H{"error": "Two-factor authentication is required for this account; set it up and log in again"})
+				c.Abort()
+				return
+			}
+		}
+
 		// Set the user ID and role in the context for use in handlers
 		c.Set("userID", claims.UserID)
 		c.Set("email", claims.Email)
-		c.Set("role", claims.Role)
+		c.Set("role", role)
+		c.Set("permissions", permissions)
+		c.Set("claims", claims)
+		c.Set("viaAccessToken", viaAccessToken)
+		if impersonating {
+			c.Set("actorID", claims.ActorID)
+		}
 
 		c.Next()
+
+		if impersonating {
+			impersonationAuditor.RecordRequest(claims.ImpersonationID, c.Request.Method, c.Request.URL.RequestURI(), c.Writer.Status(), false)
+		}
+	}
+}
+
+// checkImpersonation checks that an impersonation token may be used for the
+// request. On failure it writes the response and returns false.
+func checkImpersonation(c *gin.Context, claims *JWTClaims) bool {
+	if impersonationAuditor == nil {
+		c.JSON(401, gin.H{"error": "Impersonation is not supported"})
+		return false
+	}
+
+	active, err := impersonationAuditor.IsActive(claims.ImpersonationID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to verify token"})
+		return false
+	}
+	if !active {
+		c.JSON(401, gin.H{"error": "Impersonation has ended"})
+		return false
+	}
+
+	switch c.Request.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+	for _, p := range impersonationWritePaths {
+		if c.Request.URL.Path == p {
+			return true
+		}
+	}
+	c.JSON(403, gin.H{"error": "This action is not allowed while impersonating"})
+	impersonationAuditor.RecordRequest(claims.ImpersonationID, c.Request.Method, c.Request.URL.RequestURI(), 403, true)
+	return false
+}
+
+// authenticateJWT validates a JWT and checks that it was not revoked. On
+// failure it writes the response and returns false.
+func authenticateJWT(c *gin.Context, tokenString string) (*JWTClaims, bool) {
+	// The keyring picks the key by the token's kid and checks its algorithm
+	claims := &JWTClaims{}
+	k := tokenKeys()
+	token, err := jwt.ParseWithClaims(tokenString, claims, k.Keyfunc, jwt.WithValidMethods(k.Methods()))
+
+	// Handle token validation errors
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			c.JSON(401, gin.H{"error": "Token has expired"})
+		} else if errors.Is(err, jwt.ErrTokenMalformed) {
+			c.JSON(401, gin.H{"error": "Malformed token"})
+		} else if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			c.JSON(401, gin.H{"error": "Invalid token signature"})
+		} else {
+			c.JSON(401, gin.H{"error": "Invalid token: " + err.Error()})
+		}
+		return nil, false
+	}
+
+	// Ensure the token is valid
+	if !token.Valid {
+		c.JSON(401, gin.H{"error": "Invalid token"})
+		return nil, false
+	}
+
+	// Reject tokens that were revoked, e.g. by logging out
+	if revocationList != nil {
+		if claims.ID == "" {
+			c.JSON(401, gin.H{"error": "Invalid token: missing token ID"})
+			return nil, false
+		}
+		revoked, err := revocationList.IsRevoked(claims.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to verify token"})
+			return nil, false
+		}
+		if revoked {
+			c.JSON(401, gin.H{"error": "Token has been revoked"})
+			return nil, false
+		}
 	}
+
+	return claims, true
 }
 
-// GenerateToken generates a new JWT token for a user
-func GenerateToken(userID uint, email, role string) (string, error) {
-	// Set the expiration time for the token (e.g., 24 hours)
-	expirationTime := time.Now().Add(24 * time.Hour)
+// authenticateAccessToken resolves a personal access token. On failure it
+// writes the response and returns false.
+func authenticateAccessToken(c *gin.Context, tokenString string) (*JWTClaims, []string, bool) {
+	if accessTokenAuthenticator == nil {
+		c.JSON(401, gin.H{"error": "Personal access tokens are not supported"})
+		return nil, nil, false
+	}
 
-	// Create the JWT claims
-	claims := &JWTClaims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "jiaxun",
-		},
+	userID, scopes, err := accessTokenAuthenticator.AuthenticateAccessToken(tokenString)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAccessToken) {
+			c.JSON(401, gin.H{"error": "Invalid, expired or revoked access token"})
+		} else {
+			c.JSON(500, gin.H{"error": "Failed to verify token"})
+		}
+		return nil, nil, false
 	}
 
-	// Create the token with the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return &JWTClaims{UserID: userID}, scopes, true
+}
+
+// restrictToScopes returns the scopes that the granted permissions still cover
+func restrictToScopes(granted, scopes []string) []string {
+	permissions := []string{}
+	for _, scope := range scopes {
+		if model.HasPermission(granted, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+	return permissions
+}
+
+// ViaAccessToken reports whether the request was authenticated with a
+// personal access token rather than a login session
+func ViaAccessToken(c *gin.Context) bool {
+	return c.GetBool("viaAccessToken")
+}
 
-	// Sign the token with the secret key
-	jwtSecret := []byte(config.GetConfig().Application.Secret)
-	tokenString, err := token.SignedString(jwtSecret)
+// ImpersonatorID returns the ID of the administrator acting as the
+// authenticated user, or 0 if the request is not impersonated
+func ImpersonatorID(c *gin.Context) uint {
+	return c.GetUint("actorID")
+}
+
+// GenerateToken signs a new access token for the user and session described
+// by claims. The token ID, issue time and expiry are filled in.
+func GenerateToken(claims *JWTClaims, ttl time.Duration) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        jti,
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		Issuer:    "jiaxun",
+	}
+
+	// Sign the token with the current signing key
+	tokenString, err := tokenKeys().Sign(claims)
 	if err != nil {
 		return "", err
 	}
 
 	return tokenString, nil
 }
+
+// newTokenID returns a random identifier for the jti claim
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
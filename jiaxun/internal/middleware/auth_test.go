@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"jiaxun/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessTokens authenticates personal access tokens from a fixed set
+type accessTokens map[string]struct {
+	userID uint
+	scopes []string
+}
+
+func (a accessTokens) AuthenticateAccessToken(token string) (uint, []string, error) {
+	t, ok := a[token]
+	if !ok {
+		return 0, nil, ErrInvalidAccessToken
+	}
+	return t.userID, t.scopes, nil
+}
+
+func TestRestrictToScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted []string
+		scopes  []string
+		want    []string
+	}{
+		{"scopes the role grants", testRoles[model.RoleTeacher], []string{model.PermUsersRead, model.PermContestsManage}, []string{model.PermUsersRead, model.PermContestsManage}},
+		{"scopes beyond the role", testRoles[model.RoleTeacher], []string{model.PermUsersRead, model.PermRolesManage}, []string{model.PermUsersRead}},
+		{"wildcard role keeps the scopes only", testRoles[model.RoleAdmin], []string{model.PermUsersRead}, []string{model.PermUsersRead}},
+		{"wildcard scope of a wildcard role", testRoles[model.RoleAdmin], []string{model.PermAll}, []string{model.PermAll}},
+		{"wildcard scope of a lesser role", testRoles[model.RoleTeacher], []string{model.PermAll}, []string{}},
+		{"role without permissions", testRoles[model.RoleStudent], []string{model.PermUsersRead}, []string{}},
+		{"no scopes", testRoles[model.RoleAdmin], nil, []string{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := restrictToScopes(tc.granted, tc.scopes); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("restrictToScopes(%q, %q) = %q, want %q", tc.granted, tc.scopes, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareAccessToken(t *testing.T) {
+	const (
+		teacher = iota + 1
+		student
+	)
+	users := directory{teacher: model.RoleTeacher, student: model.RoleStudent}
+	useTestAuth(t, users)
+	SetAccessTokenAuthenticator(accessTokens{
+		PersonalAccessTokenPrefix + "teacher": {teacher, []string{model.PermUsersRead, model.PermRolesManage}},
+		PersonalAccessTokenPrefix + "student": {student, []string{model.PermUsersRead}},
+	})
+
+	r := gin.New()
+	api := r.Group("/api", AuthMiddleware())
+	api.GET("/permissions", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"permissions": Permissions(c), "access_token": ViaAccessToken(c)})
+	})
+	api.DELETE("/session-only", RequireSession(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	permissions := func(t *testing.T, auth string) []string {
+		t.Helper()
+		w := serve(r, http.MethodGet, "/api/permissions", auth)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/permissions = %d %s", w.Code, w.Body)
+		}
+		var body struct {
+			Permissions []string `json:"permissions"`
+			AccessToken bool     `json:"access_token"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if !body.AccessToken {
+			t.Error("request is not marked as authenticated with an access token")
+		}
+		return body.Permissions
+	}
+
+	t.Run("scopes the role no longer grants are dropped", func(t *testing.T) {
+		got := permissions(t, "Bearer "+PersonalAccessTokenPrefix+"teacher")
+		if want := []string{model.PermUsersRead}; !reflect.DeepEqual(got, want) {
+			t.Errorf("permissions = %q, want %q", got, want)
+		}
+	})
+	t.Run("demoted owner", func(t *testing.T) {
+		if got := permissions(t, "Bearer "+PersonalAccessTokenPrefix+"student"); len(got) != 0 {
+			t.Errorf("permissions = %q, want none", got)
+		}
+	})
+	t.Run("unknown token", func(t *testing.T) {
+		w := serve(r, http.MethodGet, "/api/permissions", "Bearer "+PersonalAccessTokenPrefix+"revoked")
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("GET /api/permissions = %d %s, want 401", w.Code, w.Body)
+		}
+	})
+	t.Run("session-only route", func(t *testing.T) {
+		w := serve(r, http.MethodDelete, "/api/session-only", "Bearer "+PersonalAccessTokenPrefix+"teacher")
+		if w.Code != http.StatusForbidden {
+			t.Errorf("with an access token = %d %s, want 403", w.Code, w.Body)
+		}
+		w = serve(r, http.MethodDelete, "/api/session-only", bearer(t, &JWTClaims{UserID: teacher}))
+		if w.Code != http.StatusOK {
+			t.Errorf("with a session = %d %s, want 200", w.Code, w.Body)
+		}
+	})
+}
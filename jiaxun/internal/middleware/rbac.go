@@ -1,9 +1,13 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"jiaxun/internal/model"
+	"jiaxun/internal/policy"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -23,8 +27,8 @@ func LoginRequired() gin.HandlerFunc {
 	}
 }
 
-// TeacherRequired ensures a user has teacher role
-func TeacherRequired() gin.HandlerFunc {
+// RequirePermission ensures the authenticated user's role grants all of the given permissions
+func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// First ensure user is authenticated
 		userID, exists := c.Get("userID")
@@ -34,19 +38,48 @@ func TeacherRequired() gin.HandlerFunc {
 			return
 		}
 
-		// Then check for teacher role
-		role, exists := c.Get("role")
-		if !exists || role != "teacher" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Teacher privileges required"})
+		// Then check every required permission
+		granted := Permissions(c)
+		for _, p := range permissions {
+			if !model.HasPermission(granted, p) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission: " + p})
+				c.Abort()
+				return
+			}
+		}
+
+		// User has all permissions, continue
+		c.Next()
+	}
+}
+
+// RequireSession refuses personal access tokens on routes that only act on
+// what users may do by themselves, such as joining a team. No scope covers
+// these routes, so a token must not reach them.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ViaAccessToken(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action cannot be performed with an access token"})
 			c.Abort()
 			return
 		}
-
-		// User is teacher, continue
 		c.Next()
 	}
 }
 
+// Permissions returns the permissions of the authenticated user (set by AuthMiddleware)
+func Permissions(c *gin.Context) []string {
+	granted, _ := c.Get("permissions")
+	permissions, _ := granted.([]string)
+	return permissions
+}
+
+// Subject returns the authenticated user as a policy subject
+func Subject(c *gin.Context) policy.Subject {
+	userID, _ := c.Get("userID")
+	id, _ := userID.(uint)
+	return policy.Subject{UserID: id, Permissions: Permissions(c), AccessToken: ViaAccessToken(c)}
+}
 
 // CanModifyUser checks if the authenticated user has permission to modify the target user
 func CanModifyUser() gin.HandlerFunc {
@@ -60,30 +93,51 @@ func CanModifyUser() gin.HandlerFunc {
 			return
 		}
 
-		// Get the authenticated user's ID and role from the context
-		authenticatedUserID, exists := c.Get("userID")
-		if !exists {
+		// Ensure the user is authenticated
+		if _, exists := c.Get("userID"); !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 			c.Abort()
 			return
 		}
 
-		userRole, _ := c.Get("role")
-
-		// Teachers can modify any user
-		if userRole == "teacher" {
-			c.Next()
-			return
+		// Users may modify themselves, users:write may modify anyone who
+		// does not outrank them
+		action := policy.ActionUpdate
+		if c.Request.Method == http.MethodDelete {
+			action = policy.ActionDelete
 		}
-
-		// Regular users can only modify themselves
-		if authenticatedUserID.(uint) == uint(targetID) {
-			c.Next()
+		target := &policy.UserTarget{User: &model.User{ID: uint(targetID)}}
+		subject := Subject(c)
+		if target.User.ID != subject.UserID {
+			permissions, err := targetPermissions(target.User.ID)
+			if err != nil {
+				if errors.Is(err, ErrUnknownUser) {
+					c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				} else {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+				}
+				c.Abort()
+				return
+			}
+			target.Permissions = permissions
+		}
+		if err := policy.Users.Authorize(subject, action, target); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": policy.Message(err)})
+			c.Abort()
 			return
 		}
 
-		// User is not authorized to modify this user
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only modify your own profile"})
-		c.Abort()
+		c.Next()
+	}
+}
+
+// targetPermissions returns the permissions of a user acted upon. Without a
+// resolver their role is unknown, so they are assumed to hold every
+// permission.
+func targetPermissions(userID uint) ([]string, error) {
+	if permissionResolver == nil {
+		return []string{model.PermAll}, nil
 	}
+	_, permissions, err := permissionResolver.ResolvePermissions(userID)
+	return permissions, err
 }
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"jiaxun/internal/keyring"
+	"jiaxun/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testRoles are the permissions of the roles seeded by the migrations, and
+// of a custom role granting only part of the teacher's
+var testRoles = map[string][]string{
+	model.RoleAdmin:   {model.PermAll},
+	model.RoleTeacher: {model.PermUsersRead, model.PermUsersWrite, model.PermContestsManage, model.PermTeamsApprove, model.PermTrainingManage, model.PermProblemsManage},
+	model.RoleStudent: nil,
+	"grader":          {model.PermUsersWrite, model.PermContestsManage},
+}
+
+// directory resolves the permissions of users from their role
+type directory map[uint]string
+
+func (d directory) ResolvePermissions(userID uint) (string, []string, error) {
+	role, ok := d[userID]
+	if !ok {
+		return "", nil, ErrUnknownUser
+	}
+	return role, testRoles[role], nil
+}
+
+// useTestAuth makes AuthMiddleware sign and verify tokens with a test key
+// and resolve permissions from the directory, until the test ends
+func useTestAuth(t *testing.T, users directory) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	SetKeyring(keyring.NewHMAC([]byte("test secret")))
+	SetPermissionResolver(users)
+	t.Cleanup(func() {
+		SetKeyring(nil)
+		SetPermissionResolver(nil)
+		SetRevocationList(nil)
+		SetAccessTokenAuthenticator(nil)
+		SetImpersonationAuditor(nil)
+	})
+}
+
+// bearer signs an access token for the claims and returns it as an
+// Authorization header
+func bearer(t *testing.T, claims *JWTClaims) string {
+	t.Helper()
+	token, err := GenerateToken(claims, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return "Bearer " + token
+}
+
+// serve sends a request through the router and returns the response
+func serve(r http.Handler, method, target, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCanModifyUser(t *testing.T) {
+	const (
+		root = iota + 1
+		admin
+		teacher
+		otherTeacher
+		student
+		otherStudent
+		grader
+	)
+	useTestAuth(t, directory{
+		root:         model.RoleAdmin,
+		admin:        model.RoleAdmin,
+		teacher:      model.RoleTeacher,
+		otherTeacher: model.RoleTeacher,
+		student:      model.RoleStudent,
+		otherStudent: model.RoleStudent,
+		grader:       "grader",
+	})
+
+	r := gin.New()
+	users := r.Group("/api/users", AuthMiddleware())
+	owner := users.Group("/:id", CanModifyUser())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	owner.PUT("", ok)
+	owner.DELETE("", ok)
+
+	tests := []struct {
+		name   string
+		actor  uint
+		method string
+		target string
+		want   int
+	}{
+		// A teacher holds users:write, but must not take over an admin
+		{"teacher sets the password of root", teacher, http.MethodPut, "1", http.StatusForbidden},
+		{"teacher deletes an admin", teacher, http.MethodDelete, "2", http.StatusForbidden},
+		{"teacher updates a student", teacher, http.MethodPut, "5", http.StatusOK},
+		{"teacher deletes a student", teacher, http.MethodDelete, "5", http.StatusOK},
+		{"teacher updates another teacher", teacher, http.MethodPut, "4", http.StatusOK},
+		{"teacher updates a lesser role", teacher, http.MethodPut, "7", http.StatusOK},
+		{"teacher updates themselves", teacher, http.MethodPut, "3", http.StatusOK},
+		{"partial role updates a teacher", grader, http.MethodPut, "3", http.StatusForbidden},
+		{"partial role updates a student", grader, http.MethodPut, "5", http.StatusOK},
+		{"admin updates root", admin, http.MethodPut, "1", http.StatusOK},
+		{"admin deletes a teacher", admin, http.MethodDelete, "3", http.StatusOK},
+		{"student updates another student", student, http.MethodPut, "6", http.StatusForbidden},
+		{"student deletes themselves", student, http.MethodDelete, "5", http.StatusOK},
+		{"teacher updates an unknown user", teacher, http.MethodPut, "99", http.StatusNotFound},
+		{"invalid user ID", teacher, http.MethodPut, "me", http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(r, tc.method, "/api/users/"+tc.target, bearer(t, &JWTClaims{UserID: tc.actor}))
+			if w.Code != tc.want {
+				t.Errorf("%s /api/users/%s = %d %s, want %d", tc.method, tc.target, w.Code, w.Body, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+// Package migration applies versioned schema migrations.
+//
+// Migrations are plain SQL files embedded per dialect, named
+// <version>_<name>.up.sql and <version>_<name>.down.sql. Applied versions are
+// tracked in the schema_migrations table.
+package migration
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sqlite/*.sql postgres/*.sql
+var files embed.FS
+
+// Migration errors
+var (
+	ErrSchemaOutdated    = errors.New("database schema has pending migrations")
+	ErrSchemaTooNew      = errors.New("database schema is newer than this binary")
+	ErrUnsupportedDriver = errors.New("migrations are not available for this database driver")
+	ErrNothingToRollback = errors.New("no applied migrations to roll back")
+)
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes a known or applied migration
+type Status struct {
+	Version   uint       `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// Unknown is set for versions recorded in the database but missing from the binary
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// schemaMigration is a row of the schema_migrations table
+type schemaMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator applies the migrations of the connected database's dialect
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New creates a migrator for the dialect of db
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := load(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// load reads and pairs the embedded migration files of a dialect
+func load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedDriver, dialect)
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unexpected migration file %s", name)
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionStr, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration file %s must be named <version>_<name>", name)
+		}
+		version, err := strconv.ParseUint(versionStr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version in migration file %s: %w", name, err)
+		}
+
+		data, err := files.ReadFile(path.Join(dialect, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: label}
+			byVersion[uint(version)] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// ensureTable creates the schema_migrations table if needed
+func (m *Migrator) ensureTable() error {
+	return m.db.Exec(`CREATE TABLE IF NOT EXISTS "schema_migrations" (
+		"version" bigint PRIMARY KEY,
+		"name" varchar(255) NOT NULL,
+		"applied_at" timestamp NOT NULL
+	)`).Error
+}
+
+// applied returns the recorded migrations ordered by version
+func (m *Migrator) applied() ([]schemaMigration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	var rows []schemaMigration
+	if err := m.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Up applies all pending migrations in order, each in its own transaction,
+// and returns the ones that were applied
+func (m *Migrator) Up() ([]Migration, error) {
+	rows, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	done := map[uint]bool{}
+	for _, row := range rows {
+		done[row.Version] = true
+	}
+	if latest := m.latest(); len(rows) > 0 && rows[len(rows)-1].Version > latest {
+		return nil, ErrSchemaTooNew
+	}
+
+	var ran []Migration
+	for _, migration := range m.migrations {
+		if done[migration.Version] {
+			continue
+		}
+		err := m.transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("applying migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// Down rolls back the given number of most recently applied migrations
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	rows, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNothingToRollback
+	}
+
+	known := map[uint]Migration{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	var ran []Migration
+	for i := len(rows) - 1; i >= 0 && len(ran) < steps; i-- {
+		migration, ok := known[rows[i].Version]
+		if !ok {
+			return ran, fmt.Errorf("%w: cannot roll back unknown migration %d", ErrSchemaTooNew, rows[i].Version)
+		}
+		err := m.transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("rolling back migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// transaction runs a migration step in a transaction.
+//
+// SQLite can only change most of a table's definition by rebuilding it, and
+// dropping a table that others reference would delete or detach their rows.
+// As SQLite recommends, foreign keys are therefore not enforced while
+// migrating, and are checked all at once before committing.
+func (m *Migrator) transaction(fn func(tx *gorm.DB) error) error {
+	if m.db.Dialector.Name() != "sqlite" {
+		return m.db.Transaction(fn)
+	}
+
+	// The pragma applies to a single connection and cannot be changed
+	// within a transaction
+	return m.db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+			return err
+		}
+		defer conn.Exec("PRAGMA foreign_keys = ON")
+
+		return conn.Transaction(func(tx *gorm.DB) error {
+			if err := fn(tx); err != nil {
+				return err
+			}
+			var violations []struct {
+				Table  string
+				Parent string
+			}
+			if err := tx.Raw("PRAGMA foreign_key_check").Scan(&violations).Error; err != nil {
+				return err
+			}
+			if len(violations) > 0 {
+				return fmt.Errorf("rows of %s reference missing rows of %s", violations[0].Table, violations[0].Parent)
+			}
+			return nil
+		})
+	})
+}
+
+// Status lists every known migration together with the applied ones
+// that this binary does not know about
+func (m *Migrator) Status() ([]Status, error) {
+	rows, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := map[uint]time.Time{}
+	for _, row := range rows {
+		appliedAt[row.Version] = row.AppliedAt
+	}
+
+	var statuses []Status
+	known := map[uint]bool{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if t, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &t
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range rows {
+		if !known[row.Version] {
+			t := row.AppliedAt
+			statuses = append(statuses, Status{Version: row.Version, Name: row.Name, AppliedAt: &t, Unknown: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Check verifies that the database schema matches this binary exactly
+func (m *Migrator) Check() error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.Unknown {
+			return fmt.Errorf("%w: unknown migration %d_%s", ErrSchemaTooNew, status.Version, status.Name)
+		}
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			return fmt.Errorf("%w: %d_%s not applied", ErrSchemaOutdated, status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+// latest returns the highest known migration version
+func (m *Migrator) latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
@@ -0,0 +1,269 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openSQLite opens an empty SQLite database in a temporary file
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=on"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	return db
+}
+
+// openPostgres opens an empty schema of the PostgreSQL database named by
+// JIAXUN_TEST_POSTGRES_DSN, skipping the test if it is not set. The schema is
+// dropped afterwards.
+func openPostgres(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("JIAXUN_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("JIAXUN_TEST_POSTGRES_DSN is not set")
+	}
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	name := fmt.Sprintf("migration_test_%d", time.Now().UnixNano())
+	if err := admin.Exec(`CREATE SCHEMA "` + name + `"`).Error; err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := admin.Exec(`DROP SCHEMA "` + name + `" CASCADE`).Error; err != nil {
+			t.Errorf("dropping schema: %v", err)
+		}
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	// Every connection of the pool looks up unqualified names in the schema
+	if strings.Contains(dsn, "://") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + "search_path=" + name
+	} else {
+		dsn += " search_path=" + name
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("opening schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// schema returns the definitions of the tables and indexes of a database,
+// leaving out the ones the database and the migrator maintain
+func schema(t *testing.T, db *gorm.DB) map[string]string {
+	t.Helper()
+	if db.Dialector.Name() == "postgres" {
+		return postgresSchema(t, db)
+	}
+	return sqliteSchema(t, db)
+}
+
+// sqliteSchema returns the statements that created the tables and indexes of
+// a SQLite database
+func sqliteSchema(t *testing.T, db *gorm.DB) map[string]string {
+	t.Helper()
+	var rows []struct {
+		Name string
+		SQL  string
+	}
+	err := db.Raw(`SELECT "name", "sql" FROM "sqlite_master" WHERE "sql" IS NOT NULL AND "name" != 'schema_migrations' AND substr("name", 1, 7) != 'sqlite_'`).Scan(&rows).Error
+	if err != nil {
+		t.Fatalf("reading schema: %v", err)
+	}
+	definitions := map[string]string{}
+	for _, row := range rows {
+		definitions[row.Name] = row.SQL
+	}
+	return definitions
+}
+
+// postgresSchema describes the tables, constraints and indexes of the current
+// PostgreSQL schema
+func postgresSchema(t *testing.T, db *gorm.DB) map[string]string {
+	t.Helper()
+	var columns []struct {
+		TableName     string
+		ColumnName    string
+		DataType      string
+		IsNullable    string
+		ColumnDefault *string
+	}
+	err := db.Raw(`SELECT "table_name", "column_name", "data_type", "is_nullable", "column_default"
+		FROM "information_schema"."columns"
+		WHERE "table_schema" = current_schema() AND "table_name" != 'schema_migrations'
+		ORDER BY "table_name", "ordinal_position"`).Scan(&columns).Error
+	if err != nil {
+		t.Fatalf("reading columns: %v", err)
+	}
+	var definitions []struct {
+		Name       string
+		Definition string
+	}
+	err = db.Raw(`SELECT c."conrelid"::regclass || '.' || c."conname" AS "name", pg_get_constraintdef(c."oid") AS "definition"
+		FROM "pg_constraint" c JOIN "pg_namespace" n ON n."oid" = c."connamespace"
+		WHERE n."nspname" = current_schema() AND c."conrelid" != 'schema_migrations'::regclass
+		UNION ALL
+		SELECT "indexname", "indexdef" FROM "pg_indexes"
+		WHERE "schemaname" = current_schema() AND "tablename" != 'schema_migrations'`).Scan(&definitions).Error
+	if err != nil {
+		t.Fatalf("reading constraints and indexes: %v", err)
+	}
+
+	result := map[string]string{}
+	for _, column := range columns {
+		definition := column.ColumnName + " " + column.DataType
+		if column.IsNullable == "NO" {
+			definition += " NOT NULL"
+		}
+		if column.ColumnDefault != nil {
+			definition += " DEFAULT " + *column.ColumnDefault
+		}
+		result[column.TableName] += definition + "\n"
+	}
+	for _, definition := range definitions {
+		result[definition.Name] = definition.Definition
+	}
+	return result
+}
+
+func TestSQLiteRoundTrip(t *testing.T) {
+	testRoundTrip(t, openSQLite(t))
+}
+
+func TestPostgresRoundTrip(t *testing.T) {
+	testRoundTrip(t, openPostgres(t))
+}
+
+// testRoundTrip applies every migration, rolls them all back and applies
+// them again, expecting the same schema both times
+func testRoundTrip(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != len(migrator.migrations) {
+		t.Fatalf("Up applied %d migrations, want %d", len(applied), len(migrator.migrations))
+	}
+	want := schema(t, db)
+	for _, index := range []string{"idx_contest_registration_contest_user", "idx_contest_registration_contest_team"} {
+		if _, ok := want[index]; !ok {
+			t.Errorf("%s is missing after Up", index)
+		}
+	}
+
+	rolledBack, err := migrator.Down(len(applied))
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if len(rolledBack) != len(applied) {
+		t.Fatalf("Down rolled back %d migrations, want %d", len(rolledBack), len(applied))
+	}
+	if left := schema(t, db); len(left) != 0 {
+		t.Errorf("schema left after rolling back everything: %v", left)
+	}
+	if _, err := migrator.Down(1); err != ErrNothingToRollback {
+		t.Errorf("Down on an empty database = %v, want ErrNothingToRollback", err)
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+	got := schema(t, db)
+	for name, definition := range want {
+		if got[name] != definition {
+			t.Errorf("%s after the round trip:\n%s\nwant:\n%s", name, got[name], definition)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("unexpected %s after the round trip", name)
+		}
+	}
+	if err := migrator.Check(); err != nil {
+		t.Errorf("Check: %v", err)
+	}
+}
+
+func TestContestRegistrationDuplicates(t *testing.T) {
+	t.Run("sqlite", func(t *testing.T) {
+		testContestRegistrationDuplicates(t, openSQLite(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		testContestRegistrationDuplicates(t, openPostgres(t))
+	})
+}
+
+// testContestRegistrationDuplicates applies the unique indexes of contest
+// registrations to a database holding duplicates
+func testContestRegistrationDuplicates(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if _, err := migrator.Down(1); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+
+	// Registrations made concurrently before the unique indexes existed
+	for _, statement := range []string{
+		`INSERT INTO "user" ("id", "username", "email") VALUES (1, 'ada', 'ada@example.org')`,
+		`INSERT INTO "team" ("team_id", "team_name") VALUES (1, 'Analytical Engines')`,
+		`INSERT INTO "contest" ("contest_id", "name") VALUES (1, 'Round 1'), (2, 'Round 2')`,
+		`INSERT INTO "contest_registration" ("registration_id", "contest_id", "user_id", "team_id") VALUES
+			(1, 1, 1, NULL), (2, 1, 1, NULL), (3, 2, 1, NULL), (4, 1, NULL, 1), (5, 1, NULL, 1), (6, 2, NULL, 1)`,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("seeding: %v", err)
+		}
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up with duplicate registrations: %v", err)
+	}
+
+	var ids []uint
+	if err := db.Raw(`SELECT "registration_id" FROM "contest_registration" ORDER BY "registration_id"`).Scan(&ids).Error; err != nil {
+		t.Fatalf("reading registrations: %v", err)
+	}
+	if len(ids) != 4 || ids[0] != 1 || ids[1] != 3 || ids[2] != 4 || ids[3] != 6 {
+		t.Errorf("registrations left = %v, want the earliest of each: [1 3 4 6]", ids)
+	}
+	err = db.Exec(`INSERT INTO "contest_registration" ("registration_id", "contest_id", "user_id") VALUES (7, 1, 1)`).Error
+	if err == nil {
+		t.Error("a user was registered twice to a contest")
+	}
+}
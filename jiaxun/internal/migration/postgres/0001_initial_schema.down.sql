@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS "training_participation";
+DROP TABLE IF EXISTS "training_plan";
+DROP TABLE IF EXISTS "team_request";
+DROP TABLE IF EXISTS "team_membership";
+DROP TABLE IF EXISTS "contest_registration";
+DROP TABLE IF EXISTS "team";
+DROP TABLE IF EXISTS "contest";
+DROP TABLE IF EXISTS "user";
@@ -0,0 +1,89 @@
+-- Tables may already exist on databases created by GORM's AutoMigrate
+-- before versioned migrations were introduced, hence IF NOT EXISTS.
+CREATE TABLE IF NOT EXISTS "user" (
+    "id" bigserial PRIMARY KEY,
+    "username" text,
+    "email" text,
+    "full_name" text,
+    "password" text,
+    "role" text,
+    "created_at" timestamptz,
+    CONSTRAINT "uni_user_username" UNIQUE ("username"),
+    CONSTRAINT "uni_user_email" UNIQUE ("email")
+);
+
+CREATE TABLE IF NOT EXISTS "contest" (
+    "contest_id" bigserial PRIMARY KEY,
+    "name" varchar(100),
+    "start_time" timestamptz,
+    "end_time" timestamptz,
+    "is_team_based" boolean DEFAULT false,
+    "organizer" varchar(100)
+);
+
+CREATE TABLE IF NOT EXISTS "team" (
+    "team_id" bigserial PRIMARY KEY,
+    "team_name" varchar(100),
+    "created_at" timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS "contest_registration" (
+    "registration_id" bigserial PRIMARY KEY,
+    "contest_id" bigint,
+    "is_user_registration" boolean,
+    "user_id" bigint,
+    "team_id" bigint,
+    "registered_at" timestamptz,
+    CONSTRAINT "fk_contest_registrations" FOREIGN KEY ("contest_id") REFERENCES "contest"("contest_id") ON DELETE CASCADE,
+    CONSTRAINT "fk_user_contest_registrations" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_team_contest_registrations" FOREIGN KEY ("team_id") REFERENCES "team"("team_id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_contest_registration_contest_id" ON "contest_registration"("contest_id");
+CREATE INDEX IF NOT EXISTS "idx_contest_registration_user_id" ON "contest_registration"("user_id");
+CREATE INDEX IF NOT EXISTS "idx_contest_registration_team_id" ON "contest_registration"("team_id");
+
+CREATE TABLE IF NOT EXISTS "team_membership" (
+    "user_id" bigint,
+    "team_id" bigint,
+    "role" varchar(16) DEFAULT 'member',
+    "joined_at" timestamptz,
+    PRIMARY KEY ("user_id", "team_id"),
+    CONSTRAINT "fk_user_team_memberships" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_team_team_memberships" FOREIGN KEY ("team_id") REFERENCES "team"("team_id") ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS "team_request" (
+    "request_id" bigserial PRIMARY KEY,
+    "team_id" bigint,
+    "user_id" bigint,
+    "kind" varchar(16),
+    "status" varchar(16) DEFAULT 'pending',
+    "created_at" timestamptz,
+    "responded_at" timestamptz,
+    CONSTRAINT "fk_team_team_requests" FOREIGN KEY ("team_id") REFERENCES "team"("team_id") ON DELETE CASCADE,
+    CONSTRAINT "fk_user_team_requests" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_team_request_team_id" ON "team_request"("team_id");
+CREATE INDEX IF NOT EXISTS "idx_team_request_user_id" ON "team_request"("user_id");
+
+CREATE TABLE IF NOT EXISTS "training_plan" (
+    "training_plan_id" bigserial PRIMARY KEY,
+    "title" varchar(100),
+    "description" text,
+    "start_date" timestamptz,
+    "end_date" timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS "training_participation" (
+    "participation_id" bigserial PRIMARY KEY,
+    "training_plan_id" bigint,
+    "user_id" bigint,
+    "team_id" bigint,
+    "joined_at" timestamptz,
+    CONSTRAINT "fk_training_plan_participations" FOREIGN KEY ("training_plan_id") REFERENCES "training_plan"("training_plan_id") ON DELETE CASCADE,
+    CONSTRAINT "fk_user_training_participations" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_team_training_participations" FOREIGN KEY ("team_id") REFERENCES "team"("team_id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_training_participation_training_plan_id" ON "training_participation"("training_plan_id");
+CREATE INDEX IF NOT EXISTS "idx_training_participation_user_id" ON "training_participation"("user_id");
+CREATE INDEX IF NOT EXISTS "idx_training_participation_team_id" ON "training_participation"("team_id");
@@ -0,0 +1,6 @@
+ALTER TABLE "team_request"
+    DROP CONSTRAINT IF EXISTS "chk_team_request_status",
+    DROP CONSTRAINT IF EXISTS "chk_team_request_kind";
+
+ALTER TABLE "team_membership"
+    DROP CONSTRAINT IF EXISTS "chk_team_membership_role";
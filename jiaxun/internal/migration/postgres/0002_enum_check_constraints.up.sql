@@ -0,0 +1,8 @@
+-- Enum-like string columns are plain varchar on every driver and are
+-- restricted to their allowed values by CHECK constraints.
+ALTER TABLE "team_membership"
+    ADD CONSTRAINT "chk_team_membership_role" CHECK ("role" IN ('member', 'captain'));
+
+ALTER TABLE "team_request"
+    ADD CONSTRAINT "chk_team_request_kind" CHECK ("kind" IN ('invitation', 'join_request')),
+    ADD CONSTRAINT "chk_team_request_status" CHECK ("status" IN ('pending', 'accepted', 'declined'));
@@ -0,0 +1,22 @@
+CREATE TABLE "refresh_token" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint,
+    "family_id" varchar(64),
+    "token_hash" varchar(64),
+    "access_jti" varchar(64),
+    "access_expires_at" timestamptz,
+    "expires_at" timestamptz,
+    "created_at" timestamptz,
+    "used_at" timestamptz,
+    "revoked_at" timestamptz,
+    CONSTRAINT "fk_user_refresh_tokens" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_refresh_token_user_id" ON "refresh_token"("user_id");
+CREATE INDEX "idx_refresh_token_family_id" ON "refresh_token"("family_id");
+CREATE UNIQUE INDEX "idx_refresh_token_token_hash" ON "refresh_token"("token_hash");
+
+CREATE TABLE "revoked_token" (
+    "jti" varchar(64) PRIMARY KEY,
+    "expires_at" timestamptz
+);
+CREATE INDEX "idx_revoked_token_expires_at" ON "revoked_token"("expires_at");
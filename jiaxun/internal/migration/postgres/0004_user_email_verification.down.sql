@@ -0,0 +1,3 @@
+ALTER TABLE "user" DROP COLUMN "email_verified_at";
+ALTER TABLE "user" DROP CONSTRAINT "chk_user_status";
+ALTER TABLE "user" DROP COLUMN "status";
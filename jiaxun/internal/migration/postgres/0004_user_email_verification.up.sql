@@ -0,0 +1,3 @@
+ALTER TABLE "user" ADD COLUMN "status" varchar(16) DEFAULT 'active';
+ALTER TABLE "user" ADD CONSTRAINT "chk_user_status" CHECK ("status" IN ('active', 'pending'));
+ALTER TABLE "user" ADD COLUMN "email_verified_at" timestamptz;
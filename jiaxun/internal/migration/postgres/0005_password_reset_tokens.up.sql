@@ -0,0 +1,11 @@
+CREATE TABLE "password_reset_token" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint,
+    "token_hash" varchar(64),
+    "expires_at" timestamptz,
+    "created_at" timestamptz,
+    "used_at" timestamptz,
+    CONSTRAINT "fk_user_password_reset_tokens" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_password_reset_token_user_id" ON "password_reset_token"("user_id");
+CREATE UNIQUE INDEX "idx_password_reset_token_token_hash" ON "password_reset_token"("token_hash");
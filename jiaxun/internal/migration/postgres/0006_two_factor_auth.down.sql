@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS "recovery_code";
+
+ALTER TABLE "refresh_token" DROP COLUMN "mfa";
+
+ALTER TABLE "user" DROP COLUMN "totp_last_step";
+ALTER TABLE "user" DROP COLUMN "totp_enabled_at";
+ALTER TABLE "user" DROP COLUMN "totp_secret";
@@ -0,0 +1,5 @@
+ALTER TABLE "contest" ADD COLUMN "created_by" bigint REFERENCES "user"("id") ON DELETE SET NULL;
+CREATE INDEX "idx_contest_created_by" ON "contest"("created_by");
+
+ALTER TABLE "training_plan" ADD COLUMN "created_by" bigint REFERENCES "user"("id") ON DELETE SET NULL;
+CREATE INDEX "idx_training_plan_created_by" ON "training_plan"("created_by");
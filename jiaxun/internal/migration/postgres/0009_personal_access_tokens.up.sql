@@ -0,0 +1,15 @@
+CREATE TABLE "personal_access_token" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint,
+    "name" varchar(100),
+    "prefix" varchar(16),
+    "token_hash" varchar(64),
+    "scopes" text,
+    "expires_at" timestamptz,
+    "created_at" timestamptz,
+    "last_used_at" timestamptz,
+    "revoked_at" timestamptz,
+    CONSTRAINT "fk_user_personal_access_tokens" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_personal_access_token_user_id" ON "personal_access_token"("user_id");
+CREATE UNIQUE INDEX "idx_personal_access_token_token_hash" ON "personal_access_token"("token_hash");
@@ -0,0 +1,26 @@
+CREATE TABLE "login_attempt" (
+    "key" varchar(255),
+    "failures" bigint,
+    "last_failure_at" timestamptz,
+    "locked_until" timestamptz,
+    PRIMARY KEY ("key")
+);
+CREATE INDEX "idx_login_attempt_last_failure_at" ON "login_attempt"("last_failure_at");
+
+CREATE TABLE "lockout_event" (
+    "id" bigserial PRIMARY KEY,
+    "kind" varchar(16),
+    "key" varchar(255),
+    "user_id" bigint,
+    "login" varchar(255),
+    "ip" varchar(64),
+    "failures" bigint,
+    "locked_until" timestamptz,
+    "created_at" timestamptz,
+    "unlocked_at" timestamptz,
+    "unlocked_by" bigint,
+    CONSTRAINT "fk_lockout_event_user" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE SET NULL,
+    CONSTRAINT "chk_lockout_event_kind" CHECK ("kind" IN ('account', 'ip'))
+);
+CREATE INDEX "idx_lockout_event_key" ON "lockout_event"("key");
+CREATE INDEX "idx_lockout_event_user_id" ON "lockout_event"("user_id");
@@ -0,0 +1,37 @@
+CREATE TABLE "session" (
+    "id" varchar(64),
+    "user_id" bigint,
+    "ip" varchar(64),
+    "user_agent" varchar(512),
+    "mfa" boolean DEFAULT false,
+    "created_at" timestamptz,
+    "last_seen_at" timestamptz,
+    "expires_at" timestamptz,
+    "revoked_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_user_sessions" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_session_user_id" ON "session"("user_id");
+CREATE INDEX "idx_session_expires_at" ON "session"("expires_at");
+
+-- Sessions started before this migration have no recorded client
+INSERT INTO "session" ("id", "user_id", "ip", "user_agent", "mfa", "created_at", "last_seen_at", "expires_at")
+SELECT "family_id", "user_id", '', '', bool_or("mfa"), min("created_at"), max("created_at"), max("expires_at")
+FROM "refresh_token"
+WHERE "revoked_at" IS NULL
+GROUP BY "family_id", "user_id";
+
+CREATE TABLE "login_event" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint,
+    "login" varchar(255),
+    "success" boolean DEFAULT false,
+    "reason" varchar(32),
+    "ip" varchar(64),
+    "user_agent" varchar(512),
+    "session_id" varchar(64),
+    "created_at" timestamptz,
+    CONSTRAINT "fk_login_event_user" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE SET NULL
+);
+CREATE INDEX "idx_login_event_user_id" ON "login_event"("user_id");
+CREATE INDEX "idx_login_event_created_at" ON "login_event"("created_at");
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "provider_login_state";
+DROP TABLE IF EXISTS "user_identity";
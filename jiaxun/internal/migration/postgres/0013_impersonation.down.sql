@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "impersonation_request";
+DROP TABLE IF EXISTS "impersonation";
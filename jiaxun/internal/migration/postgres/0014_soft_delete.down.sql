@@ -0,0 +1,16 @@
+-- Whatever is still in the trash is purged, together with the rows
+-- referencing it
+DELETE FROM "contest" WHERE "deleted_at" IS NOT NULL;
+DELETE FROM "training_plan" WHERE "deleted_at" IS NOT NULL;
+DELETE FROM "team" WHERE "deleted_at" IS NOT NULL;
+DELETE FROM "user" WHERE "deleted_at" IS NOT NULL;
+
+ALTER TABLE "training_plan" DROP COLUMN "deleted_at";
+ALTER TABLE "contest" DROP COLUMN "deleted_at";
+ALTER TABLE "team" DROP COLUMN "deleted_at";
+
+DROP INDEX "uni_user_username";
+DROP INDEX "uni_user_email";
+ALTER TABLE "user" ADD CONSTRAINT "uni_user_username" UNIQUE ("username"),
+    ADD CONSTRAINT "uni_user_email" UNIQUE ("email");
+ALTER TABLE "user" DROP COLUMN "deleted_at";
@@ -0,0 +1,17 @@
+-- Deleted users, teams, contests and training plans are kept, with the time
+-- they were deleted, until they are restored or purged. Usernames and emails
+-- only need to be unique among users that are not deleted.
+ALTER TABLE "user" ADD COLUMN "deleted_at" timestamptz;
+ALTER TABLE "user" DROP CONSTRAINT "uni_user_username", DROP CONSTRAINT "uni_user_email";
+CREATE UNIQUE INDEX "uni_user_username" ON "user"("username") WHERE "deleted_at" IS NULL;
+CREATE UNIQUE INDEX "uni_user_email" ON "user"("email") WHERE "deleted_at" IS NULL;
+CREATE INDEX "idx_user_deleted_at" ON "user"("deleted_at");
+
+ALTER TABLE "team" ADD COLUMN "deleted_at" timestamptz;
+CREATE INDEX "idx_team_deleted_at" ON "team"("deleted_at");
+
+ALTER TABLE "contest" ADD COLUMN "deleted_at" timestamptz;
+CREATE INDEX "idx_contest_deleted_at" ON "contest"("deleted_at");
+
+ALTER TABLE "training_plan" ADD COLUMN "deleted_at" timestamptz;
+CREATE INDEX "idx_training_plan_deleted_at" ON "training_plan"("deleted_at");
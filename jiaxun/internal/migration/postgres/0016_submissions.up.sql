@@ -0,0 +1,38 @@
+ALTER TABLE "judge_account" ADD COLUMN "sync_cursor" varchar(64);
+ALTER TABLE "judge_account" ADD COLUMN "synced_at" timestamptz;
+ALTER TABLE "judge_account" ADD COLUMN "sync_error" varchar(512);
+
+CREATE TABLE "problem" (
+    "id" bigserial PRIMARY KEY,
+    "platform" varchar(32),
+    "external_id" varchar(64),
+    "name" varchar(255),
+    "url" varchar(512),
+    "rating" bigint,
+    "tags" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz
+);
+CREATE UNIQUE INDEX "uni_problem_platform_external_id" ON "problem"("platform", "external_id");
+
+CREATE TABLE "submission" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint,
+    "judge_account_id" bigint,
+    "problem_id" bigint,
+    "platform" varchar(32),
+    "external_id" varchar(64),
+    "verdict" varchar(32),
+    "language" varchar(64),
+    "submitted_at" timestamptz,
+    "created_at" timestamptz,
+    CONSTRAINT "fk_submission_user" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_submission_judge_account" FOREIGN KEY ("judge_account_id") REFERENCES "judge_account"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_submission_problem" FOREIGN KEY ("problem_id") REFERENCES "problem"("id") ON DELETE CASCADE,
+    CONSTRAINT "chk_submission_verdict" CHECK ("verdict" IN ('accepted', 'wrong_answer', 'time_limit_exceeded', 'memory_limit_exceeded', 'runtime_error', 'compilation_error', 'other'))
+);
+CREATE UNIQUE INDEX "uni_submission_platform_external_id" ON "submission"("platform", "external_id");
+CREATE INDEX "idx_submission_user_id" ON "submission"("user_id");
+CREATE INDEX "idx_submission_judge_account_id" ON "submission"("judge_account_id");
+CREATE INDEX "idx_submission_problem_id" ON "submission"("problem_id");
+CREATE INDEX "idx_submission_submitted_at" ON "submission"("submitted_at");
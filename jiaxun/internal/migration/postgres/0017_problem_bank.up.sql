@@ -0,0 +1,5 @@
+CREATE INDEX "idx_problem_rating" ON "problem"("rating");
+
+-- Teachers curate the problem bank
+INSERT INTO "role_permission" ("role_name", "permission")
+    SELECT "name", 'problems:manage' FROM "role" WHERE "name" = 'teacher';
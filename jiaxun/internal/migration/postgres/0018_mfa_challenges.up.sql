@@ -0,0 +1,12 @@
+-- Challenge tokens are single-use: each is recorded by its jti until a code
+-- is accepted, and only a few codes can be tried against it.
+CREATE TABLE "mfa_challenge" (
+    "jti" varchar(64),
+    "user_id" bigint,
+    "attempts" bigint DEFAULT 0,
+    "expires_at" timestamptz,
+    PRIMARY KEY ("jti"),
+    CONSTRAINT "fk_mfa_challenge_user" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_mfa_challenge_user_id" ON "mfa_challenge"("user_id");
+CREATE INDEX "idx_mfa_challenge_expires_at" ON "mfa_challenge"("expires_at");
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "idx_contest_registration_contest_team";
+DROP INDEX IF EXISTS "idx_contest_registration_contest_user";
@@ -0,0 +1,7 @@
+-- A user or team is registered to a contest at most once. Duplicates left by
+-- concurrent registrations are removed, keeping the earliest.
+DELETE FROM "contest_registration" WHERE "registration_id" NOT IN (
+    SELECT MIN("registration_id") FROM "contest_registration" GROUP BY "contest_id", "user_id", "team_id"
+);
+CREATE UNIQUE INDEX "idx_contest_registration_contest_user" ON "contest_registration"("contest_id", "user_id");
+CREATE UNIQUE INDEX "idx_contest_registration_contest_team" ON "contest_registration"("contest_id", "team_id");
@@ -0,0 +1,89 @@
+-- Tables may already exist on databases created by GORM's AutoMigrate
+-- before versioned migrations were introduced, hence IF NOT EXISTS.
+CREATE TABLE IF NOT EXISTS "user" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "username" text,
+    "email" text,
+    "full_name" text,
+    "password" text,
+    "role" text,
+    "created_at" datetime,
+    CONSTRAINT "uni_user_username" UNIQUE ("username"),
+    CONSTRAINT "uni_user_email" UNIQUE ("email")
+);
+
+CREATE TABLE IF NOT EXISTS "contest" (
+    "contest_id" integer PRIMARY KEY AUTOINCREMENT,
+    "name" varchar(100),
+    "start_time" datetime,
+    "end_time" datetime,
+    "is_team_based" numeric DEFAULT false,
+    "organizer" varchar(100)
+);
+
+CREATE TABLE IF NOT EXISTS "team" (
+    "team_id" integer PRIMARY KEY AUTOINCREMENT,
+    "team_name" varchar(100),
+    "created_at" datetime
+);
+
+CREATE TABLE IF NOT EXISTS "contest_registration" (
+    "registration_id" integer PRIMARY KEY AUTOINCREMENT,
+    "contest_id" integer,
+    "is_user_registration" numeric,
+    "user_id" integer,
+    "team_id" integer,
+    "registered_at" datetime,
+    CONSTRAINT "fk_contest_registrations" FOREIGN KEY ("contest_id") REFERENCES "contest"("contest_id") ON DELETE CASCADE,
+    CONSTRAINT "fk_user_contest_registrations" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_team_contest_registrations" FOREIGN KEY ("team_id") REFERENCES "team"("team_id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_contest_registration_contest_id" ON "contest_registration"("contest_id");
+CREATE INDEX IF NOT EXISTS "idx_contest_registration_user_id" ON "contest_registration"("user_id");
+CREATE INDEX IF NOT EXISTS "idx_contest_registration_team_id" ON "contest_registration"("team_id");
+
+CREATE TABLE IF NOT EXISTS "team_membership" (
+    "user_id" integer,
+    "team_id" integer,
+    "role" varchar(16) DEFAULT 'member',
+    "joined_at" datetime,
+    PRIMARY KEY ("user_id", "team_id"),
+    CONSTRAINT "fk_user_team_memberships" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_team_team_memberships" FOREIGN KEY ("team_id") REFERENCES "team"("team_id") ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS "team_request" (
+    "request_id" integer PRIMARY KEY AUTOINCREMENT,
+    "team_id" integer,
+    "user_id" integer,
+    "kind" varchar(16),
+    "status" varchar(16) DEFAULT 'pending',
+    "created_at" datetime,
+    "responded_at" datetime,
+    CONSTRAINT "fk_team_team_requests" FOREIGN KEY ("team_id") REFERENCES "team"("team_id") ON DELETE CASCADE,
+    CONSTRAINT "fk_user_team_requests" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_team_request_team_id" ON "team_request"("team_id");
+CREATE INDEX IF NOT EXISTS "idx_team_request_user_id" ON "team_request"("user_id");
+
+CREATE TABLE IF NOT EXISTS "training_plan" (
+    "training_plan_id" integer PRIMARY KEY AUTOINCREMENT,
+    "title" varchar(100),
+    "description" text,
+    "start_date" datetime,
+    "end_date" datetime
+);
+
+CREATE TABLE IF NOT EXISTS "training_participation" (
+    "participation_id" integer PRIMARY KEY AUTOINCREMENT,
+    "training_plan_id" integer,
+    "user_id" integer,
+    "team_id" integer,
+    "joined_at" datetime,
+    CONSTRAINT "fk_training_plan_participations" FOREIGN KEY ("training_plan_id") REFERENCES "training_plan"("training_plan_id") ON DELETE CASCADE,
+    CONSTRAINT "fk_user_training_participations" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_team_training_participations" FOREIGN KEY ("team_id") REFERENCES "team"("team_id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_training_participation_training_plan_id" ON "training_participation"("training_plan_id");
+CREATE INDEX IF NOT EXISTS "idx_training_participation_user_id" ON "training_participation"("user_id");
+CREATE INDEX IF NOT EXISTS "idx_training_participation_team_id" ON "training_participation"("team_id");
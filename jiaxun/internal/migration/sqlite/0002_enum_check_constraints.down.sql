@@ -0,0 +1,29 @@
+CREATE TABLE "team_membership_old" (
+    "user_id" integer,
+    "team_id" integer,
+    "role" varchar(16) DEFAULT 'member',
+    "joined_at" datetime,
+    PRIMARY KEY ("user_id", "team_id"),
+    CONSTRAINT "fk_user_team_memberships" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_team_team_memberships" FOREIGN KEY ("team_id") REFERENCES "team"("team_id") ON DELETE CASCADE
+);
+INSERT INTO "team_membership_old" SELECT "user_id", "team_id", "role", "joined_at" FROM "team_membership";
+DROP TABLE "team_membership";
+ALTER TABLE "team_membership_old" RENAME TO "team_membership";
+
+CREATE TABLE "team_request_old" (
+    "request_id" integer PRIMARY KEY AUTOINCREMENT,
+    "team_id" integer,
+    "user_id" integer,
+    "kind" varchar(16),
+    "status" varchar(16) DEFAULT 'pending',
+    "created_at" datetime,
+    "responded_at" datetime,
+    CONSTRAINT "fk_team_team_requests" FOREIGN KEY ("team_id") REFERENCES "team"("team_id") ON DELETE CASCADE,
+    CONSTRAINT "fk_user_team_requests" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+INSERT INTO "team_request_old" SELECT "request_id", "team_id", "user_id", "kind", "status", "created_at", "responded_at" FROM "team_request";
+DROP TABLE "team_request";
+ALTER TABLE "team_request_old" RENAME TO "team_request";
+CREATE INDEX "idx_team_request_team_id" ON "team_request"("team_id");
+CREATE INDEX "idx_team_request_user_id" ON "team_request"("user_id");
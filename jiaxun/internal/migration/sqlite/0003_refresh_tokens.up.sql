@@ -0,0 +1,22 @@
+CREATE TABLE "refresh_token" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "user_id" integer,
+    "family_id" varchar(64),
+    "token_hash" varchar(64),
+    "access_jti" varchar(64),
+    "access_expires_at" datetime,
+    "expires_at" datetime,
+    "created_at" datetime,
+    "used_at" datetime,
+    "revoked_at" datetime,
+    CONSTRAINT "fk_user_refresh_tokens" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_refresh_token_user_id" ON "refresh_token"("user_id");
+CREATE INDEX "idx_refresh_token_family_id" ON "refresh_token"("family_id");
+CREATE UNIQUE INDEX "idx_refresh_token_token_hash" ON "refresh_token"("token_hash");
+
+CREATE TABLE "revoked_token" (
+    "jti" varchar(64) PRIMARY KEY,
+    "expires_at" datetime
+);
+CREATE INDEX "idx_revoked_token_expires_at" ON "revoked_token"("expires_at");
@@ -0,0 +1,2 @@
+ALTER TABLE "user" DROP COLUMN "email_verified_at";
+ALTER TABLE "user" DROP COLUMN "status";
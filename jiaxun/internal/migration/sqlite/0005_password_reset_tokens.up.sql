@@ -0,0 +1,11 @@
+CREATE TABLE "password_reset_token" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "user_id" integer,
+    "token_hash" varchar(64),
+    "expires_at" datetime,
+    "created_at" datetime,
+    "used_at" datetime,
+    CONSTRAINT "fk_user_password_reset_tokens" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_password_reset_token_user_id" ON "password_reset_token"("user_id");
+CREATE UNIQUE INDEX "idx_password_reset_token_token_hash" ON "password_reset_token"("token_hash");
@@ -0,0 +1,15 @@
+ALTER TABLE "user" ADD COLUMN "totp_secret" text;
+ALTER TABLE "user" ADD COLUMN "totp_enabled_at" datetime;
+ALTER TABLE "user" ADD COLUMN "totp_last_step" integer DEFAULT 0;
+
+ALTER TABLE "refresh_token" ADD COLUMN "mfa" numeric DEFAULT false;
+
+CREATE TABLE "recovery_code" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "user_id" integer,
+    "code_hash" varchar(64),
+    "created_at" datetime,
+    "used_at" datetime,
+    CONSTRAINT "fk_user_recovery_codes" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_recovery_code_user_id" ON "recovery_code"("user_id");
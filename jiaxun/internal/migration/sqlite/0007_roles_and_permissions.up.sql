@@ -0,0 +1,34 @@
+CREATE TABLE "role" (
+    "name" varchar(32) PRIMARY KEY,
+    "description" text,
+    "builtin" numeric DEFAULT false,
+    "created_at" datetime
+);
+
+CREATE TABLE "role_permission" (
+    "role_name" varchar(32),
+    "permission" varchar(64),
+    PRIMARY KEY ("role_name", "permission"),
+    CONSTRAINT "fk_role_permissions" FOREIGN KEY ("role_name") REFERENCES "role"("name") ON DELETE CASCADE
+);
+
+INSERT INTO "role" ("name", "description", "builtin", "created_at") VALUES
+    ('admin', 'Full access to the system', true, CURRENT_TIMESTAMP),
+    ('teacher', 'Manages users, contests, teams and training plans', true, CURRENT_TIMESTAMP),
+    ('student', 'Regular participant', true, CURRENT_TIMESTAMP);
+
+INSERT INTO "role_permission" ("role_name", "permission") VALUES
+    ('admin', '*'),
+    ('teacher', 'users:read'),
+    ('teacher', 'users:write'),
+    ('teacher', 'contests:manage'),
+    ('teacher', 'teams:approve'),
+    ('teacher', 'training:manage');
+
+-- Users created before roles existed have an empty role
+UPDATE "user" SET "role" = 'student' WHERE "role" IS NULL OR "role" = '';
+
+-- Keep any other role already in use, without permissions
+INSERT INTO "role" ("name", "description", "builtin", "created_at")
+    SELECT DISTINCT "role", '', false, CURRENT_TIMESTAMP FROM "user"
+    WHERE "role" NOT IN (SELECT "name" FROM "role");
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "idx_training_plan_created_by";
+ALTER TABLE "training_plan" DROP COLUMN "created_by";
+
+DROP INDEX IF EXISTS "idx_contest_created_by";
+ALTER TABLE "contest" DROP COLUMN "created_by";
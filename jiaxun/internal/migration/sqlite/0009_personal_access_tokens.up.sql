@@ -0,0 +1,15 @@
+CREATE TABLE "personal_access_token" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "user_id" integer,
+    "name" varchar(100),
+    "prefix" varchar(16),
+    "token_hash" varchar(64),
+    "scopes" text,
+    "expires_at" datetime,
+    "created_at" datetime,
+    "last_used_at" datetime,
+    "revoked_at" datetime,
+    CONSTRAINT "fk_user_personal_access_tokens" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_personal_access_token_user_id" ON "personal_access_token"("user_id");
+CREATE UNIQUE INDEX "idx_personal_access_token_token_hash" ON "personal_access_token"("token_hash");
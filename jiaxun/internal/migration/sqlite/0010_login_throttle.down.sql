@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "lockout_event";
+DROP TABLE IF EXISTS "login_attempt";
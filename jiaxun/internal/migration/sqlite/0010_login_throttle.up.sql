@@ -0,0 +1,26 @@
+CREATE TABLE "login_attempt" (
+    "key" varchar(255),
+    "failures" integer,
+    "last_failure_at" datetime,
+    "locked_until" datetime,
+    PRIMARY KEY ("key")
+);
+CREATE INDEX "idx_login_attempt_last_failure_at" ON "login_attempt"("last_failure_at");
+
+CREATE TABLE "lockout_event" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "kind" varchar(16),
+    "key" varchar(255),
+    "user_id" integer,
+    "login" varchar(255),
+    "ip" varchar(64),
+    "failures" integer,
+    "locked_until" datetime,
+    "created_at" datetime,
+    "unlocked_at" datetime,
+    "unlocked_by" integer,
+    CONSTRAINT "fk_lockout_event_user" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE SET NULL,
+    CONSTRAINT "chk_lockout_event_kind" CHECK ("kind" IN ('account', 'ip'))
+);
+CREATE INDEX "idx_lockout_event_key" ON "lockout_event"("key");
+CREATE INDEX "idx_lockout_event_user_id" ON "lockout_event"("user_id");
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "login_event";
+DROP TABLE IF EXISTS "session";
@@ -0,0 +1,22 @@
+CREATE TABLE "user_identity" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "user_id" integer,
+    "provider" varchar(64),
+    "subject" varchar(255),
+    "email" varchar(255),
+    "created_at" datetime,
+    "last_login_at" datetime,
+    CONSTRAINT "fk_user_identities" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_user_identity_user_id" ON "user_identity"("user_id");
+CREATE UNIQUE INDEX "idx_user_identity_provider_subject" ON "user_identity"("provider", "subject");
+
+CREATE TABLE "provider_login_state" (
+    "state" varchar(64),
+    "provider" varchar(64),
+    "nonce" varchar(64),
+    "code_verifier" varchar(128),
+    "expires_at" datetime,
+    PRIMARY KEY ("state")
+);
+CREATE INDEX "idx_provider_login_state_expires_at" ON "provider_login_state"("expires_at");
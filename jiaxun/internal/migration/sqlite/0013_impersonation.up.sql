@@ -0,0 +1,31 @@
+CREATE TABLE "impersonation" (
+    "id" varchar(64),
+    "actor_id" integer,
+    "actor_username" varchar(255),
+    "subject_id" integer,
+    "subject_username" varchar(255),
+    "reason" varchar(512),
+    "ip" varchar(64),
+    "user_agent" varchar(512),
+    "created_at" datetime,
+    "expires_at" datetime,
+    "ended_at" datetime,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_impersonation_actor" FOREIGN KEY ("actor_id") REFERENCES "user"("id") ON DELETE SET NULL,
+    CONSTRAINT "fk_impersonation_subject" FOREIGN KEY ("subject_id") REFERENCES "user"("id") ON DELETE SET NULL
+);
+CREATE INDEX "idx_impersonation_actor_id" ON "impersonation"("actor_id");
+CREATE INDEX "idx_impersonation_subject_id" ON "impersonation"("subject_id");
+CREATE INDEX "idx_impersonation_created_at" ON "impersonation"("created_at");
+
+CREATE TABLE "impersonation_request" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "impersonation_id" varchar(64),
+    "method" varchar(8),
+    "path" varchar(1024),
+    "status" integer,
+    "blocked" numeric DEFAULT false,
+    "created_at" datetime,
+    CONSTRAINT "fk_impersonation_request_impersonation" FOREIGN KEY ("impersonation_id") REFERENCES "impersonation"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_impersonation_request_impersonation_id" ON "impersonation_request"("impersonation_id");
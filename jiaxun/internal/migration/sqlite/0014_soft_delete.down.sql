@@ -0,0 +1,62 @@
+-- Whatever is still in the trash is purged. Foreign keys are not enforced
+-- while migrating, so the rows referencing it are removed or detached here.
+DELETE FROM "contest_registration"
+    WHERE "contest_id" IN (SELECT "contest_id" FROM "contest" WHERE "deleted_at" IS NOT NULL)
+    OR "team_id" IN (SELECT "team_id" FROM "team" WHERE "deleted_at" IS NOT NULL)
+    OR "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+DELETE FROM "training_participation"
+    WHERE "training_plan_id" IN (SELECT "training_plan_id" FROM "training_plan" WHERE "deleted_at" IS NOT NULL)
+    OR "team_id" IN (SELECT "team_id" FROM "team" WHERE "deleted_at" IS NOT NULL)
+    OR "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+DELETE FROM "team_membership"
+    WHERE "team_id" IN (SELECT "team_id" FROM "team" WHERE "deleted_at" IS NOT NULL)
+    OR "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+DELETE FROM "team_request"
+    WHERE "team_id" IN (SELECT "team_id" FROM "team" WHERE "deleted_at" IS NOT NULL)
+    OR "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+DELETE FROM "contest" WHERE "deleted_at" IS NOT NULL;
+DELETE FROM "training_plan" WHERE "deleted_at" IS NOT NULL;
+DELETE FROM "team" WHERE "deleted_at" IS NOT NULL;
+
+DELETE FROM "refresh_token" WHERE "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+DELETE FROM "password_reset_token" WHERE "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+DELETE FROM "recovery_code" WHERE "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+DELETE FROM "personal_access_token" WHERE "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+DELETE FROM "session" WHERE "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+DELETE FROM "user_identity" WHERE "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+UPDATE "contest" SET "created_by" = NULL WHERE "created_by" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+UPDATE "training_plan" SET "created_by" = NULL WHERE "created_by" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+UPDATE "lockout_event" SET "user_id" = NULL WHERE "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+UPDATE "login_event" SET "user_id" = NULL WHERE "user_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+UPDATE "impersonation" SET "actor_id" = NULL WHERE "actor_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+UPDATE "impersonation" SET "subject_id" = NULL WHERE "subject_id" IN (SELECT "id" FROM "user" WHERE "deleted_at" IS NOT NULL);
+DELETE FROM "user" WHERE "deleted_at" IS NOT NULL;
+
+DROP INDEX "idx_training_plan_deleted_at";
+ALTER TABLE "training_plan" DROP COLUMN "deleted_at";
+DROP INDEX "idx_contest_deleted_at";
+ALTER TABLE "contest" DROP COLUMN "deleted_at";
+DROP INDEX "idx_team_deleted_at";
+ALTER TABLE "team" DROP COLUMN "deleted_at";
+
+CREATE TABLE "user_old" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "username" text,
+    "email" text,
+    "full_name" text,
+    "password" text,
+    "role" text,
+    "created_at" datetime,
+    "status" varchar(16) DEFAULT 'active' CONSTRAINT "chk_user_status" CHECK ("status" IN ('active', 'pending')),
+    "email_verified_at" datetime,
+    "totp_secret" text,
+    "totp_enabled_at" datetime,
+    "totp_last_step" integer DEFAULT 0,
+    CONSTRAINT "uni_user_username" UNIQUE ("username"),
+    CONSTRAINT "uni_user_email" UNIQUE ("email")
+);
+INSERT INTO "user_old" ("id", "username", "email", "full_name", "password", "role", "created_at", "status", "email_verified_at", "totp_secret", "totp_enabled_at", "totp_last_step")
+    SELECT "id", "username", "email", "full_name", "password", "role", "created_at", "status", "email_verified_at", "totp_secret", "totp_enabled_at", "totp_last_step" FROM "user";
+UPDATE "sqlite_sequence" SET "seq" = (SELECT "seq" FROM "sqlite_sequence" WHERE "name" = 'user') WHERE "name" = 'user_old';
+DROP TABLE "user";
+ALTER TABLE "user_old" RENAME TO "user";
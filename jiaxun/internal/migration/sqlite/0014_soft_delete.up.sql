@@ -0,0 +1,38 @@
+-- Deleted users, teams, contests and training plans are kept, with the time
+-- they were deleted, until they are restored or purged. Usernames and emails
+-- only need to be unique among users that are not deleted, which SQLite can
+-- only express with partial indexes, so the user table is rebuilt without
+-- its unique constraints.
+CREATE TABLE "user_new" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "username" text,
+    "email" text,
+    "full_name" text,
+    "password" text,
+    "role" text,
+    "created_at" datetime,
+    "status" varchar(16) DEFAULT 'active' CONSTRAINT "chk_user_status" CHECK ("status" IN ('active', 'pending')),
+    "email_verified_at" datetime,
+    "totp_secret" text,
+    "totp_enabled_at" datetime,
+    "totp_last_step" integer DEFAULT 0,
+    "deleted_at" datetime
+);
+INSERT INTO "user_new" ("id", "username", "email", "full_name", "password", "role", "created_at", "status", "email_verified_at", "totp_secret", "totp_enabled_at", "totp_last_step")
+    SELECT "id", "username", "email", "full_name", "password", "role", "created_at", "status", "email_verified_at", "totp_secret", "totp_enabled_at", "totp_last_step" FROM "user";
+-- Keep the IDs of users deleted in the past from being given out again
+UPDATE "sqlite_sequence" SET "seq" = (SELECT "seq" FROM "sqlite_sequence" WHERE "name" = 'user') WHERE "name" = 'user_new';
+DROP TABLE "user";
+ALTER TABLE "user_new" RENAME TO "user";
+CREATE UNIQUE INDEX "uni_user_username" ON "user"("username") WHERE "deleted_at" IS NULL;
+CREATE UNIQUE INDEX "uni_user_email" ON "user"("email") WHERE "deleted_at" IS NULL;
+CREATE INDEX "idx_user_deleted_at" ON "user"("deleted_at");
+
+ALTER TABLE "team" ADD COLUMN "deleted_at" datetime;
+CREATE INDEX "idx_team_deleted_at" ON "team"("deleted_at");
+
+ALTER TABLE "contest" ADD COLUMN "deleted_at" datetime;
+CREATE INDEX "idx_contest_deleted_at" ON "contest"("deleted_at");
+
+ALTER TABLE "training_plan" ADD COLUMN "deleted_at" datetime;
+CREATE INDEX "idx_training_plan_deleted_at" ON "training_plan"("deleted_at");
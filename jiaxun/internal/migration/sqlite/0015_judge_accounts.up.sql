@@ -0,0 +1,17 @@
+CREATE TABLE "judge_account" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "user_id" integer,
+    "platform" varchar(32),
+    "handle" varchar(64),
+    "verified" numeric DEFAULT false,
+    "verified_at" datetime,
+    "challenge" varchar(64),
+    "challenge_expires_at" datetime,
+    "created_at" datetime,
+    CONSTRAINT "fk_user_judge_accounts" FOREIGN KEY ("user_id") REFERENCES "user"("id") ON DELETE CASCADE,
+    CONSTRAINT "chk_judge_account_platform" CHECK ("platform" IN ('codeforces', 'atcoder', 'leetcode', 'luogu'))
+);
+CREATE UNIQUE INDEX "idx_judge_account_user_platform" ON "judge_account"("user_id", "platform");
+CREATE INDEX "idx_judge_account_handle" ON "judge_account"("handle");
+-- A handle can be verified by a single user
+CREATE UNIQUE INDEX "uni_judge_account_verified_handle" ON "judge_account"("platform", LOWER("handle")) WHERE "verified";
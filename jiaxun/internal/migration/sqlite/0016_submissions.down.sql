@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS "submission";
+DROP TABLE IF EXISTS "problem";
+
+ALTER TABLE "judge_account" DROP COLUMN "sync_error";
+ALTER TABLE "judge_account" DROP COLUMN "synced_at";
+ALTER TABLE "judge_account" DROP COLUMN "sync_cursor";
@@ -0,0 +1,3 @@
+DELETE FROM "role_permission" WHERE "permission" = 'problems:manage';
+
+DROP INDEX IF EXISTS "idx_problem_rating";
@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Contest struct {
 	ContestID   uint      `gorm:"primaryKey" json:"contest_id"`
@@ -9,19 +13,24 @@ type Contest struct {
 	EndTime     time.Time `json:"end_time"`
 	IsTeamBased bool      `gorm:"default:false" json:"is_team_based"`
 	Organizer   string    `gorm:"type:varchar(100)" json:"organizer"`
+	CreatedBy   *uint     `gorm:"index" json:"created_by,omitempty"`
+	// DeletedAt is set while the contest is in the trash
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 	// Associations
-	Registrations []ContestRegistration `gorm:"foreignKey:ContestID" json:"-"`
+	Registrations []ContestRegistration `gorm:"foreignKey:ContestID;constraint:OnDelete:CASCADE" json:"-"`
+	// Relations
+	Creator *User `gorm:"foreignKey:CreatedBy;constraint:OnDelete:SET NULL" json:"-"`
 }
 
 type ContestRegistration struct {
 	RegistrationID     uint      `gorm:"primaryKey" json:"registration_id"`
-	ContestID          uint      `gorm:"index" json:"contest_id"`
-	IsUserRegistration bool      `gorm:"default:true" json:"is_user_registration"`
-	UserID             *uint     `gorm:"index" json:"user_id,omitempty"`
-	TeamID             *uint     `gorm:"index" json:"team_id,omitempty"`
+	ContestID          uint      `gorm:"index;uniqueIndex:idx_contest_registration_contest_user;uniqueIndex:idx_contest_registration_contest_team" json:"contest_id"`
+	IsUserRegistration bool      `json:"is_user_registration"`
+	UserID             *uint     `gorm:"index;uniqueIndex:idx_contest_registration_contest_user" json:"user_id,omitempty"`
+	TeamID             *uint     `gorm:"index;uniqueIndex:idx_contest_registration_contest_team" json:"team_id,omitempty"`
 	RegisteredAt       time.Time `json:"registered_at"`
 	// Relations
-	Contest *Contest `gorm:"foreignKey:ContestID;constraint:OnDelete:CASCADE" json:"-"`
+	Contest *Contest `gorm:"constraint:OnDelete:CASCADE" json:"-"`
 	User    *User    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
-	Team    *Team    `gorm:"foreignKey:TeamID;constraint:OnDelete:CASCADE" json:"-"`
+	Team    *Team    `gorm:"constraint:OnDelete:CASCADE" json:"-"`
 }
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// UserIdentity links a user to an account at an OpenID Connect provider
+// or in an LDAP directory
+type UserIdentity struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"index" json:"user_id"`
+	// Provider is the ID of the provider or directory
+	Provider string `gorm:"type:varchar(64);uniqueIndex:idx_user_identity_provider_subject" json:"provider"`
+	// Subject is the provider's stable identifier of the account
+	Subject     string     `gorm:"type:varchar(255);uniqueIndex:idx_user_identity_provider_subject" json:"subject"`
+	Email       string     `gorm:"type:varchar(255)" json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
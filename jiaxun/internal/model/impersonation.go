@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// Impersonation is a period in which an administrator acts as another user
+// to see what they see. Its ID is carried in the impersonation token.
+type Impersonation struct {
+	ID string `gorm:"primaryKey;type:varchar(64)" json:"id"`
+	// ActorID is the administrator; it and SubjectID are unset once their
+	// user is deleted, while the usernames keep the audit trail readable
+	ActorID         *uint  `gorm:"index" json:"actor_id"`
+	ActorUsername   string `gorm:"type:varchar(255)" json:"actor_username"`
+	SubjectID       *uint  `gorm:"index" json:"subject_id"`
+	SubjectUsername string `gorm:"type:varchar(255)" json:"subject_username"`
+	Reason          string `gorm:"type:varchar(512)" json:"reason"`
+	// IP and UserAgent are those of the administrator's client
+	IP        string     `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent string     `gorm:"type:varchar(512)" json:"user_agent"`
+	CreatedAt time.Time  `gorm:"index" json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	// Relations
+	Actor   *User `gorm:"foreignKey:ActorID;constraint:OnDelete:SET NULL" json:"-"`
+	Subject *User `gorm:"foreignKey:SubjectID;constraint:OnDelete:SET NULL" json:"-"`
+}
+
+// Active reports whether the impersonation token can still be used
+func (i *Impersonation) Active(now time.Time) bool {
+	return i.EndedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// ImpersonationRequest records a request made with an impersonation token
+type ImpersonationRequest struct {
+	ID              uint   `gorm:"primaryKey" json:"id"`
+	ImpersonationID string `gorm:"index;type:varchar(64)" json:"impersonation_id"`
+	Method          string `gorm:"type:varchar(8)" json:"method"`
+	Path            string `gorm:"type:varchar(1024)" json:"path"`
+	Status          int    `json:"status"`
+	// Blocked marks requests refused because they would change data
+	Blocked   bool      `json:"blocked"`
+	CreatedAt time.Time `json:"created_at"`
+	// Relations
+	Impersonation *Impersonation `gorm:"foreignKey:ImpersonationID;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// Online judges users can link their accounts on
+const (
+	JudgePlatformCodeforces = "codeforces"
+	JudgePlatformAtCoder    = "atcoder"
+	JudgePlatformLeetCode   = "leetcode"
+	JudgePlatformLuogu      = "luogu"
+)
+
+// JudgePlatforms lists the supported online judges
+var JudgePlatforms = []string{JudgePlatformCodeforces, JudgePlatformAtCoder, JudgePlatformLeetCode, JudgePlatformLuogu}
+
+// JudgeAccount is a user's handle on an online judge. A user has at most one
+// account per platform. The handle is verified once the user has shown that
+// they own it by putting a challenge on their profile there; a verified
+// handle belongs to a single user.
+type JudgeAccount struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"uniqueIndex:idx_judge_account_user_platform" json:"user_id"`
+	Platform   string     `gorm:"type:varchar(32);uniqueIndex:idx_judge_account_user_platform;check:chk_judge_account_platform,platform IN ('codeforces','atcoder','leetcode','luogu')" json:"platform"`
+	Handle     string     `gorm:"type:varchar(64);index" json:"handle"`
+	Verified   bool       `gorm:"default:false" json:"verified"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	// Challenge is the string to put on the profile to verify the handle
+	Challenge          string     `gorm:"type:varchar(64)" json:"-"`
+	ChallengeExpiresAt *time.Time `json:"-"`
+	// SyncCursor is where the next sync of submissions resumes from
+	SyncCursor string     `gorm:"type:varchar(64)" json:"-"`
+	SyncedAt   *time.Time `json:"synced_at,omitempty"`
+	// SyncError is why the last sync failed, empty if it succeeded
+	SyncError string    `gorm:"type:varchar(512)" json:"sync_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// IsJudgePlatform reports whether a platform is a supported online judge
+func IsJudgePlatform(platform string) bool {
+	for _, p := range JudgePlatforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// Kinds of login throttle keys
+const (
+	LockoutKindAccount = "account"
+	LockoutKindIP      = "ip"
+)
+
+// LoginAttempt tracks recent failed logins for an account or a client
+// address, identified by Key
+type LoginAttempt struct {
+	Key string `gorm:"primaryKey;type:varchar(255)" json:"key"`
+	// Failures counts the failed logins and those still in progress, which
+	// are uncounted once they succeed
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `gorm:"index" json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// LockoutEvent records that an account or a client address was locked
+// after too many failed logins
+type LockoutEvent struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Kind string `gorm:"type:varchar(16);check:chk_lockout_event_kind,kind IN ('account','ip')" json:"kind"`
+	Key  string `gorm:"type:varchar(255);index" json:"key"`
+	// UserID is set for account lockouts of existing users
+	UserID *uint `gorm:"index" json:"user_id,omitempty"`
+	// Login is the username or email of the attempt that triggered the lockout
+	Login       string     `gorm:"type:varchar(255)" json:"login"`
+	IP          string     `gorm:"type:varchar(64)" json:"ip"`
+	Failures    int        `json:"failures"`
+	LockedUntil time.Time  `json:"locked_until"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"`
+	UnlockedBy  *uint      `json:"unlocked_by,omitempty"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:SET NULL" json:"-"`
+}
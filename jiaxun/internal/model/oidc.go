@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// ProviderLoginState is a login that was sent to a provider and has not come
+// back yet. It holds the secrets that must not travel through the browser.
+type ProviderLoginState struct {
+	// State is the random value echoed back by the provider
+	State        string    `gorm:"primaryKey;type:varchar(64)"`
+	Provider     string    `gorm:"type:varchar(64)"`
+	Nonce        string    `gorm:"type:varchar(64)"`
+	CodeVerifier string    `gorm:"type:varchar(128)"`
+	ExpiresAt    time.Time `gorm:"index"`
+}
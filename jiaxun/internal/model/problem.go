@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Problem is a problem of the problem bank, from an online judge or another
+// source where it is identified by its external ID. Problems are added by
+// hand or in bulk, and when submissions to them are synced.
+type Problem struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	Platform   string `gorm:"type:varchar(32);uniqueIndex:uni_problem_platform_external_id" json:"platform"`
+	ExternalID string `gorm:"type:varchar(64);uniqueIndex:uni_problem_platform_external_id" json:"external_id"`
+	Name       string `gorm:"type:varchar(255)" json:"name"`
+	URL        string `gorm:"type:varchar(512)" json:"url"`
+	// Rating is the difficulty of the problem, on the scale of its source
+	Rating *int `gorm:"index" json:"rating,omitempty"`
+	// Tags are lowercase algorithm tags such as dp, graphs or number theory
+	Tags      []string  `gorm:"serializer:json;type:text" json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
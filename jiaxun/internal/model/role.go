@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// Permissions that can be granted to roles
+const (
+	// PermAll grants every permission, including ones added later
+	PermAll            = "*"
+	PermUsersRead      = "users:read"
+	PermUsersWrite     = "users:write"
+	PermContestsManage = "contests:manage"
+	PermTeamsApprove   = "teams:approve"
+	PermTrainingManage = "training:manage"
+	PermRolesManage    = "roles:manage"
+	// PermUsersImpersonate is not granted to teachers by default
+	PermUsersImpersonate = "users:impersonate"
+	PermTrashManage      = "trash:manage"
+	PermProblemsManage   = "problems:manage"
+)
+
+// Permissions lists every permission with a short description
+var Permissions = map[string]string{
+	PermAll:              "All permissions",
+	PermUsersRead:        "List and view all users",
+	PermUsersWrite:       "Create, modify and delete any user",
+	PermContestsManage:   "Create, modify and delete contests",
+	PermTeamsApprove:     "Act on any team as its captain, and delete teams",
+	PermTrainingManage:   "Create training plans and manage their participants",
+	PermRolesManage:      "Manage roles and assign them to users",
+	PermUsersImpersonate: "Act as another user, read-only, to see what they see",
+	PermTrashManage:      "List, restore and purge deleted users, teams, contests and training plans",
+	PermProblemsManage:   "Add, modify, delete and import problems of the problem bank",
+}
+
+// Built-in roles
+const (
+	RoleAdmin   = "admin"
+	RoleTeacher = "teacher"
+	RoleStudent = "student"
+)
+
+// Role is a named set of permissions assigned to users
+type Role struct {
+	Name        string    `gorm:"primaryKey;type:varchar(32)" json:"name"`
+	Description string    `json:"description"`
+	Builtin     bool      `json:"builtin"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Associations
+	Permissions []RolePermission `gorm:"foreignKey:RoleName;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// RolePermission grants a permission to a role
+type RolePermission struct {
+	RoleName   string `gorm:"primaryKey;type:varchar(32)" json:"role_name"`
+	Permission string `gorm:"primaryKey;type:varchar(64)" json:"permission"`
+}
+
+// HasPermission reports whether a set of granted permissions includes permission
+func HasPermission(granted []string, permission string) bool {
+	for _, g := range granted {
+		if g == PermAll || g == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// Session is a signed-in device or browser. Its ID is the family ID shared
+// by the refresh tokens issued since the login; IP and UserAgent are those
+// of the client that last refreshed it.
+type Session struct {
+	ID         string     `gorm:"primaryKey;type:varchar(64)" json:"id"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	IP         string     `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent  string     `gorm:"type:varchar(512)" json:"user_agent"`
+	MFA        bool       `json:"mfa"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Current marks the session of the request listing it
+	Current bool `gorm:"-" json:"current"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// Reasons a login failed
+const (
+	LoginFailureInvalidCredentials = "invalid_credentials"
+	LoginFailureEmailNotVerified   = "email_not_verified"
+	LoginFailureInvalidMFACode     = "invalid_mfa_code"
+)
+
+// LoginEvent records a successful or failed login attempt
+type LoginEvent struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+	// UserID is unset for attempts on logins that match no user
+	UserID *uint `gorm:"index" json:"user_id,omitempty"`
+	// Login is the username or email the attempt was made with
+	Login     string `gorm:"type:varchar(255)" json:"login"`
+	Success   bool   `json:"success"`
+	Reason    string `gorm:"type:varchar(32)" json:"reason,omitempty"`
+	IP        string `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent string `gorm:"type:varchar(512)" json:"user_agent"`
+	// SessionID is the session a successful login started
+	SessionID string    `gorm:"type:varchar(64)" json:"session_id,omitempty"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:SET NULL" json:"-"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// Verdicts of submissions, normalized across online judges
+const (
+	VerdictAccepted            = "accepted"
+	VerdictWrongAnswer         = "wrong_answer"
+	VerdictTimeLimitExceeded   = "time_limit_exceeded"
+	VerdictMemoryLimitExceeded = "memory_limit_exceeded"
+	VerdictRuntimeError        = "runtime_error"
+	VerdictCompilationError    = "compilation_error"
+	VerdictOther               = "other"
+)
+
+// Submission is a judged submission of a user to a problem on an online
+// judge, synced from the judge account it was made with
+type Submission struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	UserID         uint      `gorm:"index" json:"user_id"`
+	JudgeAccountID uint      `gorm:"index" json:"judge_account_id"`
+	ProblemID      uint      `gorm:"index" json:"problem_id"`
+	Platform       string    `gorm:"type:varchar(32);uniqueIndex:uni_submission_platform_external_id" json:"platform"`
+	ExternalID     string    `gorm:"type:varchar(64);uniqueIndex:uni_submission_platform_external_id" json:"external_id"`
+	Verdict        string    `gorm:"type:varchar(32);check:chk_submission_verdict,verdict IN ('accepted','wrong_answer','time_limit_exceeded','memory_limit_exceeded','runtime_error','compilation_error','other')" json:"verdict"`
+	Language       string    `gorm:"type:varchar(64)" json:"language"`
+	SubmittedAt    time.Time `gorm:"index" json:"submitted_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	// Relations
+	User         *User         `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	JudgeAccount *JudgeAccount `gorm:"foreignKey:JudgeAccountID;constraint:OnDelete:CASCADE" json:"-"`
+	Problem      *Problem      `gorm:"foreignKey:ProblemID;constraint:OnDelete:CASCADE" json:"problem,omitempty"`
+}
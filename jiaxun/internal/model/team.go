@@ -2,26 +2,63 @@ package model
 
 import (
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// Roles a user can hold within a team
+const (
+	TeamRoleMember  = "member"
+	TeamRoleCaptain = "captain"
 )
 
 type Team struct {
-    TeamID    uint      `gorm:"primaryKey" json:"team_id"`
-    TeamName  string    `gorm:"type:varchar(100)" json:"team_name"`
-    CreatedAt time.Time `json:"created_at"`
-    // Associations
-    TeamMemberships []TeamMembership `gorm:"foreignKey:TeamID" json:"-"`
-    ContestRegistrations []ContestRegistration `gorm:"foreignKey:TeamID" json:"-"`
-    TrainingParticipations []TrainingParticipation `gorm:"foreignKey:TeamID" json:"-"`
+	TeamID    uint      `gorm:"primaryKey" json:"team_id"`
+	TeamName  string    `gorm:"type:varchar(100)" json:"team_name"`
+	CreatedAt time.Time `json:"created_at"`
+	// DeletedAt is set while the team is in the trash
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	// Associations
+	TeamMemberships        []TeamMembership        `gorm:"foreignKey:TeamID;constraint:OnDelete:CASCADE" json:"-"`
+	ContestRegistrations   []ContestRegistration   `gorm:"foreignKey:TeamID;constraint:OnDelete:CASCADE" json:"-"`
+	TrainingParticipations []TrainingParticipation `gorm:"foreignKey:TeamID;constraint:OnDelete:CASCADE" json:"-"`
+	TeamRequests           []TeamRequest           `gorm:"foreignKey:TeamID;constraint:OnDelete:CASCADE" json:"-"`
 }
 
 type TeamMembership struct {
-    UserID    uint   `gorm:"primaryKey" json:"user_id"`
-    TeamID    uint   `gorm:"primaryKey" json:"team_id"`
-    Role      string `gorm:"type:enum('member','captain');default:'member'" json:"role"`
-    JoinedAt  time.Time `json:"joined_at"`
-    // Relations
-    User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
-    Team *Team `gorm:"foreignKey:TeamID;constraint:OnDelete:CASCADE" json:"-"`
+	UserID   uint      `gorm:"primaryKey" json:"user_id"`
+	TeamID   uint      `gorm:"primaryKey" json:"team_id"`
+	Role     string    `gorm:"type:varchar(16);default:'member';check:chk_team_membership_role,role IN ('member','captain')" json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Team *Team `gorm:"constraint:OnDelete:CASCADE" json:"-"`
 }
 
+// Kinds of pending team requests
+const (
+	TeamRequestInvitation = "invitation"
+	TeamRequestJoin       = "join_request"
+)
 
+// Statuses of a team request
+const (
+	TeamRequestPending  = "pending"
+	TeamRequestAccepted = "accepted"
+	TeamRequestDeclined = "declined"
+)
+
+// TeamRequest is either an invitation sent by a captain to a user or a
+// request by a user to join a team. It awaits a response from the other side.
+type TeamRequest struct {
+	RequestID   uint       `gorm:"primaryKey" json:"request_id"`
+	TeamID      uint       `gorm:"index" json:"team_id"`
+	UserID      uint       `gorm:"index" json:"user_id"`
+	Kind        string     `gorm:"type:varchar(16);check:chk_team_request_kind,kind IN ('invitation','join_request')" json:"kind"`
+	Status      string     `gorm:"type:varchar(16);default:'pending';check:chk_team_request_status,status IN ('pending','accepted','declined')" json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Team *Team `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -0,0 +1,86 @@
+package model
+
+import "time"
+
+// RefreshToken is a single-use token exchanged for a new access token.
+// Tokens issued from the same login share a FamilyID; each refresh rotates
+// the token within its family.
+type RefreshToken struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	UserID    uint   `gorm:"index" json:"user_id"`
+	FamilyID  string `gorm:"type:varchar(64);index" json:"family_id"`
+	TokenHash string `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	// The access token issued together with this refresh token
+	AccessJTI       string    `gorm:"type:varchar(64)" json:"-"`
+	AccessExpiresAt time.Time `json:"-"`
+	// MFA records whether the session was established with a second factor
+	MFA       bool       `json:"mfa"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// RevokedToken records an access token that must no longer be accepted
+// even though it has not expired yet
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;type:varchar(64)"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// PasswordResetToken is a single-use token emailed to a user who forgot
+// their password. Only its hash is stored.
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// RecoveryCode is a one-time code that can replace a TOTP code when the
+// user has lost their authenticator. Only its hash is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	CodeHash  string     `gorm:"type:varchar(64)" json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// PersonalAccessToken is a long-lived token a user creates for scripts and
+// bots. It acts on behalf of the user, limited to its scopes. Only its hash
+// is stored; Prefix is kept so the user can tell tokens apart.
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	Name       string     `gorm:"type:varchar(100)" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16)" json:"prefix"`
+	TokenHash  string     `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	Scopes     []string   `gorm:"serializer:json;type:text" json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// MFAChallenge is a pending second login step, identified by the jti of its
+// challenge token. It is deleted once a code is accepted, and refuses codes
+// after a few failed attempts.
+type MFAChallenge struct {
+	JTI       string    `gorm:"primaryKey;type:varchar(64)"`
+	UserID    uint      `gorm:"index"`
+	Attempts  int       `gorm:"default:0"`
+	ExpiresAt time.Time `gorm:"index"`
+	// Relations
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type TrainingPlan struct {
 	TrainingPlanID uint      `gorm:"primaryKey" json:"training_plan_id"`
@@ -8,8 +12,13 @@ type TrainingPlan struct {
 	Description    string    `gorm:"type:text" json:"description"`
 	StartDate      time.Time `json:"start_date"`
 	EndDate        time.Time `json:"end_date"`
+	CreatedBy      *uint     `gorm:"index" json:"created_by,omitempty"`
+	// DeletedAt is set while the plan is in the trash
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 	// Associations
-	Participations []TrainingParticipation `gorm:"foreignKey:TrainingPlanID" json:"-"`
+	Participations []TrainingParticipation `gorm:"foreignKey:TrainingPlanID;constraint:OnDelete:CASCADE" json:"-"`
+	// Relations
+	Creator *User `gorm:"foreignKey:CreatedBy;constraint:OnDelete:SET NULL" json:"-"`
 }
 
 type TrainingParticipation struct {
@@ -19,7 +28,7 @@ type TrainingParticipation struct {
 	TeamID          *uint     `gorm:"index" json:"team_id,omitempty"`
 	JoinedAt        time.Time `json:"joined_at"`
 	// Relations
-	TrainingPlan *TrainingPlan `gorm:"foreignKey:TrainingPlanID;constraint:OnDelete:CASCADE" json:"-"`
+	TrainingPlan *TrainingPlan `gorm:"constraint:OnDelete:CASCADE" json:"-"`
 	User         *User         `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
-	Team         *Team         `gorm:"foreignKey:TeamID;constraint:OnDelete:CASCADE" json:"-"`
+	Team         *Team         `gorm:"constraint:OnDelete:CASCADE" json:"-"`
 }
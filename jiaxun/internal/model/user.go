@@ -1,18 +1,46 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Account statuses
+const (
+	UserStatusActive = "active"
+	// UserStatusPending marks a self-registered account whose email is not verified yet
+	UserStatusPending = "pending"
+)
 
 type User struct {
-	ID        uint
-	Username  string `gorm:"unique"`
-	Email     string `gorm:"unique"`
-	FullName  string
-	Password  string
-	Role      string
-	CreatedAt time.Time
+	ID              uint
+	Username        string `gorm:"uniqueIndex:uni_user_username,where:deleted_at IS NULL"`
+	Email           string `gorm:"uniqueIndex:uni_user_email,where:deleted_at IS NULL"`
+	FullName        string
+	Password        string
+	Role            string
+	Status          string `gorm:"type:varchar(16);default:'active';check:chk_user_status,status IN ('active','pending')"`
+	EmailVerifiedAt *time.Time
+	// TOTPSecret is set during two-factor enrollment; 2FA is active once TOTPEnabledAt is set
+	TOTPSecret    string `json:"-"`
+	TOTPEnabledAt *time.Time
+	// TOTPLastStep is the last accepted time step, which prevents replaying a code
+	TOTPLastStep uint64 `json:"-"`
+	CreatedAt    time.Time
+	// DeletedAt is set while the user is in the trash
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 
-	 // Associations
-    TeamMemberships []TeamMembership `gorm:"foreignKey:UserID" json:"-"`
-    ContestRegistrations []ContestRegistration `gorm:"foreignKey:UserID" json:"-"`
-    TrainingParticipations []TrainingParticipation `gorm:"foreignKey:UserID" json:"-"`
+	// Associations
+	TeamMemberships        []TeamMembership        `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	ContestRegistrations   []ContestRegistration   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	TrainingParticipations []TrainingParticipation `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	TeamRequests           []TeamRequest           `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	RefreshTokens          []RefreshToken          `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	PasswordResetTokens    []PasswordResetToken    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	RecoveryCodes          []RecoveryCode          `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	PersonalAccessTokens   []PersonalAccessToken   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Sessions               []Session               `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Identities             []UserIdentity          `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	JudgeAccounts          []JudgeAccount          `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
 }
@@ -0,0 +1,280 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/oidc"
+	"jiaxun/internal/oidc/oidctest"
+)
+
+const redirectURL = "https://jiaxun.test/api/auth/oidc/test/callback"
+
+// newIdP starts a test provider and a relying party configured for it
+func newIdP(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+	idp, err := oidctest.NewServer("jiaxun", "s3cret")
+	if err != nil {
+		t.Fatalf("starting provider: %v", err)
+	}
+	t.Cleanup(idp.Close)
+	provider := oidc.NewProvider(config.OIDCProviderConfig{
+		ID:           "test",
+		Issuer:       idp.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+	}, redirectURL, nil)
+	return idp, provider
+}
+
+// login runs the flow up to the provider sending the user back, and
+// returns the code together with the verifier and nonce of the login
+func login(t *testing.T, idp *oidctest.Server, provider *oidc.Provider, claims map[string]interface{}) (code, verifier, nonce string) {
+	t.Helper()
+	verifier, nonce = "verifier-0123456789-0123456789-0123456789", "nonce-42"
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-42", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, state, err := idp.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if state != "state-42" {
+		t.Fatalf("provider sent back state %q, want state-42", state)
+	}
+	return code, verifier, nonce
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp, provider := newIdP(t)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "the-state", "the-nonce", "the-verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", authURL, err)
+	}
+	if got, want := u.Scheme+"://"+u.Host+u.Path, idp.URL+"/authorize"; got != want {
+		t.Errorf("authorization endpoint = %s, want %s", got, want)
+	}
+
+	query := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "jiaxun",
+		"redirect_uri":          redirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        oidc.CodeChallenge("the-verifier"),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := query.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestDiscoveryFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata func(issuer string) string
+		status   int
+	}{
+		{
+			name:   "provider down",
+			status: http.StatusServiceUnavailable,
+		},
+		{
+			name: "issuer mismatch",
+			metadata: func(issuer string) string {
+				return `{"issuer":"https://impostor.test","authorization_endpoint":"` + issuer + `/authorize","token_endpoint":"` + issuer + `/token","jwks_uri":"` + issuer + `/jwks"}`
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "incomplete metadata",
+			metadata: func(issuer string) string {
+				return `{"issuer":"` + issuer + `","authorization_endpoint":"` + issuer + `/authorize"}`
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:     "not JSON",
+			metadata: func(string) string { return "<html></html>" },
+			status:   http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/.well-known/openid-configuration" {
+					http.NotFound(w, r)
+					return
+				}
+				w.WriteHeader(tc.status)
+				if tc.metadata != nil {
+					w.Write([]byte(tc.metadata(server.URL)))
+				}
+			}))
+			defer server.Close()
+
+			provider := oidc.NewProvider(config.OIDCProviderConfig{ID: "test", Issuer: server.URL, ClientID: "jiaxun"}, redirectURL, nil)
+			if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+				t.Fatal("AuthCodeURL succeeded, want a discovery error")
+			}
+		})
+	}
+}
+
+func TestDiscoveryRetriedAfterFailure(t *testing.T) {
+	idp, _ := newIdP(t)
+
+	// The provider is down for the first request only
+	var requests atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"issuer":"` + idp.URL + `","authorization_endpoint":"` + idp.URL + `/authorize","token_endpoint":"` + idp.URL + `/token","jwks_uri":"` + idp.URL + `/jwks"}`))
+	}))
+	defer proxy.Close()
+
+	// The proxy serves the metadata of another issuer, so only its
+	// availability is under test here
+	provider := oidc.NewProvider(config.OIDCProviderConfig{ID: "test", Issuer: idp.URL, ClientID: "jiaxun"}, redirectURL, &http.Client{
+		Transport: rewriteHost{target: proxy.URL},
+	})
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Fatal("AuthCodeURL succeeded while the provider was down")
+	}
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err != nil {
+		t.Fatalf("AuthCodeURL after the provider came back: %v", err)
+	}
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err != nil {
+		t.Fatalf("AuthCodeURL with cached metadata: %v", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("metadata fetched %d times, want 2", got)
+	}
+}
+
+// rewriteHost sends every request to the target server
+type rewriteHost struct {
+	target string
+}
+
+func (rt rewriteHost) RoundTrip(r *http.Request) (*http.Response, error) {
+	target, _ := url.Parse(rt.target)
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = target.Scheme, target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestExchange(t *testing.T) {
+	idp, provider := newIdP(t)
+	code, verifier, nonce := login(t, idp, provider, map[string]interface{}{
+		"sub":                "user-1",
+		"email":              "ada@example.org",
+		"email_verified":     "true",
+		"preferred_username": "ada",
+		"name":               "Ada Lovelace",
+		"groups":             []string{"staff"},
+	})
+
+	claims, err := provider.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "ada@example.org" || !claims.EmailVerified ||
+		claims.PreferredUsername != "ada" || claims.Name != "Ada Lovelace" {
+		t.Errorf("Exchange = %+v", claims)
+	}
+	if groups, _ := claims.Raw["groups"].([]interface{}); len(groups) != 1 || groups[0] != "staff" {
+		t.Errorf("groups claim = %v, want [staff]", claims.Raw["groups"])
+	}
+
+	// Codes are single-use
+	if _, err := provider.Exchange(context.Background(), code, verifier, nonce); !errors.Is(err, oidc.ErrExchangeFailed) {
+		t.Errorf("reusing the code = %v, want ErrExchangeFailed", err)
+	}
+}
+
+func TestExchangeRejectsCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(code, verifier string) (string, string)
+	}{
+		{"unknown code", func(_, verifier string) (string, string) { return "forged", verifier }},
+		{"wrong verifier", func(code, _ string) (string, string) { return code, "another-verifier-0123456789-0123456789" }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			idp, provider := newIdP(t)
+			code, verifier, nonce := login(t, idp, provider, map[string]interface{}{"sub": "user-1"})
+			code, verifier = tc.tamper(code, verifier)
+			if _, err := provider.Exchange(context.Background(), code, verifier, nonce); !errors.Is(err, oidc.ErrExchangeFailed) {
+				t.Errorf("Exchange = %v, want ErrExchangeFailed", err)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		// nonce is the nonce the relying party expects, if not the one it sent
+		nonce string
+		// forge signs the token with a key the provider did not publish
+		forge bool
+	}{
+		{name: "nonce mismatch", claims: map[string]interface{}{"sub": "user-1", "nonce": "replayed"}},
+		{name: "nonce of another login", claims: map[string]interface{}{"sub": "user-1"}, nonce: "nonce-other"},
+		{name: "forged signature", claims: map[string]interface{}{"sub": "user-1"}, forge: true},
+		{name: "wrong audience", claims: map[string]interface{}{"sub": "user-1", "aud": "someone-else"}},
+		{name: "wrong issuer", claims: map[string]interface{}{"sub": "user-1", "iss": "https://impostor.test"}},
+		{name: "expired", claims: map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(-time.Hour).Unix()}},
+		{name: "missing subject", claims: map[string]interface{}{"email": "ada@example.org"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			idp, provider := newIdP(t)
+			if tc.forge {
+				if err := idp.ForgeSignatures(); err != nil {
+					t.Fatalf("ForgeSignatures: %v", err)
+				}
+			}
+			code, verifier, nonce := login(t, idp, provider, tc.claims)
+			if tc.nonce != "" {
+				nonce = tc.nonce
+			}
+
+			_, err := provider.Exchange(context.Background(), code, verifier, nonce)
+			if !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Fatalf("Exchange = %v, want ErrInvalidIDToken", err)
+			}
+			if tc.forge && !strings.Contains(err.Error(), "signature") {
+				t.Errorf("Exchange = %v, want a signature error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+// Package oidctest provides an in-process OpenID Connect provider for
+// testing the relying party, in the spirit of net/http/httptest.
+package oidctest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"jiaxun/internal/keyring"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// grant is an issued authorization code
+type grant struct {
+	redirectURI   string
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+// Server is an OpenID Connect provider listening on a local address. Its
+// issuer is its URL.
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	mu      sync.Mutex
+	keys    *keyring.Keyring
+	signing *keyring.Keyring
+	codes   map[string]grant
+}
+
+// NewServer starts a provider for a single client
+func NewServer(clientID, clientSecret string) (*Server, error) {
+	keys, err := newKeyring(randomString()[:8])
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		keys:         keys,
+		signing:      keys,
+		codes:        map[string]grant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	return s, nil
+}
+
+// newKeyring generates an Ed25519 signing key with the given ID
+func newKeyring(kid string) (*keyring.Keyring, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keyring.ParsePEM(kid, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return nil, err
+	}
+	return keyring.New(kid, key)
+}
+
+// ForgeSignatures makes the provider sign ID tokens with a fresh key
+// named like the published one, as an impostor would
+func (s *Server) ForgeSignatures() error {
+	forged, err := newKeyring(s.keys.JWKS().Keys[0].KeyID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signing = forged
+	return nil
+}
+
+// Authorize approves the login started at authURL, as if the user had
+// logged in at the provider, and returns the code and state the provider
+// sends back. The ID token carries the given claims; the issuer, audience,
+// nonce and times are filled in unless the claims set them.
+func (s *Server) Authorize(authURL string, claims map[string]interface{}) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := u.Query()
+	if query.Get("client_id") != s.ClientID {
+		return "", "", errors.New("unknown client")
+	}
+	if query.Get("code_challenge_method") != "S256" {
+		return "", "", errors.New("PKCE with S256 is required")
+	}
+
+	now := time.Now()
+	idClaims := jwt.MapClaims{
+		"iss":   s.URL,
+		"aud":   s.ClientID,
+		"nonce": query.Get("nonce"),
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+	}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+
+	code = randomString()
+	s.mu.Lock()
+	s.codes[code] = grant{
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+		claims:        idClaims,
+	}
+	s.mu.Unlock()
+	return code, query.Get("state"), nil
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.keys.JWKS())
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if r.Method != http.MethodPost || id != url.QueryEscape(s.ClientID) || secret != url.QueryEscape(s.ClientSecret) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// Codes are single-use
+	s.mu.Lock()
+	code := r.PostFormValue("code")
+	g, ok := s.codes[code]
+	delete(s.codes, code)
+	signing := s.signing
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != g.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := signing.Sign(g.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,141 @@
+// Package policy implements resource-level authorization.
+//
+// Each resource type declares a Policy that lists, per action, the rules
+// granting it: ownership or relationship rules such as "is the captain of
+// the team", and permission rules such as "holds contests:manage". An action
+// is allowed as soon as one of its rules matches. Policies only look at the
+// Subject and the resource value, so they can be evaluated by middleware and
+// services alike without any HTTP context.
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"jiaxun/internal/model"
+)
+
+// Action is an operation performed on a resource
+type Action string
+
+// Actions understood by the resource policies
+const (
+	ActionView   Action = "view"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+	ActionManage Action = "manage"
+)
+
+// ErrForbidden is matched by every authorization denial
+var ErrForbidden = errors.New("forbidden")
+
+// DeniedError reports that a subject may not perform an action on a resource
+type DeniedError struct {
+	Resource string
+	Action   Action
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("not allowed to %s this %s", e.Action, e.Resource)
+}
+
+// Unwrap makes errors.Is(err, ErrForbidden) hold for every denial
+func (e *DeniedError) Unwrap() error {
+	return ErrForbidden
+}
+
+// Message returns the user-facing text for an authorization error
+func Message(err error) string {
+	var denied *DeniedError
+	if errors.As(err, &denied) {
+		return fmt.Sprintf("You are not allowed to %s this %s", denied.Action, denied.Resource)
+	}
+	return "Forbidden"
+}
+
+// Subject is the user an authorization decision is made for
+type Subject struct {
+	UserID      uint
+	Permissions []string
+	// AccessToken is set when the user acts through a personal access
+	// token, whose Permissions are limited to its scopes
+	AccessToken bool
+}
+
+// Has reports whether the subject's role grants the permission
+func (s Subject) Has(permission string) bool {
+	return model.HasPermission(s.Permissions, permission)
+}
+
+// Rule decides whether the subject may act on the resource
+type Rule[R any] func(s Subject, resource R) bool
+
+// HasPermission returns a rule matching subjects granted the permission,
+// regardless of the resource
+func HasPermission[R any](permission string) Rule[R] {
+	return func(s Subject, _ R) bool {
+		return s.Has(permission)
+	}
+}
+
+// Related returns a rule matching like the given relationship rule, except
+// for subjects acting through a personal access token: a token acts with
+// its scopes alone, and no scope covers what users may do to their own
+// resources
+func Related[R any](rule Rule[R]) Rule[R] {
+	return func(s Subject, resource R) bool {
+		return !s.AccessToken && rule(s, resource)
+	}
+}
+
+// All returns a rule matching subjects matched by every one of the rules
+func All[R any](rules ...Rule[R]) Rule[R] {
+	return func(s Subject, resource R) bool {
+		for _, rule := range rules {
+			if !rule(s, resource) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Policy holds the rules of a single resource type
+type Policy[R any] struct {
+	resource string
+	rules    map[Action][]Rule[R]
+}
+
+// New creates an empty policy for the named resource. Actions without
+// rules are always denied.
+func New[R any](resource string) *Policy[R] {
+	return &Policy[R]{
+		resource: resource,
+		rules:    map[Action][]Rule[R]{},
+	}
+}
+
+// Allow grants the action to subjects matching any of the rules
+func (p *Policy[R]) Allow(action Action, rules ...Rule[R]) *Policy[R] {
+	p.rules[action] = append(p.rules[action], rules...)
+	return p
+}
+
+// Can reports whether the subject may perform the action on the resource
+func (p *Policy[R]) Can(s Subject, action Action, resource R) bool {
+	for _, rule := range p.rules[action] {
+		if rule(s, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize returns a *DeniedError unless the subject may perform the
+// action on the resource
+func (p *Policy[R]) Authorize(s Subject, action Action, resource R) error {
+	if p.Can(s, action, resource) {
+		return nil
+	}
+	return &DeniedError{Resource: p.resource, Action: action}
+}
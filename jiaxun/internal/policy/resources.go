@@ -0,0 +1,75 @@
+package policy
+
+import "jiaxun/internal/model"
+
+// Users governs changes to user profiles: users may modify themselves,
+// holders of users:write may modify anyone whose role grants nothing they
+// lack, so that only holders of every permission may modify an admin.
+// Relationship rules never match personal access tokens, which only act
+// with their scopes.
+var Users = New[*UserTarget]("user").
+	Allow(ActionUpdate, Related(IsSelf), All(HasPermission[*UserTarget](model.PermUsersWrite), Outranks)).
+	Allow(ActionDelete, Related(IsSelf), All(HasPermission[*UserTarget](model.PermUsersWrite), Outranks))
+
+// UserTarget is a user acted upon, with the permissions of their role
+type UserTarget struct {
+	User        *model.User
+	Permissions []string
+}
+
+// Teams governs the management of a team (invitations, join requests,
+// members, captaincy and registrations). The team must be passed with its
+// TeamMemberships loaded. Captains manage their own team, holders of
+// teams:approve manage any team and may also delete it.
+var Teams = New[*model.Team]("team").
+	Allow(ActionManage, Related(IsCaptain), HasPermission[*model.Team](model.PermTeamsApprove)).
+	Allow(ActionDelete, HasPermission[*model.Team](model.PermTeamsApprove))
+
+// Contests governs changes to a contest: its organizer and holders of
+// contests:manage may update or delete it.
+var Contests = New[*model.Contest]("contest").
+	Allow(ActionUpdate, Related(IsOrganizer), HasPermission[*model.Contest](model.PermContestsManage)).
+	Allow(ActionDelete, Related(IsOrganizer), HasPermission[*model.Contest](model.PermContestsManage))
+
+// TrainingPlans governs changes to a training plan and its participants:
+// its author and holders of training:manage may act on it.
+var TrainingPlans = New[*model.TrainingPlan]("training plan").
+	Allow(ActionUpdate, Related(IsAuthor), HasPermission[*model.TrainingPlan](model.PermTrainingManage)).
+	Allow(ActionDelete, Related(IsAuthor), HasPermission[*model.TrainingPlan](model.PermTrainingManage)).
+	Allow(ActionManage, Related(IsAuthor), HasPermission[*model.TrainingPlan](model.PermTrainingManage))
+
+// IsSelf matches a subject acting on their own user
+func IsSelf(s Subject, target *UserTarget) bool {
+	return target.User.ID == s.UserID
+}
+
+// Outranks matches subjects granted every permission of the target user's
+// role. Only holders of the wildcard outrank a user holding it.
+func Outranks(s Subject, target *UserTarget) bool {
+	for _, permission := range target.Permissions {
+		if !s.Has(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsCaptain matches the captain of the team
+func IsCaptain(s Subject, team *model.Team) bool {
+	for _, membership := range team.TeamMemberships {
+		if membership.UserID == s.UserID {
+			return membership.Role == model.TeamRoleCaptain
+		}
+	}
+	return false
+}
+
+// IsOrganizer matches the user who created the contest
+func IsOrganizer(s Subject, contest *model.Contest) bool {
+	return contest.CreatedBy != nil && *contest.CreatedBy == s.UserID
+}
+
+// IsAuthor matches the user who created the training plan
+func IsAuthor(s Subject, plan *model.TrainingPlan) bool {
+	return plan.CreatedBy != nil && *plan.CreatedBy == s.UserID
+}
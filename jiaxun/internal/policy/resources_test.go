@@ -0,0 +1,182 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"jiaxun/internal/model"
+)
+
+// Subjects shared by the policy tests: user 1 owns the resources, user 2
+// does not
+var (
+	owner      = Subject{UserID: 1}
+	stranger   = Subject{UserID: 2}
+	ownerToken = Subject{UserID: 1, AccessToken: true}
+)
+
+// granted returns the stranger holding the permissions
+func granted(permissions ...string) Subject {
+	return Subject{UserID: 2, Permissions: permissions}
+}
+
+// grantedToken returns the stranger acting through an access token scoped
+// to the permissions
+func grantedToken(permissions ...string) Subject {
+	return Subject{UserID: 2, Permissions: permissions, AccessToken: true}
+}
+
+// authorizeCase is a single decision of a policy test table
+type authorizeCase struct {
+	name    string
+	subject Subject
+	action  Action
+	allowed bool
+}
+
+// checkAuthorize runs a policy test table against a resource
+func checkAuthorize[R any](t *testing.T, p *Policy[R], resource R, cases []authorizeCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := p.Authorize(tc.subject, tc.action, resource)
+			if tc.allowed {
+				if err != nil {
+					t.Errorf("Authorize(%s) = %v, want nil", tc.action, err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrForbidden) {
+				t.Fatalf("Authorize(%s) = %v, want ErrForbidden", tc.action, err)
+			}
+			var denied *DeniedError
+			if !errors.As(err, &denied) || denied.Action != tc.action || denied.Resource != p.resource {
+				t.Errorf("Authorize(%s) = %#v, want a DeniedError for %s %s", tc.action, err, tc.action, p.resource)
+			}
+		})
+	}
+}
+
+func TestUsersAuthorize(t *testing.T) {
+	user := &UserTarget{User: &model.User{ID: 1}}
+	checkAuthorize(t, Users, user, []authorizeCase{
+		{"self updates", owner, ActionUpdate, true},
+		{"self deletes", owner, ActionDelete, true},
+		{"other user updates", stranger, ActionUpdate, false},
+		{"other user deletes", stranger, ActionDelete, false},
+		{"users:write updates", granted(model.PermUsersWrite), ActionUpdate, true},
+		{"users:write deletes", granted(model.PermUsersWrite), ActionDelete, true},
+		{"wildcard updates", granted(model.PermAll), ActionUpdate, true},
+		{"users:read updates", granted(model.PermUsersRead), ActionUpdate, false},
+		{"users:read deletes", granted(model.PermUsersRead), ActionDelete, false},
+		{"unrelated permission updates", granted(model.PermContestsManage), ActionUpdate, false},
+		{"self token updates", ownerToken, ActionUpdate, false},
+		{"self token deletes", ownerToken, ActionDelete, false},
+		{"users:write token updates", grantedToken(model.PermUsersWrite), ActionUpdate, true},
+		{"users:write token deletes", grantedToken(model.PermUsersWrite), ActionDelete, true},
+		{"self views", owner, ActionView, false},
+		{"self manages", owner, ActionManage, false},
+		{"users:write manages", granted(model.PermUsersWrite), ActionManage, false},
+	})
+}
+
+func TestUsersAuthorizeByRole(t *testing.T) {
+	teacher := []string{model.PermUsersRead, model.PermUsersWrite, model.PermContestsManage, model.PermTeamsApprove, model.PermTrainingManage}
+	admin := &UserTarget{User: &model.User{ID: 1, Role: model.RoleAdmin}, Permissions: []string{model.PermAll}}
+	peer := &UserTarget{User: &model.User{ID: 1, Role: model.RoleTeacher}, Permissions: teacher}
+	student := &UserTarget{User: &model.User{ID: 1, Role: model.RoleStudent}}
+
+	t.Run("admin", func(t *testing.T) {
+		checkAuthorize(t, Users, admin, []authorizeCase{
+			{"lower role updates", granted(teacher...), ActionUpdate, false},
+			{"lower role deletes", granted(teacher...), ActionDelete, false},
+			{"users:write alone updates", granted(model.PermUsersWrite), ActionUpdate, false},
+			{"wildcard updates", granted(model.PermAll), ActionUpdate, true},
+			{"wildcard deletes", granted(model.PermAll), ActionDelete, true},
+			{"lower role token updates", grantedToken(teacher...), ActionUpdate, false},
+			{"self updates", owner, ActionUpdate, true},
+		})
+	})
+	t.Run("teacher", func(t *testing.T) {
+		checkAuthorize(t, Users, peer, []authorizeCase{
+			{"same role updates", granted(teacher...), ActionUpdate, true},
+			{"same role deletes", granted(teacher...), ActionDelete, true},
+			{"part of the role updates", granted(model.PermUsersWrite, model.PermContestsManage), ActionUpdate, false},
+			{"role without users:write updates", granted(model.PermContestsManage, model.PermTeamsApprove), ActionUpdate, false},
+			{"wildcard deletes", granted(model.PermAll), ActionDelete, true},
+		})
+	})
+	t.Run("student", func(t *testing.T) {
+		checkAuthorize(t, Users, student, []authorizeCase{
+			{"users:write updates", granted(model.PermUsersWrite), ActionUpdate, true},
+			{"higher role deletes", granted(teacher...), ActionDelete, true},
+			{"other student updates", stranger, ActionUpdate, false},
+		})
+	})
+}
+
+func TestTeamsAuthorize(t *testing.T) {
+	team := &model.Team{
+		TeamID: 1,
+		TeamMemberships: []model.TeamMembership{
+			{UserID: 1, TeamID: 1, Role: model.TeamRoleCaptain},
+			{UserID: 3, TeamID: 1, Role: model.TeamRoleMember},
+		},
+	}
+	member := Subject{UserID: 3}
+	checkAuthorize(t, Teams, team, []authorizeCase{
+		{"captain manages", owner, ActionManage, true},
+		{"member manages", member, ActionManage, false},
+		{"outsider manages", stranger, ActionManage, false},
+		{"teams:approve manages", granted(model.PermTeamsApprove), ActionManage, true},
+		{"wildcard manages", granted(model.PermAll), ActionManage, true},
+		{"unrelated permission manages", granted(model.PermUsersWrite), ActionManage, false},
+		{"captain token manages", ownerToken, ActionManage, false},
+		{"teams:approve token manages", grantedToken(model.PermTeamsApprove), ActionManage, true},
+		{"captain updates", owner, ActionUpdate, false},
+		{"captain deletes", owner, ActionDelete, false},
+		{"teams:approve deletes", granted(model.PermTeamsApprove), ActionDelete, true},
+		{"wildcard deletes", granted(model.PermAll), ActionDelete, true},
+		{"member deletes", member, ActionDelete, false},
+	})
+}
+
+func TestTeamsAuthorizeWithoutMemberships(t *testing.T) {
+	// A team loaded without its memberships has no captain to match
+	team := &model.Team{TeamID: 1}
+	checkAuthorize(t, Teams, team, []authorizeCase{
+		{"would-be captain manages", owner, ActionManage, false},
+		{"teams:approve manages", granted(model.PermTeamsApprove), ActionManage, true},
+	})
+}
+
+func TestContestsAuthorize(t *testing.T) {
+	organizer := uint(1)
+	contest := &model.Contest{ContestID: 1, CreatedBy: &organizer}
+	checkAuthorize(t, Contests, contest, []authorizeCase{
+		{"organizer updates", owner, ActionUpdate, true},
+		{"organizer deletes", owner, ActionDelete, true},
+		{"other user updates", stranger, ActionUpdate, false},
+		{"other user deletes", stranger, ActionDelete, false},
+		{"contests:manage updates", granted(model.PermContestsManage), ActionUpdate, true},
+		{"contests:manage deletes", granted(model.PermContestsManage), ActionDelete, true},
+		{"wildcard deletes", granted(model.PermAll), ActionDelete, true},
+		{"unrelated permission updates", granted(model.PermTeamsApprove), ActionUpdate, false},
+		{"organizer token updates", ownerToken, ActionUpdate, false},
+		{"organizer token deletes", ownerToken, ActionDelete, false},
+		{"contests:manage token updates", grantedToken(model.PermContestsManage), ActionUpdate, true},
+		{"organizer manages", owner, ActionManage, false},
+		{"contests:manage views", granted(model.PermContestsManage), ActionView, false},
+	})
+}
+
+func TestContestsAuthorizeWithoutOrganizer(t *testing.T) {
+	// Contests created before organizers were recorded belong to nobody
+	contest := &model.Contest{ContestID: 1}
+	checkAuthorize(t, Contests, contest, []authorizeCase{
+		{"user updates", owner, ActionUpdate, false},
+		{"user deletes", owner, ActionDelete, false},
+		{"contests:manage updates", granted(model.PermContestsManage), ActionUpdate, true},
+	})
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// AccessTokenRepository provides database operations for personal access tokens.
+type AccessTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewAccessTokenRepository creates a new AccessTokenRepository instance.
+func NewAccessTokenRepository(db *gorm.DB) *AccessTokenRepository {
+	return &AccessTokenRepository{db: db}
+}
+
+// Create stores a new personal access token.
+func (r *AccessTokenRepository) Create(token *model.PersonalAccessToken) error {
+	return r.db.Create(token).Error
+}
+
+// ListByUser retrieves the tokens of a user, newest first.
+func (r *AccessTokenRepository) ListByUser(userID uint) ([]model.PersonalAccessToken, error) {
+	var tokens []model.PersonalAccessToken
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// GetByHash retrieves a token by the hash of its value.
+func (r *AccessTokenRepository) GetByHash(hash string) (*model.PersonalAccessToken, error) {
+	var token model.PersonalAccessToken
+	if err := r.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Revoke marks a token of the user as revoked. It returns
+// gorm.ErrRecordNotFound if the user has no such active token.
+func (r *AccessTokenRepository) Revoke(userID, id uint, at time.Time) error {
+	result := r.db.Model(&model.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// TouchLastUsed records that a token was used.
+func (r *AccessTokenRepository) TouchLastUsed(id uint, at time.Time) error {
+	return r.db.Model(&model.PersonalAccessToken{}).Where("id = ?", id).
+		Update("last_used_at", at).Error
+}
@@ -1,6 +1,12 @@
 package repository
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
 
 type BaseRepository[T any] struct {
 	db *gorm.DB
@@ -27,6 +33,13 @@ func (r *BaseRepository[T]) Update(obj *T) error {
 	return r.db.Save(obj).Error
 }
 
+// UpdateFields updates only the given columns of obj, keyed by column name
+func (r *BaseRepository[T]) UpdateFields(obj *T, fields map[string]interface{}) error {
+	return r.db.Model(obj).Updates(fields).Error
+}
+
+// Delete removes an object by ID. Objects with a DeletedAt field are only
+// moved to the trash.
 func (r *BaseRepository[T]) Delete(id uint) error {
 	var obj T
 	return r.db.Delete(&obj, id).Error
@@ -56,3 +69,70 @@ func (r *BaseRepository[T]) List(page, pageSize int) ([]T, int64, error) {
 
 	return objs, total, nil
 }
+
+// ListDeleted returns the objects in the trash with pagination, most
+// recently deleted first.
+func (r *BaseRepository[T]) ListDeleted(page, pageSize int) ([]T, int64, error) {
+	var objs []T
+	var total int64
+
+	query := r.db.Unscoped().Model(new(T)).Where("deleted_at IS NOT NULL")
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("deleted_at DESC").Offset(offset).Limit(pageSize).Find(&objs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return objs, total, nil
+}
+
+// GetDeletedByID retrieves an object in the trash by ID.
+func (r *BaseRepository[T]) GetDeletedByID(id uint) (*T, error) {
+	var obj T
+	err := r.db.Unscoped().Where("deleted_at IS NOT NULL").First(&obj, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// Restore takes an object out of the trash.
+func (r *BaseRepository[T]) Restore(obj *T) error {
+	return r.db.Unscoped().Model(obj).Update("deleted_at", nil).Error
+}
+
+// Purge permanently deletes an object, together with the rows that
+// cascade from it.
+func (r *BaseRepository[T]) Purge(obj *T) error {
+	return r.db.Unscoped().Delete(obj).Error
+}
+
+// ListDeletedBefore retrieves the objects moved to the trash before the
+// cutoff.
+func (r *BaseRepository[T]) ListDeletedBefore(cutoff time.Time) ([]T, error) {
+	var objs []T
+	err := r.db.Unscoped().Where("deleted_at < ?", cutoff).Find(&objs).Error
+	return objs, err
+}
+
+// PurgeDeletedBefore permanently deletes the objects moved to the trash
+// before the cutoff and returns how many there were.
+func (r *BaseRepository[T]) PurgeDeletedBefore(cutoff time.Time) (int64, error) {
+	result := r.db.Unscoped().Where("deleted_at < ?", cutoff).Delete(new(T))
+	return result.RowsAffected, result.Error
+}
+
+// withoutTrashedMembers excludes rows that belong to a user or a team in
+// the trash. Rows without a user or a team, such as team registrations,
+// are kept.
+func withoutTrashedMembers(db *gorm.DB) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		users := db.Unscoped().Model(&model.User{}).Select("id").Where("deleted_at IS NOT NULL")
+		teams := db.Unscoped().Model(&model.Team{}).Select("team_id").Where("deleted_at IS NOT NULL")
+		return tx.Where("user_id IS NULL OR user_id NOT IN (?)", users).
+			Where("team_id IS NULL OR team_id NOT IN (?)", teams)
+	}
+}
@@ -1,9 +1,25 @@
 package repository
 
 import (
+	"errors"
+
 	"jiaxun/internal/model"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Contest registration errors
+var (
+	// ErrParticipantRegistered is returned when a user already takes part
+	// in the contest, individually or through a team
+	ErrParticipantRegistered = errors.New("participant already registered")
+	// ErrRegistrationKind is returned when the registration does not match
+	// whether the contest is team-based
+	ErrRegistrationKind = errors.New("registration does not match the contest")
+	// ErrContestHasRegistrations is returned when changing whether a contest
+	// is team-based after users or teams registered
+	ErrContestHasRegistrations = errors.New("contest has registrations")
 )
 
 type ContestRepository struct {
@@ -19,15 +35,91 @@ func NewContestRepository(db *gorm.DB) *ContestRepository {
 }
 
 // Contest-specific methods
+
+// GetRegistrationsByContestID retrieves the registrations of a contest,
+// except those of users and teams in the trash.
 func (r *ContestRepository) GetRegistrationsByContestID(contestID uint) ([]model.ContestRegistration, error) {
 	var registrations []model.ContestRegistration
-	err := r.db.Where("contest_id = ?", contestID).Find(&registrations).Error
+	err := r.db.Scopes(withoutTrashedMembers(r.db)).Where("contest_id = ?", contestID).Find(&registrations).Error
 	if err != nil {
 		return nil, err
 	}
 	return registrations, nil
 }
 
+// CreateRegistration registers a user or a team to a contest in a single
+// transaction, holding a lock on the contest. It fails with
+// gorm.ErrDuplicatedKey if the user or team is already registered,
+// ErrParticipantRegistered if the user or a member of the team takes part
+// in the contest otherwise, and ErrRegistrationKind if the registration
+// does not match whether the contest is team-based.
 func (r *ContestRepository) CreateRegistration(registration *model.ContestRegistration) error {
-	return r.db.Create(registration).Error
-}
\ No newline at end of file
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Writing first takes the database lock on SQLite, which has no row locks
+		if err := tx.Create(registration).Error; err != nil {
+			return err
+		}
+
+		var contest model.Contest
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("contest_id", "is_team_based").First(&contest, registration.ContestID).Error
+		if err != nil {
+			return err
+		}
+		if contest.IsTeamBased == registration.IsUserRegistration {
+			return ErrRegistrationKind
+		}
+
+		userIDs := []uint{}
+		if registration.UserID != nil {
+			userIDs = append(userIDs, *registration.UserID)
+		} else {
+			err := tx.Model(&model.TeamMembership{}).Where("team_id = ?", *registration.TeamID).Pluck("user_id", &userIDs).Error
+			if err != nil {
+				return err
+			}
+		}
+		for _, userID := range userIDs {
+			var count int64
+			err := participating(tx, registration.ContestID, userID).
+				Where("registration_id <> ?", registration.RegistrationID).
+				Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrParticipantRegistered
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateUnregistered applies fields to a contest provided it has no
+// registrations. The update locks the contest, so that registrations
+// created meanwhile see the new fields. Otherwise it fails with
+// ErrContestHasRegistrations.
+func (r *ContestRepository) UpdateUnregistered(contest *model.Contest, fields map[string]interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(contest).Updates(fields).Error; err != nil {
+			return err
+		}
+		var count int64
+		err := tx.Model(&model.ContestRegistration{}).Where("contest_id = ?", contest.ContestID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrContestHasRegistrations
+		}
+		return nil
+	})
+}
+
+// participating selects the registrations through which a user takes part
+// in a contest.
+func participating(db *gorm.DB, contestID, userID uint) *gorm.DB {
+	teamIDs := db.Model(&model.TeamMembership{}).Select("team_id").Where("user_id = ?", userID)
+	return db.Model(&model.ContestRegistration{}).
+		Where("contest_id = ?", contestID).
+		Where("user_id = ? OR team_id IN (?)", userID, teamIDs)
+}
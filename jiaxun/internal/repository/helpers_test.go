@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+
+	"jiaxun/internal/migration"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// openTestDB opens a migrated SQLite database in a temporary file
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=on"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger:         logger.Discard,
+		NamingStrategy: schema.NamingStrategy{SingularTable: true},
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	migrator, err := migration.New(db)
+	if err != nil {
+		t.Fatalf("creating migrator: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return db
+}
+
+// create stores rows, failing the test on error
+func create(t *testing.T, db *gorm.DB, rows ...interface{}) {
+	t.Helper()
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("creating %T: %v", row, err)
+		}
+	}
+}
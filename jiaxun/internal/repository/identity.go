@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// IdentityRepository provides database operations for the accounts at OIDC
+// providers and LDAP directories that are linked to users.
+type IdentityRepository struct {
+	db *gorm.DB
+}
+
+// NewIdentityRepository creates a new IdentityRepository instance.
+func NewIdentityRepository(db *gorm.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// Get retrieves the link of an external account.
+func (r *IdentityRepository) Get(provider, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	if err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// Create links an external account to a user.
+func (r *IdentityRepository) Create(identity *model.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+// Touch records a login through a linked external account.
+func (r *IdentityRepository) Touch(id uint, email string, at time.Time) error {
+	return r.db.Model(&model.UserIdentity{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"email":         email,
+			"last_login_at": at,
+		}).Error
+}
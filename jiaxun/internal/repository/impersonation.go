@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// ImpersonationRepository provides database operations for impersonations
+// and the requests made in them.
+type ImpersonationRepository struct {
+	db *gorm.DB
+}
+
+// NewImpersonationRepository creates a new ImpersonationRepository instance.
+func NewImpersonationRepository(db *gorm.DB) *ImpersonationRepository {
+	return &ImpersonationRepository{db: db}
+}
+
+// Create stores a new impersonation.
+func (r *ImpersonationRepository) Create(impersonation *model.Impersonation) error {
+	return r.db.Create(impersonation).Error
+}
+
+// Get retrieves an impersonation by ID.
+func (r *ImpersonationRepository) Get(id string) (*model.Impersonation, error) {
+	var impersonation model.Impersonation
+	if err := r.db.Where("id = ?", id).First(&impersonation).Error; err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+// End marks an impersonation as ended unless it already was, reporting
+// whether it was still going on.
+func (r *ImpersonationRepository) End(id string, at time.Time) (bool, error) {
+	result := r.db.Model(&model.Impersonation{}).
+		Where("id = ? AND ended_at IS NULL", id).
+		Update("ended_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// List retrieves impersonations with pagination, newest first. Zero IDs
+// match any actor or subject.
+func (r *ImpersonationRepository) List(actorID, subjectID uint, page, pageSize int) ([]model.Impersonation, int64, error) {
+	var impersonations []model.Impersonation
+	var total int64
+
+	query := r.db.Model(&model.Impersonation{})
+	if actorID != 0 {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if subjectID != 0 {
+		query = query.Where("subject_id = ?", subjectID)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&impersonations).Error
+	return impersonations, total, err
+}
+
+// CreateRequest records a request made in an impersonation.
+func (r *ImpersonationRepository) CreateRequest(request *model.ImpersonationRequest) error {
+	return r.db.Create(request).Error
+}
+
+// ListRequests retrieves the requests made in an impersonation with
+// pagination, in the order they were made.
+func (r *ImpersonationRepository) ListRequests(impersonationID string, page, pageSize int) ([]model.ImpersonationRequest, int64, error) {
+	var requests []model.ImpersonationRequest
+	var total int64
+
+	query := r.db.Model(&model.ImpersonationRequest{}).Where("impersonation_id = ?", impersonationID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("id").Offset(offset).Limit(pageSize).Find(&requests).Error
+	return requests, total, err
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -9,6 +10,8 @@ import (
 	_ "github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 
+	"jiaxun/internal/config"
+	"jiaxun/internal/migration"
 	"jiaxun/internal/model"
 
 	"gorm.io/driver/postgres"
@@ -27,12 +30,23 @@ func hashPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
-// InitDB initializes the database connection based on the provided config
-// and creates the database schema using GORM's Auto Migration
-func InitDB(driver, host string, port int, user, password, dbName string) (*gorm.DB, error) {
+// sqliteDSN builds the SQLite connection string. Pragmas are passed as DSN
+// parameters so that they apply to every pooled connection.
+func sqliteDSN(cfg config.DatabaseConfig) string {
+	if cfg.IsInMemory() {
+		return "file::memory:?_foreign_keys=on"
+	}
+	return fmt.Sprintf("file:%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000", cfg.SQLitePath())
+}
+
+// OpenDB opens the database connection based on the provided config,
+// creating the PostgreSQL database if it does not exist yet
+func OpenDB(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	var db *gorm.DB
 	var err error
 
+	host, port, user, password, dbName := cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name
+
 	// Configure GORM with options
 	gormConfig := &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
@@ -40,29 +54,30 @@ func InitDB(driver, host string, port int, user, password, dbName string) (*gorm
 			SingularTable: true, // Use singular table names
 		},
 		DisableForeignKeyConstraintWhenMigrating: false, // Enable foreign key constraints
+		// Report unique violations as gorm.ErrDuplicatedKey on every driver
+		TranslateError: true,
 	}
 
 	// Initialize the database connection based on the driver type
-	switch driver {
-	case "sqlite3":
-		// For SQLite, check if the file exists
-		dbFile := fmt.Sprintf("%s.db", dbName)
-
+	switch cfg.Driver {
+	case config.DriverSQLite:
 		// SQLite automatically creates a new database file if it doesn't exist
-		db, err = gorm.Open(sqlite.Open(dbFile), gormConfig)
+		db, err = gorm.Open(sqlite.Open(sqliteDSN(cfg)), gormConfig)
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to SQLite database: %w", err)
 		}
 
-		// Set SQLite pragmas for better performance
-		sqlDB, err := db.DB()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get database connection: %w", err)
+		// Every connection to :memory: opens a separate database,
+		// so the pool must be limited to a single connection
+		if cfg.IsInMemory() {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get database connection: %w", err)
+			}
+			sqlDB.SetMaxOpenConns(1)
 		}
-		sqlDB.Exec("PRAGMA journal_mode=WAL;")
-		sqlDB.Exec("PRAGMA foreign_keys=ON;")
 
-	case "postgres":
+	case config.DriverPostgres:
 		// First, try to connect to the target database
 		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 			host, port, user, password, dbName)
@@ -107,73 +122,72 @@ func InitDB(driver, host string, port int, user, password, dbName string) (*gorm
 		}
 
 	default:
-		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Driver)
 	}
 
-	// Create a migrator instance
-	migrator := db.Migrator()
-
-	// Auto-migrate models using GORM schema
-	log.Println("Running database migrations...")
+	return db, nil
+}
 
-	// Register all models to be migrated
-	models := []interface{}{
-		&model.User{},
-		// Add other models here as needed
+// InitDB initializes the database connection based on the provided config,
+// verifies that the schema is fully migrated and seeds the root user
+func InitDB(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	db, err := OpenDB(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	// Perform the migrations
-	err = db.AutoMigrate(models...)
+	migrator, err := migration.New(db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to auto-migrate database: %w", err)
+		return nil, err
 	}
 
-	// Create database indexes (if they don't already exist)
-	if !migrator.HasIndex(&model.User{}, "idx_user_email") {
-		err = migrator.CreateIndex(&model.User{}, "idx_user_email")
-		if err != nil {
-			log.Printf("Warning: failed to create index idx_user_email: %v", err)
+	// An in-memory database starts empty on every run, so migrate it right away
+	if cfg.IsInMemory() {
+		if _, err := migrator.Up(); err != nil {
+			return nil, err
 		}
 	}
 
-	// Check if root user exists, if not create it
-	var rootUser model.User
-	result := db.Where("username = ?", "root").First(&rootUser)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			// Create root user
-			log.Println("Creating root user...")
+	// Refuse to run against an unmigrated or newer schema
+	if err := migrator.Check(); err != nil {
+		if errors.Is(err, migration.ErrSchemaOutdated) {
+			return nil, fmt.Errorf("%w (run `migrate up` first)", err)
+		}
+		return nil, err
+	}
 
-			// Hash the password "jiaxun"
-			hashedPassword, err := hashPassword("jiaxun")
-			if err != nil {
-				log.Printf("Warning: failed to hash password for root user: %v", err)
-				return db, nil // Continue despite the error
-			}
+	// Seed the root user into an empty database only. Users in the trash
+	// count too, so that a deleted or renamed root is not recreated with
+	// the default password
+	var users int64
+	if err := db.Unscoped().Model(&model.User{}).Count(&users).Error; err != nil {
+		log.Printf("Warning: error checking for existing users: %v", err)
+	} else if users == 0 {
+		log.Println("Creating root user...")
+
+		// Hash the password "jiaxun"
+		hashedPassword, err := hashPassword("jiaxun")
+		if err != nil {
+			log.Printf("Warning: failed to hash password for root user: %v", err)
+			return db, nil // Continue despite the error
+		}
 
-			// Create user
-			rootUser = model.User{
-				Username:  "root",
-				Email:     "root@example.com",
-				Password:  hashedPassword,
-				FullName:  "System Administrator",
-				Role:      "admin",
-				CreatedAt: time.Now(),
-			}
+		rootUser := model.User{
+			Username:  "root",
+			Email:     "root@example.com",
+			Password:  hashedPassword,
+			FullName:  "System Administrator",
+			Role:      model.RoleAdmin,
+			CreatedAt: time.Now(),
+		}
 
-			if err := db.Create(&rootUser).Error; err != nil {
-				log.Printf("Warning: failed to create root user: %v", err)
-			} else {
-				log.Println("Root user created successfully")
-			}
+		if err := db.Create(&rootUser).Error; err != nil {
+			log.Printf("Warning: failed to create root user: %v", err)
 		} else {
-			// Some other error occurred when querying for the root user
-			log.Printf("Warning: error checking for root user: %v", result.Error)
+			log.Println("Root user created successfully")
 		}
-	} else {
-		log.Println("Root user already exists")
 	}
 
-	log.Printf("Successfully connected to the %s database!", driver)
+	log.Printf("Successfully connected to the %s database!", cfg.Driver)
 	return db, nil
 }
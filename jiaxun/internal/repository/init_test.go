@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/migration"
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// initTestDB runs InitDB against the database and closes it afterwards
+func initTestDB(t *testing.T, cfg config.DatabaseConfig) *gorm.DB {
+	t.Helper()
+	db, err := InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestInitDBSeedsRootOnce(t *testing.T) {
+	cfg := config.DatabaseConfig{Driver: config.DriverSQLite, Path: filepath.Join(t.TempDir(), "jiaxun.db")}
+	db, err := OpenDB(cfg)
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	migrator, err := migration.New(db)
+	if err != nil {
+		t.Fatalf("creating migrator: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	db = initTestDB(t, cfg)
+	var root model.User
+	if err := db.Where("username = ?", "root").First(&root).Error; err != nil {
+		t.Fatalf("root user was not seeded: %v", err)
+	}
+
+	// A root in the trash is not brought back with the default password
+	if err := db.Delete(&root).Error; err != nil {
+		t.Fatalf("deleting root: %v", err)
+	}
+	db = initTestDB(t, cfg)
+	var count int64
+	if err := db.Unscoped().Model(&model.User{}).Where("username = ?", "root").Count(&count).Error; err != nil {
+		t.Fatalf("counting root users: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("%d root users after restarting, want the deleted one only", count)
+	}
+	if err := db.Where("username = ?", "root").First(&model.User{}).Error; err == nil {
+		t.Error("deleted root user was recreated")
+	}
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"strings"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// JudgeAccountRepository provides database operations for the online judge
+// accounts of users.
+type JudgeAccountRepository struct {
+	db *gorm.DB
+}
+
+// NewJudgeAccountRepository creates a new JudgeAccountRepository instance.
+func NewJudgeAccountRepository(db *gorm.DB) *JudgeAccountRepository {
+	return &JudgeAccountRepository{db: db}
+}
+
+// Create stores a new judge account.
+func (r *JudgeAccountRepository) Create(account *model.JudgeAccount) error {
+	return r.db.Create(account).Error
+}
+
+// ListByUser retrieves the judge accounts of a user, ordered by platform.
+func (r *JudgeAccountRepository) ListByUser(userID uint) ([]model.JudgeAccount, error) {
+	var accounts []model.JudgeAccount
+	err := r.db.Where("user_id = ?", userID).Order("platform").Find(&accounts).Error
+	return accounts, err
+}
+
+// Get retrieves a judge account of a user by its ID.
+func (r *JudgeAccountRepository) Get(userID, id uint) (*model.JudgeAccount, error) {
+	var account model.JudgeAccount
+	if err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetByPlatform retrieves the judge account of a user on a platform.
+func (r *JudgeAccountRepository) GetByPlatform(userID uint, platform string) (*model.JudgeAccount, error) {
+	var account model.JudgeAccount
+	if err := r.db.Where("user_id = ? AND platform = ?", userID, platform).First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetVerified retrieves the account a handle on a platform has been
+// verified for, ignoring case.
+func (r *JudgeAccountRepository) GetVerified(platform, handle string) (*model.JudgeAccount, error) {
+	var account model.JudgeAccount
+	err := r.db.Where("platform = ? AND LOWER(handle) = ? AND verified", platform, strings.ToLower(handle)).
+		First(&account).Error
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Update saves every field of a judge account.
+func (r *JudgeAccountRepository) Update(account *model.JudgeAccount) error {
+	return r.db.Save(account).Error
+}
+
+// Delete removes a judge account of a user. It returns
+// gorm.ErrRecordNotFound if the user has no such account.
+func (r *JudgeAccountRepository) Delete(userID, id uint) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.JudgeAccount{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListVerified retrieves the verified accounts on the given platforms,
+// skipping users in the trash.
+func (r *JudgeAccountRepository) ListVerified(platforms []string) ([]model.JudgeAccount, error) {
+	var accounts []model.JudgeAccount
+	trashed := r.db.Unscoped().Model(&model.User{}).Select("id").Where("deleted_at IS NOT NULL")
+	err := r.db.Where("verified AND platform IN ? AND user_id NOT IN (?)", platforms, trashed).
+		Order("id").Find(&accounts).Error
+	return accounts, err
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptRepository provides database operations for failed login
+// counters and lockout events. Its counter methods make it usable as a
+// login attempt store shared by several server instances.
+type LoginAttemptRepository struct {
+	db *gorm.DB
+}
+
+// NewLoginAttemptRepository creates a new LoginAttemptRepository instance.
+func NewLoginAttemptRepository(db *gorm.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// Acquire atomically counts an attempt in progress at now and returns the
+// counters including it. The count starts over if the previous failure
+// happened before since.
+func (r *LoginAttemptRepository) Acquire(key string, now, since time.Time) (*model.LoginAttempt, error) {
+	attempt := &model.LoginAttempt{Key: key, Failures: 1, LastFailureAt: now}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":        gorm.Expr(`CASE WHEN "login_attempt"."last_failure_at" < ? THEN 1 ELSE "login_attempt"."failures" + 1 END`, since),
+			"last_failure_at": gorm.Expr(`CASE WHEN "login_attempt"."last_failure_at" < ? THEN ? ELSE "login_attempt"."last_failure_at" END`, since, now),
+		}),
+	}, clause.Returning{}).Create(attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return attempt, nil
+}
+
+// Release uncounts an attempt in progress that did not fail.
+func (r *LoginAttemptRepository) Release(key string) error {
+	return r.db.Model(&model.LoginAttempt{}).Where(`"key" = ? AND failures > 0`, key).
+		Update("failures", gorm.Expr("failures - 1")).Error
+}
+
+// RecordFailure atomically records that an attempt in progress failed at
+// now and returns the counters. A key reset while the attempt was in
+// progress counts it anew.
+func (r *LoginAttemptRepository) RecordFailure(key string, now time.Time) (*model.LoginAttempt, error) {
+	attempt := &model.LoginAttempt{Key: key, Failures: 1, LastFailureAt: now}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"last_failure_at": now}),
+	}, clause.Returning{}).Create(attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return attempt, nil
+}
+
+// Lock locks a key until the given time and clears its failures.
+func (r *LoginAttemptRepository) Lock(key string, until time.Time) error {
+	return r.db.Model(&model.LoginAttempt{}).Where(`"key" = ?`, key).
+		Updates(map[string]interface{}{
+			"failures":     0,
+			"locked_until": until,
+		}).Error
+}
+
+// Reset forgets the failures and lock of a key.
+func (r *LoginAttemptRepository) Reset(key string) error {
+	return r.db.Where(`"key" = ?`, key).Delete(&model.LoginAttempt{}).Error
+}
+
+// Purge removes keys whose last failure and lock both ended before the given time.
+func (r *LoginAttemptRepository) Purge(before time.Time) error {
+	return r.db.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", before, before).
+		Delete(&model.LoginAttempt{}).Error
+}
+
+// CreateLockoutEvent records a lockout.
+func (r *LoginAttemptRepository) CreateLockoutEvent(event *model.LockoutEvent) error {
+	return r.db.Create(event).Error
+}
+
+// GetLockoutEvent retrieves a lockout event by ID.
+func (r *LoginAttemptRepository) GetLockoutEvent(id uint) (*model.LockoutEvent, error) {
+	var event model.LockoutEvent
+	if err := r.db.First(&event, id).Error; err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// ListLockoutEvents retrieves lockout events with pagination, newest first.
+// With activeOnly set, only events that were not unlocked and have not
+// expired yet at now are returned.
+func (r *LoginAttemptRepository) ListLockoutEvents(page, pageSize int, activeOnly bool, now time.Time) ([]model.LockoutEvent, int64, error) {
+	var events []model.LockoutEvent
+	var total int64
+
+	query := r.db.Model(&model.LockoutEvent{})
+	if activeOnly {
+		query = query.Where("unlocked_at IS NULL AND locked_until > ?", now)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&events).Error
+	return events, total, err
+}
+
+// MarkUnlocked marks the pending lockout events of a key as lifted by an administrator.
+func (r *LoginAttemptRepository) MarkUnlocked(key string, at time.Time, by uint) error {
+	return r.db.Model(&model.LockoutEvent{}).
+		Where(`"key" = ? AND unlocked_at IS NULL AND locked_until > ?`, key, at).
+		Updates(map[string]interface{}{
+			"unlocked_at": at,
+			"unlocked_by": by,
+		}).Error
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// LoginEventRepository provides database operations for the login history.
+type LoginEventRepository struct {
+	db *gorm.DB
+}
+
+// NewLoginEventRepository creates a new LoginEventRepository instance.
+func NewLoginEventRepository(db *gorm.DB) *LoginEventRepository {
+	return &LoginEventRepository{db: db}
+}
+
+// Create records a login event.
+func (r *LoginEventRepository) Create(event *model.LoginEvent) error {
+	return r.db.Create(event).Error
+}
+
+// ListByUser retrieves the login events of a user with pagination, newest first.
+func (r *LoginEventRepository) ListByUser(userID uint, page, pageSize int) ([]model.LoginEvent, int64, error) {
+	var events []model.LoginEvent
+	var total int64
+
+	query := r.db.Model(&model.LoginEvent{}).Where("user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&events).Error
+	return events, total, err
+}
+
+// DeleteBefore removes login events recorded before the given time.
+func (r *LoginEventRepository) DeleteBefore(before time.Time) error {
+	return r.db.Where("created_at < ?", before).Delete(&model.LoginEvent{}).Error
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// MFARepository provides database operations for two-factor authentication.
+type MFARepository struct {
+	db *gorm.DB
+}
+
+// NewMFARepository creates a new MFARepository instance.
+func NewMFARepository(db *gorm.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// SaveTOTPSecret stores the secret of a pending TOTP enrollment.
+func (r *MFARepository) SaveTOTPSecret(userID uint, secret string) error {
+	return r.db.Model(&model.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{
+			"totp_secret":     secret,
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error
+}
+
+// EnableTOTP activates two-factor authentication and stores the hashes of
+// a fresh set of recovery codes.
+func (r *MFARepository) EnableTOTP(userID uint, at time.Time, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).
+			Update("totp_enabled_at", at).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, at, codeHashes)
+	})
+}
+
+// DisableTOTP turns two-factor authentication off and discards the
+// recovery codes.
+func (r *MFARepository) DisableTOTP(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"totp_secret":     "",
+				"totp_enabled_at": nil,
+				"totp_last_step":  0,
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+// AdvanceTOTPStep records the time step of an accepted TOTP code. It reports
+// false if a code from this or a later step was already accepted.
+func (r *MFARepository) AdvanceTOTPStep(userID uint, step uint64) (bool, error) {
+	result := r.db.Model(&model.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReplaceRecoveryCodes discards the recovery codes of a user and stores new ones.
+func (r *MFARepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, time.Now(), codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, at time.Time, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]model.RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = model.RecoveryCode{UserID: userID, CodeHash: hash, CreatedAt: at}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// UseRecoveryCode consumes an unused recovery code of a user. It reports
+// false if no such code exists.
+func (r *MFARepository) UseRecoveryCode(userID uint, codeHash string, at time.Time) (bool, error) {
+	result := r.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountUnusedRecoveryCodes returns how many recovery codes a user has left.
+func (r *MFARepository) CountUnusedRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// CreateChallenge records a pending second login step.
+func (r *MFARepository) CreateChallenge(challenge *model.MFAChallenge) error {
+	return r.db.Create(challenge).Error
+}
+
+// GetChallenge retrieves a pending second login step by its jti.
+func (r *MFARepository) GetChallenge(jti string) (*model.MFAChallenge, error) {
+	var challenge model.MFAChallenge
+	if err := r.db.Where("jti = ?", jti).First(&challenge).Error; err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// UseChallengeAttempt counts an attempt at a pending second login step. It
+// reports false if the step does not exist, has expired or has no attempts
+// left.
+func (r *MFARepository) UseChallengeAttempt(jti string, maxAttempts int, at time.Time) (bool, error) {
+	result := r.db.Model(&model.MFAChallenge{}).
+		Where("jti = ? AND attempts < ? AND expires_at > ?", jti, maxAttempts, at).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteChallenge removes a second login step once it is done with.
+func (r *MFARepository) DeleteChallenge(jti string) error {
+	return r.db.Where("jti = ?", jti).Delete(&model.MFAChallenge{}).Error
+}
+
+// DeleteExpiredChallenges removes second login steps that expired before
+// the given time.
+func (r *MFARepository) DeleteExpiredChallenges(before time.Time) error {
+	return r.db.Where("expires_at < ?", before).Delete(&model.MFAChallenge{}).Error
+}
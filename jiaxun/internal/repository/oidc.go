@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// OIDCRepository provides database operations for pending OpenID Connect logins.
+type OIDCRepository struct {
+	db *gorm.DB
+}
+
+// NewOIDCRepository creates a new OIDCRepository instance.
+func NewOIDCRepository(db *gorm.DB) *OIDCRepository {
+	return &OIDCRepository{db: db}
+}
+
+// CreateState stores a pending login.
+func (r *OIDCRepository) CreateState(state *model.ProviderLoginState) error {
+	return r.db.Create(state).Error
+}
+
+// TakeState retrieves and removes a pending login, so that each state can
+// complete a login once. It returns gorm.ErrRecordNotFound if the state is
+// unknown or was already taken.
+func (r *OIDCRepository) TakeState(value string) (*model.ProviderLoginState, error) {
+	var state model.ProviderLoginState
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state = ?", value).First(&state).Error; err != nil {
+			return err
+		}
+		result := tx.Where("state = ?", value).Delete(&model.ProviderLoginState{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// DeleteExpiredStates removes pending logins that expired before the given time.
+func (r *OIDCRepository) DeleteExpiredStates(before time.Time) error {
+	return r.db.Where("expires_at < ?", before).Delete(&model.ProviderLoginState{}).Error
+}
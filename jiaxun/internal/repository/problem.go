@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProblemRepository provides database operations for the problem bank.
+type ProblemRepository struct {
+	*BaseRepository[model.Problem]
+	db *gorm.DB
+}
+
+// NewProblemRepository creates a new ProblemRepository instance.
+func NewProblemRepository(db *gorm.DB) *ProblemRepository {
+	return &ProblemRepository{
+		BaseRepository: NewBaseRepository[model.Problem](db),
+		db:             db,
+	}
+}
+
+// GetByExternalID retrieves a problem by its platform and external ID.
+func (r *ProblemRepository) GetByExternalID(platform, externalID string) (*model.Problem, error) {
+	var problem model.Problem
+	err := r.db.Where("platform = ? AND external_id = ?", platform, externalID).First(&problem).Error
+	if err != nil {
+		return nil, err
+	}
+	return &problem, nil
+}
+
+// ProblemFilter selects problems in a search. Zero fields match every
+// problem.
+type ProblemFilter struct {
+	// Query matches part of the name or external ID, ignoring case
+	Query    string
+	Platform string
+	// Tags match problems with every one of the tags
+	Tags []string
+	// RatingMin and RatingMax are inclusive; unrated problems never match
+	RatingMin *int
+	RatingMax *int
+	// OrderBy lists the columns to sort by; ties are broken by ID
+	OrderBy []ProblemOrder
+}
+
+// ProblemOrder sorts problems by a column.
+type ProblemOrder struct {
+	Column string
+	Desc   bool
+}
+
+// Search finds problems matching a filter with pagination.
+func (r *ProblemRepository) Search(filter ProblemFilter, page, pageSize int) ([]model.Problem, int64, error) {
+	var problems []model.Problem
+	var total int64
+
+	query := r.db.Model(&model.Problem{})
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(strings.ToLower(filter.Query)) + "%"
+		query = query.Where(`(LOWER(name) LIKE ? ESCAPE '\' OR LOWER(external_id) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	if filter.Platform != "" {
+		query = query.Where("platform = ?", filter.Platform)
+	}
+	// Tags are stored as a JSON array of strings without characters that
+	// JSON escapes, so each tag appears quoted in the column as is
+	for _, tag := range filter.Tags {
+		query = query.Where(`tags LIKE ? ESCAPE '\'`, `%"`+escapeLike(tag)+`"%`)
+	}
+	if filter.RatingMin != nil {
+		query = query.Where("rating >= ?", *filter.RatingMin)
+	}
+	if filter.RatingMax != nil {
+		query = query.Where("rating <= ?", *filter.RatingMax)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	for _, order := range filter.OrderBy {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: order.Column}, Desc: order.Desc})
+	}
+	offset := (page - 1) * pageSize
+	err := query.Order("id").Offset(offset).Limit(pageSize).Find(&problems).Error
+	return problems, total, err
+}
+
+// HasSubmissions reports whether submissions to a problem have been synced.
+func (r *ProblemRepository) HasSubmissions(id uint) (bool, error) {
+	var submission model.Submission
+	err := r.db.Select("id").Where("problem_id = ?", id).Take(&submission).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SaveBatch creates or updates several problems in a single transaction,
+// so that either all of them are saved or none is. Problems with an ID are
+// updated, the others created.
+func (r *ProblemRepository) SaveBatch(problems []*model.Problem) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, problem := range problems {
+			if err := tx.Save(problem).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -1,10 +1,25 @@
 package repository
 
+import "time"
+
 type Repository[T any] interface {
 	Create(obj *T) error
 	GetByID(id uint) (*T, error)
 	Update(obj *T) error
+	UpdateFields(obj *T, fields map[string]interface{}) error
 	Delete(id uint) error
 	GetAll() ([]T, error)
 	List(page, pageSize int) ([]T, int64, error)
 }
+
+// SoftDeleteRepository is implemented by the repositories of models with a
+// DeletedAt field, which are kept in the trash until restored or purged.
+type SoftDeleteRepository[T any] interface {
+	Repository[T]
+	ListDeleted(page, pageSize int) ([]T, int64, error)
+	GetDeletedByID(id uint) (*T, error)
+	ListDeletedBefore(cutoff time.Time) ([]T, error)
+	Restore(obj *T) error
+	Purge(obj *T) error
+	PurgeDeletedBefore(cutoff time.Time) (int64, error)
+}
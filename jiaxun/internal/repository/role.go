@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// RoleRepository provides database operations for roles and their permissions.
+type RoleRepository struct {
+	db *gorm.DB
+}
+
+// NewRoleRepository creates a new RoleRepository instance.
+func NewRoleRepository(db *gorm.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+// List retrieves all roles with their permissions.
+func (r *RoleRepository) List() ([]model.Role, error) {
+	var roles []model.Role
+	err := r.db.Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// GetByName retrieves a role with its permissions.
+func (r *RoleRepository) GetByName(name string) (*model.Role, error) {
+	var role model.Role
+	if err := r.db.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetPermissions returns the permissions granted to a role.
+func (r *RoleRepository) GetPermissions(name string) ([]string, error) {
+	var permissions []string
+	err := r.db.Model(&model.RolePermission{}).
+		Where("role_name = ?", name).
+		Order("permission").
+		Pluck("permission", &permissions).Error
+	return permissions, err
+}
+
+// Create stores a new role together with its permissions.
+func (r *RoleRepository) Create(role *model.Role) error {
+	return r.db.Create(role).Error
+}
+
+// Update changes the description of a role and replaces its permissions.
+func (r *RoleRepository) Update(role *model.Role) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Role{}).Where("name = ?", role.Name).
+			Update("description", role.Description).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_name = ?", role.Name).Delete(&model.RolePermission{}).Error; err != nil {
+			return err
+		}
+		if len(role.Permissions) == 0 {
+			return nil
+		}
+		return tx.Create(&role.Permissions).Error
+	})
+}
+
+// Delete removes a role and its permissions.
+func (r *RoleRepository) Delete(name string) error {
+	return r.db.Where("name = ?", name).Delete(&model.Role{}).Error
+}
+
+// CountUsers returns the number of users holding a role.
+func (r *RoleRepository) CountUsers(name string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.User{}).Where("role = ?", name).Count(&count).Error
+	return count, err
+}
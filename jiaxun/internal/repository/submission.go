@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SubmissionRepository provides database operations for the submissions
+// synced from online judges and their problems.
+type SubmissionRepository struct {
+	db *gorm.DB
+}
+
+// NewSubmissionRepository creates a new SubmissionRepository instance.
+func NewSubmissionRepository(db *gorm.DB) *SubmissionRepository {
+	return &SubmissionRepository{db: db}
+}
+
+// SubmissionFilter selects submissions in a search. Zero fields match
+// every submission.
+type SubmissionFilter struct {
+	UserID   uint
+	Platform string
+	Verdict  string
+	// SubmittedAfter is inclusive, SubmittedBefore exclusive
+	SubmittedAfter  *time.Time
+	SubmittedBefore *time.Time
+}
+
+// Search finds submissions matching a filter with pagination, newest
+// first, with their problems.
+func (r *SubmissionRepository) Search(filter SubmissionFilter, page, pageSize int) ([]model.Submission, int64, error) {
+	var submissions []model.Submission
+	var total int64
+
+	query := r.db.Model(&model.Submission{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Platform != "" {
+		query = query.Where("platform = ?", filter.Platform)
+	}
+	if filter.Verdict != "" {
+		query = query.Where("verdict = ?", filter.Verdict)
+	}
+	if filter.SubmittedAfter != nil {
+		query = query.Where("submitted_at >= ?", *filter.SubmittedAfter)
+	}
+	if filter.SubmittedBefore != nil {
+		query = query.Where("submitted_at < ?", *filter.SubmittedBefore)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Preload("Problem").Order("submitted_at DESC").Order("id DESC").
+		Offset(offset).Limit(pageSize).Find(&submissions).Error
+	return submissions, total, err
+}
+
+// StoreSync stores the submissions fetched by a sync of a judge account
+// with their problems, and records where the next sync resumes, in a single
+// transaction. Submissions and problems already stored are updated.
+func (r *SubmissionRepository) StoreSync(account *model.JudgeAccount, submissions []model.Submission, cursor string, at time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		problemIDs := make(map[string]uint)
+		for i := range submissions {
+			problem := submissions[i].Problem
+			id, ok := problemIDs[problem.ExternalID]
+			if !ok {
+				err := tx.Clauses(clause.OnConflict{
+					Columns:   []clause.Column{{Name: "platform"}, {Name: "external_id"}},
+					DoUpdates: clause.AssignmentColumns([]string{"name", "url", "rating", "tags", "updated_at"}),
+				}).Create(problem).Error
+				if err != nil {
+					return err
+				}
+				id = problem.ID
+				problemIDs[problem.ExternalID] = id
+			}
+			submissions[i].ProblemID = id
+			submissions[i].Problem = nil
+		}
+
+		if len(submissions) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "platform"}, {Name: "external_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"problem_id", "verdict", "language"}),
+			}).CreateInBatches(submissions, 100).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(account).Updates(map[string]interface{}{
+			"sync_cursor": cursor,
+			"synced_at":   at,
+			"sync_error":  "",
+		}).Error
+	})
+}
+
+// RecordSyncError records why a sync of a judge account failed.
+func (r *SubmissionRepository) RecordSyncError(account *model.JudgeAccount, message string, at time.Time) error {
+	return r.db.Model(account).Updates(map[string]interface{}{
+		"synced_at":  at,
+		"sync_error": message,
+	}).Error
+}
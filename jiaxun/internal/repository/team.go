@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TeamRepository provides team-specific database operations.
+type TeamRepository struct {
+	*BaseRepository[model.Team]
+	db *gorm.DB
+}
+
+// NewTeamRepository creates a new TeamRepository instance.
+func NewTeamRepository(db *gorm.DB) *TeamRepository {
+	return &TeamRepository{
+		BaseRepository: NewBaseRepository[model.Team](db),
+		db:             db,
+	}
+}
+
+// --- Team-specific methods ---
+
+// GetMemberships retrieves all memberships of a team, except those of
+// users in the trash.
+func (r *TeamRepository) GetMemberships(teamID uint) ([]model.TeamMembership, error) {
+	var memberships []model.TeamMembership
+	err := r.db.Scopes(withoutTrashedMembers(r.db)).Where("team_id = ?", teamID).Find(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// GetMembership retrieves the membership of a user in a team.
+func (r *TeamRepository) GetMembership(teamID, userID uint) (*model.TeamMembership, error) {
+	var membership model.TeamMembership
+	err := r.db.Where("team_id = ? AND user_id = ?", teamID, userID).First(&membership).Error
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// GetCaptain retrieves the membership of the captain of a team, even if
+// the captain is in the trash.
+func (r *TeamRepository) GetCaptain(teamID uint) (*model.TeamMembership, error) {
+	var membership model.TeamMembership
+	err := r.db.Where("team_id = ? AND role = ?", teamID, model.TeamRoleCaptain).First(&membership).Error
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// ListByUser retrieves all teams a user is a member of.
+func (r *TeamRepository) ListByUser(userID uint) ([]model.Team, error) {
+	var teams []model.Team
+	err := r.db.Joins("JOIN team_membership ON team_membership.team_id = team.team_id").
+		Where("team_membership.user_id = ?", userID).
+		Find(&teams).Error
+	if err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+// CountMembers returns the number of members of a team, including users in
+// the trash, who would take their place back if restored.
+func (r *TeamRepository) CountMembers(teamID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.TeamMembership{}).Where("team_id = ?", teamID).Count(&count).Error
+	return count, err
+}
+
+// CreateWithCaptain creates a team and makes the given user its captain.
+func (r *TeamRepository) CreateWithCaptain(team *model.Team, captainID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(team).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.TeamMembership{
+			UserID:   captainID,
+			TeamID:   team.TeamID,
+			Role:     model.TeamRoleCaptain,
+			JoinedAt: team.CreatedAt,
+		}).Error
+	})
+}
+
+// AddMember adds a membership to a team.
+func (r *TeamRepository) AddMember(membership *model.TeamMembership) error {
+	return r.db.Create(membership).Error
+}
+
+// RemoveMember removes a user from a team.
+func (r *TeamRepository) RemoveMember(teamID, userID uint) error {
+	return r.db.Where("team_id = ? AND user_id = ?", teamID, userID).Delete(&model.TeamMembership{}).Error
+}
+
+// TransferCaptain demotes the current captain and promotes another member
+// in a single transaction.
+func (r *TeamRepository) TransferCaptain(teamID, fromUserID, toUserID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.TeamMembership{}).
+			Where("team_id = ? AND user_id = ?", teamID, fromUserID).
+			Update("role", model.TeamRoleMember).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&model.TeamMembership{}).
+			Where("team_id = ? AND user_id = ?", teamID, toUserID).
+			Update("role", model.TeamRoleCaptain).Error
+	})
+}
+
+// CreateRequest stores a new invitation or join request.
+func (r *TeamRepository) CreateRequest(request *model.TeamRequest) error {
+	return r.db.Create(request).Error
+}
+
+// GetRequestByID retrieves a team request by its ID.
+func (r *TeamRepository) GetRequestByID(requestID uint) (*model.TeamRequest, error) {
+	var request model.TeamRequest
+	err := r.db.First(&request, requestID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// HasPendingRequest reports whether a pending request exists between a team and a user.
+func (r *TeamRepository) HasPendingRequest(teamID, userID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.TeamRequest{}).
+		Where("team_id = ? AND user_id = ? AND status = ?", teamID, userID, model.TeamRequestPending).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListPendingRequestsByTeam retrieves the pending invitations and join requests of a team.
+func (r *TeamRepository) ListPendingRequestsByTeam(teamID uint) ([]model.TeamRequest, error) {
+	var requests []model.TeamRequest
+	err := r.db.Where("team_id = ? AND status = ?", teamID, model.TeamRequestPending).Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// ListPendingRequestsByUser retrieves the pending requests of a given kind concerning a user.
+func (r *TeamRepository) ListPendingRequestsByUser(userID uint, kind string) ([]model.TeamRequest, error) {
+	var requests []model.TeamRequest
+	err := r.db.Where("user_id = ? AND kind = ? AND status = ?", userID, kind, model.TeamRequestPending).Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// ErrTeamFull is returned by CloseRequest when accepting a request would
+// take the team past its maximum size.
+var ErrTeamFull = errors.New("team is full")
+
+// CloseRequest records the response to a request. When accepted, the user
+// joins the team as a member in the same transaction, provided the team has
+// fewer than maxSize members once the team row is locked, so that requests
+// accepted concurrently cannot overfill it.
+func (r *TeamRepository) CloseRequest(request *model.TeamRequest, accepted bool, maxSize int) error {
+	now := time.Now()
+	status := model.TeamRequestDeclined
+	if accepted {
+		status = model.TeamRequestAccepted
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Writing first takes the database lock on SQLite, which has no row locks
+		err := tx.Model(request).Updates(map[string]interface{}{
+			"status":       status,
+			"responded_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return nil
+		}
+
+		var team model.Team
+		err = tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("team_id").First(&team, request.TeamID).Error
+		if err != nil {
+			return err
+		}
+		var count int64
+		err = tx.Model(&model.TeamMembership{}).Where("team_id = ?", request.TeamID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count >= int64(maxSize) {
+			return ErrTeamFull
+		}
+
+		return tx.Create(&model.TeamMembership{
+			UserID:   request.UserID,
+			TeamID:   request.TeamID,
+			Role:     model.TeamRoleMember,
+			JoinedAt: now,
+		}).Error
+	})
+}
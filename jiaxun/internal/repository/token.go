@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TokenRepository provides database operations for sessions, refresh
+// tokens, revoked access tokens and password reset tokens.
+type TokenRepository struct {
+	db *gorm.DB
+}
+
+// NewTokenRepository creates a new TokenRepository instance.
+func NewTokenRepository(db *gorm.DB) *TokenRepository {
+	return &TokenRepository{db: db}
+}
+
+// CreateSession stores a new session.
+func (r *TokenRepository) CreateSession(session *model.Session) error {
+	return r.db.Create(session).Error
+}
+
+// TouchSession records that a session was refreshed by a client and now
+// lasts until expiresAt.
+func (r *TokenRepository) TouchSession(id string, at, expiresAt time.Time, ip, userAgent string) error {
+	return r.db.Model(&model.Session{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"last_seen_at": at,
+			"expires_at":   expiresAt,
+			"ip":           ip,
+			"user_agent":   userAgent,
+		}).Error
+}
+
+// ListActiveSessions retrieves the sessions of a user that are neither
+// revoked nor expired at now, most recently used first.
+func (r *TokenRepository) ListActiveSessions(userID uint, now time.Time) ([]model.Session, error) {
+	var sessions []model.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSession revokes an active session of a user together with its
+// token family. It returns gorm.ErrRecordNotFound if the user has no such
+// active session.
+func (r *TokenRepository) RevokeSession(userID uint, id string, at time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", id, userID, at).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return revokeFamily(tx, id, at)
+	})
+}
+
+// CreateRefreshToken stores a new refresh token.
+func (r *TokenRepository) CreateRefreshToken(token *model.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by the hash of its value.
+func (r *TokenRepository) GetRefreshTokenByHash(hash string) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	if err := r.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed marks a refresh token as consumed. It reports false if
+// the token had already been used, which makes concurrent refreshes with the
+// same token count as reuse.
+func (r *TokenRepository) MarkRefreshTokenUsed(id uint, at time.Time) (bool, error) {
+	result := r.db.Model(&model.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RevokeFamily revokes every refresh token of a family together with the
+// access tokens issued alongside them that have not expired yet.
+func (r *TokenRepository) RevokeFamily(familyID string, at time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return revokeFamily(tx, familyID, at)
+	})
+}
+
+// RevokeUserFamilies revokes every token family of a user, ending all of
+// their sessions.
+func (r *TokenRepository) RevokeUserFamilies(userID uint, at time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var familyIDs []string
+		if err := tx.Model(&model.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Distinct().Pluck("family_id", &familyIDs).Error; err != nil {
+			return err
+		}
+		for _, familyID := range familyIDs {
+			if err := revokeFamily(tx, familyID, at); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func revokeFamily(tx *gorm.DB, familyID string, at time.Time) error {
+	if err := tx.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).Error; err != nil {
+		return err
+	}
+
+	var tokens []model.RefreshToken
+	if err := tx.Where("family_id = ? AND access_expires_at > ?", familyID, at).
+		Find(&tokens).Error; err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := revokeAccessToken(tx, token.AccessJTI, token.AccessExpiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken adds an access token to the revocation list.
+func (r *TokenRepository) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	return revokeAccessToken(r.db, jti, expiresAt)
+}
+
+func revokeAccessToken(db *gorm.DB, jti string, expiresAt time.Time) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+// IsAccessTokenRevoked checks whether an access token is on the revocation list.
+func (r *TokenRepository) IsAccessTokenRevoked(jti string) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// CreatePasswordResetToken stores a new password reset token, invalidating
+// any reset token the user has not used yet.
+func (r *TokenRepository) CreatePasswordResetToken(token *model.PasswordResetToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", token.CreatedAt).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// GetPasswordResetTokenByHash retrieves a password reset token by the hash of its value.
+func (r *TokenRepository) GetPasswordResetTokenByHash(hash string) (*model.PasswordResetToken, error) {
+	var token model.PasswordResetToken
+	if err := r.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkPasswordResetTokenUsed consumes a password reset token. It reports
+// false if the token had already been used.
+func (r *TokenRepository) MarkPasswordResetTokenUsed(id uint, at time.Time) (bool, error) {
+	result := r.db.Model(&model.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteExpired removes sessions, refresh tokens, revocation entries and
+// password reset tokens that expired before the given time.
+func (r *TokenRepository) DeleteExpired(before time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", before).Delete(&model.Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("expires_at < ?", before).Delete(&model.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("expires_at < ?", before).Delete(&model.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("expires_at < ?", before).Delete(&model.RevokedToken{}).Error
+	})
+}
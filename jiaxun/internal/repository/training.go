@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// TrainingPlanRepository provides training-plan-specific database operations.
+type TrainingPlanRepository struct {
+	*BaseRepository[model.TrainingPlan]
+	db *gorm.DB
+}
+
+// NewTrainingPlanRepository creates a new TrainingPlanRepository instance.
+func NewTrainingPlanRepository(db *gorm.DB) *TrainingPlanRepository {
+	return &TrainingPlanRepository{
+		BaseRepository: NewBaseRepository[model.TrainingPlan](db),
+		db:             db,
+	}
+}
+
+// --- Training-plan-specific methods ---
+
+// GetParticipations retrieves all participations of a training plan, except
+// those of users and teams in the trash.
+func (r *TrainingPlanRepository) GetParticipations(planID uint) ([]model.TrainingParticipation, error) {
+	var participations []model.TrainingParticipation
+	err := r.db.Scopes(withoutTrashedMembers(r.db)).Where("training_plan_id = ?", planID).Find(&participations).Error
+	if err != nil {
+		return nil, err
+	}
+	return participations, nil
+}
+
+// GetParticipation retrieves a participation of a training plan by its ID.
+func (r *TrainingPlanRepository) GetParticipation(planID, participationID uint) (*model.TrainingParticipation, error) {
+	var participation model.TrainingParticipation
+	err := r.db.Where("training_plan_id = ?", planID).First(&participation, participationID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &participation, nil
+}
+
+// CreateParticipation stores a new participation.
+func (r *TrainingPlanRepository) CreateParticipation(participation *model.TrainingParticipation) error {
+	return r.db.Create(participation).Error
+}
+
+// DeleteParticipation removes a participation by its ID.
+func (r *TrainingPlanRepository) DeleteParticipation(participationID uint) error {
+	return r.db.Delete(&model.TrainingParticipation{}, participationID).Error
+}
+
+// IsUserEnrolled reports whether a user is enrolled in a plan individually.
+func (r *TrainingPlanRepository) IsUserEnrolled(planID, userID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.TrainingParticipation{}).
+		Where("training_plan_id = ? AND user_id = ?", planID, userID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// IsTeamEnrolled reports whether a team is enrolled in a plan.
+func (r *TrainingPlanRepository) IsTeamEnrolled(planID, teamID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.TrainingParticipation{}).
+		Where("training_plan_id = ? AND team_id = ?", planID, teamID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListActiveByUser retrieves the plans running at the given time in which
+// a user participates, either individually or through one of their teams.
+func (r *TrainingPlanRepository) ListActiveByUser(userID uint, at time.Time) ([]model.TrainingPlan, error) {
+	var plans []model.TrainingPlan
+	teamIDs := r.db.Model(&model.TeamMembership{}).Select("team_id").Where("user_id = ?", userID)
+	planIDs := r.db.Model(&model.TrainingParticipation{}).
+		Select("training_plan_id").
+		Where("user_id = ? OR team_id IN (?)", userID, teamIDs)
+	err := r.db.Where("training_plan_id IN (?)", planIDs).
+		Where("start_date <= ? AND end_date >= ?", at, at).
+		Order("start_date").
+		Find(&plans).Error
+	if err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
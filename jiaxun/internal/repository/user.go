@@ -1,9 +1,15 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"jiaxun/internal/model"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // UserRepository provides user-specific database operations.
@@ -22,6 +28,14 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 
 // --- User-specific methods ---
 
+// CountByRole returns the number of users holding a role, leaving out the
+// users in the trash.
+func (r *UserRepository) CountByRole(role string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.User{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
 // GetByUsername retrieves a user by their username.
 func (r *UserRepository) GetByUsername(username string) (*model.User, error) {
 	var user model.User
@@ -42,40 +56,144 @@ func (r *UserRepository) GetByEmail(email string) (*model.User, error) {
 	return &user, nil
 }
 
-// SearchByEmail finds users whose email contains the search string.
-func (r *UserRepository) SearchByEmail(search string, page, pageSize int) ([]*model.User, int64, error) {
-	var users []*model.User
+// UserFilter selects users in a search. Zero fields match every user.
+type UserFilter struct {
+	// Query matches part of the username, email or full name, ignoring case
+	Query  string
+	Roles  []string
+	Status string
+	TeamID uint
+	// ContestID and TrainingPlanID match users enrolled themselves or
+	// through one of their teams
+	ContestID      uint
+	TrainingPlanID uint
+	// Handle matches part of the handle of a linked judge account, ignoring
+	// case; Platform restricts the match to accounts on one platform
+	Handle   string
+	Platform string
+	// CreatedAfter is inclusive, CreatedBefore exclusive
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// OrderBy lists the columns to sort by; ties are broken by ID
+	OrderBy []UserOrder
+}
+
+// UserOrder sorts users by a column.
+type UserOrder struct {
+	Column string
+	Desc   bool
+}
+
+// Search finds users matching a filter with pagination.
+func (r *UserRepository) Search(filter UserFilter, page, pageSize int) ([]model.User, int64, error) {
+	var users []model.User
 	var total int64
 
-	query := r.db.Model(&model.User{}).Where("email LIKE ?", "%"+search+"%")
+	query := r.db.Model(&model.User{})
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(strings.ToLower(filter.Query)) + "%"
+		query = query.Where(`(LOWER(username) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\' OR LOWER(full_name) LIKE ? ESCAPE '\')`,
+			pattern, pattern, pattern)
+	}
+	if len(filter.Roles) > 0 {
+		query = query.Where("role IN ?", filter.Roles)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.TeamID != 0 {
+		query = query.Where("id IN (?)", r.db.Model(&model.TeamMembership{}).Select("user_id").
+			Where("team_id = ?", filter.TeamID))
+	}
+	if filter.ContestID != 0 {
+		query = query.Where("(id IN (?) OR id IN (?))",
+			r.db.Model(&model.ContestRegistration{}).Select("user_id").
+				Where("contest_id = ? AND user_id IS NOT NULL", filter.ContestID),
+			r.db.Model(&model.TeamMembership{}).Select("user_id").
+				Where("team_id IN (?)", r.db.Model(&model.ContestRegistration{}).Select("team_id").
+					Where("contest_id = ? AND team_id IS NOT NULL", filter.ContestID)))
+	}
+	if filter.TrainingPlanID != 0 {
+		query = query.Where("(id IN (?) OR id IN (?))",
+			r.db.Model(&model.TrainingParticipation{}).Select("user_id").
+				Where("training_plan_id = ? AND user_id IS NOT NULL", filter.TrainingPlanID),
+			r.db.Model(&model.TeamMembership{}).Select("user_id").
+				Where("team_id IN (?)", r.db.Model(&model.TrainingParticipation{}).Select("team_id").
+					Where("training_plan_id = ? AND team_id IS NOT NULL", filter.TrainingPlanID)))
+	}
+	if filter.Handle != "" || filter.Platform != "" {
+		accounts := r.db.Model(&model.JudgeAccount{}).Select("user_id")
+		if filter.Handle != "" {
+			pattern := "%" + escapeLike(strings.ToLower(filter.Handle)) + "%"
+			accounts = accounts.Where(`LOWER(handle) LIKE ? ESCAPE '\'`, pattern)
+		}
+		if filter.Platform != "" {
+			accounts = accounts.Where("platform = ?", filter.Platform)
+		}
+		query = query.Where("id IN (?)", accounts)
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
 
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
-	offset := (page - 1) * pageSize
-	if err := query.Limit(pageSize).Offset(offset).Find(&users).Error; err != nil {
-		return nil, 0, err
+	for _, order := range filter.OrderBy {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: order.Column}, Desc: order.Desc})
 	}
+	offset := (page - 1) * pageSize
+	err := query.Order("id").Offset(offset).Limit(pageSize).Find(&users).Error
+	return users, total, err
+}
 
-	return users, total, nil
+// escapeLike escapes the wildcards of a LIKE pattern, using backslash as
+// the escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
 }
 
-// SearchByFullName finds users whose full_name contains the search string.
-func (r *UserRepository) SearchByFullName(search string, page, pageSize int) ([]*model.User, int64, error) {
-	var users []*model.User
-	var total int64
+// BatchConflictError reports the user of a batch whose username or email was
+// taken by another user, in the meantime or earlier in the batch. It matches
+// gorm.ErrDuplicatedKey.
+type BatchConflictError struct {
+	// Index is the position of the user in the batch.
+	Index int
+}
 
-	query := r.db.Model(&model.User{}).Where("full_name LIKE ?", "%"+search+"%")
+func (e *BatchConflictError) Error() string {
+	return fmt.Sprintf("user %d of the batch: %s", e.Index, gorm.ErrDuplicatedKey)
+}
 
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, err
-	}
+// Unwrap makes errors.Is(err, gorm.ErrDuplicatedKey) hold.
+func (e *BatchConflictError) Unwrap() error {
+	return gorm.ErrDuplicatedKey
+}
 
-	offset := (page - 1) * pageSize
-	if err := query.Limit(pageSize).Offset(offset).Find(&users).Error; err != nil {
-		return nil, 0, err
-	}
+// CreateBatch stores several users in a single transaction, so that either
+// all of them are created or none is. A user conflicting with an existing
+// one fails the batch with a *BatchConflictError.
+func (r *UserRepository) CreateBatch(users []*model.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for i, user := range users {
+			if err := tx.Create(user).Error; err != nil {
+				if errors.Is(err, gorm.ErrDuplicatedKey) {
+					return &BatchConflictError{Index: i}
+				}
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-	return users, total, nil
+// ListAll retrieves every user ordered by ID.
+func (r *UserRepository) ListAll() ([]model.User, error) {
+	var users []model.User
+	err := r.db.Order("id").Find(&users).Error
+	return users, err
 }
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// searchUsers returns the usernames of the users matching a filter
+func searchUsers(t *testing.T, repo *UserRepository, filter UserFilter) []string {
+	t.Helper()
+	users, total, err := repo.Search(filter, 1, 100)
+	if err != nil {
+		t.Fatalf("Search(%+v): %v", filter, err)
+	}
+	if int(total) != len(users) {
+		t.Errorf("Search(%+v) counted %d users, returned %d", filter, total, len(users))
+	}
+	names := []string{}
+	for _, user := range users {
+		names = append(names, user.Username)
+	}
+	return names
+}
+
+// newUsers stores users by username, with an email and full name derived
+// from it unless given
+func newUsers(t *testing.T, db *gorm.DB, users ...*model.User) map[string]*model.User {
+	t.Helper()
+	byName := map[string]*model.User{}
+	for _, user := range users {
+		if user.Email == "" {
+			user.Email = user.Username + "@example.org"
+		}
+		user.Password = "hash"
+		create(t, db, user)
+		byName[user.Username] = user
+	}
+	return byName
+}
+
+func TestSearchUsersEscapesWildcards(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewUserRepository(db)
+	newUsers(t, db,
+		&model.User{Username: "ada_lovelace", FullName: "Ada Lovelace"},
+		&model.User{Username: "adaxlovelace", FullName: "Not Ada"},
+		&model.User{Username: "grace", FullName: "Grace 100% Hopper"},
+		&model.User{Username: "hedy", FullName: `Hedy \ Lamarr`},
+	)
+	create(t, db,
+		&model.JudgeAccount{UserID: 1, Platform: model.JudgePlatformCodeforces, Handle: "tourist_"},
+		&model.JudgeAccount{UserID: 2, Platform: model.JudgePlatformCodeforces, Handle: "touristx"},
+		&model.JudgeAccount{UserID: 3, Platform: model.JudgePlatformAtCoder, Handle: "Tourist_2"},
+	)
+
+	tests := []struct {
+		name   string
+		filter UserFilter
+		want   []string
+	}{
+		{"underscore", UserFilter{Query: "a_l"}, []string{"ada_lovelace"}},
+		{"percent", UserFilter{Query: "100%"}, []string{"grace"}},
+		{"lone percent", UserFilter{Query: "%"}, []string{"grace"}},
+		{"backslash", UserFilter{Query: `\`}, []string{"hedy"}},
+		{"case", UserFilter{Query: "LOVELACE"}, []string{"ada_lovelace", "adaxlovelace"}},
+		{"email", UserFilter{Query: "grace@"}, []string{"grace"}},
+		{"handle underscore", UserFilter{Handle: "t_"}, []string{"ada_lovelace", "grace"}},
+		{"handle on a platform", UserFilter{Handle: "TOURIST_", Platform: model.JudgePlatformCodeforces}, []string{"ada_lovelace"}},
+		{"platform", UserFilter{Platform: model.JudgePlatformAtCoder}, []string{"grace"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := searchUsers(t, repo, tc.filter); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Search(%+v) = %q, want %q", tc.filter, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearchUsersByEnrollment(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewUserRepository(db)
+	users := newUsers(t, db,
+		&model.User{Username: "ada"},
+		&model.User{Username: "grace"},
+		&model.User{Username: "hedy"},
+		&model.User{Username: "katherine"},
+	)
+	id := func(name string) *uint { return &users[name].ID }
+
+	engines := &model.Team{TeamName: "Analytical Engines"}
+	create(t, db, engines)
+	for _, name := range []string{"grace", "hedy"} {
+		create(t, db, &model.TeamMembership{UserID: users[name].ID, TeamID: engines.TeamID, Role: model.TeamRoleMember, JoinedAt: time.Now()})
+	}
+
+	start := time.Now()
+	contest := &model.Contest{Name: "Round 1", StartTime: start, EndTime: start.Add(time.Hour), IsTeamBased: true}
+	other := &model.Contest{Name: "Round 2", StartTime: start, EndTime: start.Add(time.Hour)}
+	plan := &model.TrainingPlan{Title: "Graphs", StartDate: start, EndDate: start.Add(time.Hour)}
+	create(t, db, contest, other, plan)
+	create(t, db,
+		&model.ContestRegistration{ContestID: contest.ContestID, TeamID: &engines.TeamID, RegisteredAt: start},
+		&model.ContestRegistration{ContestID: other.ContestID, UserID: id("katherine"), IsUserRegistration: true, RegisteredAt: start},
+		&model.TrainingParticipation{TrainingPlanID: plan.TrainingPlanID, UserID: id("ada"), JoinedAt: start},
+		&model.TrainingParticipation{TrainingPlanID: plan.TrainingPlanID, TeamID: &engines.TeamID, JoinedAt: start},
+	)
+
+	tests := []struct {
+		name   string
+		filter UserFilter
+		want   []string
+	}{
+		{"team", UserFilter{TeamID: engines.TeamID}, []string{"grace", "hedy"}},
+		{"contest through a team", UserFilter{ContestID: contest.ContestID}, []string{"grace", "hedy"}},
+		{"contest in person", UserFilter{ContestID: other.ContestID}, []string{"katherine"}},
+		{"training in person and through a team", UserFilter{TrainingPlanID: plan.TrainingPlanID}, []string{"ada", "grace", "hedy"}},
+		{"contest and training", UserFilter{ContestID: contest.ContestID, TrainingPlanID: plan.TrainingPlanID, Query: "h"}, []string{"hedy"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := searchUsers(t, repo, tc.filter); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Search(%+v) = %q, want %q", tc.filter, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearchUsersOrder(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewUserRepository(db)
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	newUsers(t, db,
+		&model.User{Username: "ada", Role: model.RoleTeacher, CreatedAt: created.Add(2 * time.Hour)},
+		&model.User{Username: "grace", Role: model.RoleStudent, CreatedAt: created},
+		&model.User{Username: "hedy", Role: model.RoleStudent, CreatedAt: created.Add(time.Hour)},
+	)
+	after := created.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		filter UserFilter
+		want   []string
+	}{
+		{"by ID", UserFilter{}, []string{"ada", "grace", "hedy"}},
+		{"descending", UserFilter{OrderBy: []UserOrder{{Column: "username", Desc: true}}}, []string{"hedy", "grace", "ada"}},
+		{"ties broken by the next column", UserFilter{OrderBy: []UserOrder{{Column: "role"}, {Column: "created_at", Desc: true}}}, []string{"hedy", "grace", "ada"}},
+		{"created range", UserFilter{CreatedAfter: &after, OrderBy: []UserOrder{{Column: "created_at"}}}, []string{"hedy", "ada"}},
+		{"created before", UserFilter{CreatedBefore: &after}, []string{"grace"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := searchUsers(t, repo, tc.filter); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Search(%+v) = %q, want %q", tc.filter, got, tc.want)
+			}
+		})
+	}
+}
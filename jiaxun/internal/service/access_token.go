@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// AccessTokenService errors
+var (
+	ErrAccessTokenNotFound   = errors.New("access token not found")
+	ErrInvalidAccessTokenTTL = errors.New("invalid access token lifetime")
+	ErrScopeNotGranted       = errors.New("scope is not granted to the user")
+)
+
+// lastUsedResolution is how stale the last-used time of a token may get
+// before it is written again, so that busy scripts do not write on every request
+const lastUsedResolution = time.Minute
+
+// accessTokenPrefixLength is how much of a token is kept to identify it
+const accessTokenPrefixLength = 12
+
+// AccessTokenService manages personal access tokens: long-lived tokens that
+// let scripts act on behalf of a user without their password
+type AccessTokenService struct {
+	repo        *repository.AccessTokenRepository
+	rbacService *RBACService
+	maxTTL      time.Duration
+}
+
+// NewAccessTokenService creates a new access token service instance
+func NewAccessTokenService(repo *repository.AccessTokenRepository, rbacService *RBACService, maxTTL time.Duration) *AccessTokenService {
+	return &AccessTokenService{
+		repo:        repo,
+		rbacService: rbacService,
+		maxTTL:      maxTTL,
+	}
+}
+
+// Create issues a token for the user holding role. The scopes must be
+// permissions the role grants. The token value is returned only here.
+func (s *AccessTokenService) Create(userID uint, role, name string, scopes []string, ttl time.Duration) (*model.PersonalAccessToken, string, error) {
+	if ttl <= 0 || ttl > s.maxTTL {
+		return nil, "", ErrInvalidAccessTokenTTL
+	}
+
+	scopes = dedupe(scopes)
+	if err := validatePermissions(scopes); err != nil {
+		return nil, "", err
+	}
+	granted, err := s.rbacService.PermissionsOf(role)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, scope := range scopes {
+		if !model.HasPermission(granted, scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrScopeNotGranted, scope)
+		}
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	value := middleware.PersonalAccessTokenPrefix + secret
+
+	now := time.Now()
+	token := &model.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    value[:accessTokenPrefixLength],
+		TokenHash: hashToken(value),
+		Scopes:    scopes,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := s.repo.Create(token); err != nil {
+		return nil, "", err
+	}
+	return token, value, nil
+}
+
+// List returns the tokens of a user, including expired and revoked ones
+func (s *AccessTokenService) List(userID uint) ([]model.PersonalAccessToken, error) {
+	return s.repo.ListByUser(userID)
+}
+
+// Revoke revokes one of the user's tokens
+func (s *AccessTokenService) Revoke(userID, id uint) error {
+	if err := s.repo.Revoke(userID, id, time.Now()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAccessTokenNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// AuthenticateAccessToken resolves a token value to its owner and scopes
+// and records its use. It implements middleware.AccessTokenAuthenticator.
+func (s *AccessTokenService) AuthenticateAccessToken(value string) (uint, []string, error) {
+	token, err := s.repo.GetByHash(hashToken(value))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil, middleware.ErrInvalidAccessToken
+		}
+		return 0, nil, err
+	}
+
+	now := time.Now()
+	if token.RevokedAt != nil || now.After(token.ExpiresAt) {
+		return 0, nil, middleware.ErrInvalidAccessToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedResolution {
+		if err := s.repo.TouchLastUsed(token.ID, now); err != nil {
+			return 0, nil, err
+		}
+	}
+	return token.UserID, token.Scopes, nil
+}
+
+// dedupe removes repeated entries while keeping their order
+func dedupe(values []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// newTestAccessTokenService returns an access token service backed by the
+// database, allowing tokens to live up to a year, and the owner of tokens
+func newTestAccessTokenService(t *testing.T, db *gorm.DB) (*AccessTokenService, *model.User) {
+	t.Helper()
+	userService := newTestUserService(db)
+	rbacService := NewRBACService(repository.NewRoleRepository(db), userService)
+	user := &model.User{Username: "ada", Email: "ada@example.org", Password: "password", Role: model.RoleTeacher}
+	if err := userService.Create(user); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return NewAccessTokenService(repository.NewAccessTokenRepository(db), rbacService, 365*24*time.Hour), user
+}
+
+func TestAccessTokenLookup(t *testing.T) {
+	db := openTestDB(t)
+	service, user := newTestAccessTokenService(t, db)
+
+	token, value, err := service.Create(user.ID, user.Role, "backup", []string{model.PermUsersRead}, time.Hour)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !strings.HasPrefix(value, middleware.PersonalAccessTokenPrefix) {
+		t.Errorf("token %q does not start with %q", value, middleware.PersonalAccessTokenPrefix)
+	}
+	if token.Prefix != value[:accessTokenPrefixLength] {
+		t.Errorf("prefix = %q, want the start of the token %q", token.Prefix, value)
+	}
+	var stored model.PersonalAccessToken
+	if err := db.First(&stored, token.ID).Error; err != nil {
+		t.Fatalf("reading token: %v", err)
+	}
+	if stored.TokenHash != hashToken(value) || strings.Contains(stored.TokenHash, value[len(middleware.PersonalAccessTokenPrefix):]) {
+		t.Errorf("stored hash = %q, want the hash of the token only", stored.TokenHash)
+	}
+
+	userID, scopes, err := service.AuthenticateAccessToken(value)
+	if err != nil {
+		t.Fatalf("AuthenticateAccessToken: %v", err)
+	}
+	if userID != user.ID || !reflect.DeepEqual(scopes, []string{model.PermUsersRead}) {
+		t.Errorf("AuthenticateAccessToken = %d %q, want %d %q", userID, scopes, user.ID, model.PermUsersRead)
+	}
+
+	// Tokens are found by their hash; sharing the displayed prefix is not enough
+	for _, guess := range []string{token.Prefix, value[:len(value)-1] + "x", value + "x"} {
+		if _, _, err := service.AuthenticateAccessToken(guess); !errors.Is(err, middleware.ErrInvalidAccessToken) {
+			t.Errorf("AuthenticateAccessToken(%q) = %v, want ErrInvalidAccessToken", guess, err)
+		}
+	}
+}
+
+func TestAccessTokenExpiryAndRevocation(t *testing.T) {
+	db := openTestDB(t)
+	service, user := newTestAccessTokenService(t, db)
+
+	expiring, expiringValue, err := service.Create(user.ID, user.Role, "expiring", nil, time.Hour)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := db.Model(expiring).Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("expiring token: %v", err)
+	}
+	if _, _, err := service.AuthenticateAccessToken(expiringValue); !errors.Is(err, middleware.ErrInvalidAccessToken) {
+		t.Errorf("expired token = %v, want ErrInvalidAccessToken", err)
+	}
+
+	revoked, revokedValue, err := service.Create(user.ID, user.Role, "revoked", nil, time.Hour)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := service.Revoke(user.ID+1, revoked.ID); !errors.Is(err, ErrAccessTokenNotFound) {
+		t.Errorf("revoking another user's token = %v, want ErrAccessTokenNotFound", err)
+	}
+	if _, _, err := service.AuthenticateAccessToken(revokedValue); err != nil {
+		t.Errorf("token revoked by another user stopped working: %v", err)
+	}
+	if err := service.Revoke(user.ID, revoked.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, _, err := service.AuthenticateAccessToken(revokedValue); !errors.Is(err, middleware.ErrInvalidAccessToken) {
+		t.Errorf("revoked token = %v, want ErrInvalidAccessToken", err)
+	}
+	if err := service.Revoke(user.ID, revoked.ID); !errors.Is(err, ErrAccessTokenNotFound) {
+		t.Errorf("revoking twice = %v, want ErrAccessTokenNotFound", err)
+	}
+}
+
+func TestCreateAccessTokenScopes(t *testing.T) {
+	db := openTestDB(t)
+	service, user := newTestAccessTokenService(t, db)
+
+	tests := []struct {
+		name   string
+		scopes []string
+		ttl    time.Duration
+		want   error
+	}{
+		{"scopes of the role", []string{model.PermUsersRead, model.PermContestsManage, model.PermUsersRead}, time.Hour, nil},
+		{"no scopes", nil, time.Hour, nil},
+		{"scope beyond the role", []string{model.PermUsersRead, model.PermRolesManage}, time.Hour, ErrScopeNotGranted},
+		{"wildcard scope", []string{model.PermAll}, time.Hour, ErrScopeNotGranted},
+		{"unknown scope", []string{"users:everything"}, time.Hour, ErrUnknownPermission},
+		{"lifetime beyond the maximum", nil, 366 * 24 * time.Hour, ErrInvalidAccessTokenTTL},
+		{"no lifetime", nil, 0, ErrInvalidAccessTokenTTL},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			token, _, err := service.Create(user.ID, user.Role, tc.name, tc.scopes, tc.ttl)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("Create = %v, want %v", err, tc.want)
+			}
+			if err == nil && len(token.Scopes) != len(dedupe(tc.scopes)) {
+				t.Errorf("scopes = %q, want %q once each", token.Scopes, tc.scopes)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// AuthService errors
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+// maxUserAgentLength is how much of a client's user agent is stored
+const maxUserAgentLength = 512
+
+// ClientInfo describes the client a request came from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// normalized returns the client info cut to the lengths that are stored
+func (c ClientInfo) normalized() ClientInfo {
+	if len(c.UserAgent) > maxUserAgentLength {
+		c.UserAgent = strings.ToValidUTF8(c.UserAgent[:maxUserAgentLength], "")
+	}
+	return c
+}
+
+// TokenPair is the set of tokens handed to a client after authentication
+type TokenPair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	SessionID    string    `json:"session_id"`
+}
+
+// AuthService issues, rotates and revokes the tokens of user sessions.
+// Every login starts a new refresh token family; refreshing consumes the
+// presented token and issues the next one in the same family. Presenting a
+// consumed token again revokes the whole family.
+type AuthService struct {
+	repo        *repository.TokenRepository
+	userService *UserService
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+}
+
+// NewAuthService creates a new auth service instance
+func NewAuthService(repo *repository.TokenRepository, userService *UserService, accessTTL, refreshTTL time.Duration) *AuthService {
+	return &AuthService{
+		repo:        repo,
+		userService: userService,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+	}
+}
+
+// IssueTokens starts a new session for an authenticated user on a client.
+// mfa records whether the user also passed a second factor.
+func (s *AuthService) IssueTokens(user *model.User, mfa bool, client ClientInfo) (*TokenPair, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	client = client.normalized()
+	now := time.Now()
+	if err := s.repo.CreateSession(&model.Session{
+		ID:         familyID,
+		UserID:     user.ID,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		MFA:        mfa,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.refreshTTL),
+	}); err != nil {
+		return nil, err
+	}
+	return s.issue(user, familyID, mfa)
+}
+
+// Refresh exchanges a refresh token presented by a client for a new token pair
+func (s *AuthService) Refresh(refreshToken string, client ClientInfo) (*TokenPair, error) {
+	token, err := s.repo.GetRefreshTokenByHash(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.RevokedAt != nil || now.After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	fresh, err := s.repo.MarkRefreshTokenUsed(token.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		// The token was rotated before, so either the client or an
+		// attacker holds a stolen copy: end the session for both
+		if err := s.repo.RevokeFamily(token.FamilyID, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	// Reload the user so role changes take effect on refresh
+	user, err := s.userService.GetByID(token.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	tokens, err := s.issue(user, token.FamilyID, token.MFA)
+	if err != nil {
+		return nil, err
+	}
+	client = client.normalized()
+	if err := s.repo.TouchSession(token.FamilyID, now, now.Add(s.refreshTTL), client.IP, client.UserAgent); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Logout revokes the session an access token belongs to, including the
+// access token itself
+func (s *AuthService) Logout(claims *middleware.JWTClaims) error {
+	now := time.Now()
+	if claims.SessionID != "" {
+		if err := s.repo.RevokeFamily(claims.SessionID, now); err != nil {
+			return err
+		}
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	return s.repo.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time)
+}
+
+// ListSessions returns the active sessions of a user. The session with
+// currentID, if any, is marked as current.
+func (s *AuthService) ListSessions(userID uint, currentID string) ([]model.Session, error) {
+	sessions, err := s.repo.ListActiveSessions(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one active session of a user
+func (s *AuthService) RevokeSession(userID uint, sessionID string) error {
+	if err := s.repo.RevokeSession(userID, sessionID, time.Now()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// RevokeAllSessions ends every session of a user
+func (s *AuthService) RevokeAllSessions(userID uint) error {
+	return s.repo.RevokeUserFamilies(userID, time.Now())
+}
+
+// IsRevoked reports whether an access token has been revoked
+func (s *AuthService) IsRevoked(jti string) (bool, error) {
+	return s.repo.IsAccessTokenRevoked(jti)
+}
+
+// PurgeExpired removes tokens that can no longer be used
+func (s *AuthService) PurgeExpired() error {
+	return s.repo.DeleteExpired(time.Now())
+}
+
+// issue creates an access token and a refresh token within a family
+func (s *AuthService) issue(user *model.User, familyID string, mfa bool) (*TokenPair, error) {
+	claims := &middleware.JWTClaims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: familyID,
+		MFA:       mfa,
+	}
+	accessToken, err := middleware.GenerateToken(claims, s.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.repo.CreateRefreshToken(&model.RefreshToken{
+		UserID:          user.ID,
+		FamilyID:        familyID,
+		TokenHash:       hashToken(refreshToken),
+		AccessJTI:       claims.ID,
+		AccessExpiresAt: claims.ExpiresAt.Time,
+		MFA:             mfa,
+		ExpiresAt:       now.Add(s.refreshTTL),
+		CreatedAt:       now,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    claims.ExpiresAt.Time,
+		SessionID:    familyID,
+	}, nil
+}
+
+// randomToken returns n random bytes encoded as URL-safe base64
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex-encoded SHA-256 digest stored in place of a token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
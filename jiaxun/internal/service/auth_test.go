@@ -0,0 +1,190 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// newTestAuthService returns an auth service backed by the database and a
+// user to log in
+func newTestAuthService(t *testing.T, db *gorm.DB) (*AuthService, *model.User) {
+	t.Helper()
+	useTestKeyring(t)
+	userService := newTestUserService(db)
+	user := &model.User{Username: "ada", Email: "ada@example.org", Password: "password"}
+	if err := userService.Create(user); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return NewAuthService(repository.NewTokenRepository(db), userService, 15*time.Minute, 24*time.Hour), user
+}
+
+// authenticated reports the status AuthMiddleware answers an access token with
+func authenticated(t *testing.T, accessToken string) int {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/me", middleware.AuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRefreshRotation(t *testing.T) {
+	db := openTestDB(t)
+	service, user := newTestAuthService(t, db)
+	client := ClientInfo{IP: "192.0.2.1", UserAgent: "test"}
+
+	first, err := service.IssueTokens(user, false, client)
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	second, err := service.Refresh(first.RefreshToken, client)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Error("refreshing returned the same tokens")
+	}
+	if second.SessionID != first.SessionID {
+		t.Errorf("refreshed session = %q, want %q", second.SessionID, first.SessionID)
+	}
+	if _, err := service.Refresh(second.RefreshToken, client); err != nil {
+		t.Errorf("refreshing the rotated token: %v", err)
+	}
+	if _, err := service.Refresh("unknown", client); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refreshing an unknown token = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	db := openTestDB(t)
+	service, user := newTestAuthService(t, db)
+	middleware.SetRevocationList(service)
+	client := ClientInfo{IP: "192.0.2.1", UserAgent: "test"}
+
+	first, err := service.IssueTokens(user, false, client)
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	other, err := service.IssueTokens(user, false, client)
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	second, err := service.Refresh(first.RefreshToken, client)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if code := authenticated(t, second.AccessToken); code != http.StatusOK {
+		t.Fatalf("fresh access token = %d, want 200", code)
+	}
+
+	// Replaying a consumed token ends the session of its family
+	if _, err := service.Refresh(first.RefreshToken, client); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replaying a used refresh token = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := service.Refresh(second.RefreshToken, client); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refreshing within a revoked family = %v, want ErrInvalidRefreshToken", err)
+	}
+	for name, token := range map[string]string{"first": first.AccessToken, "second": second.AccessToken} {
+		if code := authenticated(t, token); code != http.StatusUnauthorized {
+			t.Errorf("%s access token of the revoked family = %d, want 401", name, code)
+		}
+	}
+
+	// Other sessions of the user are left alone
+	if code := authenticated(t, other.AccessToken); code != http.StatusOK {
+		t.Errorf("access token of another session = %d, want 200", code)
+	}
+	if _, err := service.Refresh(other.RefreshToken, client); err != nil {
+		t.Errorf("refreshing another session: %v", err)
+	}
+}
+
+func TestRefreshConcurrentReuse(t *testing.T) {
+	db := openTestDB(t)
+	service, user := newTestAuthService(t, db)
+	client := ClientInfo{IP: "192.0.2.1", UserAgent: "test"}
+
+	tokens, err := service.IssueTokens(user, false, client)
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	// A second refresh racing the first finds the token already used
+	repo := repository.NewTokenRepository(db)
+	stored, err := repo.GetRefreshTokenByHash(hashToken(tokens.RefreshToken))
+	if err != nil {
+		t.Fatalf("GetRefreshTokenByHash: %v", err)
+	}
+	if fresh, err := repo.MarkRefreshTokenUsed(stored.ID, time.Now()); err != nil || !fresh {
+		t.Fatalf("MarkRefreshTokenUsed = %v, %v, want the token fresh", fresh, err)
+	}
+	if fresh, err := repo.MarkRefreshTokenUsed(stored.ID, time.Now()); err != nil || fresh {
+		t.Fatalf("MarkRefreshTokenUsed twice = %v, %v, want the token used", fresh, err)
+	}
+	if _, err := service.Refresh(tokens.RefreshToken, client); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("Refresh after the race = %v, want ErrRefreshTokenReused", err)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	db := openTestDB(t)
+	service, user := newTestAuthService(t, db)
+	middleware.SetRevocationList(service)
+	other := &model.User{Username: "grace", Email: "grace@example.org", Password: "password"}
+	if err := newTestUserService(db).Create(other); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	revoked, err := service.IssueTokens(user, false, ClientInfo{IP: "192.0.2.1", UserAgent: "laptop"})
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	kept, err := service.IssueTokens(user, false, ClientInfo{IP: "192.0.2.2", UserAgent: "phone"})
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+
+	// Sessions are only found among those of their user
+	if err := service.RevokeSession(other.ID, revoked.SessionID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("revoking another user's session = %v, want ErrSessionNotFound", err)
+	}
+	if code := authenticated(t, revoked.AccessToken); code != http.StatusOK {
+		t.Fatalf("session revoked by another user = %d, want 200", code)
+	}
+
+	if err := service.RevokeSession(user.ID, revoked.SessionID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if _, err := service.Refresh(revoked.RefreshToken, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refreshing a revoked session = %v, want ErrInvalidRefreshToken", err)
+	}
+	if code := authenticated(t, revoked.AccessToken); code != http.StatusUnauthorized {
+		t.Errorf("access token of a revoked session = %d, want 401", code)
+	}
+	if err := service.RevokeSession(user.ID, revoked.SessionID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking twice = %v, want ErrSessionNotFound", err)
+	}
+
+	sessions, err := service.ListSessions(user.ID, kept.SessionID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != kept.SessionID || !sessions[0].Current || sessions[0].UserAgent != "phone" {
+		t.Errorf("sessions = %+v, want the current one only", sessions)
+	}
+	if _, err := service.Refresh(kept.RefreshToken, ClientInfo{}); err != nil {
+		t.Errorf("refreshing the other session: %v", err)
+	}
+}
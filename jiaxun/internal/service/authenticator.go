@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/model"
+)
+
+// Authenticator checks passwords against one source of accounts. The
+// user service tries its authenticators in order until one accepts.
+type Authenticator interface {
+	// Name identifies the authenticator in configuration and logs
+	Name() string
+	// Authenticate returns the user the credentials belong to, or
+	// ErrInvalidCredentials if the login is unknown or the password wrong
+	Authenticate(login, password string) (*model.User, error)
+}
+
+// LocalAuthenticator checks the bcrypt password hashes stored by jiaxun
+type LocalAuthenticator struct {
+	userService *UserService
+}
+
+// NewLocalAuthenticator creates an authenticator for local passwords
+func NewLocalAuthenticator(userService *UserService) *LocalAuthenticator {
+	return &LocalAuthenticator{userService: userService}
+}
+
+// Name returns "local"
+func (a *LocalAuthenticator) Name() string {
+	return config.AuthenticatorLocal
+}
+
+// Authenticate finds the user by username or email and checks the password
+func (a *LocalAuthenticator) Authenticate(login, password string) (*model.User, error) {
+	user, err := a.userService.FindByLogin(login)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if err := CheckPassword(password, user.Password); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
@@ -2,7 +2,10 @@ package service
 
 import (
 	"errors"
+	"time"
+
 	"jiaxun/internal/model"
+	"jiaxun/internal/policy"
 	"jiaxun/internal/repository"
 
 	"gorm.io/gorm"
@@ -11,21 +14,46 @@ import (
 var (
 	ErrContestAlreadyExists = errors.New("contest already exists")
 	ErrContestNotFound      = errors.New("contest not found")
-	ErrNotImplemented       = errors.New("not implemented")
+	ErrInvalidContestTime   = errors.New("contest end time must be after start time")
+	// ErrContestHasRegistrations is returned when making a contest team-based
+	// or individual once users or teams registered to it
+	ErrContestHasRegistrations = errors.New("contest already has registrations")
+
+	ErrContestIsTeamBased      = errors.New("contest only accepts team registrations")
+	ErrContestNotTeamBased     = errors.New("contest only accepts individual registrations")
+	ErrAlreadyRegistered       = errors.New("already registered to contest")
+	ErrMemberAlreadyRegistered = errors.New("a team member is already registered to contest")
 )
 
 type ContestService struct {
-	repo *repository.ContestRepository
+	repo        *repository.ContestRepository
+	teamRepo    *repository.TeamRepository
 	userService *UserService
 }
 
-func NewContestService(repo *repository.ContestRepository) *ContestService {
+func NewContestService(repo *repository.ContestRepository, teamRepo *repository.TeamRepository, userService *UserService) *ContestService {
 	return &ContestService{
-		repo: repo,
+		repo:        repo,
+		teamRepo:    teamRepo,
+		userService: userService,
 	}
 }
 
+// ContestUpdate describes a partial update of a contest.
+// Nil fields are left untouched.
+type ContestUpdate struct {
+	Name        *string
+	StartTime   *time.Time
+	EndTime     *time.Time
+	IsTeamBased *bool
+	Organizer   *string
+}
+
 func (s *ContestService) CreateContest(contest *model.Contest) error {
+	if !contest.EndTime.After(contest.StartTime) {
+		return ErrInvalidContestTime
+	}
+
 	err := s.repo.Create(contest)
 	if err != nil { // wrap around gorm errors
 		// duplicate entry error handling
@@ -56,73 +84,185 @@ func (s *ContestService) ListContests(page, pageSize int) ([]model.Contest, int6
 		}
 		return nil, 0, err
 	}
-	return contests, total,  nil
+	return contests, total, nil
 }
 
+// UpdateContest applies the non-nil fields of update to the contest
+// and returns the stored result. Only its organizer and contest managers
+// may update it.
+func (s *ContestService) UpdateContest(subject policy.Subject, id uint, update ContestUpdate) (*model.Contest, error) {
+	contest, err := s.GetContestByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Contests.Authorize(subject, policy.ActionUpdate, contest); err != nil {
+		return nil, err
+	}
 
-func (s *ContestService) UpdateContest(contest *model.Contest) error {
-	existingContest, err := s.repo.GetByID(contest.ContestID)
+	wasTeamBased := contest.IsTeamBased
+	fields := map[string]interface{}{}
+	if update.Name != nil {
+		fields["name"] = *update.Name
+		contest.Name = *update.Name
+	}
+	if update.StartTime != nil {
+		fields["start_time"] = *update.StartTime
+		contest.StartTime = *update.StartTime
+	}
+	if update.EndTime != nil {
+		fields["end_time"] = *update.EndTime
+		contest.EndTime = *update.EndTime
+	}
+	if update.IsTeamBased != nil {
+		fields["is_team_based"] = *update.IsTeamBased
+		contest.IsTeamBased = *update.IsTeamBased
+	}
+	if update.Organizer != nil {
+		fields["organizer"] = *update.Organizer
+		contest.Organizer = *update.Organizer
+	}
+
+	if len(fields) == 0 {
+		return contest, nil
+	}
+	if !contest.EndTime.After(contest.StartTime) {
+		return nil, ErrInvalidContestTime
+	}
+
+	// Existing registrations would no longer match the kind of contest
+	if update.IsTeamBased != nil && *update.IsTeamBased != wasTeamBased {
+		err = s.repo.UpdateUnregistered(contest, fields)
+	} else {
+		err = s.repo.UpdateFields(contest, fields)
+	}
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ErrContestNotFound
+		if errors.Is(err, repository.ErrContestHasRegistrations) {
+			return nil, ErrContestHasRegistrations
 		}
-		return err
+		return nil, err
 	}
+	return contest, nil
+}
 
-	return s.repo.Update(existingContest)
+// DeleteContest moves a contest to the trash on behalf of its organizer or
+// a contest manager. Its registrations are kept until it is purged.
+func (s *ContestService) DeleteContest(subject policy.Subject, id uint) error {
+	contest, err := s.GetContestByID(id)
+	if err != nil {
+		return err
+	}
+	if err := policy.Contests.Authorize(subject, policy.ActionDelete, contest); err != nil {
+		return err
+	}
+	return s.repo.Delete(id)
 }
 
+// GetRegistrations lists all registrations of a contest
+func (s *ContestService) GetRegistrations(contestID uint) ([]model.ContestRegistration, error) {
+	if _, err := s.GetContestByID(contestID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetRegistrationsByContestID(contestID)
+}
 
 // Register a user to a contest
-func (s *ContestService) RegisterUserToContest(contestID uint, userID uint) error {
+func (s *ContestService) RegisterUserToContest(contestID uint, userID uint) (*model.ContestRegistration, error) {
 	// Check if the contest exists
-	contest, err := s.repo.GetByID(contestID)
+	contest, err := s.GetContestByID(contestID)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ErrContestNotFound
-		}
-		return err
+		return nil, err
+	}
+
+	// Team-based contests only accept team registrations
+	if contest.IsTeamBased {
+		return nil, ErrContestIsTeamBased
 	}
 
 	// Check if the user exists
 	exists, err := s.userService.Exists(userID)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ErrUserNotFound
-		}
-		return err
+		return nil, err
 	}
 	if !exists {
-		return ErrUserNotFound
+		return nil, ErrUserNotFound
 	}
 
-	// Create a new registration
+	// The user may not take part already, individually or through a team,
+	// which the repository checks in the transaction creating the registration
 	registration := &model.ContestRegistration{
-		UserID:    &userID,
-		ContestID: contest.ContestID,
+		UserID:             &userID,
+		ContestID:          contest.ContestID,
+		IsUserRegistration: true,
+		RegisteredAt:       time.Now(),
 	}
 
-	return s.repo.CreateRegistration(registration)
+	if err := s.repo.CreateRegistration(registration); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrDuplicatedKey), errors.Is(err, repository.ErrParticipantRegistered):
+			return nil, ErrAlreadyRegistered
+		case errors.Is(err, repository.ErrRegistrationKind):
+			return nil, ErrContestIsTeamBased
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, ErrContestNotFound
+		}
+		return nil, err
+	}
+	return registration, nil
 }
 
-
-func (s *ContestService) RegisterTeamToContest(contestID, teamID uint) error {
-	// Currently not supported
-	return ErrNotImplemented
+// RegisterTeamToContest registers a team to a team-based contest on behalf
+// of its captain or a team approver. No member may already take part in the
+// contest.
+func (s *ContestService) RegisterTeamToContest(subject policy.Subject, contestID, teamID uint) (*model.ContestRegistration, error) {
 	// Check if the contest exists
-	// contest, err := s.repo.GetByID(contestID)
-	// if err != nil {
-	// 	if errors.Is(err, gorm.ErrRecordNotFound) {
-	// 		return ErrContestNotFound
-	// 	}
-	// 	return err
-	// }
-
-	// // Create a new registration
-	// registration := &model.ContestRegistration{
-	// 	TeamID: &teamID,
-	// 	ContestID: contest.ContestID,
-	// }
-	// return s.repo.CreateRegistration(registration)
-}
+	contest, err := s.GetContestByID(contestID)
+	if err != nil {
+		return nil, err
+	}
+	if !contest.IsTeamBased {
+		return nil, ErrContestNotTeamBased
+	}
 
+	// Check if the team exists
+	team, err := s.teamRepo.GetByID(teamID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, err
+	}
+	members, err := s.teamRepo.GetMemberships(teamID)
+	if err != nil {
+		return nil, err
+	}
+	team.TeamMemberships = members
+
+	// Only those managing the team may register it
+	if err := policy.Teams.Authorize(subject, policy.ActionManage, team); err != nil {
+		return nil, err
+	}
+
+	// No member may be registered individually or through another team,
+	// which the repository checks in the transaction creating the registration
+	registration := &model.ContestRegistration{
+		TeamID:             &teamID,
+		ContestID:          contest.ContestID,
+		IsUserRegistration: false,
+		RegisteredAt:       time.Now(),
+	}
+
+	if err := s.repo.CreateRegistration(registration); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrDuplicatedKey):
+			return nil, ErrAlreadyRegistered
+		case errors.Is(err, repository.ErrParticipantRegistered):
+			return nil, ErrMemberAlreadyRegistered
+		case errors.Is(err, repository.ErrRegistrationKind):
+			return nil, ErrContestNotTeamBased
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, ErrContestNotFound
+		}
+		return nil, err
+	}
+	return registration, nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/policy"
+	"jiaxun/internal/repository"
+)
+
+// contestFixture holds the services of contest tests and a few users
+type contestFixture struct {
+	service *ContestService
+	teams   *TeamService
+	users   []*model.User
+}
+
+func newContestFixture(t *testing.T) *contestFixture {
+	t.Helper()
+	db := openTestDB(t)
+	userService := newTestUserService(db)
+	teamRepo := repository.NewTeamRepository(db)
+	f := &contestFixture{
+		service: NewContestService(repository.NewContestRepository(db), teamRepo, userService),
+		teams:   NewTeamService(teamRepo, userService, 3),
+	}
+	for _, name := range []string{"ada", "grace", "hedy"} {
+		user := &model.User{Username: name, Email: name + "@example.org", Password: "password"}
+		if err := userService.Create(user); err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		f.users = append(f.users, user)
+	}
+	return f
+}
+
+// contest creates a contest
+func (f *contestFixture) contest(t *testing.T, teamBased bool) *model.Contest {
+	t.Helper()
+	start := time.Now().Add(time.Hour)
+	contest := &model.Contest{Name: "Round 1", StartTime: start, EndTime: start.Add(2 * time.Hour), IsTeamBased: teamBased}
+	if err := f.service.CreateContest(contest); err != nil {
+		t.Fatalf("CreateContest: %v", err)
+	}
+	return contest
+}
+
+// team creates a team of the users, the first being its captain
+func (f *contestFixture) team(t *testing.T, name string, users ...*model.User) *model.Team {
+	t.Helper()
+	team, err := f.teams.CreateTeam(name, users[0].ID)
+	if err != nil {
+		t.Fatalf("CreateTeam: %v", err)
+	}
+	for _, user := range users[1:] {
+		invitation, err := f.teams.Invite(policy.Subject{UserID: users[0].ID}, team.TeamID, user.ID)
+		if err != nil {
+			t.Fatalf("Invite: %v", err)
+		}
+		if _, err := f.teams.RespondToRequest(policy.Subject{UserID: user.ID}, invitation.RequestID, true); err != nil {
+			t.Fatalf("accepting invitation: %v", err)
+		}
+	}
+	return team
+}
+
+func TestRegisterUserToContest(t *testing.T) {
+	f := newContestFixture(t)
+	contest := f.contest(t, false)
+	ada := f.users[0]
+
+	if _, err := f.service.RegisterUserToContest(contest.ContestID, ada.ID); err != nil {
+		t.Fatalf("RegisterUserToContest: %v", err)
+	}
+	if _, err := f.service.RegisterUserToContest(contest.ContestID, ada.ID); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("registering twice = %v, want ErrAlreadyRegistered", err)
+	}
+	registrations, err := f.service.GetRegistrations(contest.ContestID)
+	if err != nil {
+		t.Fatalf("GetRegistrations: %v", err)
+	}
+	if len(registrations) != 1 {
+		t.Errorf("contest has %d registrations, want 1", len(registrations))
+	}
+
+	teamContest := f.contest(t, true)
+	if _, err := f.service.RegisterUserToContest(teamContest.ContestID, ada.ID); !errors.Is(err, ErrContestIsTeamBased) {
+		t.Errorf("registering to a team-based contest = %v, want ErrContestIsTeamBased", err)
+	}
+}
+
+func TestRegisterTeamToContest(t *testing.T) {
+	f := newContestFixture(t)
+	contest := f.contest(t, true)
+	ada, grace, hedy := f.users[0], f.users[1], f.users[2]
+	engines := f.team(t, "Analytical Engines", ada, grace)
+	compilers := f.team(t, "Compilers", hedy, grace)
+
+	if _, err := f.service.RegisterTeamToContest(policy.Subject{UserID: ada.ID}, contest.ContestID, engines.TeamID); err != nil {
+		t.Fatalf("RegisterTeamToContest: %v", err)
+	}
+	if _, err := f.service.RegisterTeamToContest(policy.Subject{UserID: ada.ID}, contest.ContestID, engines.TeamID); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("registering the team twice = %v, want ErrAlreadyRegistered", err)
+	}
+	// Grace takes part through the first team already
+	if _, err := f.service.RegisterTeamToContest(policy.Subject{UserID: hedy.ID}, contest.ContestID, compilers.TeamID); !errors.Is(err, ErrMemberAlreadyRegistered) {
+		t.Errorf("registering a team sharing a member = %v, want ErrMemberAlreadyRegistered", err)
+	}
+	registrations, err := f.service.GetRegistrations(contest.ContestID)
+	if err != nil {
+		t.Fatalf("GetRegistrations: %v", err)
+	}
+	if len(registrations) != 1 {
+		t.Errorf("contest has %d registrations, want 1", len(registrations))
+	}
+
+	individual := f.contest(t, false)
+	if _, err := f.service.RegisterTeamToContest(policy.Subject{UserID: ada.ID}, individual.ContestID, engines.TeamID); !errors.Is(err, ErrContestNotTeamBased) {
+		t.Errorf("registering to an individual contest = %v, want ErrContestNotTeamBased", err)
+	}
+}
+
+func TestUpdateContestKindAfterRegistrations(t *testing.T) {
+	f := newContestFixture(t)
+	manager := policy.Subject{UserID: 100, Permissions: []string{model.PermContestsManage}}
+	teamBased := true
+	contest := f.contest(t, false)
+
+	// Without registrations the contest can still become team-based
+	updated, err := f.service.UpdateContest(manager, contest.ContestID, ContestUpdate{IsTeamBased: &teamBased})
+	if err != nil {
+		t.Fatalf("UpdateContest: %v", err)
+	}
+	if !updated.IsTeamBased {
+		t.Fatal("contest did not become team-based")
+	}
+
+	contest = f.contest(t, false)
+	if _, err := f.service.RegisterUserToContest(contest.ContestID, f.users[0].ID); err != nil {
+		t.Fatalf("RegisterUserToContest: %v", err)
+	}
+	name := "Round 2"
+	_, err = f.service.UpdateContest(manager, contest.ContestID, ContestUpdate{Name: &name, IsTeamBased: &teamBased})
+	if !errors.Is(err, ErrContestHasRegistrations) {
+		t.Fatalf("UpdateContest = %v, want ErrContestHasRegistrations", err)
+	}
+	stored, err := f.service.GetContestByID(contest.ContestID)
+	if err != nil {
+		t.Fatalf("GetContestByID: %v", err)
+	}
+	if stored.IsTeamBased || stored.Name != contest.Name {
+		t.Errorf("refused update was stored: %+v", stored)
+	}
+
+	// Other fields, and setting the kind it already has, remain possible
+	individual := false
+	if _, err := f.service.UpdateContest(manager, contest.ContestID, ContestUpdate{Name: &name, IsTeamBased: &individual}); err != nil {
+		t.Errorf("UpdateContest without changing the kind: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"jiaxun/internal/keyring"
+	"jiaxun/internal/mailer"
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/migration"
+	"jiaxun/internal/repository"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// openTestDB opens a migrated SQLite database in a temporary file, named
+// like the one repository.OpenDB opens
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=on"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger:         logger.Discard,
+		NamingStrategy: schema.NamingStrategy{SingularTable: true},
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	migrator, err := migration.New(db)
+	if err != nil {
+		t.Fatalf("creating migrator: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return db
+}
+
+// newTestUserService returns a user service backed by the database
+func newTestUserService(db *gorm.DB) *UserService {
+	return NewUserService(*repository.NewUserRepository(db))
+}
+
+// useTestKeyring signs access tokens with a test key and restores the
+// authentication globals of the middleware after the test
+func useTestKeyring(t *testing.T) {
+	t.Helper()
+	middleware.SetKeyring(keyring.NewHMAC([]byte("test secret")))
+	t.Cleanup(func() {
+		middleware.SetKeyring(nil)
+		middleware.SetRevocationList(nil)
+		middleware.SetImpersonationAuditor(nil)
+	})
+}
+
+// outbox is a mailer keeping the messages it is asked to send
+type outbox struct {
+	messages []mailer.Message
+}
+
+func (o *outbox) Send(msg mailer.Message) error {
+	o.messages = append(o.messages, msg)
+	return nil
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// Reasons an external account cannot be resolved to a user
+var (
+	errExternalEmailNotVerified = errors.New("external account has no verified email address")
+	errExternalAccountNotFound  = errors.New("no user matches the external account")
+)
+
+// maxUsernameAttempts bounds the search for a free username when provisioning
+const maxUsernameAttempts = 100
+
+// externalAccount is an account at an OIDC provider or in an LDAP
+// directory, as reported when its user logs in
+type externalAccount struct {
+	// Source is the ID of the provider or directory
+	Source  string
+	Subject string
+	Email   string
+	// EmailVerified is set when the source vouches for the email address
+	EmailVerified bool
+	Name          string
+	Username      string
+	// Groups are matched against the role mapping, in order
+	Groups []string
+}
+
+// linkPolicy says how the accounts of a source become and stay users
+type linkPolicy struct {
+	AutoProvision bool
+	RoleMapping   map[string]string
+	DefaultRole   string
+	SyncRoles     bool
+	// SyncProfile copies the email address and name to the user on every login
+	SyncProfile bool
+}
+
+// identityLinker finds, links or provisions the users of external accounts.
+// Accounts are linked to users by their verified email on first login and
+// by the source's subject afterwards.
+type identityLinker struct {
+	identities  *repository.IdentityRepository
+	userService *UserService
+}
+
+// resolve returns the user of an external account
+func (l *identityLinker) resolve(account externalAccount, policy linkPolicy) (*model.User, error) {
+	now := time.Now()
+
+	// Accounts that logged in before are known by their subject
+	identity, err := l.identities.Get(account.Source, account.Subject)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if identity != nil {
+		user, err := l.userService.GetByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.identities.Touch(identity.ID, account.Email, now); err != nil {
+			return nil, err
+		}
+		if policy.SyncProfile {
+			if err := l.syncProfile(account, user); err != nil {
+				return nil, err
+			}
+		}
+		if err := l.syncRole(account, policy, user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	// Otherwise the source must vouch for the email address
+	if account.Email == "" || !account.EmailVerified {
+		return nil, errExternalEmailNotVerified
+	}
+
+	user, err := l.userService.GetByEmail(account.Email)
+	switch {
+	case err == nil:
+		// The source verified the address, so a pending account is confirmed
+		if user.Status == model.UserStatusPending {
+			if err := l.userService.MarkEmailVerified(user); err != nil {
+				return nil, err
+			}
+		}
+		if policy.SyncProfile {
+			if err := l.syncProfile(account, user); err != nil {
+				return nil, err
+			}
+		}
+		if err := l.syncRole(account, policy, user); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, ErrUserNotFound):
+		if !policy.AutoProvision {
+			return nil, errExternalAccountNotFound
+		}
+		if user, err = l.provision(account, policy); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if err := l.identities.Create(&model.UserIdentity{
+		UserID:      user.ID,
+		Provider:    account.Source,
+		Subject:     account.Subject,
+		Email:       account.Email,
+		CreatedAt:   now,
+		LastLoginAt: &now,
+	}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provision creates a user for an external account. It gets a random
+// password, so it can only log in through the source until one is set.
+func (l *identityLinker) provision(account externalAccount, policy linkPolicy) (*model.User, error) {
+	password, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	role, ok := mapRole(policy.RoleMapping, account.Groups)
+	if !ok {
+		role = policy.DefaultRole
+	}
+
+	now := time.Now()
+	user := &model.User{
+		Email:           account.Email,
+		FullName:        account.Name,
+		Password:        password,
+		Role:            role,
+		Status:          model.UserStatusActive,
+		EmailVerifiedAt: &now,
+	}
+
+	base := account.Username
+	if base == "" {
+		base, _, _ = strings.Cut(account.Email, "@")
+	}
+	for i := 1; i <= maxUsernameAttempts; i++ {
+		user.Username = base
+		if i > 1 {
+			user.Username = fmt.Sprintf("%s%d", base, i)
+		}
+		err := l.userService.Create(user)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrUserAlreadyExists) {
+			return nil, err
+		}
+	}
+	return nil, ErrUserAlreadyExists
+}
+
+// syncRole applies the role mapping to an existing user if the source is
+// configured to keep roles in sync
+func (l *identityLinker) syncRole(account externalAccount, policy linkPolicy, user *model.User) error {
+	if !policy.SyncRoles {
+		return nil
+	}
+	role, ok := mapRole(policy.RoleMapping, account.Groups)
+	if !ok || role == user.Role {
+		return nil
+	}
+	return l.userService.SetRole(user, role)
+}
+
+// syncProfile copies the email address and name of an external account to
+// its user. An address taken by another user is left alone.
+func (l *identityLinker) syncProfile(account externalAccount, user *model.User) error {
+	changed := false
+	if account.Email != "" && !strings.EqualFold(account.Email, user.Email) {
+		owner, err := l.userService.GetByEmail(account.Email)
+		switch {
+		case errors.Is(err, ErrUserNotFound):
+			user.Email = account.Email
+			changed = true
+		case err != nil:
+			return err
+		default:
+			log.Printf("Not syncing email of user %d from %s: %s belongs to user %d", user.ID, account.Source, account.Email, owner.ID)
+		}
+	}
+	if account.Name != "" && account.Name != user.FullName {
+		user.FullName = account.Name
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return l.userService.Update(user)
+}
+
+// mapRole returns the role of the first group that has a mapping
+func mapRole(mapping map[string]string, groups []string) (string, bool) {
+	for _, group := range groups {
+		if role, ok := mapping[group]; ok {
+			return role, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"jiaxun/internal/mailer"
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// ImpersonationService errors
+var (
+	ErrImpersonationNotFound        = errors.New("impersonation not found")
+	ErrCannotImpersonate            = errors.New("this user cannot be impersonated")
+	ErrInvalidImpersonationDuration = errors.New("invalid impersonation duration")
+)
+
+// defaultImpersonationTTL is how long an impersonation lasts unless asked otherwise
+const defaultImpersonationTTL = 30 * time.Minute
+
+// ImpersonationToken is handed to an administrator starting an impersonation
+type ImpersonationToken struct {
+	AccessToken   string               `json:"token"`
+	ExpiresAt     time.Time            `json:"expires_at"`
+	Impersonation *model.Impersonation `json:"impersonation"`
+}
+
+// ImpersonationService lets administrators act as another user to see what
+// they see. Impersonation tokens are read-only and short-lived, have no
+// refresh token, and every request made with them is recorded. The
+// impersonated user is notified by email.
+type ImpersonationService struct {
+	repo        *repository.ImpersonationRepository
+	userService *UserService
+	rbacService *RBACService
+	mailer      mailer.Mailer
+	maxTTL      time.Duration
+}
+
+// NewImpersonationService creates a new impersonation service instance
+func NewImpersonationService(repo *repository.ImpersonationRepository, userService *UserService, rbacService *RBACService, m mailer.Mailer, maxTTL time.Duration) *ImpersonationService {
+	return &ImpersonationService{
+		repo:        repo,
+		userService: userService,
+		rbacService: rbacService,
+		mailer:      m,
+		maxTTL:      maxTTL,
+	}
+}
+
+// Start issues a token for an administrator to act as another user. A zero
+// duration picks the default, capped at the configured maximum. The token
+// keeps the second factor state of the administrator's session.
+func (s *ImpersonationService) Start(actorID uint, mfa bool, subjectID uint, reason string, duration time.Duration, client ClientInfo) (*ImpersonationToken, error) {
+	if duration == 0 {
+		duration = min(defaultImpersonationTTL, s.maxTTL)
+	}
+	if duration < time.Minute || duration > s.maxTTL {
+		return nil, ErrInvalidImpersonationDuration
+	}
+	if actorID == subjectID {
+		return nil, ErrCannotImpersonate
+	}
+
+	actor, err := s.userService.GetByID(actorID)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := s.userService.GetByID(subjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Administrators cannot be impersonated, which would let one borrow
+	// another's identity in the audit trail
+	permissions, err := s.rbacService.PermissionsOf(subject.Role)
+	if err != nil {
+		return nil, err
+	}
+	if model.HasPermission(permissions, model.PermUsersImpersonate) {
+		return nil, ErrCannotImpersonate
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	client = client.normalized()
+	now := time.Now()
+	impersonation := &model.Impersonation{
+		ID:              id,
+		ActorID:         &actor.ID,
+		ActorUsername:   actor.Username,
+		SubjectID:       &subject.ID,
+		SubjectUsername: subject.Username,
+		Reason:          reason,
+		IP:              client.IP,
+		UserAgent:       client.UserAgent,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(duration),
+	}
+	if err := s.repo.Create(impersonation); err != nil {
+		return nil, err
+	}
+
+	token, err := middleware.GenerateToken(&middleware.JWTClaims{
+		UserID:          subject.ID,
+		Email:           subject.Email,
+		Role:            subject.Role,
+		MFA:             mfa,
+		ActorID:         actor.ID,
+		ImpersonationID: impersonation.ID,
+	}, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(actor, subject, impersonation)
+
+	return &ImpersonationToken{
+		AccessToken:   token,
+		ExpiresAt:     impersonation.ExpiresAt,
+		Impersonation: impersonation,
+	}, nil
+}
+
+// End ends an impersonation, after which its token is rejected. Ending an
+// impersonation that is already over has no effect.
+func (s *ImpersonationService) End(id string) error {
+	if _, err := s.get(id); err != nil {
+		return err
+	}
+	_, err := s.repo.End(id, time.Now())
+	return err
+}
+
+// IsActive reports whether an impersonation has neither ended nor expired
+func (s *ImpersonationService) IsActive(id string) (bool, error) {
+	impersonation, err := s.get(id)
+	if err != nil {
+		if errors.Is(err, ErrImpersonationNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return impersonation.Active(time.Now()), nil
+}
+
+// RecordRequest adds a request to the audit trail of an impersonation.
+// Failures are logged, as the request has already been answered.
+func (s *ImpersonationService) RecordRequest(id, method, path string, status int, blocked bool) {
+	if len(path) > 1024 {
+		path = path[:1024]
+	}
+	if err := s.repo.CreateRequest(&model.ImpersonationRequest{
+		ImpersonationID: id,
+		Method:          method,
+		Path:            path,
+		Status:          status,
+		Blocked:         blocked,
+		CreatedAt:       time.Now(),
+	}); err != nil {
+		log.Printf("Failed to record request %s %s of impersonation %s: %v", method, path, id, err)
+	}
+}
+
+// Get returns an impersonation
+func (s *ImpersonationService) Get(id string) (*model.Impersonation, error) {
+	return s.get(id)
+}
+
+// List returns impersonations with pagination, newest first. Zero IDs match
+// any actor or subject.
+func (s *ImpersonationService) List(actorID, subjectID uint, page, pageSize int) ([]model.Impersonation, int64, error) {
+	return s.repo.List(actorID, subjectID, page, pageSize)
+}
+
+// ListRequests returns the requests made in an impersonation with pagination
+func (s *ImpersonationService) ListRequests(id string, page, pageSize int) ([]model.ImpersonationRequest, int64, error) {
+	if _, err := s.get(id); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.ListRequests(id, page, pageSize)
+}
+
+// get retrieves an impersonation, mapping a missing record to ErrImpersonationNotFound
+func (s *ImpersonationService) get(id string) (*model.Impersonation, error) {
+	impersonation, err := s.repo.Get(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImpersonationNotFound
+		}
+		return nil, err
+	}
+	return impersonation, nil
+}
+
+// notify tells the impersonated user who is acting as them and why
+func (s *ImpersonationService) notify(actor, subject *model.User, impersonation *model.Impersonation) {
+	name := actor.FullName
+	if name == "" {
+		name = actor.Username
+	}
+	if err := s.mailer.Send(mailer.Message{
+		To:      subject.Email,
+		Subject: "An administrator is viewing Jiaxun as you",
+		Body: fmt.Sprintf("Hello %s,\n\n%s started viewing Jiaxun as you at %s, giving this reason:\n\n%s\n\n"+
+			"They can see what you see until %s, but cannot change anything on your behalf. "+
+			"Every page they open is recorded, and you can review these visits in your account.\n\n"+
+			"If you did not expect this, please contact your coach.\n",
+			subject.Username, name, impersonation.CreatedAt.Format(time.RFC1123),
+			impersonation.Reason, impersonation.ExpiresAt.Format(time.RFC1123)),
+	}); err != nil {
+		// The impersonation is recorded either way
+		log.Printf("Failed to send impersonation notice to %s: %v", subject.Email, err)
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// impersonationFixture holds an impersonation service acting as the auditor
+// of AuthMiddleware, an administrator and a student
+type impersonationFixture struct {
+	service *ImpersonationService
+	rbac    *RBACService
+	users   *UserService
+	outbox  *outbox
+	admin   *model.User
+	student *model.User
+}
+
+func newImpersonationFixture(t *testing.T) *impersonationFixture {
+	t.Helper()
+	useTestKeyring(t)
+	db := openTestDB(t)
+	f := &impersonationFixture{users: newTestUserService(db), outbox: &outbox{}}
+	f.rbac = NewRBACService(repository.NewRoleRepository(db), f.users)
+	f.service = NewImpersonationService(repository.NewImpersonationRepository(db), f.users, f.rbac, f.outbox, time.Hour)
+	middleware.SetImpersonationAuditor(f.service)
+
+	f.admin = &model.User{Username: "root", Email: "root@example.org", Password: "password", Role: model.RoleAdmin}
+	f.student = &model.User{Username: "ada", Email: "ada@example.org", Password: "password", Role: model.RoleStudent}
+	for _, user := range []*model.User{f.admin, f.student} {
+		if err := f.users.Create(user); err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+	}
+	return f
+}
+
+// router serves a page, a write and the end of an impersonation behind
+// AuthMiddleware
+func (f *impersonationFixture) router() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api", middleware.AuthMiddleware())
+	api.GET("/teams", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.POST("/teams", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	api.POST("/auth/impersonation/end", func(c *gin.Context) {
+		claims := c.MustGet("claims").(*middleware.JWTClaims)
+		if err := f.service.End(claims.ImpersonationID); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+// request sends a request with an access token and returns the status
+func request(r http.Handler, method, target, accessToken string) int {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestImpersonationIsReadOnly(t *testing.T) {
+	f := newImpersonationFixture(t)
+	token, err := f.service.Start(f.admin.ID, true, f.student.ID, "ticket 42", 0, ClientInfo{IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if len(f.outbox.messages) != 1 || f.outbox.messages[0].To != f.student.Email {
+		t.Errorf("sent %+v, want a notice to %s", f.outbox.messages, f.student.Email)
+	}
+
+	r := f.router()
+	steps := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/api/teams", http.StatusOK},
+		{http.MethodPost, "/api/teams", http.StatusForbidden},
+		{http.MethodPost, "/api/auth/impersonation/end", http.StatusOK},
+		{http.MethodGet, "/api/teams", http.StatusUnauthorized},
+	}
+	for _, step := range steps {
+		if code := request(r, step.method, step.target, token.AccessToken); code != step.want {
+			t.Errorf("%s %s = %d, want %d", step.method, step.target, code, step.want)
+		}
+	}
+
+	// Every request made while the impersonation lasted is on record,
+	// including the refused one
+	requests, total, err := f.service.ListRequests(token.Impersonation.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("ListRequests: %v", err)
+	}
+	if total != 3 {
+		t.Fatalf("%d requests recorded, want 3: %+v", total, requests)
+	}
+	for i, step := range steps[:3] {
+		got := requests[i]
+		if got.Method != step.method || got.Path != step.target || got.Status != step.want || got.Blocked != (step.want == http.StatusForbidden) {
+			t.Errorf("request %d = %s %s %d blocked %t, want %s %s %d", i+1, got.Method, got.Path, got.Status, got.Blocked, step.method, step.target, step.want)
+		}
+	}
+}
+
+func TestImpersonateRefused(t *testing.T) {
+	f := newImpersonationFixture(t)
+	if _, err := f.rbac.CreateRole("auditor", "Looks into support tickets", []string{model.PermUsersRead, model.PermUsersImpersonate}); err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	auditor := &model.User{Username: "grace", Email: "grace@example.org", Password: "password", Role: "auditor"}
+	if err := f.users.Create(auditor); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		actorID   uint
+		subjectID uint
+		duration  time.Duration
+		want      error
+	}{
+		{"holder of a custom role granting users:impersonate", f.admin.ID, auditor.ID, 0, ErrCannotImpersonate},
+		{"administrator", auditor.ID, f.admin.ID, 0, ErrCannotImpersonate},
+		{"themselves", f.admin.ID, f.admin.ID, 0, ErrCannotImpersonate},
+		{"beyond the maximum duration", f.admin.ID, f.student.ID, 2 * time.Hour, ErrInvalidImpersonationDuration},
+		{"unknown user", f.admin.ID, f.student.ID + 100, 0, ErrUserNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := f.service.Start(tc.actorID, true, tc.subjectID, "ticket 42", tc.duration, ClientInfo{}); !errors.Is(err, tc.want) {
+				t.Errorf("Start = %v, want %v", err, tc.want)
+			}
+		})
+	}
+	if len(f.outbox.messages) != 0 {
+		t.Errorf("sent %d notices for refused impersonations", len(f.outbox.messages))
+	}
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"jiaxun/internal/judge"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// JudgeAccountService errors
+var (
+	ErrJudgeAccountNotFound = errors.New("judge account not found")
+	ErrJudgeAccountExists   = errors.New("an account on this platform is already linked")
+	ErrUnknownJudgePlatform = errors.New("unknown judge platform")
+	ErrInvalidHandle        = errors.New("invalid handle")
+	ErrHandleTaken          = errors.New("handle is verified by another user")
+	ErrHandleNotFound       = errors.New("handle does not exist on the platform")
+	ErrNoChallenge          = errors.New("no verification challenge is pending")
+	ErrChallengeExpired     = errors.New("verification challenge has expired")
+	ErrChallengeNotFound    = errors.New("challenge not found on the profile")
+	ErrJudgeUnavailable     = errors.New("judge is unavailable")
+)
+
+// maxHandleLength bounds the length of handles
+const maxHandleLength = 64
+
+// JudgeChallenge is a pending verification of a judge account
+type JudgeChallenge struct {
+	Challenge    string    `json:"challenge"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Instructions string    `json:"instructions"`
+}
+
+// JudgeAccountService manages the accounts users link on online judges and
+// verifies that they own them
+type JudgeAccountService struct {
+	repo         *repository.JudgeAccountRepository
+	verifiers    map[string]judge.Verifier
+	challengeTTL time.Duration
+}
+
+// NewJudgeAccountService creates a new judge account service instance
+func NewJudgeAccountService(repo *repository.JudgeAccountRepository, verifiers map[string]judge.Verifier, challengeTTL time.Duration) *JudgeAccountService {
+	return &JudgeAccountService{
+		repo:         repo,
+		verifiers:    verifiers,
+		challengeTTL: challengeTTL,
+	}
+}
+
+// List returns the judge accounts of a user
+func (s *JudgeAccountService) List(userID uint) ([]model.JudgeAccount, error) {
+	return s.repo.ListByUser(userID)
+}
+
+// Add links an unverified account on a platform to a user
+func (s *JudgeAccountService) Add(userID uint, platform, handle string) (*model.JudgeAccount, error) {
+	if _, ok := s.verifiers[platform]; !ok {
+		return nil, ErrUnknownJudgePlatform
+	}
+	handle = strings.TrimSpace(handle)
+	if !validHandle(handle) {
+		return nil, ErrInvalidHandle
+	}
+
+	if _, err := s.repo.GetByPlatform(userID, platform); err == nil {
+		return nil, ErrJudgeAccountExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err := s.checkHandleFree(userID, platform, handle); err != nil {
+		return nil, err
+	}
+
+	account := &model.JudgeAccount{
+		UserID:    userID,
+		Platform:  platform,
+		Handle:    handle,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.Create(account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Remove unlinks a judge account of a user
+func (s *JudgeAccountService) Remove(userID, id uint) error {
+	if err := s.repo.Delete(userID, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrJudgeAccountNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// IssueChallenge starts the verification of a judge account, replacing any
+// challenge issued before. The user proves they own the handle by putting
+// the challenge on its profile before it expires.
+func (s *JudgeAccountService) IssueChallenge(userID, id uint) (*JudgeChallenge, error) {
+	account, err := s.get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(s.challengeTTL)
+	account.Challenge = "jiaxun-" + hex.EncodeToString(b)
+	account.ChallengeExpiresAt = &expiresAt
+	if err := s.repo.Update(account); err != nil {
+		return nil, err
+	}
+
+	return &JudgeChallenge{
+		Challenge:    account.Challenge,
+		ExpiresAt:    expiresAt,
+		Instructions: s.verifiers[account.Platform].Instructions(),
+	}, nil
+}
+
+// Verify checks that the profile of a judge account shows its pending
+// challenge and marks the account as verified if it does
+func (s *JudgeAccountService) Verify(ctx context.Context, userID, id uint) (*model.JudgeAccount, error) {
+	account, err := s.get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if account.Challenge == "" {
+		return nil, ErrNoChallenge
+	}
+	if account.ChallengeExpiresAt == nil || time.Now().After(*account.ChallengeExpiresAt) {
+		return nil, ErrChallengeExpired
+	}
+	if err := s.checkHandleFree(userID, account.Platform, account.Handle); err != nil {
+		return nil, err
+	}
+
+	verifier, ok := s.verifiers[account.Platform]
+	if !ok {
+		return nil, ErrUnknownJudgePlatform
+	}
+	found, err := verifier.Verify(ctx, account.Handle, account.Challenge)
+	if err != nil {
+		if errors.Is(err, judge.ErrHandleNotFound) {
+			return nil, ErrHandleNotFound
+		}
+		return nil, fmt.Errorf("%w: %v", ErrJudgeUnavailable, err)
+	}
+	if !found {
+		return nil, ErrChallengeNotFound
+	}
+
+	now := time.Now()
+	account.Verified = true
+	account.VerifiedAt = &now
+	account.Challenge = ""
+	account.ChallengeExpiresAt = nil
+	if err := s.repo.Update(account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// get returns a judge account of a user
+func (s *JudgeAccountService) get(userID, id uint) (*model.JudgeAccount, error) {
+	account, err := s.repo.Get(userID, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrJudgeAccountNotFound
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+// checkHandleFree fails if another user has verified the handle
+func (s *JudgeAccountService) checkHandleFree(userID uint, platform, handle string) error {
+	owner, err := s.repo.GetVerified(platform, handle)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if owner.UserID != userID {
+		return ErrHandleTaken
+	}
+	return nil
+}
+
+// validHandle reports whether a handle is short and free of spaces and
+// control characters
+func validHandle(handle string) bool {
+	if handle == "" || len(handle) > maxHandleLength {
+		return false
+	}
+	for _, r := range handle {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || r == '/' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/ldap"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+)
+
+// Defaults for directories that leave attributes unconfigured, matching
+// the inetOrgPerson schema of OpenLDAP
+const (
+	defaultLDAPUserFilter        = "(uid={login})"
+	defaultLDAPUsernameAttribute = "uid"
+	defaultLDAPEmailAttribute    = "mail"
+	defaultLDAPNameAttribute     = "cn"
+	defaultLDAPGroupAttribute    = "memberOf"
+	defaultLDAPGroupFilter       = "(member={dn})"
+	defaultLDAPTimeout           = 10 * time.Second
+)
+
+// LDAPAuthenticator checks passwords by binding to an LDAP directory as the
+// user. Users are provisioned on their first login, and their email
+// address, name and, if configured, role are synced on every login.
+type LDAPAuthenticator struct {
+	cfg       config.LDAPDirectoryConfig
+	linker    *identityLinker
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	// roleMapping has lower-cased keys, as DNs are case-insensitive
+	roleMapping map[string]string
+}
+
+// NewLDAPAuthenticator creates an authenticator for a directory
+func NewLDAPAuthenticator(cfg config.LDAPDirectoryConfig, identities *repository.IdentityRepository, userService *UserService) *LDAPAuthenticator {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = defaultLDAPUserFilter
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = defaultLDAPUsernameAttribute
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = defaultLDAPEmailAttribute
+	}
+	if cfg.NameAttribute == "" {
+		cfg.NameAttribute = defaultLDAPNameAttribute
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = defaultLDAPGroupAttribute
+	}
+	if cfg.GroupFilter == "" {
+		cfg.GroupFilter = defaultLDAPGroupFilter
+	}
+	timeout := defaultLDAPTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	roleMapping := make(map[string]string, len(cfg.RoleMapping))
+	for group, role := range cfg.RoleMapping {
+		roleMapping[strings.ToLower(group)] = role
+	}
+
+	return &LDAPAuthenticator{
+		cfg:         cfg,
+		linker:      &identityLinker{identities: identities, userService: userService},
+		tlsConfig:   &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+		timeout:     timeout,
+		roleMapping: roleMapping,
+	}
+}
+
+// Name returns the ID of the directory
+func (a *LDAPAuthenticator) Name() string {
+	return a.cfg.ID
+}
+
+// Authenticate looks the user up in the directory and binds as them
+func (a *LDAPAuthenticator) Authenticate(login, password string) (*model.User, error) {
+	// Directories accept binds without a password as anonymous
+	if login == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := a.findUser(conn, login)
+	if err != nil {
+		return nil, err
+	}
+	// Groups are looked up while still bound as the search account
+	groups, err := a.groups(conn, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsResult(err, ldap.ResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("binding as %s: %w", entry.DN, err)
+	}
+
+	subject := a.subject(entry)
+	if subject == "" {
+		return nil, fmt.Errorf("entry %s has no %s attribute", entry.DN, a.cfg.IDAttribute)
+	}
+	username := entry.Value(a.cfg.UsernameAttribute)
+	if username == "" {
+		username = login
+	}
+	email := entry.Value(a.cfg.EmailAttribute)
+	user, err := a.linker.resolve(externalAccount{
+		Source:  a.cfg.ID,
+		Subject: subject,
+		Email:   email,
+		// The directory is run by the school, so its addresses are trusted
+		EmailVerified: email != "",
+		Name:          entry.Value(a.cfg.NameAttribute),
+		Username:      username,
+		Groups:        groups,
+	}, linkPolicy{
+		AutoProvision: true,
+		RoleMapping:   a.roleMapping,
+		DefaultRole:   a.cfg.DefaultRole,
+		SyncRoles:     a.cfg.SyncRoles,
+		SyncProfile:   true,
+	})
+	if errors.Is(err, errExternalEmailNotVerified) {
+		return nil, fmt.Errorf("entry %s has no %s attribute", entry.DN, a.cfg.EmailAttribute)
+	}
+	return user, err
+}
+
+// connect opens a connection, bound as the search account if there is one
+func (a *LDAPAuthenticator) connect() (*ldap.Conn, error) {
+	conn, err := ldap.Dial(a.cfg.URL, a.tlsConfig, a.timeout)
+	if err != nil {
+		return nil, err
+	}
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(a.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("starting TLS: %w", err)
+		}
+	}
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("binding as search account: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// findUser returns the single entry matching a login
+func (a *LDAPAuthenticator) findUser(conn *ldap.Conn, login string) (*ldap.Entry, error) {
+	attributes := []string{a.cfg.UsernameAttribute, a.cfg.EmailAttribute, a.cfg.NameAttribute, a.cfg.GroupAttribute}
+	if a.cfg.IDAttribute != "" {
+		attributes = append(attributes, a.cfg.IDAttribute)
+	}
+
+	entries, err := conn.Search(ldap.SearchRequest{
+		BaseDN:     a.cfg.UserBaseDN,
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     strings.ReplaceAll(a.cfg.UserFilter, "{login}", ldap.EscapeFilter(login)),
+		Attributes: attributes,
+		SizeLimit:  2,
+	})
+	if err != nil && !ldap.IsResult(err, ldap.ResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("searching for user: %w", err)
+	}
+	switch len(entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+		return entries[0], nil
+	default:
+		log.Printf("Login %q matches several entries in LDAP directory %s", login, a.cfg.ID)
+		return nil, ErrInvalidCredentials
+	}
+}
+
+// groups returns the lower-cased DNs and common names of the user's groups,
+// to be matched against the role mapping
+func (a *LDAPAuthenticator) groups(conn *ldap.Conn, entry *ldap.Entry) ([]string, error) {
+	dns := entry.Values(a.cfg.GroupAttribute)
+
+	if a.cfg.GroupBaseDN != "" {
+		groups, err := conn.Search(ldap.SearchRequest{
+			BaseDN:     a.cfg.GroupBaseDN,
+			Scope:      ldap.ScopeWholeSubtree,
+			Filter:     strings.ReplaceAll(a.cfg.GroupFilter, "{dn}", ldap.EscapeFilter(entry.DN)),
+			Attributes: []string{"cn"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("searching for groups: %w", err)
+		}
+		for _, group := range groups {
+			dns = append(dns, group.DN)
+		}
+	}
+
+	var names []string
+	for _, dn := range dns {
+		names = append(names, strings.ToLower(dn))
+		if cn, ok := commonName(dn); ok {
+			names = append(names, strings.ToLower(cn))
+		}
+	}
+	return names, nil
+}
+
+// subject returns the stable identifier of an entry
+func (a *LDAPAuthenticator) subject(entry *ldap.Entry) string {
+	if a.cfg.IDAttribute == "" {
+		return strings.ToLower(entry.DN)
+	}
+	id := entry.Value(a.cfg.IDAttribute)
+	// Binary identifiers such as objectGUID are stored in hex
+	if !utf8.ValidString(id) {
+		return hex.EncodeToString([]byte(id))
+	}
+	return id
+}
+
+// commonName returns the value of a DN's first RDN if it is a cn
+func commonName(dn string) (string, bool) {
+	rdn, _, _ := strings.Cut(dn, ",")
+	attr, value, ok := strings.Cut(rdn, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(attr), "cn") {
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
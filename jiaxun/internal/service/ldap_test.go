@@ -0,0 +1,341 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/ldap/ldaptest"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// ldapFixture is an LDAP authenticator for a test directory
+type ldapFixture struct {
+	db            *gorm.DB
+	server        *ldaptest.Server
+	authenticator *LDAPAuthenticator
+	userService   *UserService
+}
+
+// testDirectoryConfig configures the sample directory of ldaptest
+func testDirectoryConfig(server *ldaptest.Server) config.LDAPDirectoryConfig {
+	return config.LDAPDirectoryConfig{
+		ID:           "school",
+		URL:          server.URL(),
+		BindDN:       "cn=reader,dc=example,dc=edu",
+		BindPassword: "reader",
+		UserBaseDN:   "ou=people,dc=example,dc=edu",
+		IDAttribute:  "entryUUID",
+		RoleMapping:  map[string]string{"staff": model.RoleTeacher},
+		DefaultRole:  model.RoleStudent,
+	}
+}
+
+// newLDAPFixture serves the directory and configures an authenticator for
+// it, adjusted by configure if given
+func newLDAPFixture(t *testing.T, directory []*ldaptest.Entry, configure func(*config.LDAPDirectoryConfig)) *ldapFixture {
+	t.Helper()
+	server, err := ldaptest.NewServer(directory)
+	if err != nil {
+		t.Fatalf("starting LDAP server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	cfg := testDirectoryConfig(server)
+	if configure != nil {
+		configure(&cfg)
+	}
+	db := openTestDB(t)
+	userService := newTestUserService(db)
+	return &ldapFixture{
+		db:            db,
+		server:        server,
+		authenticator: NewLDAPAuthenticator(cfg, repository.NewIdentityRepository(db), userService),
+		userService:   userService,
+	}
+}
+
+// person returns a directory entry for a user below ou=people
+func person(uid, password string, groups ...string) *ldaptest.Entry {
+	return &ldaptest.Entry{
+		DN: "uid=" + uid + ",ou=people,dc=example,dc=edu",
+		Attributes: map[string][]string{
+			"objectClass":  {"inetOrgPerson"},
+			"uid":          {uid},
+			"cn":           {uid},
+			"mail":         {uid + "@example.edu"},
+			"entryUUID":    {"uuid-" + uid},
+			"memberOf":     groups,
+			"userPassword": {password},
+		},
+	}
+}
+
+// reader is the search account of the test directories
+var reader = &ldaptest.Entry{DN: "cn=reader,dc=example,dc=edu", Attributes: map[string][]string{
+	"cn": {"reader"}, "userPassword": {"reader"},
+}}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	f := newLDAPFixture(t, ldaptest.SampleDirectory(), nil)
+
+	user, err := f.authenticator.Authenticate("alice", "password")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Username != "alice" || user.Email != "alice@example.edu" || user.FullName != "Alice Teacher" {
+		t.Errorf("provisioned %s <%s> %q, want alice <alice@example.edu> \"Alice Teacher\"", user.Username, user.Email, user.FullName)
+	}
+
+	// Later logins resolve the same user
+	again, err := f.authenticator.Authenticate("alice", "password")
+	if err != nil {
+		t.Fatalf("second Authenticate: %v", err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("second login resolved user %d, want %d", again.ID, user.ID)
+	}
+}
+
+func TestLDAPAuthenticateBindFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		login     string
+		password  string
+		configure func(*config.LDAPDirectoryConfig)
+		// stopped closes the server before logging in
+		stopped bool
+		// wantInvalid is set when the failure must read as wrong
+		// credentials; otherwise it must be reported as a directory error
+		wantInvalid bool
+	}{
+		{name: "wrong password", login: "alice", password: "wrong", wantInvalid: true},
+		{name: "empty password", login: "alice", password: "", wantInvalid: true},
+		{name: "unknown user", login: "mallory", password: "password", wantInvalid: true},
+		{name: "password of another user", login: "bob", password: "reader", wantInvalid: true},
+		{
+			name: "search account rejected", login: "alice", password: "password",
+			configure: func(cfg *config.LDAPDirectoryConfig) { cfg.BindPassword = "wrong" },
+		},
+		{name: "directory down", login: "alice", password: "password", stopped: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newLDAPFixture(t, ldaptest.SampleDirectory(), tc.configure)
+			if tc.stopped {
+				f.server.Close()
+			}
+
+			user, err := f.authenticator.Authenticate(tc.login, tc.password)
+			if err == nil {
+				t.Fatalf("Authenticate logged in as %s", user.Username)
+			}
+			if got := errors.Is(err, ErrInvalidCredentials); got != tc.wantInvalid {
+				t.Errorf("Authenticate = %v; invalid credentials: %v, want %v", err, got, tc.wantInvalid)
+			}
+
+			var users int64
+			if err := f.db.Model(&model.User{}).Count(&users).Error; err != nil {
+				t.Fatalf("counting users: %v", err)
+			}
+			if users != 0 {
+				t.Errorf("%d users provisioned by a failed login", users)
+			}
+		})
+	}
+}
+
+func TestLDAPFilterEscaping(t *testing.T) {
+	// The directory holds a single user, so that any login the filter
+	// matches as a wildcard would bind as alice with her password
+	directory := []*ldaptest.Entry{reader, person("alice", "password"), person("o(brien)*", "secret")}
+
+	tests := []struct {
+		login    string
+		password string
+		want     string
+	}{
+		{login: "*", password: "password"},
+		{login: "a*", password: "password"},
+		{login: "*lic*", password: "password"},
+		{login: "alice)(uid=*", password: "password"},
+		{login: "*)(objectClass=*", password: "password"},
+		{login: `alic\65`, password: "password"},
+		{login: "alice", password: "password", want: "alice"},
+		{login: "o(brien)*", password: "secret", want: "o(brien)*"},
+	}
+
+	f := newLDAPFixture(t, directory, nil)
+	for _, tc := range tests {
+		t.Run(tc.login, func(t *testing.T) {
+			user, err := f.authenticator.Authenticate(tc.login, tc.password)
+			if tc.want == "" {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("Authenticate = %v, %v; want ErrInvalidCredentials", user, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if user.Username != tc.want {
+				t.Errorf("logged in as %s, want %s", user.Username, tc.want)
+			}
+		})
+	}
+}
+
+func TestLDAPGroupRoleMapping(t *testing.T) {
+	staff := "cn=staff,ou=groups,dc=example,dc=edu"
+	tests := []struct {
+		name      string
+		groups    []string
+		configure func(*config.LDAPDirectoryConfig)
+		want      string
+	}{
+		{name: "mapped by common name", groups: []string{staff}, want: model.RoleTeacher},
+		{name: "unmapped group gets the default role", groups: []string{"cn=students,ou=groups,dc=example,dc=edu"}, want: model.RoleStudent},
+		{name: "no groups get the default role", want: model.RoleStudent},
+		{
+			name:   "mapped by DN, case-insensitively",
+			groups: []string{"CN=Admins,OU=Groups,DC=example,DC=edu"},
+			configure: func(cfg *config.LDAPDirectoryConfig) {
+				cfg.RoleMapping = map[string]string{"cn=admins,ou=groups,dc=example,dc=edu": model.RoleAdmin}
+			},
+			want: model.RoleAdmin,
+		},
+		{
+			name:   "first mapped group wins",
+			groups: []string{"cn=students,ou=groups,dc=example,dc=edu", staff},
+			configure: func(cfg *config.LDAPDirectoryConfig) {
+				cfg.RoleMapping = map[string]string{"students": model.RoleStudent, "staff": model.RoleTeacher}
+				cfg.DefaultRole = model.RoleAdmin
+			},
+			want: model.RoleStudent,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newLDAPFixture(t, []*ldaptest.Entry{reader, person("carol", "password", tc.groups...)}, tc.configure)
+			user, err := f.authenticator.Authenticate("carol", "password")
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if user.Role != tc.want {
+				t.Errorf("role = %s, want %s", user.Role, tc.want)
+			}
+		})
+	}
+}
+
+func TestLDAPGroupSearch(t *testing.T) {
+	// Without memberOf, groups are found by searching for the user's DN
+	carol := person("carol", "password")
+	delete(carol.Attributes, "memberOf")
+	directory := []*ldaptest.Entry{reader, carol,
+		{DN: "cn=staff,ou=groups,dc=example,dc=edu", Attributes: map[string][]string{
+			"objectClass": {"groupOfNames"}, "cn": {"staff"}, "member": {carol.DN},
+		}},
+	}
+
+	f := newLDAPFixture(t, directory, func(cfg *config.LDAPDirectoryConfig) {
+		cfg.GroupBaseDN = "ou=groups,dc=example,dc=edu"
+	})
+	user, err := f.authenticator.Authenticate("carol", "password")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Role != model.RoleTeacher {
+		t.Errorf("role = %s, want %s", user.Role, model.RoleTeacher)
+	}
+}
+
+func TestLDAPSyncRoles(t *testing.T) {
+	staff := "cn=staff,ou=groups,dc=example,dc=edu"
+	for _, sync := range []bool{false, true} {
+		name := "kept"
+		if sync {
+			name = "synced"
+		}
+		t.Run(name, func(t *testing.T) {
+			carol := person("carol", "password", staff)
+			f := newLDAPFixture(t, []*ldaptest.Entry{reader, carol}, func(cfg *config.LDAPDirectoryConfig) {
+				cfg.RoleMapping = map[string]string{"staff": model.RoleTeacher, "students": model.RoleStudent}
+				cfg.SyncRoles = sync
+			})
+			if _, err := f.authenticator.Authenticate("carol", "password"); err != nil {
+				t.Fatalf("first Authenticate: %v", err)
+			}
+
+			carol.Attributes["memberOf"] = []string{"cn=students,ou=groups,dc=example,dc=edu"}
+			user, err := f.authenticator.Authenticate("carol", "password")
+			if err != nil {
+				t.Fatalf("second Authenticate: %v", err)
+			}
+			want := model.RoleTeacher
+			if sync {
+				want = model.RoleStudent
+			}
+			if user.Role != want {
+				t.Errorf("role after moving groups = %s, want %s", user.Role, want)
+			}
+		})
+	}
+}
+
+func TestLDAPFallbackToLocal(t *testing.T) {
+	tests := []struct {
+		name     string
+		local    bool
+		stopped  bool
+		login    string
+		password string
+		want     string
+		wantErr  error
+	}{
+		{name: "local user unknown to the directory", login: "dave", password: "local-password", want: "dave"},
+		{name: "local user while the directory is down", stopped: true, login: "dave", password: "local-password", want: "dave"},
+		{name: "directory user", login: "alice", password: "password", want: "alice"},
+		{name: "local first, directory user", local: true, login: "alice", password: "password", want: "alice"},
+		{name: "local first, local user", local: true, login: "dave", password: "local-password", want: "dave"},
+		{name: "wrong password everywhere", login: "dave", password: "wrong", wantErr: ErrInvalidCredentials},
+		{name: "directory down and wrong password", stopped: true, login: "alice", password: "password", wantErr: ErrInvalidCredentials},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newLDAPFixture(t, ldaptest.SampleDirectory(), nil)
+			if err := f.userService.Create(&model.User{Username: "dave", Email: "dave@example.org", Password: "local-password"}); err != nil {
+				t.Fatalf("creating local user: %v", err)
+			}
+			local := NewLocalAuthenticator(f.userService)
+			if tc.local {
+				f.userService.SetAuthenticators(local, f.authenticator)
+			} else {
+				f.userService.SetAuthenticators(f.authenticator, local)
+			}
+			if tc.stopped {
+				f.server.Close()
+			}
+
+			user, err := f.userService.Authenticate(tc.login, tc.password)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Authenticate = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if user.Username != tc.want {
+				t.Errorf("logged in as %s, want %s", user.Username, tc.want)
+			}
+		})
+	}
+}
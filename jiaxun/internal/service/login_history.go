@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+)
+
+// maxLoginLength is how much of the username or email of an attempt is stored
+const maxLoginLength = 255
+
+// LoginHistoryService records successful and failed logins so that users
+// and administrators can review where an account was signed in from
+type LoginHistoryService struct {
+	repo        *repository.LoginEventRepository
+	userService *UserService
+	retention   time.Duration
+}
+
+// NewLoginHistoryService creates a new login history service instance
+func NewLoginHistoryService(repo *repository.LoginEventRepository, userService *UserService, retention time.Duration) *LoginHistoryService {
+	return &LoginHistoryService{
+		repo:        repo,
+		userService: userService,
+		retention:   retention,
+	}
+}
+
+// RecordSuccess records a login of a user that started the given session
+func (s *LoginHistoryService) RecordSuccess(user *model.User, sessionID string, client ClientInfo) error {
+	return s.record(&model.LoginEvent{
+		UserID:    &user.ID,
+		Login:     user.Username,
+		Success:   true,
+		SessionID: sessionID,
+	}, client)
+}
+
+// RecordFailure records a failed login with a username or email. The
+// event is attributed to the matching user, if there is one.
+func (s *LoginHistoryService) RecordFailure(login, reason string, client ClientInfo) error {
+	event := &model.LoginEvent{
+		Login:  login,
+		Reason: reason,
+	}
+	user, err := s.userService.FindByLogin(login)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	if user != nil {
+		event.UserID = &user.ID
+	}
+	return s.record(event, client)
+}
+
+// RecordUserFailure records a failed login of a known user, such as a
+// wrong second factor after a correct password
+func (s *LoginHistoryService) RecordUserFailure(user *model.User, reason string, client ClientInfo) error {
+	return s.record(&model.LoginEvent{
+		UserID: &user.ID,
+		Login:  user.Username,
+		Reason: reason,
+	}, client)
+}
+
+// List returns the paginated login history of a user
+func (s *LoginHistoryService) List(userID uint, page, pageSize int) ([]model.LoginEvent, int64, error) {
+	exists, err := s.userService.Exists(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !exists {
+		return nil, 0, ErrUserNotFound
+	}
+	return s.repo.ListByUser(userID, page, pageSize)
+}
+
+// PurgeExpired removes login events older than the retention period
+func (s *LoginHistoryService) PurgeExpired() error {
+	return s.repo.DeleteBefore(time.Now().Add(-s.retention))
+}
+
+func (s *LoginHistoryService) record(event *model.LoginEvent, client ClientInfo) error {
+	if len(event.Login) > maxLoginLength {
+		event.Login = strings.ToValidUTF8(event.Login[:maxLoginLength], "")
+	}
+	client = client.normalized()
+	event.IP = client.IP
+	event.UserAgent = client.UserAgent
+	event.CreatedAt = time.Now()
+	return s.repo.Create(event)
+}
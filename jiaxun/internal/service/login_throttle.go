@@ -0,0 +1,442 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// LoginThrottleService errors
+var (
+	ErrLoginThrottled       = errors.New("too many failed login attempts")
+	ErrLockoutEventNotFound = errors.New("lockout event not found")
+)
+
+// ThrottledError reports that a login attempt was refused and when the
+// next attempt will be considered. It matches ErrLoginThrottled.
+type ThrottledError struct {
+	RetryAfter time.Duration
+	// Locked is set for lockouts, as opposed to backoff between attempts
+	Locked bool
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrLoginThrottled, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap makes errors.Is(err, ErrLoginThrottled) hold
+func (e *ThrottledError) Unwrap() error {
+	return ErrLoginThrottled
+}
+
+// LoginAttemptStore keeps the failed login counters of accounts and client
+// addresses. The memory store suits a single instance; the database store
+// (repository.LoginAttemptRepository) is shared between instances. Counters
+// are incremented and read in one step, so that concurrent attempts each
+// see the ones before them.
+type LoginAttemptStore interface {
+	// Acquire counts an attempt in progress at now and returns the counters
+	// including it. The count starts over if the previous failure happened
+	// before since.
+	Acquire(key string, now, since time.Time) (*model.LoginAttempt, error)
+	// Release uncounts an attempt in progress that did not fail
+	Release(key string) error
+	// RecordFailure records that an attempt in progress failed at now and
+	// returns the counters
+	RecordFailure(key string, now time.Time) (*model.LoginAttempt, error)
+	// Lock locks a key until the given time and clears its failures
+	Lock(key string, until time.Time) error
+	// Reset forgets a key
+	Reset(key string) error
+	// Purge forgets keys whose last failure and lock both ended before the given time
+	Purge(before time.Time) error
+}
+
+// LoginThrottleService protects logins against password guessing. Failed
+// attempts are counted per account and per client address; beyond a few
+// free attempts each further attempt must wait exponentially longer, and
+// too many failures lock the account or address for a while.
+//
+// Attempts are counted as failures from the moment they are checked, so that
+// concurrent guesses cannot all pass the check before any of them failed.
+// Attempts that succeed or are abandoned are uncounted again.
+type LoginThrottleService struct {
+	store       LoginAttemptStore
+	repo        *repository.LoginAttemptRepository
+	userService *UserService
+	cfg         config.LoginThrottleConfig
+	now         func() time.Time
+}
+
+// NewLoginThrottleService creates a new login throttle service instance
+func NewLoginThrottleService(store LoginAttemptStore, repo *repository.LoginAttemptRepository, userService *UserService, cfg config.LoginThrottleConfig) *LoginThrottleService {
+	return &LoginThrottleService{
+		store:       store,
+		repo:        repo,
+		userService: userService,
+		cfg:         cfg,
+		now:         time.Now,
+	}
+}
+
+// Check starts a login for the given username or email from the given
+// address and returns a *ThrottledError if it must be refused right now.
+// Unless refused, the attempt counts as a failure until it is concluded with
+// RecordFailure, RecordSuccess or Release.
+func (s *LoginThrottleService) Check(login, ip string) error {
+	if !s.cfg.Enabled {
+		return nil
+	}
+
+	accountKey, _, err := s.accountKey(login)
+	if err != nil {
+		return err
+	}
+	return s.check(accountKey, ip)
+}
+
+// CheckUser starts the second login step of a user who passed the password
+// check, like Check
+func (s *LoginThrottleService) CheckUser(user *model.User, ip string) error {
+	if !s.cfg.Enabled {
+		return nil
+	}
+	return s.check(userKey(user.ID), ip)
+}
+
+// check counts an attempt of the account key and the address and returns a
+// *ThrottledError, uncounting it again, if either is backing off or locked
+func (s *LoginThrottleService) check(accountKey, ip string) error {
+	now := s.now()
+	since := now.Add(-s.cfg.Window())
+	account, err := s.store.Acquire(accountKey, now, since)
+	if err != nil {
+		return err
+	}
+	address, err := s.store.Acquire(ipKey(ip), now, since)
+	if err != nil {
+		return errors.Join(err, s.store.Release(accountKey))
+	}
+
+	// Report the longer wait if both are refused
+	refused := s.evaluate(account, s.cfg.AccountFreeAttempts, now)
+	if e := s.evaluate(address, s.cfg.IPFreeAttempts, now); e != nil && (refused == nil || e.RetryAfter > refused.RetryAfter) {
+		refused = e
+	}
+	if refused != nil {
+		// Refused attempts are not evaluated, so they do not count
+		if err := s.release(accountKey, ip); err != nil {
+			return err
+		}
+		return refused
+	}
+	return nil
+}
+
+// Release uncounts a login started with Check that neither failed nor
+// completed, e.g. as it continues with a second factor or ran into an error
+func (s *LoginThrottleService) Release(login, ip string) error {
+	if !s.cfg.Enabled {
+		return nil
+	}
+
+	accountKey, _, err := s.accountKey(login)
+	if err != nil {
+		return err
+	}
+	return s.release(accountKey, ip)
+}
+
+// ReleaseUser uncounts a second login step started with CheckUser, like Release
+func (s *LoginThrottleService) ReleaseUser(user *model.User, ip string) error {
+	if !s.cfg.Enabled {
+		return nil
+	}
+	return s.release(userKey(user.ID), ip)
+}
+
+// release uncounts an attempt of the account key and the address
+func (s *LoginThrottleService) release(accountKey, ip string) error {
+	return errors.Join(s.store.Release(accountKey), s.store.Release(ipKey(ip)))
+}
+
+// RecordFailure records that a login started with Check failed and locks
+// the account or address once its threshold is reached
+func (s *LoginThrottleService) RecordFailure(login, ip string) error {
+	if !s.cfg.Enabled {
+		return nil
+	}
+
+	accountKey, userID, err := s.accountKey(login)
+	if err != nil {
+		return err
+	}
+	return s.recordFailure(login, accountKey, userID, ip)
+}
+
+// RecordUserFailure counts a wrong second factor like a wrong password, so
+// that a stolen password does not allow guessing codes
+func (s *LoginThrottleService) RecordUserFailure(user *model.User, ip string) error {
+	if !s.cfg.Enabled {
+		return nil
+	}
+	return s.recordFailure(user.Username, userKey(user.ID), &user.ID, ip)
+}
+
+// recordFailure records a failure of the account key and the address and
+// locks them once their threshold is reached. The decision rests on the
+// counters returned with the update, which include concurrent attempts.
+func (s *LoginThrottleService) recordFailure(login, accountKey string, userID *uint, ip string) error {
+	now := s.now()
+
+	attempt, err := s.store.RecordFailure(accountKey, now)
+	if err != nil {
+		return err
+	}
+	if attempt.Failures >= s.cfg.AccountLockoutThreshold {
+		event := &model.LockoutEvent{
+			Kind:   model.LockoutKindAccount,
+			Key:    accountKey,
+			UserID: userID,
+		}
+		if err := s.lock(event, attempt, login, ip, now); err != nil {
+			return err
+		}
+	}
+
+	attempt, err = s.store.RecordFailure(ipKey(ip), now)
+	if err != nil {
+		return err
+	}
+	if attempt.Failures >= s.cfg.IPLockoutThreshold {
+		event := &model.LockoutEvent{
+			Kind: model.LockoutKindIP,
+			Key:  ipKey(ip),
+		}
+		if err := s.lock(event, attempt, login, ip, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordSuccess clears the failures of the account after a successful
+// login, second factor included, and uncounts the attempt of the address.
+// The address keeps its failures so that an attacker cannot reset them by
+// logging into an account of their own.
+func (s *LoginThrottleService) RecordSuccess(user *model.User, ip string) error {
+	if !s.cfg.Enabled {
+		return nil
+	}
+	return errors.Join(s.store.Reset(userKey(user.ID)), s.store.Release(ipKey(ip)))
+}
+
+// ListLockouts returns paginated lockout events, optionally only those
+// still in effect
+func (s *LoginThrottleService) ListLockouts(page, pageSize int, activeOnly bool) ([]model.LockoutEvent, int64, error) {
+	return s.repo.ListLockoutEvents(page, pageSize, activeOnly, s.now())
+}
+
+// Unlock lifts the lockout of the account or address behind an event and
+// clears its failures
+func (s *LoginThrottleService) Unlock(eventID, adminID uint) (*model.LockoutEvent, error) {
+	event, err := s.repo.GetLockoutEvent(eventID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLockoutEventNotFound
+		}
+		return nil, err
+	}
+
+	if err := s.store.Reset(event.Key); err != nil {
+		return nil, err
+	}
+	if err := s.repo.MarkUnlocked(event.Key, s.now(), adminID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetLockoutEvent(eventID)
+}
+
+// UnlockUser lifts a lockout of a user's account
+func (s *LoginThrottleService) UnlockUser(userID, adminID uint) error {
+	exists, err := s.userService.Exists(userID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	key := userKey(userID)
+	if err := s.store.Reset(key); err != nil {
+		return err
+	}
+	return s.repo.MarkUnlocked(key, s.now(), adminID)
+}
+
+// PurgeExpired forgets counters that no longer affect any login
+func (s *LoginThrottleService) PurgeExpired() error {
+	return s.store.Purge(s.now().Add(-s.cfg.Window()))
+}
+
+// evaluate returns why an attempt is refused at now, if it is, given the
+// counters of its key including it and the free attempts of the key
+func (s *LoginThrottleService) evaluate(attempt *model.LoginAttempt, freeAttempts int, now time.Time) *ThrottledError {
+	if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+		return &ThrottledError{RetryAfter: attempt.LockedUntil.Sub(now), Locked: true}
+	}
+
+	// The failures before this attempt, in progress ones included
+	excess := attempt.Failures - 1 - freeAttempts
+	if excess < 0 {
+		return nil
+	}
+
+	// The wait doubles with every failure beyond the free attempts
+	delay := s.cfg.MaxDelay()
+	if excess < 32 {
+		delay = min(s.cfg.BaseDelay()<<excess, s.cfg.MaxDelay())
+	}
+	if next := attempt.LastFailureAt.Add(delay); now.Before(next) {
+		return &ThrottledError{RetryAfter: next.Sub(now)}
+	}
+	return nil
+}
+
+// lock locks the key of the event and records the event
+func (s *LoginThrottleService) lock(event *model.LockoutEvent, attempt *model.LoginAttempt, login, ip string, now time.Time) error {
+	until := now.Add(s.cfg.LockoutDuration())
+	if err := s.store.Lock(event.Key, until); err != nil {
+		return err
+	}
+
+	event.Login = login
+	event.IP = ip
+	event.Failures = attempt.Failures
+	event.LockedUntil = until
+	event.CreatedAt = now
+	log.Printf("Locked %s %s after %d failed logins until %s", event.Kind, event.Key, attempt.Failures, until.Format(time.RFC3339))
+	return s.repo.CreateLockoutEvent(event)
+}
+
+// accountKey returns the throttle key of a login. Existing users are keyed
+// by ID so that their username and email share one count; unknown logins
+// are throttled alike so that responses do not reveal which accounts exist.
+func (s *LoginThrottleService) accountKey(login string) (string, *uint, error) {
+	user, err := s.userService.FindByLogin(login)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return "login:" + strings.ToLower(login), nil, nil
+		}
+		return "", nil, err
+	}
+	return userKey(user.ID), &user.ID, nil
+}
+
+func userKey(id uint) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// MemoryLoginAttemptStore keeps login attempt counters in process memory
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempt
+}
+
+// NewMemoryLoginAttemptStore creates an empty in-memory store
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: map[string]model.LoginAttempt{}}
+}
+
+// Acquire counts an attempt in progress at now
+func (m *MemoryLoginAttemptStore) Acquire(key string, now, since time.Time) (*model.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, ok := m.attempts[key]
+	if !ok {
+		attempt = model.LoginAttempt{Key: key}
+	}
+	if attempt.LastFailureAt.Before(since) {
+		attempt.Failures = 0
+		attempt.LastFailureAt = now
+	}
+	attempt.Failures++
+	m.attempts[key] = attempt
+	return &attempt, nil
+}
+
+// Release uncounts an attempt in progress
+func (m *MemoryLoginAttemptStore) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if attempt, ok := m.attempts[key]; ok && attempt.Failures > 0 {
+		attempt.Failures--
+		m.attempts[key] = attempt
+	}
+	return nil
+}
+
+// RecordFailure records that an attempt in progress failed at now
+func (m *MemoryLoginAttemptStore) RecordFailure(key string, now time.Time) (*model.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A key reset while the attempt was in progress counts it anew
+	attempt, ok := m.attempts[key]
+	if !ok {
+		attempt = model.LoginAttempt{Key: key, Failures: 1}
+	}
+	attempt.LastFailureAt = now
+	m.attempts[key] = attempt
+	return &attempt, nil
+}
+
+// Lock locks a key until the given time and clears its failures
+func (m *MemoryLoginAttemptStore) Lock(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt := m.attempts[key]
+	attempt.Key = key
+	attempt.Failures = 0
+	attempt.LockedUntil = &until
+	m.attempts[key] = attempt
+	return nil
+}
+
+// Reset forgets a key
+func (m *MemoryLoginAttemptStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
+
+// Purge forgets keys whose last failure and lock both ended before the given time
+func (m *MemoryLoginAttemptStore) Purge(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, attempt := range m.attempts {
+		if attempt.LastFailureAt.Before(before) && (attempt.LockedUntil == nil || attempt.LockedUntil.Before(before)) {
+			delete(m.attempts, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+)
+
+// testThrottleConfig allows accounts 3 free attempts and addresses 5, then
+// waits 1s, 2s, 4s, 4s... and locks accounts after 7 failures
+var testThrottleConfig = config.LoginThrottleConfig{
+	Enabled:                 true,
+	Store:                   config.ThrottleStoreMemory,
+	AccountFreeAttempts:     3,
+	AccountLockoutThreshold: 7,
+	IPFreeAttempts:          5,
+	IPLockoutThreshold:      9,
+	BaseDelaySeconds:        1,
+	MaxDelaySeconds:         4,
+	LockoutMinutes:          15,
+	WindowMinutes:           60,
+}
+
+// throttleFixture is a login throttle with a fixed clock and a user
+type throttleFixture struct {
+	service *LoginThrottleService
+	repo    *repository.LoginAttemptRepository
+	user    *model.User
+	clock   time.Time
+}
+
+// newThrottleFixture returns a throttle keeping its counters in memory, or
+// in the database if shared is set
+func newThrottleFixture(t *testing.T, shared bool) *throttleFixture {
+	t.Helper()
+	db := openTestDB(t)
+	userService := newTestUserService(db)
+	user := &model.User{Username: "ada", Email: "ada@example.org", Password: "password"}
+	if err := userService.Create(user); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	repo := repository.NewLoginAttemptRepository(db)
+	var store LoginAttemptStore = NewMemoryLoginAttemptStore()
+	if shared {
+		store = repo
+	}
+	f := &throttleFixture{
+		service: NewLoginThrottleService(store, repo, userService, testThrottleConfig),
+		repo:    repo,
+		user:    user,
+		clock:   time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC),
+	}
+	f.service.now = func() time.Time { return f.clock }
+	return f
+}
+
+// fail makes a login that fails its password check
+func (f *throttleFixture) fail(t *testing.T, login, ip string) {
+	t.Helper()
+	if err := f.service.Check(login, ip); err != nil {
+		t.Fatalf("Check(%s, %s) at %s: %v", login, ip, f.clock.Format(time.TimeOnly), err)
+	}
+	if err := f.service.RecordFailure(login, ip); err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+}
+
+// refused returns the refusal of a login, failing the test if it is allowed
+func (f *throttleFixture) refused(t *testing.T, login, ip string) *ThrottledError {
+	t.Helper()
+	err := f.service.Check(login, ip)
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("Check(%s, %s) at %s = %v, want a refusal", login, ip, f.clock.Format(time.TimeOnly), err)
+	}
+	return throttled
+}
+
+// forEachStore runs a test with counters kept in memory and in the database
+func forEachStore(t *testing.T, test func(t *testing.T, f *throttleFixture)) {
+	for name, shared := range map[string]bool{"memory": false, "database": true} {
+		t.Run(name, func(t *testing.T) {
+			test(t, newThrottleFixture(t, shared))
+		})
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	forEachStore(t, func(t *testing.T, f *throttleFixture) {
+		for i := 0; i < testThrottleConfig.AccountFreeAttempts; i++ {
+			f.fail(t, "ada", "192.0.2.1")
+		}
+
+		// Each failure beyond the free attempts doubles the wait, up to the maximum
+		for _, wait := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+			refused := f.refused(t, "ada", "192.0.2.2")
+			if refused.RetryAfter != wait || refused.Locked {
+				t.Fatalf("refusal = %+v, want a wait of %s", refused, wait)
+			}
+			// Refused attempts do not lengthen the wait
+			f.clock = f.clock.Add(wait - time.Millisecond)
+			if refused := f.refused(t, "ada", "192.0.2.2"); refused.RetryAfter != time.Millisecond {
+				t.Fatalf("refusal = %+v, want a wait of 1ms", refused)
+			}
+			f.clock = f.clock.Add(time.Millisecond)
+			f.fail(t, "ada", "192.0.2.2")
+		}
+
+		// The account is keyed by user, whichever login is used
+		refused := f.refused(t, "ada@example.org", "192.0.2.3")
+		if !refused.Locked || refused.RetryAfter != 15*time.Minute {
+			t.Fatalf("refusal = %+v, want a 15 minute lockout", refused)
+		}
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	forEachStore(t, func(t *testing.T, f *throttleFixture) {
+		for i := 0; i < testThrottleConfig.AccountLockoutThreshold; i++ {
+			f.fail(t, "ada", "192.0.2.1")
+			f.clock = f.clock.Add(time.Minute)
+		}
+		lockedAt := f.clock.Add(-time.Minute)
+
+		refused := f.refused(t, "ada", "192.0.2.2")
+		if want := lockedAt.Add(15 * time.Minute).Sub(f.clock); !refused.Locked || refused.RetryAfter != want {
+			t.Fatalf("refusal = %+v, want locked for %s", refused, want)
+		}
+		events, total, err := f.service.ListLockouts(1, 10, true)
+		if err != nil {
+			t.Fatalf("ListLockouts: %v", err)
+		}
+		if total != 1 || events[0].Kind != model.LockoutKindAccount || events[0].UserID == nil || *events[0].UserID != f.user.ID || events[0].Failures != testThrottleConfig.AccountLockoutThreshold {
+			t.Fatalf("lockouts = %+v, want the account locked after %d failures", events, testThrottleConfig.AccountLockoutThreshold)
+		}
+
+		// The lockout ends on its own, with the failures cleared
+		f.clock = lockedAt.Add(15 * time.Minute)
+		for i := 0; i < testThrottleConfig.AccountFreeAttempts; i++ {
+			f.fail(t, "ada", "192.0.2.3")
+		}
+
+		// Or earlier, by an administrator, once the failures above are forgotten
+		f.clock = f.clock.Add(2 * time.Hour)
+		for i := 0; i < testThrottleConfig.AccountLockoutThreshold; i++ {
+			f.fail(t, "ada", "192.0.2.4")
+			f.clock = f.clock.Add(time.Minute)
+		}
+		f.refused(t, "ada", "192.0.2.5")
+		if err := f.service.UnlockUser(f.user.ID, 1); err != nil {
+			t.Fatalf("UnlockUser: %v", err)
+		}
+		f.fail(t, "ada", "192.0.2.5")
+	})
+}
+
+func TestLoginAddressLimit(t *testing.T) {
+	forEachStore(t, func(t *testing.T, f *throttleFixture) {
+		// Guessing one password for many accounts is throttled by address
+		logins := []string{"alan", "barbara", "claude", "dennis", "edsger", "frances", "grace", "hedy", "ivan"}
+		for _, login := range logins[:testThrottleConfig.IPFreeAttempts] {
+			f.fail(t, login, "192.0.2.1")
+		}
+		refused := f.refused(t, "john", "192.0.2.1")
+		if refused.Locked || refused.RetryAfter != time.Second {
+			t.Fatalf("refusal = %+v, want a wait of 1s", refused)
+		}
+		// Other addresses are not affected
+		f.fail(t, "john", "192.0.2.2")
+
+		for _, login := range logins[testThrottleConfig.IPFreeAttempts:] {
+			f.clock = f.clock.Add(4 * time.Second)
+			f.fail(t, login, "192.0.2.1")
+		}
+		refused = f.refused(t, "ada", "192.0.2.1")
+		if !refused.Locked {
+			t.Fatalf("refusal = %+v, want the address locked", refused)
+		}
+		events, _, err := f.service.ListLockouts(1, 10, true)
+		if err != nil {
+			t.Fatalf("ListLockouts: %v", err)
+		}
+		if len(events) != 1 || events[0].Kind != model.LockoutKindIP || events[0].Key != "ip:192.0.2.1" {
+			t.Fatalf("lockouts = %+v, want the address locked", events)
+		}
+
+		// A successful login does not clear the failures of the address
+		if err := f.service.RecordSuccess(f.user, "192.0.2.1"); err != nil {
+			t.Fatalf("RecordSuccess: %v", err)
+		}
+		f.refused(t, "ada", "192.0.2.1")
+	})
+}
+
+func TestLoginResetAfterSecondFactor(t *testing.T) {
+	forEachStore(t, func(t *testing.T, f *throttleFixture) {
+		for i := 0; i < testThrottleConfig.AccountFreeAttempts; i++ {
+			f.fail(t, "ada", "192.0.2.1")
+		}
+		f.clock = f.clock.Add(time.Second)
+
+		// The password is right, but the login waits for the second factor
+		if err := f.service.Check("ada", "192.0.2.1"); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		if err := f.service.Release("ada", "192.0.2.1"); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+		// A wrong code counts like a wrong password
+		if err := f.service.CheckUser(f.user, "192.0.2.1"); err != nil {
+			t.Fatalf("CheckUser: %v", err)
+		}
+		if err := f.service.RecordUserFailure(f.user, "192.0.2.1"); err != nil {
+			t.Fatalf("RecordUserFailure: %v", err)
+		}
+		if refused := f.refused(t, "ada", "192.0.2.1"); refused.RetryAfter != 2*time.Second {
+			t.Fatalf("refusal after a wrong code = %+v, want a wait of 2s", refused)
+		}
+		refused := f.service.CheckUser(f.user, "192.0.2.1")
+		if !errors.Is(refused, ErrLoginThrottled) {
+			t.Fatalf("CheckUser = %v, want a refusal", refused)
+		}
+
+		// Only the second factor clears the failures of the account
+		f.clock = f.clock.Add(2 * time.Second)
+		if err := f.service.CheckUser(f.user, "192.0.2.1"); err != nil {
+			t.Fatalf("CheckUser: %v", err)
+		}
+		if err := f.service.RecordSuccess(f.user, "192.0.2.1"); err != nil {
+			t.Fatalf("RecordSuccess: %v", err)
+		}
+		for i := 0; i < testThrottleConfig.AccountFreeAttempts; i++ {
+			f.fail(t, "ada", "192.0.2.2")
+		}
+	})
+}
+
+func TestLoginConcurrentAttempts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, f *throttleFixture) {
+		// Attempts in progress count, so they cannot all pass the check
+		// before the first of them fails
+		for i := 0; i < testThrottleConfig.AccountFreeAttempts; i++ {
+			if err := f.service.Check("ada", "192.0.2.1"); err != nil {
+				t.Fatalf("attempt %d: %v", i+1, err)
+			}
+		}
+		f.refused(t, "ada", "192.0.2.1")
+
+		// Concluded attempts no longer count unless they failed
+		if err := f.service.Release("ada", "192.0.2.1"); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+		if err := f.service.Check("ada", "192.0.2.1"); err != nil {
+			t.Fatalf("attempt after a release: %v", err)
+		}
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		f := newThrottleFixture(t, false)
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		allowed := 0
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := f.service.Check("ada", "192.0.2.1")
+				if err == nil {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+					err = f.service.RecordFailure("ada", "192.0.2.1")
+				}
+				if err != nil && !errors.Is(err, ErrLoginThrottled) {
+					t.Errorf("attempt: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if allowed != testThrottleConfig.AccountFreeAttempts {
+			t.Errorf("%d parallel attempts were allowed, want %d", allowed, testThrottleConfig.AccountFreeAttempts)
+		}
+	})
+}
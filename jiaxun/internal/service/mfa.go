@@ -0,0 +1,428 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"image/png"
+	"strconv"
+	"strings"
+	"time"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+// MFAService errors
+var (
+	ErrMFAAlreadyEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled         = errors.New("two-factor authentication is not enabled")
+	ErrMFANotSetUp           = errors.New("two-factor authentication has not been set up")
+	ErrInvalidMFACode        = errors.New("invalid two-factor authentication code")
+	ErrInvalidChallengeToken = errors.New("invalid or expired two-factor challenge")
+)
+
+const (
+	// totpIssuer is shown by authenticator apps next to the account name
+	totpIssuer = "Jiaxun"
+	// totpPeriod is the length of a TOTP time step in seconds
+	totpPeriod = 30
+	// recoveryCodeCount is the number of recovery codes generated at a time
+	recoveryCodeCount = 10
+	// challengeTTL is how long the second login step may take
+	challengeTTL = 5 * time.Minute
+	// challengeMaxAttempts is how many codes can be tried with a challenge
+	// before the user must log in again
+	challengeMaxAttempts = 5
+	// challengeAudience distinguishes challenge tokens from access tokens
+	// signed with the same secret
+	challengeAudience = "mfa-challenge"
+)
+
+// TOTPSetup is what a user needs to add their account to an authenticator app
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+	// QRCode is a PNG image encoding URI, serialized as base64
+	QRCode []byte `json:"qr_png"`
+}
+
+// MFAStatus describes the two-factor setup of a user
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int64      `json:"recovery_codes_remaining"`
+	// Required is set when the account must use two-factor authentication
+	Required bool `json:"required"`
+}
+
+// MFAService handles TOTP two-factor authentication (RFC 6238), recovery
+// codes and the second step of the login flow
+type MFAService struct {
+	repo              *repository.MFARepository
+	userService       *UserService
+	rbacService       *RBACService
+	secret            []byte
+	requirePrivileged bool
+	now               func() time.Time
+}
+
+// NewMFAService creates a new MFA service instance
+func NewMFAService(repo *repository.MFARepository, userService *UserService, rbacService *RBACService, secret string, requirePrivileged bool) *MFAService {
+	return &MFAService{
+		repo:              repo,
+		userService:       userService,
+		rbacService:       rbacService,
+		secret:            []byte(secret),
+		requirePrivileged: requirePrivileged,
+		now:               time.Now,
+	}
+}
+
+// IsEnabled reports whether a user has completed TOTP enrollment
+func (s *MFAService) IsEnabled(user *model.User) bool {
+	return user.TOTPEnabledAt != nil
+}
+
+// SetupRequired reports whether a user must enroll before using privileged features
+func (s *MFAService) SetupRequired(user *model.User) (bool, error) {
+	if s.IsEnabled(user) {
+		return false, nil
+	}
+	return s.isRequired(user)
+}
+
+// isRequired reports whether two-factor authentication is mandatory for a
+// user, which is the case for roles holding any permission
+func (s *MFAService) isRequired(user *model.User) (bool, error) {
+	if !s.requirePrivileged {
+		return false, nil
+	}
+	return s.rbacService.IsPrivileged(user.Role)
+}
+
+// Status returns the two-factor setup of a user
+func (s *MFAService) Status(userID uint) (*MFAStatus, error) {
+	user, err := s.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	required, err := s.isRequired(user)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{
+		Enabled:   s.IsEnabled(user),
+		EnabledAt: user.TOTPEnabledAt,
+		Required:  required,
+	}
+	if status.Enabled {
+		if status.RecoveryCodesRemaining, err = s.repo.CountUnusedRecoveryCodes(userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Setup starts TOTP enrollment by generating a new secret. Enrollment
+// completes once Enable is called with a code from the authenticator.
+func (s *MFAService) Setup(userID uint) (*TOTPSetup, error) {
+	user, err := s.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.IsEnabled(user) {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveTOTPSecret(userID, key.Secret()); err != nil {
+		return nil, err
+	}
+	return &TOTPSetup{
+		Secret: key.Secret(),
+		URI:    key.URL(),
+		QRCode: buf.Bytes(),
+	}, nil
+}
+
+// Enable completes enrollment after checking a code from the authenticator
+// and returns the user's recovery codes. They are only shown this once.
+func (s *MFAService) Enable(userID uint, code string) ([]string, error) {
+	user, err := s.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.IsEnabled(user) {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotSetUp
+	}
+	if err := s.checkTOTP(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.EnableTOTP(userID, s.now(), hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off after re-checking both the
+// password and a second factor
+func (s *MFAService) Disable(userID uint, password, code string) error {
+	user, err := s.userService.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if !s.IsEnabled(user) {
+		return ErrMFANotEnabled
+	}
+	if err := CheckPassword(password, user.Password); err != nil {
+		return ErrInvalidCredentials
+	}
+	if err := s.checkSecondFactor(user, code); err != nil {
+		return err
+	}
+	return s.repo.DisableTOTP(userID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of a user after
+// checking a TOTP code
+func (s *MFAService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	user, err := s.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.IsEnabled(user) {
+		return nil, ErrMFANotEnabled
+	}
+	if err := s.checkTOTP(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// NewChallenge issues the short-lived token that links the two login steps
+// of a user who passed the password check. The token is single-use and only
+// allows a few codes to be tried.
+func (s *MFAService) NewChallenge(user *model.User) (string, time.Time, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := s.now()
+	expiresAt := now.Add(challengeTTL)
+	claims := jwt.RegisteredClaims{
+		ID:        jti,
+		Subject:   strconv.FormatUint(uint64(user.ID), 10),
+		Audience:  jwt.ClaimStrings{challengeAudience},
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(now),
+		Issuer:    "jiaxun",
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := s.repo.CreateChallenge(&model.MFAChallenge{
+		JTI:       jti,
+		UserID:    user.ID,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// ChallengeUser returns the user a pending challenge token was issued to,
+// so that the second login step can be throttled before the code is checked
+func (s *MFAService) ChallengeUser(challengeToken string) (*model.User, error) {
+	jti, user, err := s.parseChallenge(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.repo.GetChallenge(jti)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidChallengeToken
+		}
+		return nil, err
+	}
+	if challenge.UserID != user.ID || challenge.Attempts >= challengeMaxAttempts {
+		return nil, ErrInvalidChallengeToken
+	}
+	return user, nil
+}
+
+// VerifyChallenge completes a two-step login with a TOTP or recovery code
+// and returns the authenticated user. If the challenge is valid but the
+// code is not, the user is returned along with the error so that the
+// failed attempt can be attributed. A challenge is used up by a valid code
+// or by too many invalid ones.
+func (s *MFAService) VerifyChallenge(challengeToken, code string) (*model.User, error) {
+	jti, user, err := s.parseChallenge(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the attempt before checking the code, so that concurrent
+	// attempts cannot exceed the limit
+	allowed, err := s.repo.UseChallengeAttempt(jti, challengeMaxAttempts, s.now())
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrInvalidChallengeToken
+	}
+
+	if err := s.checkSecondFactor(user, code); err != nil {
+		return user, err
+	}
+	if err := s.repo.DeleteChallenge(jti); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// PurgeExpired removes challenges that can no longer be used
+func (s *MFAService) PurgeExpired() error {
+	return s.repo.DeleteExpiredChallenges(s.now())
+}
+
+// parseChallenge validates a challenge token and returns its jti and the
+// user it was issued to, who must still have two-factor authentication
+func (s *MFAService) parseChallenge(challengeToken string) (string, *model.User, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(challengeToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(challengeAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(s.now),
+	)
+	if err != nil || claims.ID == "" {
+		return "", nil, ErrInvalidChallengeToken
+	}
+
+	id, err := strconv.ParseUint(claims.Subject, 10, 32)
+	if err != nil {
+		return "", nil, ErrInvalidChallengeToken
+	}
+	user, err := s.userService.GetByID(uint(id))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return "", nil, ErrInvalidChallengeToken
+		}
+		return "", nil, err
+	}
+	if !s.IsEnabled(user) {
+		return "", nil, ErrInvalidChallengeToken
+	}
+	return claims.ID, user, nil
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code
+func (s *MFAService) checkSecondFactor(user *model.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == otp.DigitsSix.Length() {
+		return s.checkTOTP(user, code)
+	}
+
+	used, err := s.repo.UseRecoveryCode(user.ID, hashToken(normalizeRecoveryCode(code)), s.now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// checkTOTP validates a TOTP code, allowing one step of clock drift either
+// way. Each time step can only be used once.
+func (s *MFAService) checkTOTP(user *model.User, code string) error {
+	current := uint64(s.now().Unix()) / totpPeriod
+	for _, step := range []uint64{current - 1, current, current + 1} {
+		valid, err := hotp.ValidateCustom(strings.TrimSpace(code), step, user.TOTPSecret, hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil || !valid {
+			continue
+		}
+		fresh, err := s.repo.AdvanceTOTPStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			// Replay of an already accepted code
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+	return ErrInvalidMFACode
+}
+
+// generateRecoveryCodes returns new recovery codes together with their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashToken(raw)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode strips the formatting of a recovery code as typed by a user
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"github.com/pquerna/otp/totp"
+)
+
+// mfaFixture is an MFA service with a fixed clock and a user who enrolled
+type mfaFixture struct {
+	service       *MFAService
+	user          *model.User
+	secret        string
+	recoveryCodes []string
+	clock         time.Time
+}
+
+func newMFAFixture(t *testing.T) *mfaFixture {
+	t.Helper()
+	db := openTestDB(t)
+	userService := newTestUserService(db)
+	rbacService := NewRBACService(repository.NewRoleRepository(db), userService)
+	user := &model.User{Username: "ada", Email: "ada@example.org", Password: "password"}
+	if err := userService.Create(user); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	f := &mfaFixture{
+		service: NewMFAService(repository.NewMFARepository(db), userService, rbacService, "test secret", false),
+		clock:   time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC),
+	}
+	f.service.now = func() time.Time { return f.clock }
+	setup, err := f.service.Setup(user.ID)
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	f.secret = setup.Secret
+	if f.recoveryCodes, err = f.service.Enable(user.ID, f.code(t)); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	if f.user, err = userService.GetByID(user.ID); err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	// The code used to enroll cannot log in, so start at the next step
+	f.clock = f.clock.Add(totpPeriod * time.Second)
+	return f
+}
+
+// code returns the TOTP code of the current time step
+func (f *mfaFixture) code(t *testing.T) string {
+	t.Helper()
+	code, err := totp.GenerateCode(f.secret, f.clock)
+	if err != nil {
+		t.Fatalf("GenerateCode: %v", err)
+	}
+	return code
+}
+
+// challenge starts a second login step
+func (f *mfaFixture) challenge(t *testing.T) string {
+	t.Helper()
+	token, _, err := f.service.NewChallenge(f.user)
+	if err != nil {
+		t.Fatalf("NewChallenge: %v", err)
+	}
+	return token
+}
+
+func TestVerifyChallengeTOTPReplay(t *testing.T) {
+	f := newMFAFixture(t)
+	code := f.code(t)
+	if _, err := f.service.VerifyChallenge(f.challenge(t), code); err != nil {
+		t.Fatalf("VerifyChallenge: %v", err)
+	}
+
+	// The code stays valid for its time step, but is only accepted once
+	user, err := f.service.VerifyChallenge(f.challenge(t), code)
+	if !errors.Is(err, ErrInvalidMFACode) || user == nil || user.ID != f.user.ID {
+		t.Errorf("replaying the code = %v, %v, want ErrInvalidMFACode for the user", user, err)
+	}
+
+	// Codes of the next step are accepted, after which earlier steps are not
+	previous := code
+	f.clock = f.clock.Add(totpPeriod * time.Second)
+	if _, err := f.service.VerifyChallenge(f.challenge(t), f.code(t)); err != nil {
+		t.Fatalf("VerifyChallenge with the next code: %v", err)
+	}
+	if _, err := f.service.VerifyChallenge(f.challenge(t), previous); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("code of an earlier step = %v, want ErrInvalidMFACode", err)
+	}
+}
+
+func TestVerifyChallengeSingleUse(t *testing.T) {
+	f := newMFAFixture(t)
+	challenge := f.challenge(t)
+	if user, err := f.service.ChallengeUser(challenge); err != nil || user.ID != f.user.ID {
+		t.Fatalf("ChallengeUser = %v, %v, want the user", user, err)
+	}
+	if _, err := f.service.VerifyChallenge(challenge, f.code(t)); err != nil {
+		t.Fatalf("VerifyChallenge: %v", err)
+	}
+
+	f.clock = f.clock.Add(totpPeriod * time.Second)
+	if _, err := f.service.ChallengeUser(challenge); !errors.Is(err, ErrInvalidChallengeToken) {
+		t.Errorf("ChallengeUser after use = %v, want ErrInvalidChallengeToken", err)
+	}
+	if _, err := f.service.VerifyChallenge(challenge, f.code(t)); !errors.Is(err, ErrInvalidChallengeToken) {
+		t.Errorf("reusing the challenge = %v, want ErrInvalidChallengeToken", err)
+	}
+
+	// Challenges expire, however many attempts are left
+	expiring := f.challenge(t)
+	f.clock = f.clock.Add(challengeTTL + time.Second)
+	if _, err := f.service.VerifyChallenge(expiring, f.code(t)); !errors.Is(err, ErrInvalidChallengeToken) {
+		t.Errorf("expired challenge = %v, want ErrInvalidChallengeToken", err)
+	}
+}
+
+func TestVerifyChallengeAttemptLimit(t *testing.T) {
+	f := newMFAFixture(t)
+	challenge := f.challenge(t)
+	for i := 0; i < challengeMaxAttempts; i++ {
+		if _, err := f.service.ChallengeUser(challenge); err != nil {
+			t.Fatalf("ChallengeUser before attempt %d: %v", i+1, err)
+		}
+		if _, err := f.service.VerifyChallenge(challenge, "aaaaa-aaaaa"); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("attempt %d = %v, want ErrInvalidMFACode", i+1, err)
+		}
+	}
+
+	// Even the right code no longer completes the login
+	if _, err := f.service.ChallengeUser(challenge); !errors.Is(err, ErrInvalidChallengeToken) {
+		t.Errorf("ChallengeUser after %d attempts = %v, want ErrInvalidChallengeToken", challengeMaxAttempts, err)
+	}
+	if _, err := f.service.VerifyChallenge(challenge, f.code(t)); !errors.Is(err, ErrInvalidChallengeToken) {
+		t.Errorf("right code after %d attempts = %v, want ErrInvalidChallengeToken", challengeMaxAttempts, err)
+	}
+	// The code itself was not used up by the refused attempt
+	if _, err := f.service.VerifyChallenge(f.challenge(t), f.code(t)); err != nil {
+		t.Errorf("VerifyChallenge with a new challenge: %v", err)
+	}
+}
+
+func TestVerifyChallengeRecoveryCode(t *testing.T) {
+	f := newMFAFixture(t)
+	if len(f.recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(f.recoveryCodes), recoveryCodeCount)
+	}
+
+	// Recovery codes are accepted however they are typed, but only once
+	typed := " " + strings.ToUpper(strings.ReplaceAll(f.recoveryCodes[0], "-", " ")) + " "
+	if _, err := f.service.VerifyChallenge(f.challenge(t), typed); err != nil {
+		t.Fatalf("VerifyChallenge with a recovery code: %v", err)
+	}
+	if _, err := f.service.VerifyChallenge(f.challenge(t), f.recoveryCodes[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("reusing a recovery code = %v, want ErrInvalidMFACode", err)
+	}
+	status, err := f.service.Status(f.user.ID)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Errorf("%d recovery codes remaining, want %d", status.RecoveryCodesRemaining, recoveryCodeCount-1)
+	}
+
+	// New codes replace the old ones
+	codes, err := f.service.RegenerateRecoveryCodes(f.user.ID, f.code(t))
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes: %v", err)
+	}
+	if _, err := f.service.VerifyChallenge(f.challenge(t), f.recoveryCodes[1]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("replaced recovery code = %v, want ErrInvalidMFACode", err)
+	}
+	if _, err := f.service.VerifyChallenge(f.challenge(t), codes[0]); err != nil {
+		t.Errorf("VerifyChallenge with a new recovery code: %v", err)
+	}
+}
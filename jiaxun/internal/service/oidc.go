@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/model"
+	"jiaxun/internal/oidc"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// OIDCService errors
+var (
+	ErrOIDCProviderNotFound = errors.New("unknown identity provider")
+	ErrInvalidOIDCState     = errors.New("invalid or expired login state")
+	ErrOIDCEmailNotVerified = errors.New("identity provider did not verify the email address")
+	ErrOIDCAccountNotFound  = errors.New("no account matches the identity")
+)
+
+// OIDCStateTTL is how long a user may take to log in at the provider
+const OIDCStateTTL = 10 * time.Minute
+
+// OIDCProviderInfo describes a provider users can log in with
+type OIDCProviderInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// OIDCService logs users in through OpenID Connect providers. Provider
+// accounts are linked to users by their verified email on first login and
+// by the provider's subject afterwards; unknown users can be provisioned.
+type OIDCService struct {
+	repo      *repository.OIDCRepository
+	linker    *identityLinker
+	providers map[string]*oidc.Provider
+	order     []*oidc.Provider
+}
+
+// NewOIDCService creates a new OIDC service instance for the configured providers
+func NewOIDCService(repo *repository.OIDCRepository, identities *repository.IdentityRepository, userService *UserService, cfg config.OIDCConfig, app config.ApplicationConfig) *OIDCService {
+	s := &OIDCService{
+		repo:      repo,
+		linker:    &identityLinker{identities: identities, userService: userService},
+		providers: map[string]*oidc.Provider{},
+	}
+	baseURL := strings.TrimSuffix(app.BaseURL, "/")
+	for _, pc := range cfg.Providers {
+		callback := fmt.Sprintf("%s/api/auth/oidc/%s/callback", baseURL, pc.ID)
+		provider := oidc.NewProvider(pc, callback, nil)
+		s.providers[pc.ID] = provider
+		s.order = append(s.order, provider)
+	}
+	return s
+}
+
+// Providers lists the configured providers
+func (s *OIDCService) Providers() []OIDCProviderInfo {
+	providers := []OIDCProviderInfo{}
+	for _, p := range s.order {
+		providers = append(providers, OIDCProviderInfo{ID: p.ID(), Name: p.Name()})
+	}
+	return providers
+}
+
+// Begin starts a login with a provider and returns the URL to send the
+// user's browser to, along with the state the provider will send back
+func (s *OIDCService) Begin(ctx context.Context, providerID string) (string, string, error) {
+	provider, ok := s.providers[providerID]
+	if !ok {
+		return "", "", ErrOIDCProviderNotFound
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomToken(48)
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.repo.CreateState(&model.ProviderLoginState{
+		State:        state,
+		Provider:     providerID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(OIDCStateTTL),
+	}); err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// Complete finishes a login when the provider sends the user back with an
+// authorization code, and returns the user it logged in
+func (s *OIDCService) Complete(ctx context.Context, providerID, state, code string) (*model.User, error) {
+	provider, ok := s.providers[providerID]
+	if !ok {
+		return nil, ErrOIDCProviderNotFound
+	}
+
+	pending, err := s.repo.TakeState(state)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+	if pending.Provider != providerID || time.Now().After(pending.ExpiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+
+	claims, err := provider.Exchange(ctx, code, pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return s.resolveUser(provider.Config(), claims)
+}
+
+// PurgeExpired removes logins that were never completed
+func (s *OIDCService) PurgeExpired() error {
+	return s.repo.DeleteExpiredStates(time.Now())
+}
+
+// resolveUser finds, links or provisions the user of a provider account
+func (s *OIDCService) resolveUser(pc config.OIDCProviderConfig, claims *oidc.Claims) (*model.User, error) {
+	user, err := s.linker.resolve(externalAccount{
+		Source:        pc.ID,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		Username:      claims.PreferredUsername,
+		Groups:        claimValues(claims, pc.RoleClaim),
+	}, linkPolicy{
+		AutoProvision: pc.AutoProvision,
+		RoleMapping:   pc.RoleMapping,
+		DefaultRole:   pc.DefaultRole,
+		SyncRoles:     pc.SyncRoles,
+	})
+	switch {
+	case errors.Is(err, errExternalEmailNotVerified):
+		return nil, ErrOIDCEmailNotVerified
+	case errors.Is(err, errExternalAccountNotFound):
+		return nil, ErrOIDCAccountNotFound
+	}
+	return user, err
+}
+
+// claimValues returns the values of a claim holding a string or a list of them
+func claimValues(claims *oidc.Claims, name string) []string {
+	if name == "" {
+		return nil
+	}
+
+	var values []string
+	switch v := claims.Raw[name].(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
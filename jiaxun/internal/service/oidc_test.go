@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/model"
+	"jiaxun/internal/oidc/oidctest"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// oidcFixture is an OIDC service logging users in at a test provider
+type oidcFixture struct {
+	db          *gorm.DB
+	idp         *oidctest.Server
+	service     *OIDCService
+	userService *UserService
+}
+
+// newOIDCFixture starts a test provider and configures it as "test"
+func newOIDCFixture(t *testing.T, pc config.OIDCProviderConfig) *oidcFixture {
+	t.Helper()
+	idp, err := oidctest.NewServer("jiaxun", "s3cret")
+	if err != nil {
+		t.Fatalf("starting provider: %v", err)
+	}
+	t.Cleanup(idp.Close)
+
+	pc.ID = "test"
+	pc.Issuer = idp.URL
+	pc.ClientID = idp.ClientID
+	pc.ClientSecret = idp.ClientSecret
+
+	db := openTestDB(t)
+	userService := newTestUserService(db)
+	service := NewOIDCService(
+		repository.NewOIDCRepository(db),
+		repository.NewIdentityRepository(db),
+		userService,
+		config.OIDCConfig{Providers: []config.OIDCProviderConfig{pc}},
+		config.ApplicationConfig{BaseURL: "https://jiaxun.test"},
+	)
+	return &oidcFixture{db: db, idp: idp, service: service, userService: userService}
+}
+
+// login logs in at the provider with the given ID token claims and
+// completes the login
+func (f *oidcFixture) login(t *testing.T, claims map[string]interface{}) (*model.User, error) {
+	t.Helper()
+	authURL, state, err := f.service.Begin(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, returned, err := f.idp.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if returned != state {
+		t.Fatalf("provider sent back state %q, want %q", returned, state)
+	}
+	return f.service.Complete(context.Background(), "test", state, code)
+}
+
+func TestOIDCCompleteRejectsState(t *testing.T) {
+	claims := map[string]interface{}{"sub": "user-1", "email": "ada@example.org", "email_verified": true}
+
+	tests := []struct {
+		name string
+		// tamper returns the provider and state the callback is made with
+		tamper  func(t *testing.T, f *oidcFixture, state string) (string, string)
+		wantErr error
+	}{
+		{
+			name: "unknown state",
+			tamper: func(t *testing.T, f *oidcFixture, state string) (string, string) {
+				return "test", "forged-state"
+			},
+			wantErr: ErrInvalidOIDCState,
+		},
+		{
+			name: "state of another provider",
+			tamper: func(t *testing.T, f *oidcFixture, state string) (string, string) {
+				if err := f.db.Model(&model.ProviderLoginState{}).Where("state = ?", state).Update("provider", "other").Error; err != nil {
+					t.Fatalf("moving state: %v", err)
+				}
+				return "test", state
+			},
+			wantErr: ErrInvalidOIDCState,
+		},
+		{
+			name: "expired state",
+			tamper: func(t *testing.T, f *oidcFixture, state string) (string, string) {
+				if err := f.db.Model(&model.ProviderLoginState{}).Where("state = ?", state).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+					t.Fatalf("expiring state: %v", err)
+				}
+				return "test", state
+			},
+			wantErr: ErrInvalidOIDCState,
+		},
+		{
+			name: "unknown provider",
+			tamper: func(t *testing.T, f *oidcFixture, state string) (string, string) {
+				return "other", state
+			},
+			wantErr: ErrOIDCProviderNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newOIDCFixture(t, config.OIDCProviderConfig{AutoProvision: true})
+			authURL, state, err := f.service.Begin(context.Background(), "test")
+			if err != nil {
+				t.Fatalf("Begin: %v", err)
+			}
+			code, _, err := f.idp.Authorize(authURL, claims)
+			if err != nil {
+				t.Fatalf("Authorize: %v", err)
+			}
+
+			provider, state := tc.tamper(t, f, state)
+			if _, err := f.service.Complete(context.Background(), provider, state, code); !errors.Is(err, tc.wantErr) {
+				t.Errorf("Complete = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCCompleteStateIsSingleUse(t *testing.T) {
+	f := newOIDCFixture(t, config.OIDCProviderConfig{AutoProvision: true})
+	claims := map[string]interface{}{"sub": "user-1", "email": "ada@example.org", "email_verified": true}
+
+	authURL, state, err := f.service.Begin(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, _, err := f.idp.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if _, err := f.service.Complete(context.Background(), "test", state, code); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	code, _, err = f.idp.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if _, err := f.service.Complete(context.Background(), "test", state, code); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("replayed Complete = %v, want ErrInvalidOIDCState", err)
+	}
+}
+
+func TestOIDCCompleteRejectsForgedIDToken(t *testing.T) {
+	f := newOIDCFixture(t, config.OIDCProviderConfig{AutoProvision: true})
+	if err := f.idp.ForgeSignatures(); err != nil {
+		t.Fatalf("ForgeSignatures: %v", err)
+	}
+
+	_, err := f.login(t, map[string]interface{}{"sub": "user-1", "email": "ada@example.org", "email_verified": true})
+	if err == nil {
+		t.Fatal("Complete accepted a forged ID token")
+	}
+	if _, err := f.userService.GetByEmail("ada@example.org"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("a user was provisioned from a forged ID token: %v", err)
+	}
+}
+
+func TestOIDCFirstLoginProvisioning(t *testing.T) {
+	f := newOIDCFixture(t, config.OIDCProviderConfig{
+		AutoProvision: true,
+		RoleClaim:     "groups",
+		RoleMapping:   map[string]string{"faculty": model.RoleTeacher},
+		DefaultRole:   model.RoleStudent,
+	})
+
+	// Another user already holds the preferred username
+	if err := f.userService.Create(&model.User{Username: "ada", Email: "someone@example.org", Password: "password"}); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	user, err := f.login(t, map[string]interface{}{
+		"sub":                "user-1",
+		"email":              "ada@example.org",
+		"email_verified":     true,
+		"preferred_username": "ada",
+		"name":               "Ada Lovelace",
+		"groups":             []string{"library", "faculty"},
+	})
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if user.Username != "ada2" || user.Email != "ada@example.org" || user.FullName != "Ada Lovelace" {
+		t.Errorf("provisioned %s <%s> %q, want ada2 <ada@example.org> \"Ada Lovelace\"", user.Username, user.Email, user.FullName)
+	}
+	if user.Role != model.RoleTeacher {
+		t.Errorf("provisioned role = %s, want %s", user.Role, model.RoleTeacher)
+	}
+	if user.Status != model.UserStatusActive || user.EmailVerifiedAt == nil {
+		t.Errorf("provisioned user is %s, verified at %v; want an active, verified user", user.Status, user.EmailVerifiedAt)
+	}
+
+	// The identity is linked, so later logins find the user by subject
+	// even after the email changed at the provider
+	again, err := f.login(t, map[string]interface{}{
+		"sub":            "user-1",
+		"email":          "ada.lovelace@example.org",
+		"email_verified": true,
+	})
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("second login resolved user %d, want %d", again.ID, user.ID)
+	}
+
+	var users int64
+	if err := f.db.Model(&model.User{}).Where("email LIKE ?", "%@example.org").Count(&users).Error; err != nil {
+		t.Fatalf("counting users: %v", err)
+	}
+	if users != 2 {
+		t.Errorf("%d users at example.org, want 2", users)
+	}
+}
+
+func TestOIDCFirstLogin(t *testing.T) {
+	tests := []struct {
+		name          string
+		autoProvision bool
+		// existing is the email of a user created before the login
+		existing string
+		claims   map[string]interface{}
+		wantErr  error
+		// wantLinked is set when the login must resolve to the existing user
+		wantLinked bool
+	}{
+		{
+			name:       "links the user with the verified email",
+			existing:   "ada@example.org",
+			claims:     map[string]interface{}{"sub": "user-1", "email": "ada@example.org", "email_verified": true},
+			wantLinked: true,
+		},
+		{
+			name:     "refuses an unverified email",
+			existing: "ada@example.org",
+			claims:   map[string]interface{}{"sub": "user-1", "email": "ada@example.org", "email_verified": false},
+			wantErr:  ErrOIDCEmailNotVerified,
+		},
+		{
+			name:          "refuses a missing email",
+			autoProvision: true,
+			claims:        map[string]interface{}{"sub": "user-1"},
+			wantErr:       ErrOIDCEmailNotVerified,
+		},
+		{
+			name:    "refuses unknown users without provisioning",
+			claims:  map[string]interface{}{"sub": "user-1", "email": "ada@example.org", "email_verified": true},
+			wantErr: ErrOIDCAccountNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newOIDCFixture(t, config.OIDCProviderConfig{AutoProvision: tc.autoProvision})
+			var existing *model.User
+			if tc.existing != "" {
+				existing = &model.User{Username: "existing", Email: tc.existing, Password: "password"}
+				if err := f.userService.Create(existing); err != nil {
+					t.Fatalf("creating user: %v", err)
+				}
+			}
+
+			user, err := f.login(t, tc.claims)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Complete = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			if tc.wantLinked && user.ID != existing.ID {
+				t.Errorf("login resolved user %d, want the existing user %d", user.ID, existing.ID)
+			}
+		})
+	}
+}
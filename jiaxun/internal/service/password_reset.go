@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"jiaxun/internal/mailer"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetService errors
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+)
+
+// PasswordResetService lets users who forgot their password set a new one
+// through a single-use link sent to their email address
+type PasswordResetService struct {
+	repo        *repository.TokenRepository
+	userService *UserService
+	authService *AuthService
+	mailer      mailer.Mailer
+	ttl         time.Duration
+	frontendURL string
+}
+
+// NewPasswordResetService creates a new password reset service instance
+func NewPasswordResetService(repo *repository.TokenRepository, userService *UserService, authService *AuthService, m mailer.Mailer, ttl time.Duration, frontendURL string) *PasswordResetService {
+	return &PasswordResetService{
+		repo:        repo,
+		userService: userService,
+		authService: authService,
+		mailer:      m,
+		ttl:         ttl,
+		frontendURL: strings.TrimSuffix(frontendURL, "/"),
+	}
+}
+
+// ForgotPassword emails a reset link if the address belongs to an account.
+// It succeeds whether or not the account exists so that callers cannot
+// probe for registered addresses.
+func (s *PasswordResetService) ForgotPassword(email string) error {
+	user, err := s.userService.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	link, err := s.newLink(user, s.ttl)
+	if err != nil {
+		return err
+	}
+
+	if err := s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Jiaxun password",
+		Body: fmt.Sprintf("Hello %s,\n\nSomeone asked to reset the password of your account. "+
+			"To choose a new password, open the link below:\n\n%s\n\n"+
+			"The link expires in %d minutes and can be used once. "+
+			"If you did not ask for a reset, you can ignore this email.\n",
+			user.Username, link, int(s.ttl.Minutes())),
+	}); err != nil {
+		// Reporting the failure would reveal that the account exists
+		log.Printf("Failed to send password reset email to %s: %v", user.Email, err)
+	}
+	return nil
+}
+
+// Invite emails a new user a link to choose their password, valid for ttl.
+// The link is a password reset link, so it also works for accounts that
+// were given an initial password.
+func (s *PasswordResetService) Invite(user *model.User, ttl time.Duration) error {
+	link, err := s.newLink(user, ttl)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Welcome to Jiaxun",
+		Body: fmt.Sprintf("Hello %s,\n\nAn account was created for you on Jiaxun with the username %s. "+
+			"To choose your password, open the link below:\n\n%s\n\n"+
+			"The link is valid until %s and can be used once.\n",
+			user.Username, user.Username, link, time.Now().Add(ttl).Format(time.RFC1123)),
+	})
+}
+
+// newLink stores a reset token for a user and returns the link that uses it
+func (s *PasswordResetService) newLink(user *model.User, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if err := s.repo.CreatePasswordResetToken(&model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/reset-password?token=%s", s.frontendURL, token), nil
+}
+
+// ResetPassword sets a new password using a reset token and ends every
+// existing session of the account
+func (s *PasswordResetService) ResetPassword(token, password string) error {
+	resetToken, err := s.repo.GetPasswordResetTokenByHash(hashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	now := time.Now()
+	if resetToken.UsedAt != nil || now.After(resetToken.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+	fresh, err := s.repo.MarkPasswordResetTokenUsed(resetToken.ID, now)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.userService.GetByID(resetToken.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if err := s.userService.SetPassword(user, password); err != nil {
+		return err
+	}
+	return s.authService.RevokeAllSessions(user.ID)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// passwordResetFixture holds a password reset service sending to an outbox
+type passwordResetFixture struct {
+	db      *gorm.DB
+	service *PasswordResetService
+	auth    *AuthService
+	users   *UserService
+	outbox  *outbox
+	user    *model.User
+}
+
+func newPasswordResetFixture(t *testing.T) *passwordResetFixture {
+	t.Helper()
+	db := openTestDB(t)
+	auth, user := newTestAuthService(t, db)
+	f := &passwordResetFixture{db: db, auth: auth, users: newTestUserService(db), outbox: &outbox{}, user: user}
+	f.service = NewPasswordResetService(repository.NewTokenRepository(db), f.users, auth, f.outbox, time.Hour, "https://jiaxun.example.org/")
+	return f
+}
+
+var resetLink = regexp.MustCompile(`https://jiaxun\.example\.org/reset-password\?token=\S+`)
+
+// forgot asks for a reset link and returns its token
+func (f *passwordResetFixture) forgot(t *testing.T) string {
+	t.Helper()
+	if err := f.service.ForgotPassword(f.user.Email); err != nil {
+		t.Fatalf("ForgotPassword: %v", err)
+	}
+	msg := f.outbox.messages[len(f.outbox.messages)-1]
+	link := resetLink.FindString(msg.Body)
+	if msg.To != f.user.Email || link == "" {
+		t.Fatalf("sent %+v, want a reset link to %s", msg, f.user.Email)
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parsing link %q: %v", link, err)
+	}
+	return parsed.Query().Get("token")
+}
+
+// password checks which password the user has
+func (f *passwordResetFixture) password(t *testing.T, want string) {
+	t.Helper()
+	user, err := f.users.GetByID(f.user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if err := CheckPassword(want, user.Password); err != nil {
+		t.Errorf("password is not %q", want)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	f := newPasswordResetFixture(t)
+	middleware.SetRevocationList(f.auth)
+	session, err := f.auth.IssueTokens(f.user, false, ClientInfo{IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+
+	token := f.forgot(t)
+	if err := f.service.ResetPassword(token, "new password"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	f.password(t, "new password")
+
+	// The link works once
+	if err := f.service.ResetPassword(token, "another password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("reusing the link = %v, want ErrInvalidResetToken", err)
+	}
+	f.password(t, "new password")
+
+	// Whoever knew the old password is logged out
+	if _, err := f.auth.Refresh(session.RefreshToken, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refreshing a session from before the reset = %v, want ErrInvalidRefreshToken", err)
+	}
+	if code := authenticated(t, session.AccessToken); code != http.StatusUnauthorized {
+		t.Errorf("access token from before the reset = %d, want 401", code)
+	}
+	sessions, err := f.auth.ListSessions(f.user.ID, "")
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("%d sessions left after the reset, want none", len(sessions))
+	}
+}
+
+func TestResetPasswordInvalidLinks(t *testing.T) {
+	f := newPasswordResetFixture(t)
+
+	// Only the latest link works
+	replaced := f.forgot(t)
+	latest := f.forgot(t)
+	if err := f.service.ResetPassword(replaced, "new password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("replaced link = %v, want ErrInvalidResetToken", err)
+	}
+
+	// Links expire
+	if err := f.db.Model(&model.PasswordResetToken{}).Where("token_hash = ?", hashToken(latest)).
+		Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("expiring link: %v", err)
+	}
+	if err := f.service.ResetPassword(latest, "new password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("expired link = %v, want ErrInvalidResetToken", err)
+	}
+	if err := f.service.ResetPassword("unknown", "new password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("unknown link = %v, want ErrInvalidResetToken", err)
+	}
+	f.password(t, "password")
+
+	// Unknown addresses get no email, and no error either
+	sent := len(f.outbox.messages)
+	if err := f.service.ForgotPassword("nobody@example.org"); err != nil {
+		t.Errorf("ForgotPassword for an unknown address = %v, want nil", err)
+	}
+	if len(f.outbox.messages) != sent {
+		t.Error("an email was sent to an unknown address")
+	}
+}
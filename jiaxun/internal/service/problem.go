@@ -0,0 +1,303 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// ProblemService errors
+var (
+	ErrProblemNotFound       = errors.New("problem not found")
+	ErrProblemAlreadyExists  = errors.New("a problem with this platform and external ID already exists")
+	ErrProblemHasSubmissions = errors.New("problem has submissions")
+	ErrInvalidProblem        = errors.New("invalid problem")
+	ErrInvalidRatingRange    = errors.New("invalid rating range")
+)
+
+// Limits on the fields of problems
+const (
+	maxPlatformLength   = 32
+	maxExternalIDLength = 64
+	maxProblemNameLen   = 255
+	maxProblemURLLength = 512
+	maxProblemRating    = 10000
+	maxProblemTags      = 20
+	maxTagLength        = 32
+)
+
+// problemSortFields lists the fields problems can be sorted by
+var problemSortFields = map[string]bool{
+	"id":          true,
+	"platform":    true,
+	"external_id": true,
+	"name":        true,
+	"rating":      true,
+	"created_at":  true,
+}
+
+// ProblemInput describes a problem to add to the bank
+type ProblemInput struct {
+	Platform   string
+	ExternalID string
+	Name       string
+	URL        string
+	Rating     *int
+	Tags       []string
+}
+
+// ProblemUpdate describes a partial update of a problem.
+// Nil fields are left untouched.
+type ProblemUpdate struct {
+	Name *string
+	URL  *string
+	// Rating removes the rating when zero
+	Rating *int
+	Tags   *[]string
+}
+
+// ProblemQuery selects and orders problems in a search. Zero fields match
+// every problem.
+type ProblemQuery struct {
+	// Q matches part of the name or external ID, ignoring case
+	Q        string
+	Platform string
+	// Tags match problems with every one of the tags
+	Tags      []string
+	RatingMin *int
+	RatingMax *int
+	// Sort is a comma-separated list of fields, each prefixed with "-" to
+	// sort in descending order
+	Sort string
+}
+
+// ProblemService handles business logic for the problem bank
+type ProblemService struct {
+	repo *repository.ProblemRepository
+}
+
+// NewProblemService creates a new problem service instance
+func NewProblemService(repo *repository.ProblemRepository) *ProblemService {
+	return &ProblemService{repo: repo}
+}
+
+// Create adds a problem to the bank. A problem is identified by its platform
+// and external ID, which must not be in the bank yet.
+func (s *ProblemService) Create(input ProblemInput) (*model.Problem, error) {
+	problem := &model.Problem{
+		Platform:   input.Platform,
+		ExternalID: input.ExternalID,
+		Name:       input.Name,
+		URL:        input.URL,
+		Rating:     input.Rating,
+		Tags:       input.Tags,
+	}
+	if reasons := normalizeProblem(problem); len(reasons) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProblem, strings.Join(reasons, "; "))
+	}
+
+	if _, err := s.repo.GetByExternalID(problem.Platform, problem.ExternalID); err == nil {
+		return nil, ErrProblemAlreadyExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err := s.repo.Create(problem); err != nil {
+		return nil, err
+	}
+	return problem, nil
+}
+
+// Get returns a problem of the bank
+func (s *ProblemService) Get(id uint) (*model.Problem, error) {
+	problem, err := s.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProblemNotFound
+		}
+		return nil, err
+	}
+	return problem, nil
+}
+
+// Update changes the given fields of a problem. Its platform and external
+// ID identify it and cannot change.
+func (s *ProblemService) Update(id uint, update ProblemUpdate) (*model.Problem, error) {
+	problem, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		problem.Name = *update.Name
+	}
+	if update.URL != nil {
+		problem.URL = *update.URL
+	}
+	if update.Rating != nil {
+		problem.Rating = update.Rating
+	}
+	if update.Tags != nil {
+		problem.Tags = *update.Tags
+	}
+	if reasons := normalizeProblem(problem); len(reasons) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProblem, strings.Join(reasons, "; "))
+	}
+
+	if err := s.repo.Update(problem); err != nil {
+		return nil, err
+	}
+	return problem, nil
+}
+
+// Delete removes a problem from the bank. Problems with synced submissions
+// are kept, as the next sync would add them back anyway.
+func (s *ProblemService) Delete(id uint) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	used, err := s.repo.HasSubmissions(id)
+	if err != nil {
+		return err
+	}
+	if used {
+		return ErrProblemHasSubmissions
+	}
+	return s.repo.Delete(id)
+}
+
+// Search returns the problems matching a query
+func (s *ProblemService) Search(query ProblemQuery, page, pageSize int) ([]model.Problem, int64, error) {
+	if query.RatingMin != nil && query.RatingMax != nil && *query.RatingMin > *query.RatingMax {
+		return nil, 0, ErrInvalidRatingRange
+	}
+	filter := repository.ProblemFilter{
+		Query:     query.Q,
+		Platform:  strings.ToLower(query.Platform),
+		RatingMin: query.RatingMin,
+		RatingMax: query.RatingMax,
+	}
+	for _, tag := range query.Tags {
+		tag = normalizeTag(tag)
+		if !validTag(tag) {
+			return nil, 0, fmt.Errorf("%w: invalid tag %q", ErrInvalidProblem, tag)
+		}
+		filter.Tags = append(filter.Tags, tag)
+	}
+	if query.Sort != "" {
+		for _, field := range strings.Split(query.Sort, ",") {
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			if !problemSortFields[field] {
+				return nil, 0, fmt.Errorf("%w: %q", ErrInvalidSortField, field)
+			}
+			filter.OrderBy = append(filter.OrderBy, repository.ProblemOrder{Column: field, Desc: desc})
+		}
+	}
+	return s.repo.Search(filter, page, pageSize)
+}
+
+// normalizeProblem trims the fields of a problem, lowercases its platform
+// and tags and drops duplicate tags. It returns what is wrong with the
+// problem, if anything.
+func normalizeProblem(problem *model.Problem) []string {
+	var reasons []string
+
+	problem.Platform = strings.ToLower(strings.TrimSpace(problem.Platform))
+	if problem.Platform == "" {
+		reasons = append(reasons, "platform is required")
+	} else if !validPlatform(problem.Platform) {
+		reasons = append(reasons, fmt.Sprintf("platform must be at most %d lowercase letters, digits, dashes or underscores", maxPlatformLength))
+	}
+
+	problem.ExternalID = strings.TrimSpace(problem.ExternalID)
+	if problem.ExternalID == "" {
+		reasons = append(reasons, "external_id is required")
+	} else if len(problem.ExternalID) > maxExternalIDLength {
+		reasons = append(reasons, fmt.Sprintf("external_id must be at most %d characters", maxExternalIDLength))
+	}
+
+	problem.Name = strings.TrimSpace(problem.Name)
+	if problem.Name == "" {
+		reasons = append(reasons, "name is required")
+	} else if len(problem.Name) > maxProblemNameLen {
+		reasons = append(reasons, fmt.Sprintf("name must be at most %d characters", maxProblemNameLen))
+	}
+
+	problem.URL = strings.TrimSpace(problem.URL)
+	if problem.URL != "" {
+		u, err := url.Parse(problem.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			reasons = append(reasons, "url must be an http or https URL")
+		} else if len(problem.URL) > maxProblemURLLength {
+			reasons = append(reasons, fmt.Sprintf("url must be at most %d characters", maxProblemURLLength))
+		}
+	}
+
+	// Zero means unrated, as on most judges
+	if problem.Rating != nil && *problem.Rating == 0 {
+		problem.Rating = nil
+	}
+	if problem.Rating != nil && (*problem.Rating < 0 || *problem.Rating > maxProblemRating) {
+		reasons = append(reasons, fmt.Sprintf("rating must be between 0 and %d", maxProblemRating))
+	}
+
+	tags := make([]string, 0, len(problem.Tags))
+	seen := map[string]bool{}
+	for _, tag := range problem.Tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if !validTag(tag) {
+			reasons = append(reasons, fmt.Sprintf("tag %q must be at most %d letters, digits, spaces or -+*./#'()", tag, maxTagLength))
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxProblemTags {
+		reasons = append(reasons, fmt.Sprintf("at most %d tags are allowed", maxProblemTags))
+	}
+	problem.Tags = tags
+
+	return reasons
+}
+
+// validPlatform reports whether a platform is a short lowercase identifier
+func validPlatform(platform string) bool {
+	if len(platform) > maxPlatformLength {
+		return false
+	}
+	for _, r := range platform {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeTag lowercases a tag and collapses its spaces
+func normalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), " ")
+}
+
+// validTag reports whether a tag is short and only made of characters that
+// JSON leaves as is, so that tags can be matched in their JSON column
+func validTag(tag string) bool {
+	if tag == "" || len(tag) > maxTagLength {
+		return false
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(" -+*./#'()", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"jiaxun/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// TableFormatJSON is the format of problem lists given as a JSON array
+const TableFormatJSON = "json"
+
+// MaxProblemImportRows caps the problems imported at once
+const MaxProblemImportRows = 5000
+
+// Outcomes of importing a problem
+const (
+	ProblemImportCreated = "created"
+	ProblemImportUpdated = "updated"
+)
+
+// ProblemImportRow is the outcome of importing a problem
+type ProblemImportRow struct {
+	// Row is the position of the problem in a JSON array, or its line in a
+	// table, counting the header
+	Row        int    `json:"row"`
+	Platform   string `json:"platform"`
+	ExternalID string `json:"external_id"`
+	Name       string `json:"name"`
+	ProblemID  uint   `json:"problem_id,omitempty"`
+	// Action is created or updated
+	Action string   `json:"action,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ProblemImportResult describes an import
+type ProblemImportResult struct {
+	DryRun  bool               `json:"dry_run"`
+	Created int                `json:"created"`
+	Updated int                `json:"updated"`
+	Rows    []ProblemImportRow `json:"rows"`
+}
+
+// problemImportEntry is a problem as listed in an import file
+type problemImportEntry struct {
+	Platform   string   `json:"platform"`
+	ExternalID string   `json:"external_id"`
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Rating     *int     `json:"rating"`
+	Tags       []string `json:"tags"`
+	// errors found while reading the entry
+	errors []string
+}
+
+// Import adds problems to the bank from a JSON array or a CSV or XLSX
+// table. Problems already in the bank, identified by their platform and
+// external ID, are updated instead; their URL, rating and tags are only
+// changed when given. Every problem is checked first, and problems are
+// only saved if all are valid, in a single transaction. If any is invalid,
+// nothing is saved and ErrInvalidImportRows is returned together with the
+// result listing each row's errors.
+func (s *ProblemService) Import(format string, data []byte, dryRun bool) (*ProblemImportResult, error) {
+	var entries []problemImportEntry
+	var lines []int
+	var err error
+	if format == TableFormatJSON {
+		entries, lines, err = parseProblemJSON(data)
+	} else {
+		var table [][]string
+		if table, err = readTable(format, data); err != nil {
+			return nil, err
+		}
+		entries, lines, err = parseProblemRows(table)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProblemImportResult{DryRun: dryRun, Rows: make([]ProblemImportRow, len(entries))}
+	problems := make([]*model.Problem, len(entries))
+	seen := map[string]int{}
+	valid := true
+	for i, entry := range entries {
+		row := &result.Rows[i]
+		row.Row = lines[i]
+
+		problem := &model.Problem{
+			Platform:   entry.Platform,
+			ExternalID: entry.ExternalID,
+			Name:       entry.Name,
+			URL:        entry.URL,
+			Rating:     entry.Rating,
+			Tags:       entry.Tags,
+		}
+		row.Errors = append(entry.errors, normalizeProblem(problem)...)
+		row.Platform, row.ExternalID, row.Name = problem.Platform, problem.ExternalID, problem.Name
+
+		if problem.Platform != "" && problem.ExternalID != "" {
+			key := problem.Platform + "\x00" + problem.ExternalID
+			if first, ok := seen[key]; ok {
+				row.Errors = append(row.Errors, fmt.Sprintf("problem is already in row %d", first))
+			} else {
+				seen[key] = row.Row
+			}
+		}
+		if len(row.Errors) > 0 {
+			valid = false
+			continue
+		}
+
+		existing, err := s.repo.GetByExternalID(problem.Platform, problem.ExternalID)
+		switch {
+		case err == nil:
+			existing.Name = problem.Name
+			if entry.URL != "" {
+				existing.URL = problem.URL
+			}
+			if entry.Rating != nil {
+				existing.Rating = problem.Rating
+			}
+			if entry.Tags != nil {
+				existing.Tags = problem.Tags
+			}
+			problem = existing
+			row.ProblemID = existing.ID
+			row.Action = ProblemImportUpdated
+			result.Updated++
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			row.Action = ProblemImportCreated
+			result.Created++
+		default:
+			return nil, err
+		}
+		problems[i] = problem
+	}
+
+	if !valid {
+		result.Created, result.Updated = 0, 0
+		for i := range result.Rows {
+			result.Rows[i].Action = ""
+		}
+		return result, ErrInvalidImportRows
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	if err := s.repo.SaveBatch(problems); err != nil {
+		return nil, err
+	}
+	for i, problem := range problems {
+		result.Rows[i].ProblemID = problem.ID
+	}
+	return result, nil
+}
+
+// parseProblemJSON reads a JSON array of problems
+func parseProblemJSON(data []byte) ([]problemImportEntry, []int, error) {
+	var entries []problemImportEntry
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("%w: the file has no problems", ErrInvalidImportFile)
+	}
+	if len(entries) > MaxProblemImportRows {
+		return nil, nil, ErrTooManyImportRows
+	}
+
+	lines := make([]int, len(entries))
+	for i := range entries {
+		lines[i] = i + 1
+	}
+	return entries, lines, nil
+}
+
+// parseProblemRows maps the rows of a table to problems by its header,
+// skipping empty rows. Tags are separated by commas or semicolons.
+func parseProblemRows(table [][]string) ([]problemImportEntry, []int, error) {
+	if len(table) == 0 {
+		return nil, nil, fmt.Errorf("%w: the file is empty", ErrInvalidImportFile)
+	}
+
+	columns := map[string]int{}
+	for i, name := range table[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	for _, required := range []string{"platform", "external_id", "name"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("%w: missing column %q", ErrInvalidImportFile, required)
+		}
+	}
+
+	var entries []problemImportEntry
+	var lines []int
+	for i, cells := range table[1:] {
+		cell := func(name string) string {
+			if col, ok := columns[name]; ok && col < len(cells) {
+				return strings.TrimSpace(cells[col])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(cells, "")) == "" {
+			continue
+		}
+		if len(entries) == MaxProblemImportRows {
+			return nil, nil, ErrTooManyImportRows
+		}
+
+		entry := problemImportEntry{
+			Platform:   cell("platform"),
+			ExternalID: cell("external_id"),
+			Name:       cell("name"),
+			URL:        cell("url"),
+		}
+		if rating := cell("rating"); rating != "" {
+			if r, err := strconv.Atoi(rating); err == nil {
+				entry.Rating = &r
+			} else {
+				entry.errors = append(entry.errors, "rating must be a whole number")
+			}
+		}
+		if tags := cell("tags"); tags != "" {
+			entry.Tags = strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ';' })
+		}
+		entries = append(entries, entry)
+		lines = append(lines, i+2)
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("%w: the file has no problems", ErrInvalidImportFile)
+	}
+	return entries, lines, nil
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"jiaxun/internal/repository"
+)
+
+// searchProblems returns the external IDs of the problems matching a query
+func searchProblems(t *testing.T, service *ProblemService, query ProblemQuery) []string {
+	t.Helper()
+	problems, total, err := service.Search(query, 1, 100)
+	if err != nil {
+		t.Fatalf("Search(%+v): %v", query, err)
+	}
+	if int(total) != len(problems) {
+		t.Errorf("Search(%+v) counted %d problems, returned %d", query, total, len(problems))
+	}
+	ids := []string{}
+	for _, problem := range problems {
+		ids = append(ids, problem.ExternalID)
+	}
+	return ids
+}
+
+func TestImportProblemsTwice(t *testing.T) {
+	db := openTestDB(t)
+	service := NewProblemService(repository.NewProblemRepository(db))
+
+	first := `[
+		{"platform": "codeforces", "external_id": "1A", "name": "Theatre Square", "rating": 1000, "tags": ["math"]},
+		{"platform": "atcoder", "external_id": "abc001_a", "name": "Snow Depth"}
+	]`
+	result, err := service.Import(TableFormatJSON, []byte(first), false)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Created != 2 || result.Updated != 0 {
+		t.Fatalf("first import created %d and updated %d, want 2 created", result.Created, result.Updated)
+	}
+
+	// Problems are matched by platform and external ID; fields left out keep
+	// their value
+	second := "platform,external_id,name,url\n" +
+		"Codeforces,1A,Theatre Square (renamed),\n" +
+		"codeforces,4A,Watermelon,https://codeforces.com/problemset/problem/4/A\n"
+	result, err = service.Import("csv", []byte(second), false)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Created != 1 || result.Updated != 1 || result.Rows[0].Action != ProblemImportUpdated {
+		t.Fatalf("second import = %+v, want 1A updated and 4A created", result)
+	}
+	if ids := searchProblems(t, service, ProblemQuery{}); len(ids) != 3 {
+		t.Errorf("bank holds %q, want 3 problems", ids)
+	}
+	updated, err := service.Get(result.Rows[0].ProblemID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if updated.Name != "Theatre Square (renamed)" || updated.Rating == nil || *updated.Rating != 1000 || !reflect.DeepEqual(updated.Tags, []string{"math"}) {
+		t.Errorf("updated problem = %+v, want the new name with the rating and tags kept", updated)
+	}
+
+	// A problem listed twice invalidates the whole import
+	twice := `[
+		{"platform": "luogu", "external_id": "P1001", "name": "A+B Problem"},
+		{"platform": "LUOGU", "external_id": "P1001", "name": "A+B Problem again"}
+	]`
+	result, err = service.Import(TableFormatJSON, []byte(twice), false)
+	if !errors.Is(err, ErrInvalidImportRows) {
+		t.Fatalf("importing a problem twice = %v, want ErrInvalidImportRows", err)
+	}
+	if len(result.Rows) != 2 || len(result.Rows[0].Errors) != 0 || len(result.Rows[1].Errors) != 1 {
+		t.Errorf("rows = %+v, want the second one reported", result.Rows)
+	}
+	if ids := searchProblems(t, service, ProblemQuery{Platform: "luogu"}); len(ids) != 0 {
+		t.Errorf("refused import saved %q", ids)
+	}
+
+	// A dry run saves nothing either
+	result, err = service.Import(TableFormatJSON, []byte(`[{"platform": "luogu", "external_id": "P1001", "name": "A+B Problem"}]`), true)
+	if err != nil || result.Created != 1 {
+		t.Fatalf("dry run = %+v, %v, want one problem to create", result, err)
+	}
+	if ids := searchProblems(t, service, ProblemQuery{Platform: "luogu"}); len(ids) != 0 {
+		t.Errorf("dry run saved %q", ids)
+	}
+}
+
+func TestSearchProblems(t *testing.T) {
+	db := openTestDB(t)
+	service := NewProblemService(repository.NewProblemRepository(db))
+	rating := func(r int) *int { return &r }
+	for _, input := range []ProblemInput{
+		{Platform: "codeforces", ExternalID: "1A", Name: "Theatre Square", Rating: rating(1000), Tags: []string{"Math"}},
+		{Platform: "codeforces", ExternalID: "455A", Name: "Boredom", Rating: rating(1500), Tags: []string{"dp"}},
+		{Platform: "codeforces", ExternalID: "1195C", Name: "Basketball Exercise", Rating: rating(1500), Tags: []string{"dp", "greedy"}},
+		{Platform: "atcoder", ExternalID: "dp_a", Name: "Frog 1", Tags: []string{"dp optimization"}},
+	} {
+		if _, err := service.Create(input); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if _, err := service.Create(ProblemInput{Platform: "CodeForces", ExternalID: "1A", Name: "Theatre Square"}); !errors.Is(err, ErrProblemAlreadyExists) {
+		t.Errorf("creating a problem twice = %v, want ErrProblemAlreadyExists", err)
+	}
+
+	tests := []struct {
+		name  string
+		query ProblemQuery
+		want  []string
+	}{
+		{"tag", ProblemQuery{Tags: []string{"DP"}}, []string{"455A", "1195C"}},
+		{"every tag", ProblemQuery{Tags: []string{"dp", "greedy"}}, []string{"1195C"}},
+		{"tag with a space", ProblemQuery{Tags: []string{"dp  optimization"}}, []string{"dp_a"}},
+		{"rating range", ProblemQuery{RatingMin: rating(1200), RatingMax: rating(1500)}, []string{"455A", "1195C"}},
+		{"ratings are inclusive", ProblemQuery{RatingMax: rating(1000)}, []string{"1A"}},
+		{"unrated problems never match a rating", ProblemQuery{RatingMin: rating(0)}, []string{"1A", "455A", "1195C"}},
+		{"tag and rating", ProblemQuery{Tags: []string{"dp"}, RatingMin: rating(1500), Sort: "-external_id"}, []string{"455A", "1195C"}},
+		{"platform", ProblemQuery{Platform: "AtCoder"}, []string{"dp_a"}},
+		{"underscore is not a wildcard", ProblemQuery{Q: "1_"}, []string{}},
+		{"name or external ID", ProblemQuery{Q: "FROG"}, []string{"dp_a"}},
+		{"external ID", ProblemQuery{Q: "dp_"}, []string{"dp_a"}},
+		{"sorted by rating", ProblemQuery{RatingMin: rating(1), Sort: "-rating,name"}, []string{"1195C", "455A", "1A"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := searchProblems(t, service, tc.query); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Search(%+v) = %q, want %q", tc.query, got, tc.want)
+			}
+		})
+	}
+
+	for _, tc := range []struct {
+		name  string
+		query ProblemQuery
+		want  error
+	}{
+		{"inverted rating range", ProblemQuery{RatingMin: rating(2000), RatingMax: rating(1000)}, ErrInvalidRatingRange},
+		{"invalid tag", ProblemQuery{Tags: []string{`dp"`}}, ErrInvalidProblem},
+		{"unknown sort field", ProblemQuery{Sort: "tags"}, ErrInvalidSortField},
+	} {
+		if _, _, err := service.Search(tc.query, 1, 10); !errors.Is(err, tc.want) {
+			t.Errorf("%s: Search = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"jiaxun/internal/middleware"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// RBACService errors
+var (
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrRoleAlreadyExists  = errors.New("role already exists")
+	ErrInvalidRoleName    = errors.New("role name must be 1-32 lowercase letters, digits, '-' or '_'")
+	ErrUnknownPermission  = errors.New("unknown permission")
+	ErrBuiltinRole        = errors.New("built-in roles cannot be deleted")
+	ErrAdminRoleImmutable = errors.New("the admin role cannot be modified")
+	ErrRoleInUse          = errors.New("role is still assigned to users")
+	ErrLastAdmin          = errors.New("the last admin cannot be removed")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// RoleInfo is a role together with the names of its permissions
+type RoleInfo struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Builtin     bool      `json:"builtin"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RoleUpdate describes a partial update of a role.
+// Nil fields are left untouched.
+type RoleUpdate struct {
+	Description *string
+	Permissions *[]string
+}
+
+// RBACService manages roles and resolves the permissions of users.
+// The permissions of each role are cached in memory and invalidated
+// whenever a role changes.
+type RBACService struct {
+	repo        *repository.RoleRepository
+	userService *UserService
+
+	mu    sync.RWMutex
+	cache map[string][]string
+}
+
+// NewRBACService creates a new RBAC service instance
+func NewRBACService(repo *repository.RoleRepository, userService *UserService) *RBACService {
+	return &RBACService{
+		repo:        repo,
+		userService: userService,
+		cache:       map[string][]string{},
+	}
+}
+
+// ListPermissions returns every known permission with its description
+func (s *RBACService) ListPermissions() map[string]string {
+	return model.Permissions
+}
+
+// ListRoles returns all roles with their permissions
+func (s *RBACService) ListRoles() ([]RoleInfo, error) {
+	roles, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]RoleInfo, len(roles))
+	for i := range roles {
+		infos[i] = toRoleInfo(&roles[i])
+	}
+	return infos, nil
+}
+
+// GetRole retrieves a role by name
+func (s *RBACService) GetRole(name string) (*RoleInfo, error) {
+	role, err := s.getRole(name)
+	if err != nil {
+		return nil, err
+	}
+	info := toRoleInfo(role)
+	return &info, nil
+}
+
+// CreateRole creates a custom role
+func (s *RBACService) CreateRole(name, description string, permissions []string) (*RoleInfo, error) {
+	if !roleNamePattern.MatchString(name) {
+		return nil, ErrInvalidRoleName
+	}
+	if err := validatePermissions(permissions); err != nil {
+		return nil, err
+	}
+	if _, err := s.getRole(name); err == nil {
+		return nil, ErrRoleAlreadyExists
+	} else if !errors.Is(err, ErrRoleNotFound) {
+		return nil, err
+	}
+
+	role := &model.Role{
+		Name:        name,
+		Description: description,
+		CreatedAt:   time.Now(),
+		Permissions: toRolePermissions(name, permissions),
+	}
+	if err := s.repo.Create(role); err != nil {
+		return nil, err
+	}
+	s.invalidate(name)
+	info := toRoleInfo(role)
+	return &info, nil
+}
+
+// UpdateRole changes the description or permissions of a role.
+// The admin role cannot be changed so that nobody can lock themselves out.
+func (s *RBACService) UpdateRole(name string, update RoleUpdate) (*RoleInfo, error) {
+	role, err := s.getRole(name)
+	if err != nil {
+		return nil, err
+	}
+	if role.Name == model.RoleAdmin {
+		return nil, ErrAdminRoleImmutable
+	}
+
+	if update.Description != nil {
+		role.Description = *update.Description
+	}
+	if update.Permissions != nil {
+		if err := validatePermissions(*update.Permissions); err != nil {
+			return nil, err
+		}
+		role.Permissions = toRolePermissions(name, *update.Permissions)
+	}
+
+	if err := s.repo.Update(role); err != nil {
+		return nil, err
+	}
+	s.invalidate(name)
+	info := toRoleInfo(role)
+	return &info, nil
+}
+
+// DeleteRole removes a custom role that is no longer assigned to anyone
+func (s *RBACService) DeleteRole(name string) error {
+	role, err := s.getRole(name)
+	if err != nil {
+		return err
+	}
+	if role.Builtin {
+		return ErrBuiltinRole
+	}
+	count, err := s.repo.CountUsers(name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+	if err := s.repo.Delete(name); err != nil {
+		return err
+	}
+	s.invalidate(name)
+	return nil
+}
+
+// AssignRole gives a user a new role. It takes effect on the user's next
+// request, since permissions are resolved from the database every time.
+func (s *RBACService) AssignRole(userID uint, roleName string) (*model.User, error) {
+	if _, err := s.getRole(roleName); err != nil {
+		return nil, err
+	}
+	user, err := s.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == roleName {
+		return user, nil
+	}
+
+	if user.Role == model.RoleAdmin {
+		admins, err := s.repo.CountUsers(model.RoleAdmin)
+		if err != nil {
+			return nil, err
+		}
+		if admins <= 1 {
+			return nil, ErrLastAdmin
+		}
+	}
+
+	if err := s.userService.SetRole(user, roleName); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// PermissionsOf returns the permissions granted to a role
+func (s *RBACService) PermissionsOf(role string) ([]string, error) {
+	s.mu.RLock()
+	permissions, ok := s.cache[role]
+	s.mu.RUnlock()
+	if ok {
+		return permissions, nil
+	}
+
+	permissions, err := s.repo.GetPermissions(role)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.cache[role] = permissions
+	s.mu.Unlock()
+	return permissions, nil
+}
+
+// IsPrivileged reports whether a role grants any permission at all
+func (s *RBACService) IsPrivileged(role string) (bool, error) {
+	permissions, err := s.PermissionsOf(role)
+	if err != nil {
+		return false, err
+	}
+	return len(permissions) > 0, nil
+}
+
+// ResolvePermissions returns the current role and permissions of a user.
+// It is used by the auth middleware so that role changes apply immediately.
+func (s *RBACService) ResolvePermissions(userID uint) (string, []string, error) {
+	user, err := s.userService.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return "", nil, middleware.ErrUnknownUser
+		}
+		return "", nil, err
+	}
+	permissions, err := s.PermissionsOf(user.Role)
+	if err != nil {
+		return "", nil, err
+	}
+	return user.Role, permissions, nil
+}
+
+// getRole retrieves a role, mapping a missing record to ErrRoleNotFound
+func (s *RBACService) getRole(name string) (*model.Role, error) {
+	role, err := s.repo.GetByName(name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return role, nil
+}
+
+// invalidate drops the cached permissions of a role
+func (s *RBACService) invalidate(role string) {
+	s.mu.Lock()
+	delete(s.cache, role)
+	s.mu.Unlock()
+}
+
+// validatePermissions checks that every permission is known
+func validatePermissions(permissions []string) error {
+	for _, p := range permissions {
+		if _, ok := model.Permissions[p]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+		}
+	}
+	return nil
+}
+
+func toRolePermissions(role string, permissions []string) []model.RolePermission {
+	seen := map[string]bool{}
+	var result []model.RolePermission
+	for _, p := range permissions {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		result = append(result, model.RolePermission{RoleName: role, Permission: p})
+	}
+	return result
+}
+
+func toRoleInfo(role *model.Role) RoleInfo {
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		permissions = append(permissions, p.Permission)
+	}
+	sort.Strings(permissions)
+	return RoleInfo{
+		Name:        role.Name,
+		Description: role.Description,
+		Builtin:     role.Builtin,
+		Permissions: permissions,
+		CreatedAt:   role.CreatedAt,
+	}
+}
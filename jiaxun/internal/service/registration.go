@@ -0,0 +1,273 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"jiaxun/internal/config"
+	"jiaxun/internal/mailer"
+	"jiaxun/internal/model"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RegistrationService errors
+var (
+	ErrRegistrationDisabled     = errors.New("self-service registration is disabled")
+	ErrEmailDomainNotAllowed    = errors.New("email domain is not allowed to register")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
+)
+
+// verificationAudience and emailChangeAudience distinguish verification
+// tokens from access tokens, and from each other, as all are signed with the
+// same secret
+const (
+	verificationAudience = "email-verification"
+	emailChangeAudience  = "email-change"
+)
+
+// verificationClaims are the claims of a signed email verification token
+type verificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// emailChangeClaims are the claims of a signed email change token. The
+// change only applies while the account still has the previous address.
+type emailChangeClaims struct {
+	Email         string `json:"email"`
+	PreviousEmail string `json:"previous_email"`
+	jwt.RegisteredClaims
+}
+
+// RegistrationService handles self-service signup and email verification
+type RegistrationService struct {
+	userService *UserService
+	mailer      mailer.Mailer
+	cfg         config.RegistrationConfig
+	baseURL     string
+	secret      []byte
+}
+
+// NewRegistrationService creates a new registration service instance
+func NewRegistrationService(userService *UserService, m mailer.Mailer, cfg config.RegistrationConfig, app config.ApplicationConfig) *RegistrationService {
+	return &RegistrationService{
+		userService: userService,
+		mailer:      m,
+		cfg:         cfg,
+		baseURL:     strings.TrimSuffix(app.BaseURL, "/"),
+		secret:      []byte(app.Secret),
+	}
+}
+
+// Register creates a pending account and emails it a verification link.
+// The account cannot log in until the link has been followed.
+func (s *RegistrationService) Register(user *model.User) error {
+	if !s.cfg.Enabled {
+		return ErrRegistrationDisabled
+	}
+	if !s.domainAllowed(user.Email) {
+		return ErrEmailDomainNotAllowed
+	}
+
+	user.Status = model.UserStatusPending
+	if err := s.userService.Create(user); err != nil {
+		return err
+	}
+
+	// The account exists at this point; a lost email can be resent
+	if err := s.sendVerification(user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+	}
+	return nil
+}
+
+// ResendVerification sends a new verification link to a pending account.
+// Unknown or already verified addresses are silently ignored.
+func (s *RegistrationService) ResendVerification(email string) error {
+	if !s.cfg.Enabled {
+		return ErrRegistrationDisabled
+	}
+	user, err := s.userService.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.Status != model.UserStatusPending {
+		return nil
+	}
+	return s.sendVerification(user)
+}
+
+// VerifyEmail activates the account a verification token was issued for
+func (s *RegistrationService) VerifyEmail(token string) (*model.User, error) {
+	claims := &verificationClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(verificationAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	id, err := strconv.ParseUint(claims.Subject, 10, 32)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	user, err := s.userService.GetByID(uint(id))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+	// A link sent to a previous address must not verify the current one
+	if !strings.EqualFold(user.Email, claims.Email) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if user.Status == model.UserStatusPending {
+		if err := s.userService.MarkEmailVerified(user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// RequestEmailChange emails a confirmation link to the new address of a
+// user. The account keeps its current address until the link is followed,
+// so that nobody can take over an address they do not control.
+func (s *RegistrationService) RequestEmailChange(user *model.User, email string) error {
+	if !s.domainAllowed(email) {
+		return ErrEmailDomainNotAllowed
+	}
+	existing, err := s.userService.GetByEmail(email)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	if existing != nil && existing.ID != user.ID {
+		return ErrEmailAlreadyExists
+	}
+
+	now := time.Now()
+	claims := &emailChangeClaims{
+		Email:         email,
+		PreviousEmail: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			Audience:  jwt.ClaimStrings{emailChangeAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.VerificationTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "jiaxun",
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/auth/confirm-email?token=%s", s.baseURL, token)
+	return s.mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your new Jiaxun email address",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your new email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %d hours. If you did not ask for this change, you can ignore this email.\n",
+			user.Username, link, s.cfg.VerificationTTLHours),
+	})
+}
+
+// ConfirmEmailChange moves the account an email change token was issued for
+// to its new address
+func (s *RegistrationService) ConfirmEmailChange(token string) (*model.User, error) {
+	claims := &emailChangeClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(emailChangeAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	id, err := strconv.ParseUint(claims.Subject, 10, 32)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	user, err := s.userService.GetByID(uint(id))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+	// A link is spent once the address has changed, by it or otherwise
+	if !strings.EqualFold(user.Email, claims.PreviousEmail) {
+		return nil, ErrInvalidVerificationToken
+	}
+	// The allowlist may have changed since the link was sent
+	if !s.domainAllowed(claims.Email) {
+		return nil, ErrEmailDomainNotAllowed
+	}
+
+	if err := s.userService.SetEmail(user, claims.Email); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// domainAllowed checks an email address against the configured allowlist
+func (s *RegistrationService) domainAllowed(email string) bool {
+	if len(s.cfg.AllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, allowed := range s.cfg.AllowedDomains {
+		if strings.EqualFold(domain, strings.TrimSpace(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendVerification emails a signed verification link to the user
+func (s *RegistrationService) sendVerification(user *model.User) error {
+	now := time.Now()
+	claims := &verificationClaims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			Audience:  jwt.ClaimStrings{verificationAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.VerificationTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "jiaxun",
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/auth/verify-email?token=%s", s.baseURL, token)
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Jiaxun account",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %d hours. If you did not sign up, you can ignore this email.\n",
+			user.Username, link, s.cfg.VerificationTTLHours),
+	})
+}
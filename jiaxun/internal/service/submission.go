@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"jiaxun/internal/judge"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// SubmissionService errors
+var (
+	ErrJudgeAccountNotVerified = errors.New("judge account is not verified")
+	ErrSyncNotSupported        = errors.New("submissions cannot be synced from this platform")
+	ErrInvalidVerdict          = errors.New("invalid verdict")
+)
+
+// maxSyncErrorLength bounds the length of the sync errors recorded
+const maxSyncErrorLength = 512
+
+// verdicts lists the normalized verdicts of submissions
+var verdicts = map[string]bool{
+	model.VerdictAccepted:            true,
+	model.VerdictWrongAnswer:         true,
+	model.VerdictTimeLimitExceeded:   true,
+	model.VerdictMemoryLimitExceeded: true,
+	model.VerdictRuntimeError:        true,
+	model.VerdictCompilationError:    true,
+	model.VerdictOther:               true,
+}
+
+// SubmissionQuery selects submissions in a search. Zero fields match every
+// submission.
+type SubmissionQuery struct {
+	Platform string
+	Verdict  string
+	// SubmittedAfter is inclusive, SubmittedBefore exclusive
+	SubmittedAfter  *time.Time
+	SubmittedBefore *time.Time
+}
+
+// SubmissionService syncs the submissions of verified judge accounts from
+// their platforms and lists them
+type SubmissionService struct {
+	repo         *repository.SubmissionRepository
+	accountsRepo *repository.JudgeAccountRepository
+	sources      map[string]judge.SubmissionSource
+}
+
+// NewSubmissionService creates a new submission service instance
+func NewSubmissionService(repo *repository.SubmissionRepository, accountsRepo *repository.JudgeAccountRepository, sources map[string]judge.SubmissionSource) *SubmissionService {
+	return &SubmissionService{
+		repo:         repo,
+		accountsRepo: accountsRepo,
+		sources:      sources,
+	}
+}
+
+// Search returns the submissions of a user matching a query
+func (s *SubmissionService) Search(userID uint, query SubmissionQuery, page, pageSize int) ([]model.Submission, int64, error) {
+	if query.Platform != "" && !model.IsJudgePlatform(query.Platform) {
+		return nil, 0, ErrUnknownJudgePlatform
+	}
+	if query.Verdict != "" && !verdicts[query.Verdict] {
+		return nil, 0, ErrInvalidVerdict
+	}
+	return s.repo.Search(repository.SubmissionFilter{
+		UserID:          userID,
+		Platform:        query.Platform,
+		Verdict:         query.Verdict,
+		SubmittedAfter:  query.SubmittedAfter,
+		SubmittedBefore: query.SubmittedBefore,
+	}, page, pageSize)
+}
+
+// SyncAll syncs every verified account on a platform submissions can be
+// synced from. An account failing to sync does not stop the others; the
+// number of accounts synced is returned with the failures.
+func (s *SubmissionService) SyncAll(ctx context.Context) (int, error) {
+	platforms := make([]string, 0, len(s.sources))
+	for platform := range s.sources {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	accounts, err := s.accountsRepo.ListVerified(platforms)
+	if err != nil {
+		return 0, err
+	}
+
+	synced := 0
+	var errs []error
+	for i := range accounts {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		if _, err := s.sync(ctx, &accounts[i]); err != nil {
+			errs = append(errs, fmt.Errorf("%s handle %s: %w", accounts[i].Platform, accounts[i].Handle, err))
+			continue
+		}
+		synced++
+	}
+	return synced, errors.Join(errs...)
+}
+
+// Sync syncs a verified judge account of a user right away and returns the
+// number of submissions fetched
+func (s *SubmissionService) Sync(ctx context.Context, userID, accountID uint) (*model.JudgeAccount, int, error) {
+	account, err := s.accountsRepo.Get(userID, accountID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, 0, ErrJudgeAccountNotFound
+		}
+		return nil, 0, err
+	}
+	if !account.Verified {
+		return nil, 0, ErrJudgeAccountNotVerified
+	}
+
+	fetched, err := s.sync(ctx, account)
+	if err != nil {
+		return nil, 0, err
+	}
+	return account, fetched, nil
+}
+
+// sync fetches the submissions of an account made since its last sync and
+// stores them, or records why it failed
+func (s *SubmissionService) sync(ctx context.Context, account *model.JudgeAccount) (int, error) {
+	source, ok := s.sources[account.Platform]
+	if !ok {
+		return 0, ErrSyncNotSupported
+	}
+
+	fetched, cursor, err := source.Submissions(ctx, account.Handle, account.SyncCursor)
+	now := time.Now()
+	if err != nil {
+		message := err.Error()
+		if len(message) > maxSyncErrorLength {
+			message = message[:maxSyncErrorLength]
+		}
+		if err := s.repo.RecordSyncError(account, message, now); err != nil {
+			log.Printf("Failed to record sync error of judge account %d: %v", account.ID, err)
+		}
+		if errors.Is(err, judge.ErrHandleNotFound) {
+			return 0, ErrHandleNotFound
+		}
+		return 0, fmt.Errorf("%w: %v", ErrJudgeUnavailable, err)
+	}
+
+	submissions := make([]model.Submission, len(fetched))
+	for i, f := range fetched {
+		problem := &model.Problem{
+			Platform:   account.Platform,
+			ExternalID: f.Problem.ExternalID,
+			Name:       f.Problem.Name,
+			URL:        f.Problem.URL,
+			Tags:       f.Problem.Tags,
+		}
+		if f.Problem.Rating != 0 {
+			rating := f.Problem.Rating
+			problem.Rating = &rating
+		}
+		submissions[i] = model.Submission{
+			UserID:         account.UserID,
+			JudgeAccountID: account.ID,
+			Platform:       account.Platform,
+			ExternalID:     f.ExternalID,
+			Verdict:        f.Verdict,
+			Language:       f.Language,
+			SubmittedAt:    f.SubmittedAt,
+			Problem:        problem,
+		}
+	}
+
+	if err := s.repo.StoreSync(account, submissions, cursor, now); err != nil {
+		return 0, err
+	}
+	account.SyncCursor = cursor
+	account.SyncedAt = &now
+	account.SyncError = ""
+	return len(submissions), nil
+}
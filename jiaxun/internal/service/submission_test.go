@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"jiaxun/internal/judge"
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+)
+
+// replaySource returns the recorded results of successive syncs in turn
+type replaySource struct {
+	syncs []sourceSync
+	// cursors records the cursor each sync was asked to resume from
+	cursors []string
+}
+
+type sourceSync struct {
+	submissions []judge.Submission
+	cursor      string
+}
+
+func (s *replaySource) Submissions(_ context.Context, _, cursor string) ([]judge.Submission, string, error) {
+	s.cursors = append(s.cursors, cursor)
+	next := s.syncs[0]
+	s.syncs = s.syncs[1:]
+	return next.submissions, next.cursor, nil
+}
+
+func TestSubmissionSyncStoresDuplicatesOnce(t *testing.T) {
+	db := openTestDB(t)
+	user := &model.User{Username: "ada", Email: "ada@example.org", Password: "password"}
+	if err := newTestUserService(db).Create(user); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	accountsRepo := repository.NewJudgeAccountRepository(db)
+	account := &model.JudgeAccount{UserID: user.ID, Platform: model.JudgePlatformCodeforces, Handle: "ada", Verified: true}
+	if err := accountsRepo.Create(account); err != nil {
+		t.Fatalf("creating judge account: %v", err)
+	}
+
+	watermelon := judge.Problem{ExternalID: "4A", Name: "Watermelon", Rating: 800, Tags: []string{"math"}}
+	at := time.Unix(1760000000, 0)
+	submission := func(id, verdict string, problem judge.Problem, minutes int) judge.Submission {
+		return judge.Submission{ExternalID: id, Problem: problem, Verdict: verdict, Language: "Go", SubmittedAt: at.Add(time.Duration(minutes) * time.Minute)}
+	}
+	// The second sync lists submission 2 again, now rejudged, as sources
+	// may return a submission more than once
+	source := &replaySource{syncs: []sourceSync{
+		{
+			submissions: []judge.Submission{
+				submission("1", model.VerdictWrongAnswer, watermelon, 1),
+				submission("2", model.VerdictWrongAnswer, watermelon, 2),
+			},
+			cursor: "2",
+		},
+		{
+			submissions: []judge.Submission{
+				submission("2", model.VerdictAccepted, watermelon, 2),
+				submission("3", model.VerdictAccepted, judge.Problem{ExternalID: "1A", Name: "Theatre Square"}, 3),
+			},
+			cursor: "3",
+		},
+	}}
+	service := NewSubmissionService(repository.NewSubmissionRepository(db), accountsRepo, map[string]judge.SubmissionSource{
+		model.JudgePlatformCodeforces: source,
+	})
+
+	for i, want := range []int{2, 2} {
+		_, fetched, err := service.Sync(context.Background(), user.ID, account.ID)
+		if err != nil {
+			t.Fatalf("sync %d: %v", i+1, err)
+		}
+		if fetched != want {
+			t.Errorf("sync %d fetched %d submissions, want %d", i+1, fetched, want)
+		}
+	}
+	if len(source.cursors) != 2 || source.cursors[0] != "" || source.cursors[1] != "2" {
+		t.Errorf("syncs resumed from %q, want from \"\" then \"2\"", source.cursors)
+	}
+
+	submissions, total, err := service.Search(user.ID, SubmissionQuery{}, 1, 10)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if total != 3 {
+		t.Fatalf("%d submissions stored, want 3", total)
+	}
+	verdicts := make(map[string]string)
+	for _, s := range submissions {
+		verdicts[s.ExternalID] = s.Verdict
+	}
+	if verdicts["2"] != model.VerdictAccepted {
+		t.Errorf("rejudged submission verdict = %s, want %s", verdicts["2"], model.VerdictAccepted)
+	}
+
+	var problems int64
+	if err := db.Model(&model.Problem{}).Count(&problems).Error; err != nil {
+		t.Fatalf("counting problems: %v", err)
+	}
+	if problems != 2 {
+		t.Errorf("%d problems stored, want 2", problems)
+	}
+
+	stored, err := accountsRepo.Get(user.ID, account.ID)
+	if err != nil {
+		t.Fatalf("getting judge account: %v", err)
+	}
+	if stored.SyncCursor != "3" || stored.SyncedAt == nil || stored.SyncError != "" {
+		t.Errorf("account cursor %q synced at %v with error %q, want cursor 3 synced without error", stored.SyncCursor, stored.SyncedAt, stored.SyncError)
+	}
+}
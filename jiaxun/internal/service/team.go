@@ -0,0 +1,324 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/policy"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// TeamService errors
+var (
+	ErrTeamNotFound          = errors.New("team not found")
+	ErrNotTeamMember         = errors.New("user is not a member of the team")
+	ErrAlreadyTeamMember     = errors.New("user is already a member of the team")
+	ErrTeamFull              = errors.New("team has reached its maximum size")
+	ErrCaptainCannotLeave    = errors.New("captain must transfer captaincy before leaving")
+	ErrTeamRequestNotFound   = errors.New("team request not found")
+	ErrTeamRequestPending    = errors.New("a pending request already exists")
+	ErrTeamRequestClosed     = errors.New("team request has already been answered")
+	ErrNotTeamRequestHandler = errors.New("user cannot respond to this request")
+)
+
+// TeamService handles business logic for teams and their memberships.
+// It keeps the invariants that every team has exactly one captain and
+// never exceeds the configured maximum size.
+type TeamService struct {
+	repo        *repository.TeamRepository
+	userService *UserService
+	maxSize     int
+}
+
+// NewTeamService creates a new team service instance
+func NewTeamService(repo *repository.TeamRepository, userService *UserService, maxSize int) *TeamService {
+	return &TeamService{
+		repo:        repo,
+		userService: userService,
+		maxSize:     maxSize,
+	}
+}
+
+// CreateTeam creates a team with the given user as its captain
+func (s *TeamService) CreateTeam(name string, captainID uint) (*model.Team, error) {
+	team := &model.Team{
+		TeamName:  name,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.CreateWithCaptain(team, captainID); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// GetTeam retrieves a team by ID
+func (s *TeamService) GetTeam(id uint) (*model.Team, error) {
+	team, err := s.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, err
+	}
+	return team, nil
+}
+
+// ListTeams returns paginated teams
+func (s *TeamService) ListTeams(page, pageSize int) ([]model.Team, int64, error) {
+	return s.repo.List(page, pageSize)
+}
+
+// ListTeamsByUser returns all teams a user is a member of
+func (s *TeamService) ListTeamsByUser(userID uint) ([]model.Team, error) {
+	return s.repo.ListByUser(userID)
+}
+
+// GetMembers returns the memberships of a team
+func (s *TeamService) GetMembers(teamID uint) ([]model.TeamMembership, error) {
+	if _, err := s.GetTeam(teamID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetMemberships(teamID)
+}
+
+// Invite sends an invitation from the team to a user
+func (s *TeamService) Invite(subject policy.Subject, teamID, userID uint) (*model.TeamRequest, error) {
+	if _, err := s.authorize(subject, teamID); err != nil {
+		return nil, err
+	}
+
+	exists, err := s.userService.Exists(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	return s.openRequest(teamID, userID, model.TeamRequestInvitation)
+}
+
+// RequestToJoin asks the captain of a team to accept the user as a member
+func (s *TeamService) RequestToJoin(teamID, userID uint) (*model.TeamRequest, error) {
+	if _, err := s.GetTeam(teamID); err != nil {
+		return nil, err
+	}
+	return s.openRequest(teamID, userID, model.TeamRequestJoin)
+}
+
+// ListTeamRequests returns the pending requests of a team
+func (s *TeamService) ListTeamRequests(subject policy.Subject, teamID uint) ([]model.TeamRequest, error) {
+	if _, err := s.authorize(subject, teamID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListPendingRequestsByTeam(teamID)
+}
+
+// ListInvitations returns the pending invitations addressed to a user
+func (s *TeamService) ListInvitations(userID uint) ([]model.TeamRequest, error) {
+	return s.repo.ListPendingRequestsByUser(userID, model.TeamRequestInvitation)
+}
+
+// RespondToRequest accepts or declines a pending request. Invitations are
+// answered by the invited user, join requests by those managing the team.
+func (s *TeamService) RespondToRequest(subject policy.Subject, requestID uint, accept bool) (*model.TeamRequest, error) {
+	request, err := s.repo.GetRequestByID(requestID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamRequestNotFound
+		}
+		return nil, err
+	}
+	if request.Status != model.TeamRequestPending {
+		return nil, ErrTeamRequestClosed
+	}
+
+	switch request.Kind {
+	case model.TeamRequestInvitation:
+		if request.UserID != subject.UserID {
+			return nil, ErrNotTeamRequestHandler
+		}
+	case model.TeamRequestJoin:
+		if _, err := s.authorize(subject, request.TeamID); err != nil {
+			if errors.Is(err, policy.ErrForbidden) {
+				return nil, ErrNotTeamRequestHandler
+			}
+			return nil, err
+		}
+	}
+
+	if accept {
+		if err := s.checkCanJoin(request.TeamID, request.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The size is checked again while the team is locked, as other requests
+	// may have been accepted since
+	if err := s.repo.CloseRequest(request, accept, s.maxSize); err != nil {
+		if errors.Is(err, repository.ErrTeamFull) {
+			return nil, ErrTeamFull
+		}
+		return nil, err
+	}
+	return request, nil
+}
+
+// Leave removes a user from a team. The captain may only leave once the
+// captaincy has been transferred, unless they are the last member, in which
+// case the team is disbanded and moved to the trash.
+func (s *TeamService) Leave(teamID, userID uint) error {
+	membership, err := s.getMembership(teamID, userID)
+	if err != nil {
+		return err
+	}
+
+	if membership.Role == model.TeamRoleCaptain {
+		count, err := s.repo.CountMembers(teamID)
+		if err != nil {
+			return err
+		}
+		if count > 1 {
+			return ErrCaptainCannotLeave
+		}
+		return s.repo.Delete(teamID)
+	}
+
+	return s.repo.RemoveMember(teamID, userID)
+}
+
+// DeleteTeam moves a team to the trash, from which it can be restored with
+// its members
+func (s *TeamService) DeleteTeam(subject policy.Subject, teamID uint) error {
+	team, err := s.GetTeam(teamID)
+	if err != nil {
+		return err
+	}
+	if err := policy.Teams.Authorize(subject, policy.ActionDelete, team); err != nil {
+		return err
+	}
+	return s.repo.Delete(teamID)
+}
+
+// RemoveMember removes another member from the team. The captain cannot
+// be removed before the captaincy has been transferred.
+func (s *TeamService) RemoveMember(subject policy.Subject, teamID, userID uint) error {
+	if _, err := s.authorize(subject, teamID); err != nil {
+		return err
+	}
+	membership, err := s.getMembership(teamID, userID)
+	if err != nil {
+		return err
+	}
+	if membership.Role == model.TeamRoleCaptain {
+		return ErrCaptainCannotLeave
+	}
+	return s.repo.RemoveMember(teamID, userID)
+}
+
+// TransferCaptain hands the captaincy over to another member. The captain
+// is looked up even if they are in the trash, so that the captaincy of a
+// deleted user's team can still be handed over.
+func (s *TeamService) TransferCaptain(subject policy.Subject, teamID, newCaptainID uint) error {
+	if _, err := s.authorize(subject, teamID); err != nil {
+		return err
+	}
+	membership, err := s.getMembership(teamID, newCaptainID)
+	if err != nil {
+		return err
+	}
+	if membership.Role == model.TeamRoleCaptain {
+		return nil
+	}
+	captain, err := s.repo.GetCaptain(teamID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotTeamMember
+		}
+		return err
+	}
+	return s.repo.TransferCaptain(teamID, captain.UserID, newCaptainID)
+}
+
+// openRequest creates a pending request after checking the user could join
+func (s *TeamService) openRequest(teamID, userID uint, kind string) (*model.TeamRequest, error) {
+	if err := s.checkCanJoin(teamID, userID); err != nil {
+		return nil, err
+	}
+
+	pending, err := s.repo.HasPendingRequest(teamID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrTeamRequestPending
+	}
+
+	request := &model.TeamRequest{
+		TeamID:    teamID,
+		UserID:    userID,
+		Kind:      kind,
+		Status:    model.TeamRequestPending,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.CreateRequest(request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// checkCanJoin verifies that the user is not yet a member and the team has room
+func (s *TeamService) checkCanJoin(teamID, userID uint) error {
+	_, err := s.repo.GetMembership(teamID, userID)
+	if err == nil {
+		return ErrAlreadyTeamMember
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	count, err := s.repo.CountMembers(teamID)
+	if err != nil {
+		return err
+	}
+	if count >= int64(s.maxSize) {
+		return ErrTeamFull
+	}
+	return nil
+}
+
+// authorize loads the team with its memberships and checks that the
+// subject may manage it
+func (s *TeamService) authorize(subject policy.Subject, teamID uint) (*model.Team, error) {
+	team, err := s.GetTeam(teamID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.repo.GetMemberships(teamID)
+	if err != nil {
+		return nil, err
+	}
+	team.TeamMemberships = members
+	if err := policy.Teams.Authorize(subject, policy.ActionManage, team); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// getMembership retrieves the membership of a user in an existing team
+func (s *TeamService) getMembership(teamID, userID uint) (*model.TeamMembership, error) {
+	if _, err := s.GetTeam(teamID); err != nil {
+		return nil, err
+	}
+	membership, err := s.repo.GetMembership(teamID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotTeamMember
+		}
+		return nil, err
+	}
+	return membership, nil
+}
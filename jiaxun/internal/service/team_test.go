@@ -0,0 +1,146 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/policy"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+func TestTransferCaptainOfTrashedCaptain(t *testing.T) {
+	db := openTestDB(t)
+	userService := newTestUserService(db)
+	teamRepo := repository.NewTeamRepository(db)
+	service := NewTeamService(teamRepo, userService, 3)
+
+	captain := &model.User{Username: "ada", Email: "ada@example.org", Password: "password"}
+	member := &model.User{Username: "grace", Email: "grace@example.org", Password: "password"}
+	for _, user := range []*model.User{captain, member} {
+		if err := userService.Create(user); err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+	}
+	team, err := service.CreateTeam("Analytical Engines", captain.ID)
+	if err != nil {
+		t.Fatalf("CreateTeam: %v", err)
+	}
+	if err := teamRepo.AddMember(&model.TeamMembership{UserID: member.ID, TeamID: team.TeamID, Role: model.TeamRoleMember, JoinedAt: time.Now()}); err != nil {
+		t.Fatalf("adding member: %v", err)
+	}
+	if err := userService.Delete(captain.ID); err != nil {
+		t.Fatalf("deleting captain: %v", err)
+	}
+
+	staff := policy.Subject{UserID: 100, Permissions: []string{model.PermTeamsApprove}}
+	if err := service.TransferCaptain(staff, team.TeamID, member.ID); err != nil {
+		t.Fatalf("TransferCaptain: %v", err)
+	}
+
+	for userID, want := range map[uint]string{captain.ID: model.TeamRoleMember, member.ID: model.TeamRoleCaptain} {
+		membership, err := teamRepo.GetMembership(team.TeamID, userID)
+		if err != nil {
+			t.Fatalf("getting membership of user %d: %v", userID, err)
+		}
+		if membership.Role != want {
+			t.Errorf("user %d is %s, want %s", userID, membership.Role, want)
+		}
+	}
+
+	// The new captain manages the team on their own
+	if _, err := service.ListTeamRequests(policy.Subject{UserID: member.ID}, team.TeamID); err != nil {
+		t.Errorf("new captain cannot manage the team: %v", err)
+	}
+}
+
+func TestRespondToRequestRechecksSize(t *testing.T) {
+	db := openTestDB(t)
+	userService := newTestUserService(db)
+	teamRepo := repository.NewTeamRepository(db)
+	service := NewTeamService(teamRepo, userService, 2)
+
+	var users []*model.User
+	for _, name := range []string{"ada", "grace", "hedy"} {
+		user := &model.User{Username: name, Email: name + "@example.org", Password: "password"}
+		if err := userService.Create(user); err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		users = append(users, user)
+	}
+	captain, invited, joining := users[0], users[1], users[2]
+	team, err := service.CreateTeam("Analytical Engines", captain.ID)
+	if err != nil {
+		t.Fatalf("CreateTeam: %v", err)
+	}
+	invitation, err := service.Invite(policy.Subject{UserID: captain.ID}, team.TeamID, invited.ID)
+	if err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	request, err := service.RequestToJoin(team.TeamID, joining.ID)
+	if err != nil {
+		t.Fatalf("RequestToJoin: %v", err)
+	}
+
+	// The captain accepts the join request while the invitation is being
+	// accepted, after the team was found to have room for one more
+	accepted := false
+	err = db.Callback().Update().Before("gorm:update").Register("test:accept", func(tx *gorm.DB) {
+		if accepted || tx.Statement.Table != "team_request" {
+			return
+		}
+		accepted = true
+		if _, err := service.RespondToRequest(policy.Subject{UserID: captain.ID}, request.RequestID, true); err != nil {
+			t.Errorf("accepting the join request: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("registering callback: %v", err)
+	}
+
+	if _, err := service.RespondToRequest(policy.Subject{UserID: invited.ID}, invitation.RequestID, true); !errors.Is(err, ErrTeamFull) {
+		t.Fatalf("RespondToRequest = %v, want ErrTeamFull", err)
+	}
+	if !accepted {
+		t.Fatal("the join request was not accepted concurrently")
+	}
+	count, err := teamRepo.CountMembers(team.TeamID)
+	if err != nil {
+		t.Fatalf("CountMembers: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("team has %d members, want 2", count)
+	}
+	// The refused invitation stays pending, as the transaction was rolled back
+	got, err := teamRepo.GetRequestByID(invitation.RequestID)
+	if err != nil {
+		t.Fatalf("GetRequestByID: %v", err)
+	}
+	if got.Status != model.TeamRequestPending {
+		t.Errorf("invitation is %s, want %s", got.Status, model.TeamRequestPending)
+	}
+}
+
+func TestDeleteTeam(t *testing.T) {
+	f := newContestFixture(t)
+	ada, grace := f.users[0], f.users[1]
+	team := f.team(t, "Analytical Engines", ada, grace)
+
+	// Captains disband their team by leaving it last, not by deleting it
+	if err := f.teams.DeleteTeam(policy.Subject{UserID: ada.ID}, team.TeamID); !errors.Is(err, policy.ErrForbidden) {
+		t.Fatalf("captain deleting the team = %v, want ErrForbidden", err)
+	}
+	staff := policy.Subject{UserID: 100, Permissions: []string{model.PermTeamsApprove}}
+	if err := f.teams.DeleteTeam(staff, team.TeamID); err != nil {
+		t.Fatalf("DeleteTeam: %v", err)
+	}
+	if _, err := f.teams.GetTeam(team.TeamID); !errors.Is(err, ErrTeamNotFound) {
+		t.Errorf("GetTeam after deleting = %v, want ErrTeamNotFound", err)
+	}
+	if err := f.teams.DeleteTeam(staff, team.TeamID); !errors.Is(err, ErrTeamNotFound) {
+		t.Errorf("deleting twice = %v, want ErrTeamNotFound", err)
+	}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/policy"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// TrainingService errors
+var (
+	ErrTrainingPlanNotFound  = errors.New("training plan not found")
+	ErrInvalidTrainingDates  = errors.New("training plan end date must be after start date")
+	ErrTrainingPlanEnded     = errors.New("training plan has already ended")
+	ErrAlreadyEnrolled       = errors.New("already enrolled in training plan")
+	ErrParticipationNotFound = errors.New("participation not found")
+)
+
+// TrainingService handles business logic for training plans and their participants
+type TrainingService struct {
+	repo        *repository.TrainingPlanRepository
+	userService *UserService
+	teamService *TeamService
+}
+
+// NewTrainingService creates a new training service instance
+func NewTrainingService(repo *repository.TrainingPlanRepository, userService *UserService, teamService *TeamService) *TrainingService {
+	return &TrainingService{
+		repo:        repo,
+		userService: userService,
+		teamService: teamService,
+	}
+}
+
+// TrainingPlanUpdate describes a partial update of a training plan.
+// Nil fields are left untouched.
+type TrainingPlanUpdate struct {
+	Title       *string
+	Description *string
+	StartDate   *time.Time
+	EndDate     *time.Time
+}
+
+// CreatePlan creates a new training plan
+func (s *TrainingService) CreatePlan(plan *model.TrainingPlan) error {
+	if !plan.EndDate.After(plan.StartDate) {
+		return ErrInvalidTrainingDates
+	}
+	return s.repo.Create(plan)
+}
+
+// GetPlan retrieves a training plan by ID
+func (s *TrainingService) GetPlan(id uint) (*model.TrainingPlan, error) {
+	plan, err := s.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTrainingPlanNotFound
+		}
+		return nil, err
+	}
+	return plan, nil
+}
+
+// AuthorizePlan retrieves a training plan and checks that the subject may
+// perform the action on it
+func (s *TrainingService) AuthorizePlan(subject policy.Subject, action policy.Action, id uint) (*model.TrainingPlan, error) {
+	plan, err := s.GetPlan(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.TrainingPlans.Authorize(subject, action, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// ListPlans returns paginated training plans
+func (s *TrainingService) ListPlans(page, pageSize int) ([]model.TrainingPlan, int64, error) {
+	return s.repo.List(page, pageSize)
+}
+
+// UpdatePlan applies the non-nil fields of update to the plan
+// and returns the stored result
+func (s *TrainingService) UpdatePlan(subject policy.Subject, id uint, update TrainingPlanUpdate) (*model.TrainingPlan, error) {
+	plan, err := s.AuthorizePlan(subject, policy.ActionUpdate, id)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	if update.Title != nil {
+		fields["title"] = *update.Title
+		plan.Title = *update.Title
+	}
+	if update.Description != nil {
+		fields["description"] = *update.Description
+		plan.Description = *update.Description
+	}
+	if update.StartDate != nil {
+		fields["start_date"] = *update.StartDate
+		plan.StartDate = *update.StartDate
+	}
+	if update.EndDate != nil {
+		fields["end_date"] = *update.EndDate
+		plan.EndDate = *update.EndDate
+	}
+
+	if len(fields) == 0 {
+		return plan, nil
+	}
+	if !plan.EndDate.After(plan.StartDate) {
+		return nil, ErrInvalidTrainingDates
+	}
+
+	if err := s.repo.UpdateFields(plan, fields); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// DeletePlan moves a training plan to the trash. Its participations are
+// kept until it is purged.
+func (s *TrainingService) DeletePlan(subject policy.Subject, id uint) error {
+	if _, err := s.AuthorizePlan(subject, policy.ActionDelete, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(id)
+}
+
+// GetParticipations lists all participations of a training plan
+func (s *TrainingService) GetParticipations(planID uint) ([]model.TrainingParticipation, error) {
+	if _, err := s.GetPlan(planID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetParticipations(planID)
+}
+
+// EnrollUser adds an individual user to a training plan
+func (s *TrainingService) EnrollUser(planID, userID uint) (*model.TrainingParticipation, error) {
+	if err := s.checkOpen(planID); err != nil {
+		return nil, err
+	}
+
+	exists, err := s.userService.Exists(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	enrolled, err := s.repo.IsUserEnrolled(planID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enrolled {
+		return nil, ErrAlreadyEnrolled
+	}
+
+	participation := &model.TrainingParticipation{
+		TrainingPlanID: planID,
+		UserID:         &userID,
+		JoinedAt:       time.Now(),
+	}
+	if err := s.repo.CreateParticipation(participation); err != nil {
+		return nil, err
+	}
+	return participation, nil
+}
+
+// EnrollTeam adds a whole team to a training plan
+func (s *TrainingService) EnrollTeam(planID, teamID uint) (*model.TrainingParticipation, error) {
+	if err := s.checkOpen(planID); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.teamService.GetTeam(teamID); err != nil {
+		return nil, err
+	}
+
+	enrolled, err := s.repo.IsTeamEnrolled(planID, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if enrolled {
+		return nil, ErrAlreadyEnrolled
+	}
+
+	participation := &model.TrainingParticipation{
+		TrainingPlanID: planID,
+		TeamID:         &teamID,
+		JoinedAt:       time.Now(),
+	}
+	if err := s.repo.CreateParticipation(participation); err != nil {
+		return nil, err
+	}
+	return participation, nil
+}
+
+// RemoveParticipation removes a participant from a training plan
+func (s *TrainingService) RemoveParticipation(subject policy.Subject, planID, participationID uint) error {
+	if _, err := s.AuthorizePlan(subject, policy.ActionManage, planID); err != nil {
+		return err
+	}
+	if _, err := s.repo.GetParticipation(planID, participationID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrParticipationNotFound
+		}
+		return err
+	}
+	return s.repo.DeleteParticipation(participationID)
+}
+
+// ListActivePlans returns the currently running plans a user takes part in,
+// either individually or through a team
+func (s *TrainingService) ListActivePlans(userID uint) ([]model.TrainingPlan, error) {
+	return s.repo.ListActiveByUser(userID, time.Now())
+}
+
+// checkOpen verifies that the plan exists and still accepts participants
+func (s *TrainingService) checkOpen(planID uint) error {
+	plan, err := s.GetPlan(planID)
+	if err != nil {
+		return err
+	}
+	if time.Now().After(plan.EndDate) {
+		return ErrTrainingPlanEnded
+	}
+	return nil
+}
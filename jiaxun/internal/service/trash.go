@@ -0,0 +1,244 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// TrashService errors
+var (
+	ErrUnknownTrashKind = errors.New("unknown kind of deleted entity")
+	ErrNotInTrash       = errors.New("not found in the trash")
+)
+
+// Kinds of entities kept in the trash
+const (
+	TrashUsers         = "users"
+	TrashTeams         = "teams"
+	TrashContests      = "contests"
+	TrashTrainingPlans = "training-plans"
+)
+
+// TrashKinds lists the kinds of entities kept in the trash
+var TrashKinds = []string{TrashUsers, TrashTeams, TrashContests, TrashTrainingPlans}
+
+// trashBin holds the deleted entities of one kind
+type trashBin interface {
+	list(page, pageSize int) (interface{}, int64, error)
+	restore(id uint) error
+	purge(id uint) error
+	purgeBefore(cutoff time.Time) (int64, error)
+}
+
+// softDeleteBin is the trash bin of a model with a DeletedAt field
+type softDeleteBin[T any] struct {
+	repo repository.SoftDeleteRepository[T]
+	// check refuses to restore an entity that conflicts with current ones
+	check func(obj *T) error
+	// checkPurge refuses to purge an entity that must be kept
+	checkPurge func(obj *T) error
+	// redact removes secrets from listed entities
+	redact func(objs []T)
+}
+
+func (b softDeleteBin[T]) list(page, pageSize int) (interface{}, int64, error) {
+	objs, total, err := b.repo.ListDeleted(page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	if b.redact != nil {
+		b.redact(objs)
+	}
+	return objs, total, nil
+}
+
+func (b softDeleteBin[T]) restore(id uint) error {
+	obj, err := b.get(id)
+	if err != nil {
+		return err
+	}
+	if b.check != nil {
+		if err := b.check(obj); err != nil {
+			return err
+		}
+	}
+	return b.repo.Restore(obj)
+}
+
+func (b softDeleteBin[T]) purge(id uint) error {
+	obj, err := b.get(id)
+	if err != nil {
+		return err
+	}
+	if b.checkPurge != nil {
+		if err := b.checkPurge(obj); err != nil {
+			return err
+		}
+	}
+	return b.repo.Purge(obj)
+}
+
+func (b softDeleteBin[T]) purgeBefore(cutoff time.Time) (int64, error) {
+	if b.checkPurge == nil {
+		return b.repo.PurgeDeletedBefore(cutoff)
+	}
+
+	// Entities that must be kept are skipped one by one
+	objs, err := b.repo.ListDeletedBefore(cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var purged int64
+	for i := range objs {
+		if err := b.checkPurge(&objs[i]); err != nil {
+			continue
+		}
+		if err := b.repo.Purge(&objs[i]); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// get retrieves an entity in the trash, mapping a missing record to ErrNotInTrash
+func (b softDeleteBin[T]) get(id uint) (*T, error) {
+	obj, err := b.repo.GetDeletedByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotInTrash
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+// TrashService keeps deleted users, teams, contests and training plans for
+// a retention period, during which they can be restored together with
+// their memberships, registrations and participations. Past it, they are
+// purged for good.
+type TrashService struct {
+	bins        map[string]trashBin
+	userService *UserService
+	retention   time.Duration
+}
+
+// NewTrashService creates a new trash service instance
+func NewTrashService(users *repository.UserRepository, teams *repository.TeamRepository, contests *repository.ContestRepository, plans *repository.TrainingPlanRepository, userService *UserService, retention time.Duration) *TrashService {
+	s := &TrashService{
+		userService: userService,
+		retention:   retention,
+	}
+	s.bins = map[string]trashBin{
+		TrashUsers: softDeleteBin[model.User]{
+			repo:       users,
+			check:      s.checkUserRestore,
+			checkPurge: s.checkUserPurge,
+			redact:     redactUsers,
+		},
+		TrashTeams:         softDeleteBin[model.Team]{repo: teams},
+		TrashContests:      softDeleteBin[model.Contest]{repo: contests},
+		TrashTrainingPlans: softDeleteBin[model.TrainingPlan]{repo: plans},
+	}
+	return s
+}
+
+// Retention returns how long deleted entities are kept
+func (s *TrashService) Retention() time.Duration {
+	return s.retention
+}
+
+// List returns the deleted entities of a kind with pagination, most
+// recently deleted first
+func (s *TrashService) List(kind string, page, pageSize int) (interface{}, int64, error) {
+	bin, err := s.bin(kind)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bin.list(page, pageSize)
+}
+
+// Restore takes a deleted entity out of the trash. Users cannot be restored
+// while their username or email belongs to another user.
+func (s *TrashService) Restore(kind string, id uint) error {
+	bin, err := s.bin(kind)
+	if err != nil {
+		return err
+	}
+	return bin.restore(id)
+}
+
+// Purge permanently deletes an entity in the trash, together with its
+// memberships, registrations and participations
+func (s *TrashService) Purge(kind string, id uint) error {
+	bin, err := s.bin(kind)
+	if err != nil {
+		return err
+	}
+	return bin.purge(id)
+}
+
+// PurgeExpired permanently deletes the entities kept past the retention
+// period. An admin stays in the trash while no other admin is left.
+func (s *TrashService) PurgeExpired() error {
+	cutoff := time.Now().Add(-s.retention)
+	for _, kind := range TrashKinds {
+		if _, err := s.bins[kind].purgeBefore(cutoff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bin returns the trash bin of a kind of entities
+func (s *TrashService) bin(kind string) (trashBin, error) {
+	bin, ok := s.bins[kind]
+	if !ok {
+		return nil, ErrUnknownTrashKind
+	}
+	return bin, nil
+}
+
+// checkUserRestore refuses to restore a user whose username or email has
+// been taken since they were deleted
+func (s *TrashService) checkUserRestore(user *model.User) error {
+	if _, err := s.userService.GetByUsername(user.Username); err == nil {
+		return ErrUserAlreadyExists
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	if _, err := s.userService.GetByEmail(user.Email); err == nil {
+		return ErrEmailAlreadyExists
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	return nil
+}
+
+// checkUserPurge refuses to purge an admin while no other admin is left,
+// so that they can still be restored
+func (s *TrashService) checkUserPurge(user *model.User) error {
+	if user.Role != model.RoleAdmin {
+		return nil
+	}
+	admins, err := s.userService.CountByRole(model.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins < 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// redactUsers removes the password hashes of users
+func redactUsers(users []model.User) {
+	for i := range users {
+		users[i].Password = ""
+	}
+}
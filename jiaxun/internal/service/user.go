@@ -2,6 +2,9 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"jiaxun/internal/model"
@@ -17,8 +20,43 @@ var (
 	ErrUserAlreadyExists  = errors.New("user already exists")
 	ErrEmailAlreadyExists = errors.New("email already in use")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrEmailNotVerified   = errors.New("email address not verified")
+	ErrInvalidSortField   = errors.New("invalid sort field")
 )
 
+// Fields users can be sorted by
+var userSortFields = map[string]bool{
+	"id":         true,
+	"username":   true,
+	"email":      true,
+	"full_name":  true,
+	"role":       true,
+	"created_at": true,
+}
+
+// UserQuery selects and orders users in a search. Zero fields match every user.
+type UserQuery struct {
+	// Q matches part of the username, email or full name, ignoring case
+	Q      string
+	Roles  []string
+	Status string
+	TeamID uint
+	// ContestID and TrainingPlanID match users enrolled themselves or
+	// through one of their teams
+	ContestID      uint
+	TrainingPlanID uint
+	// Handle matches part of the handle of a linked judge account, ignoring
+	// case; Platform restricts the match to accounts on one platform
+	Handle   string
+	Platform string
+	// CreatedAfter is inclusive, CreatedBefore exclusive
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Sort is a comma-separated list of fields, each prefixed with "-" to
+	// sort in descending order
+	Sort string
+}
+
 // HashPassword generates a bcrypt hash from a password string
 func HashPassword(password string) (string, error) {
 	// Generate the hash with a cost factor (bcrypt cost of 10 is a good trade-off)
@@ -41,14 +79,23 @@ func CheckPassword(provided, recorded string) error {
 
 // UserService handles business logic for user operations
 type UserService struct {
-	repo repository.UserRepository
+	repo           repository.UserRepository
+	authenticators []Authenticator
 }
 
-// NewUserService creates a new user service instance
+// NewUserService creates a new user service instance that checks passwords
+// against the local password hashes
 func NewUserService(repo repository.UserRepository) *UserService {
-	return &UserService{
+	s := &UserService{
 		repo: repo,
 	}
+	s.authenticators = []Authenticator{NewLocalAuthenticator(s)}
+	return s
+}
+
+// SetAuthenticators replaces the authenticators passwords are checked with
+func (s *UserService) SetAuthenticators(authenticators ...Authenticator) {
+	s.authenticators = authenticators
 }
 
 // Create registers a new user
@@ -75,6 +122,13 @@ func (s *UserService) Create(user *model.User) error {
 	now := time.Now()
 	user.CreatedAt = now
 
+	if user.Status == "" {
+		user.Status = model.UserStatusActive
+	}
+	if user.Role == "" {
+		user.Role = model.RoleStudent
+	}
+
 	// Password hashing
 	hashedPassword, err := HashPassword(user.Password)
 	if err != nil {
@@ -165,43 +219,119 @@ func (s *UserService) Update(user *model.User) error {
 	return s.repo.Update(user)
 }
 
-// Delete removes a user by ID
+// Delete moves a user to the trash. Their memberships, registrations and
+// participations are kept until they are purged. The last admin cannot be
+// deleted, as nobody would be left to restore them.
 func (s *UserService) Delete(id uint) error {
-	_, err := s.repo.GetByID(id)
+	user, err := s.repo.GetByID(id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return ErrUserNotFound
 		}
 		return err
 	}
+	if user.Role == model.RoleAdmin {
+		admins, err := s.repo.CountByRole(model.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return ErrLastAdmin
+		}
+	}
 	return s.repo.Delete(id)
 }
 
-// Authenticate validates user credentials and returns user if valid
-func (s *UserService) Authenticate(usernameOrEmail, password string) (*model.User, error) {
-	var user *model.User
-	var err error
+// CountByRole returns the number of users holding a role, leaving out the
+// users in the trash
+func (s *UserService) CountByRole(role string) (int64, error) {
+	return s.repo.CountByRole(role)
+}
 
-	// Try to authenticate by username first
-	user, err = s.repo.GetByUsername(usernameOrEmail)
+// FindByLogin retrieves a user by username, falling back to email
+func (s *UserService) FindByLogin(usernameOrEmail string) (*model.User, error) {
+	// Try the username first
+	user, err := s.repo.GetByUsername(usernameOrEmail)
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		// If not found by username, try by email
 		user, err = s.repo.GetByEmail(usernameOrEmail)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// Authenticate validates user credentials with each authenticator in turn
+// and returns the user of the first one that accepts them
+func (s *UserService) Authenticate(usernameOrEmail, password string) (*model.User, error) {
+	for _, authenticator := range s.authenticators {
+		user, err := authenticator.Authenticate(usernameOrEmail, password)
 		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return nil, ErrInvalidCredentials
+			// An unreachable directory must not lock out the users of the
+			// others, and still counts as a failed attempt for throttling
+			if !errors.Is(err, ErrInvalidCredentials) {
+				log.Printf("Authenticator %s failed: %v", authenticator.Name(), err)
 			}
-			return nil, err
+			continue
 		}
-	} else if err != nil {
-		return nil, err
+
+		if user.Status == model.UserStatusPending {
+			return nil, ErrEmailNotVerified
+		}
+		return user, nil
 	}
 
-	if err := CheckPassword(password, user.Password); err != nil {
-		return nil, ErrInvalidCredentials
+	return nil, ErrInvalidCredentials
+}
+
+// SetPassword hashes and stores a new password for a user
+func (s *UserService) SetPassword(user *model.User, password string) error {
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
 	}
+	user.Password = hashedPassword
+	return s.repo.UpdateFields(user, map[string]interface{}{"password": hashedPassword})
+}
 
-	return user, nil
+// SetRole changes the role of a user
+func (s *UserService) SetRole(user *model.User, role string) error {
+	user.Role = role
+	return s.repo.UpdateFields(user, map[string]interface{}{"role": role})
+}
+
+// SetEmail moves a user to an email address they have confirmed
+func (s *UserService) SetEmail(user *model.User, email string) error {
+	existing, err := s.repo.GetByEmail(email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if existing != nil && existing.ID != user.ID {
+		return ErrEmailAlreadyExists
+	}
+
+	now := time.Now()
+	user.Email = email
+	user.EmailVerifiedAt = &now
+	return s.repo.UpdateFields(user, map[string]interface{}{
+		"email":             email,
+		"email_verified_at": now,
+	})
+}
+
+// MarkEmailVerified activates a pending account once its email is confirmed
+func (s *UserService) MarkEmailVerified(user *model.User) error {
+	now := time.Now()
+	user.Status = model.UserStatusActive
+	user.EmailVerifiedAt = &now
+	return s.repo.UpdateFields(user, map[string]interface{}{
+		"status":            user.Status,
+		"email_verified_at": now,
+	})
 }
 
 // List returns paginated users
@@ -209,12 +339,32 @@ func (s *UserService) List(page, pageSize int) ([]model.User, int64, error) {
 	return s.repo.List(page, pageSize)
 }
 
-// SearchByEmail finds users with matching email pattern
-func (s *UserService) SearchByEmail(search string, page, pageSize int) ([]*model.User, int64, error) {
-	return s.repo.SearchByEmail(search, page, pageSize)
-}
-
-// SearchByFullName finds users with matching full name pattern
-func (s *UserService) SearchByFullName(search string, page, pageSize int) ([]*model.User, int64, error) {
-	return s.repo.SearchByFullName(search, page, pageSize)
+// Search finds users matching a query with pagination
+func (s *UserService) Search(query UserQuery, page, pageSize int) ([]model.User, int64, error) {
+	if query.Platform != "" && !model.IsJudgePlatform(query.Platform) {
+		return nil, 0, ErrUnknownJudgePlatform
+	}
+	filter := repository.UserFilter{
+		Query:          query.Q,
+		Roles:          query.Roles,
+		Status:         query.Status,
+		TeamID:         query.TeamID,
+		ContestID:      query.ContestID,
+		TrainingPlanID: query.TrainingPlanID,
+		Handle:         query.Handle,
+		Platform:       query.Platform,
+		CreatedAfter:   query.CreatedAfter,
+		CreatedBefore:  query.CreatedBefore,
+	}
+	if query.Sort != "" {
+		for _, field := range strings.Split(query.Sort, ",") {
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			if !userSortFields[field] {
+				return nil, 0, fmt.Errorf("%w: %q", ErrInvalidSortField, field)
+			}
+			filter.OrderBy = append(filter.OrderBy, repository.UserOrder{Column: field, Desc: desc})
+		}
+	}
+	return s.repo.Search(filter, page, pageSize)
 }
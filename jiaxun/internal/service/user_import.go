@@ -0,0 +1,435 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+	"jiaxun/internal/xlsx"
+
+	"gorm.io/gorm"
+)
+
+// UserImportService errors
+var (
+	ErrInvalidImportFile   = errors.New("invalid import file")
+	ErrUnknownTableFormat  = errors.New("unknown file format")
+	ErrTooManyImportRows   = errors.New("too many rows to import")
+	ErrInvalidImportRows   = errors.New("some rows cannot be imported")
+	ErrUnknownPasswordMode = errors.New("unknown password mode")
+)
+
+// Table formats users can be imported from and exported to
+const (
+	TableFormatCSV  = "csv"
+	TableFormatXLSX = "xlsx"
+)
+
+// How imported users get their first password, unless the file sets one
+const (
+	// ImportPasswordGenerate returns a random password for each user in the result
+	ImportPasswordGenerate = "generate"
+	// ImportPasswordInvite emails each user a link to choose their password
+	ImportPasswordInvite = "invite"
+)
+
+// MaxImportRows caps the users imported at once, as hashing their
+// passwords takes a while
+const MaxImportRows = 500
+
+// minPasswordLength matches the length required when creating a user
+const minPasswordLength = 6
+
+// userExportColumns are the columns of exported tables. Imports read the
+// same header, of which they need username and email and ignore the rest
+// except full_name, role and password.
+var userExportColumns = []string{"id", "username", "email", "full_name", "role", "status", "email_verified_at", "two_factor", "created_at"}
+
+// UserImportOptions controls an import
+type UserImportOptions struct {
+	// DryRun validates the rows without creating any user
+	DryRun       bool
+	PasswordMode string
+	// CanAssignRoles allows the role column, which otherwise must be empty
+	// or the default role
+	CanAssignRoles bool
+}
+
+// UserImportRow is the outcome of importing a row
+type UserImportRow struct {
+	// Row is the line of the row in the file, or of the sheet, counting the header
+	Row      int    `json:"row"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	FullName string `json:"full_name,omitempty"`
+	Role     string `json:"role"`
+	UserID   uint   `json:"user_id,omitempty"`
+	// Password is the generated initial password; it is only returned once
+	Password       string   `json:"password,omitempty"`
+	InvitationSent bool     `json:"invitation_sent,omitempty"`
+	Errors         []string `json:"errors,omitempty"`
+}
+
+// UserImportResult describes an import
+type UserImportResult struct {
+	DryRun  bool            `json:"dry_run"`
+	Created int             `json:"created"`
+	Rows    []UserImportRow `json:"rows"`
+}
+
+// UserImportService creates users in bulk from CSV or XLSX files and
+// exports them in the same formats
+type UserImportService struct {
+	repo          repository.UserRepository
+	rbacService   *RBACService
+	passwordReset *PasswordResetService
+	invitationTTL time.Duration
+}
+
+// NewUserImportService creates a new user import service instance
+func NewUserImportService(repo repository.UserRepository, rbacService *RBACService, passwordReset *PasswordResetService, invitationTTL time.Duration) *UserImportService {
+	return &UserImportService{
+		repo:          repo,
+		rbacService:   rbacService,
+		passwordReset: passwordReset,
+		invitationTTL: invitationTTL,
+	}
+}
+
+// Import validates every row of a table and, unless it is a dry run and if
+// all rows are valid, creates their users in a single transaction. If any
+// row is invalid, nothing is created and ErrInvalidImportRows is returned
+// together with the result listing each row's errors. A username or email
+// taken by a concurrent import or registration between the validation and
+// the transaction is reported the same way, through the unique indexes.
+func (s *UserImportService) Import(format string, data []byte, opts UserImportOptions) (*UserImportResult, error) {
+	if opts.PasswordMode == "" {
+		opts.PasswordMode = ImportPasswordGenerate
+	}
+	if opts.PasswordMode != ImportPasswordGenerate && opts.PasswordMode != ImportPasswordInvite {
+		return nil, ErrUnknownPasswordMode
+	}
+
+	table, err := readTable(format, data)
+	if err != nil {
+		return nil, err
+	}
+	rows, passwords, err := parseUserRows(table)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UserImportResult{DryRun: opts.DryRun, Rows: rows}
+	valid, err := s.validate(result.Rows, passwords, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return result, ErrInvalidImportRows
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// Rows without a password get a random one, which is either returned or
+	// replaced by the user through the invitation
+	now := time.Now()
+	users := make([]*model.User, len(result.Rows))
+	for i := range result.Rows {
+		row := &result.Rows[i]
+		password := passwords[i]
+		if password == "" {
+			if password, err = randomToken(12); err != nil {
+				return nil, err
+			}
+			if opts.PasswordMode == ImportPasswordGenerate {
+				row.Password = password
+			}
+		}
+		hashedPassword, err := HashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		users[i] = &model.User{
+			Username:  row.Username,
+			Email:     row.Email,
+			FullName:  row.FullName,
+			Password:  hashedPassword,
+			Role:      row.Role,
+			Status:    model.UserStatusActive,
+			CreatedAt: now,
+		}
+	}
+	if err := s.repo.CreateBatch(users); err != nil {
+		var conflict *repository.BatchConflictError
+		if !errors.As(err, &conflict) {
+			return nil, err
+		}
+		// Another import or registration took the username or email after
+		// the rows were validated, so the batch was rolled back
+		for i := range result.Rows {
+			result.Rows[i].Password = ""
+		}
+		row := &result.Rows[conflict.Index]
+		if err := s.recordConflict(row); err != nil {
+			return nil, err
+		}
+		return result, ErrInvalidImportRows
+	}
+	result.Created = len(users)
+
+	for i, user := range users {
+		row := &result.Rows[i]
+		row.UserID = user.ID
+		if opts.PasswordMode != ImportPasswordInvite {
+			continue
+		}
+		// The users exist now, so failures are reported rather than undone
+		if err := s.passwordReset.Invite(user, s.invitationTTL); err != nil {
+			log.Printf("Failed to send invitation to %s: %v", user.Email, err)
+			row.Errors = append(row.Errors, "invitation could not be sent")
+			continue
+		}
+		row.InvitationSent = true
+	}
+	return result, nil
+}
+
+// validate records the errors of each row, checking usernames and email
+// addresses against each other and existing users the way UserService.Create
+// does. It reports whether every row is valid.
+func (s *UserImportService) validate(rows []UserImportRow, passwords []string, opts UserImportOptions) (bool, error) {
+	usernames := map[string]int{}
+	emails := map[string]int{}
+	roles := map[string]bool{}
+	valid := true
+
+	for i := range rows {
+		row := &rows[i]
+
+		if row.Username == "" {
+			row.Errors = append(row.Errors, "username is required")
+		} else if first, ok := usernames[row.Username]; ok {
+			row.Errors = append(row.Errors, fmt.Sprintf("username is already used in row %d", first))
+		} else {
+			usernames[row.Username] = row.Row
+			if _, err := s.repo.GetByUsername(row.Username); err == nil {
+				row.Errors = append(row.Errors, "username already exists")
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, err
+			}
+		}
+
+		if row.Email == "" {
+			row.Errors = append(row.Errors, "email is required")
+		} else if addr, err := mail.ParseAddress(row.Email); err != nil || addr.Address != row.Email {
+			row.Errors = append(row.Errors, "email is not a valid address")
+		} else if first, ok := emails[strings.ToLower(row.Email)]; ok {
+			row.Errors = append(row.Errors, fmt.Sprintf("email is already used in row %d", first))
+		} else {
+			emails[strings.ToLower(row.Email)] = row.Row
+			if _, err := s.repo.GetByEmail(row.Email); err == nil {
+				row.Errors = append(row.Errors, "email already in use")
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, err
+			}
+		}
+
+		if row.Role == "" {
+			row.Role = model.RoleStudent
+		}
+		if row.Role != model.RoleStudent && !opts.CanAssignRoles {
+			row.Errors = append(row.Errors, "assigning roles requires "+model.PermRolesManage)
+		} else {
+			exists, cached := roles[row.Role]
+			if !cached {
+				_, err := s.rbacService.GetRole(row.Role)
+				if err != nil && !errors.Is(err, ErrRoleNotFound) {
+					return false, err
+				}
+				exists = err == nil
+				roles[row.Role] = exists
+			}
+			if !exists {
+				row.Errors = append(row.Errors, fmt.Sprintf("role %q does not exist", row.Role))
+			}
+		}
+
+		if passwords[i] != "" && len(passwords[i]) < minPasswordLength {
+			row.Errors = append(row.Errors, fmt.Sprintf("password must be at least %d characters", minPasswordLength))
+		}
+
+		if len(row.Errors) > 0 {
+			valid = false
+		}
+	}
+	return valid, nil
+}
+
+// recordConflict records on a row which of its username and email was taken
+// by a user created since the rows were validated
+func (s *UserImportService) recordConflict(row *UserImportRow) error {
+	before := len(row.Errors)
+	if _, err := s.repo.GetByUsername(row.Username); err == nil {
+		row.Errors = append(row.Errors, "username already exists")
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if _, err := s.repo.GetByEmail(row.Email); err == nil {
+		row.Errors = append(row.Errors, "email already in use")
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	// The conflicting user may be gone again by now
+	if len(row.Errors) == before {
+		row.Errors = append(row.Errors, "username or email already in use")
+	}
+	return nil
+}
+
+// Export writes every user as a table, without passwords or secrets
+func (s *UserImportService) Export(w io.Writer, format string) error {
+	users, err := s.repo.ListAll()
+	if err != nil {
+		return err
+	}
+
+	table := [][]string{userExportColumns}
+	for _, user := range users {
+		verifiedAt := ""
+		if user.EmailVerifiedAt != nil {
+			verifiedAt = user.EmailVerifiedAt.UTC().Format(time.RFC3339)
+		}
+		table = append(table, []string{
+			strconv.FormatUint(uint64(user.ID), 10),
+			user.Username,
+			user.Email,
+			user.FullName,
+			user.Role,
+			user.Status,
+			verifiedAt,
+			strconv.FormatBool(user.TOTPEnabledAt != nil),
+			user.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	switch format {
+	case TableFormatCSV:
+		// Spreadsheets run cells starting with a formula character, so
+		// exported values are kept from being interpreted
+		for _, row := range table[1:] {
+			for i, value := range row {
+				if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+					row[i] = "'" + value
+				}
+			}
+		}
+		cw := csv.NewWriter(w)
+		if err := cw.WriteAll(table); err != nil {
+			return err
+		}
+		return cw.Error()
+	case TableFormatXLSX:
+		return xlsx.Write(w, "Users", table)
+	default:
+		return ErrUnknownTableFormat
+	}
+}
+
+// readTable decodes a CSV or XLSX file into rows of cells
+func readTable(format string, data []byte) ([][]string, error) {
+	switch format {
+	case TableFormatCSV:
+		// Spreadsheets often save CSV files with a byte order mark
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		var table [][]string
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				return table, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+			}
+			// Blank lines are skipped by the reader but keep their place,
+			// so that rows are numbered by their line
+			line, _ := r.FieldPos(0)
+			for len(table) < line-1 {
+				table = append(table, nil)
+			}
+			table = append(table, record)
+		}
+	case TableFormatXLSX:
+		table, err := xlsx.Read(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		return table, nil
+	default:
+		return nil, ErrUnknownTableFormat
+	}
+}
+
+// parseUserRows maps the rows of a table to users by its header, skipping
+// empty rows. Passwords are returned separately so that they never end up
+// in the result.
+func parseUserRows(table [][]string) ([]UserImportRow, []string, error) {
+	if len(table) == 0 {
+		return nil, nil, fmt.Errorf("%w: the file is empty", ErrInvalidImportFile)
+	}
+
+	columns := map[string]int{}
+	for i, name := range table[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	for _, required := range []string{"username", "email"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("%w: missing column %q", ErrInvalidImportFile, required)
+		}
+	}
+
+	var rows []UserImportRow
+	var passwords []string
+	for i, cells := range table[1:] {
+		cell := func(name string) string {
+			if col, ok := columns[name]; ok && col < len(cells) {
+				return strings.TrimSpace(cells[col])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(cells, "")) == "" {
+			continue
+		}
+		if len(rows) == MaxImportRows {
+			return nil, nil, ErrTooManyImportRows
+		}
+		rows = append(rows, UserImportRow{
+			Row:      i + 2,
+			Username: cell("username"),
+			Email:    cell("email"),
+			FullName: cell("full_name"),
+			Role:     cell("role"),
+		})
+		passwords = append(passwords, cell("password"))
+	}
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("%w: the file has no users", ErrInvalidImportFile)
+	}
+	return rows, passwords, nil
+}
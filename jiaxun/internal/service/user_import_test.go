@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"jiaxun/internal/model"
+	"jiaxun/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// newTestUserImportService returns an import service backed by the database
+func newTestUserImportService(db *gorm.DB) (*UserImportService, *UserService) {
+	userService := newTestUserService(db)
+	rbacService := NewRBACService(repository.NewRoleRepository(db), userService)
+	return NewUserImportService(*repository.NewUserRepository(db), rbacService, nil, time.Hour), userService
+}
+
+func TestImportRejectsTakenUsernames(t *testing.T) {
+	db := openTestDB(t)
+	service, userService := newTestUserImportService(db)
+	if err := userService.Create(&model.User{Username: "ada", Email: "ada@example.org", Password: "password"}); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	table := "username,email\nada,lovelace@example.org\ngrace,ada@example.org\ngrace,hopper@example.org\n"
+	result, err := service.Import(TableFormatCSV, []byte(table), UserImportOptions{})
+	if !errors.Is(err, ErrInvalidImportRows) {
+		t.Fatalf("Import = %v, want ErrInvalidImportRows", err)
+	}
+	want := [][]string{{"username already exists"}, {"email already in use"}, {"username is already used in row 3"}}
+	for i, row := range result.Rows {
+		if strings.Join(row.Errors, "; ") != strings.Join(want[i], "; ") {
+			t.Errorf("row %d errors = %q, want %q", row.Row, row.Errors, want[i])
+		}
+	}
+}
+
+func TestImportConcurrentRegistration(t *testing.T) {
+	db := openTestDB(t)
+	service, userService := newTestUserImportService(db)
+
+	// Someone registers with the email of the second row once the rows are
+	// validated, right before the import creates its first user
+	registered := false
+	err := db.Callback().Create().Before("gorm:create").Register("test:register", func(tx *gorm.DB) {
+		if registered || tx.Statement.Table != "user" {
+			return
+		}
+		registered = true
+		if err := userService.Create(&model.User{Username: "hopper", Email: "grace@example.org", Password: "password"}); err != nil {
+			t.Errorf("registering concurrently: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("registering callback: %v", err)
+	}
+
+	table := "username,email\nada,ada@example.org\ngrace,grace@example.org\n"
+	result, err := service.Import(TableFormatCSV, []byte(table), UserImportOptions{})
+	if !errors.Is(err, ErrInvalidImportRows) {
+		t.Fatalf("Import = %v, want ErrInvalidImportRows", err)
+	}
+	if !registered {
+		t.Fatal("the concurrent registration did not happen")
+	}
+	if result.Created != 0 {
+		t.Errorf("Created = %d, want 0", result.Created)
+	}
+	for _, row := range result.Rows {
+		if row.Password != "" || row.UserID != 0 {
+			t.Errorf("row %d reports user %d with password %q, but nothing was created", row.Row, row.UserID, row.Password)
+		}
+	}
+	if got := result.Rows[1].Errors; len(got) != 1 || got[0] != "email already in use" {
+		t.Errorf("row 3 errors = %q, want the email in use", got)
+	}
+	if len(result.Rows[0].Errors) != 0 {
+		t.Errorf("row 2 errors = %q, want none", result.Rows[0].Errors)
+	}
+	if _, err := userService.GetByUsername("ada"); err == nil {
+		t.Error("the first row was created although the import failed")
+	}
+}
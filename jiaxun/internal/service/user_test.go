@@ -0,0 +1,42 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"jiaxun/internal/model"
+)
+
+func TestSearchUsersSort(t *testing.T) {
+	db := openTestDB(t)
+	service := newTestUserService(db)
+	for _, name := range []string{"grace", "ada", "hedy"} {
+		if err := service.Create(&model.User{Username: name, Email: name + "@example.org", Password: "password"}); err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+	}
+
+	users, _, err := service.Search(UserQuery{Sort: "-role,username"}, 1, 10)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	var names []string
+	for _, user := range users {
+		names = append(names, user.Username)
+	}
+	if len(names) != 3 || names[0] != "ada" || names[1] != "grace" || names[2] != "hedy" {
+		t.Errorf("sorted users = %q, want ada, grace, hedy", names)
+	}
+
+	// Only the listed fields can be sorted by, so that users cannot be
+	// ordered by their password hash or arbitrary SQL
+	for _, sort := range []string{"password", "-password", "username,totp_secret", "id; DROP TABLE user", "username,"} {
+		if _, _, err := service.Search(UserQuery{Sort: sort}, 1, 10); !errors.Is(err, ErrInvalidSortField) {
+			t.Errorf("sorting by %q = %v, want ErrInvalidSortField", sort, err)
+		}
+	}
+
+	if _, _, err := service.Search(UserQuery{Platform: "topcoder"}, 1, 10); !errors.Is(err, ErrUnknownJudgePlatform) {
+		t.Errorf("unknown platform = %v, want ErrUnknownJudgePlatform", err)
+	}
+}
@@ -0,0 +1,306 @@
+// Package xlsx reads and writes the cell values of Office Open XML
+// spreadsheets (ECMA-376), as far as importing and exporting tables needs:
+// the first worksheet of a workbook, as text, without any formatting.
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalid is returned for files that are not workbooks
+var ErrInvalid = errors.New("xlsx: not a valid workbook")
+
+// maxPartSize bounds the uncompressed size of a part, so that small files
+// cannot expand to exhaust memory
+const maxPartSize = 64 << 20
+
+const (
+	relationshipsNS = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	spreadsheetNS   = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	packageRelsNS   = "http://schemas.openxmlformats.org/package/2006/relationships"
+)
+
+// richText is a string that is either plain or made of formatted runs
+type richText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (r richText) String() string {
+	if len(r.Runs) == 0 {
+		return r.T
+	}
+	var b strings.Builder
+	for _, run := range r.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+type workbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		// The namespace is left out, as prefixes vary between producers
+		RID string `xml:"id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type relationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type worksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string   `xml:"r,attr"`
+			T      string   `xml:"t,attr"`
+			V      string   `xml:"v"`
+			Inline richText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// Read returns the rows of the first worksheet of a workbook. Rows and
+// cells are placed at their position in the sheet, with empty ones filled
+// in; trailing empty cells are dropped. Numbers and dates are returned as
+// stored, without applying their display format.
+func Read(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []richText `xml:"si"`
+		}
+		if err := decodePart(f, &sst); err != nil {
+			return nil, err
+		}
+		shared = make([]string, len(sst.Items))
+		for i, item := range sst.Items {
+			shared[i] = item.String()
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, ErrInvalid
+	}
+	var sheet worksheet
+	if err := decodePart(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		index := len(rows)
+		if row.R > 0 {
+			index = row.R - 1
+		}
+		if index < len(rows) {
+			return nil, fmt.Errorf("%w: rows out of order", ErrInvalid)
+		}
+		for len(rows) < index {
+			rows = append(rows, nil)
+		}
+
+		var values []string
+		for _, cell := range row.Cells {
+			col := len(values)
+			if cell.R != "" {
+				if col, err = columnIndex(cell.R); err != nil {
+					return nil, err
+				}
+			}
+			if col < len(values) {
+				return nil, fmt.Errorf("%w: cells out of order", ErrInvalid)
+			}
+			for len(values) < col {
+				values = append(values, "")
+			}
+
+			value := cell.V
+			switch cell.T {
+			case "s":
+				i, err := strconv.Atoi(cell.V)
+				if err != nil || i < 0 || i >= len(shared) {
+					return nil, fmt.Errorf("%w: unknown shared string %q", ErrInvalid, cell.V)
+				}
+				value = shared[i]
+			case "inlineStr":
+				value = cell.Inline.String()
+			case "b":
+				value = "FALSE"
+				if cell.V == "1" {
+					value = "TRUE"
+				}
+			}
+			values = append(values, value)
+		}
+		for len(values) > 0 && values[len(values)-1] == "" {
+			values = values[:len(values)-1]
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+// firstSheet returns the path of the first worksheet of a workbook
+func firstSheet(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	f, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", ErrInvalid
+	}
+	var wb workbook
+	if err := decodePart(f, &wb); err != nil {
+		return "", err
+	}
+	rf, ok := files["xl/_rels/workbook.xml.rels"]
+	if len(wb.Sheets) == 0 || !ok {
+		return fallback, nil
+	}
+	var rels relationships
+	if err := decodePart(rf, &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != wb.Sheets[0].RID {
+			continue
+		}
+		// Targets are relative to the workbook, or absolute within the package
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return fallback, nil
+}
+
+func decodePart(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return ErrInvalid
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxPartSize+1))
+	if err != nil {
+		return ErrInvalid
+	}
+	if len(data) > maxPartSize {
+		return fmt.Errorf("%w: %s is too large", ErrInvalid, f.Name)
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalid, f.Name, err)
+	}
+	return nil
+}
+
+// columnIndex returns the zero-based column of a cell reference such as "AB12"
+func columnIndex(ref string) (int, error) {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A'+1)
+		if col > 1<<14 {
+			break
+		}
+	}
+	if i == 0 || col > 1<<14 {
+		return 0, fmt.Errorf("%w: invalid cell reference %q", ErrInvalid, ref)
+	}
+	return col - 1, nil
+}
+
+// columnName returns the letters of a zero-based column, e.g. "AB" for 27
+func columnName(col int) string {
+	var name []byte
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = append([]byte{byte('A' + (col-1)%26)}, name...)
+	}
+	return string(name)
+}
+
+// Write writes a workbook with a single worksheet holding rows as text
+func Write(w io.Writer, sheetName string, rows [][]string) error {
+	zw := zip.NewWriter(w)
+
+	var sheet bytes.Buffer
+	sheet.WriteString(xml.Header)
+	fmt.Fprintf(&sheet, `<worksheet xmlns="%s"><sheetData>`, spreadsheetNS)
+	for i, row := range rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, i+1)
+		for j, value := range row {
+			fmt.Fprintf(&sheet, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, columnName(j), i+1)
+			xml.EscapeText(&sheet, []byte(value))
+			sheet.WriteString(`</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	var name bytes.Buffer
+	xml.EscapeText(&name, []byte(sheetName))
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xml.Header +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header +
+			`<Relationships xmlns="` + packageRelsNS + `">` +
+			`<Relationship Id="rId1" Type="` + relationshipsNS + `/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header +
+			`<workbook xmlns="` + spreadsheetNS + `" xmlns:r="` + relationshipsNS + `">` +
+			`<sheets><sheet name="` + name.String() + `" sheetId="1" r:id="rId1"/></sheets>` +
+			`</workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header +
+			`<Relationships xmlns="` + packageRelsNS + `">` +
+			`<Relationship Id="rId1" Type="` + relationshipsNS + `/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	}
+	for _, part := range parts {
+		pw, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(pw, part.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,304 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// part is a file of a workbook package
+type part struct {
+	name    string
+	content string
+}
+
+// workbookParts are the parts pointing to the worksheet at xl/worksheets/sheet1.xml
+var workbookParts = []part{
+	{"xl/workbook.xml", `<workbook xmlns="` + spreadsheetNS + `" xmlns:r="` + relationshipsNS + `">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="` + packageRelsNS + `">` +
+		`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// sheet returns a worksheet part holding the rows
+func sheet(rows string) part {
+	return part{"xl/worksheets/sheet1.xml", `<worksheet xmlns="` + spreadsheetNS + `"><sheetData>` + rows + `</sheetData></worksheet>`}
+}
+
+// withWorkbook returns the parts after the workbook parts
+func withWorkbook(parts ...part) []part {
+	return append(append([]part(nil), workbookParts...), parts...)
+}
+
+// pack zips the parts into a package
+func pack(t *testing.T, parts ...part) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, p := range parts {
+		w, err := zw.Create(p.name)
+		if err != nil {
+			t.Fatalf("creating %s: %v", p.name, err)
+		}
+		if _, err := io.WriteString(w, p.content); err != nil {
+			t.Fatalf("writing %s: %v", p.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing package: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// read reads a package with Read
+func read(data []byte) ([][]string, error) {
+	return Read(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestWriteRead(t *testing.T) {
+	rows := [][]string{
+		{"username", "email", "full_name"},
+		{"ada", "ada@example.org", "Ada Lovelace"},
+		{},
+		{"grace", "", "  Grace <Hopper> & \"co\"  "},
+		{"", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "last column"},
+		{"line\nbreak", "=1+1", "日本語"},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, "Users & <staff>", rows); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got, err := read(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	want := append([][]string(nil), rows...)
+	want[2] = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read = %q, want %q", got, want)
+	}
+}
+
+func TestRead(t *testing.T) {
+	sharedStrings := part{"xl/sharedStrings.xml", `<sst xmlns="` + spreadsheetNS + `">` +
+		`<si><t>ada</t></si>` +
+		`<si><r><t>Ada </t></r><r><rPr><b/></rPr><t>Lovelace</t></r></si>` +
+		`</sst>`}
+
+	tests := []struct {
+		name  string
+		parts []part
+		want  [][]string
+	}{
+		{
+			name:  "shared strings",
+			parts: withWorkbook(sharedStrings, sheet(`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>`)),
+			want:  [][]string{{"ada", "Ada Lovelace"}},
+		},
+		{
+			name: "inline strings",
+			parts: withWorkbook(sheet(`<row r="1"><c r="A1" t="inlineStr"><is><t>ada</t></is></c>` +
+				`<c r="B1" t="inlineStr"><is><r><t>Ada </t></r><r><t>Lovelace</t></r></is></c></row>`)),
+			want: [][]string{{"ada", "Ada Lovelace"}},
+		},
+		{
+			name:  "numbers and booleans",
+			parts: withWorkbook(sheet(`<row><c><v>42</v></c><c t="b"><v>1</v></c><c t="b"><v>0</v></c></row>`)),
+			want:  [][]string{{"42", "TRUE", "FALSE"}},
+		},
+		{
+			name: "gaps",
+			parts: withWorkbook(sheet(`<row r="2"><c r="C2"><v>1</v></c><c r="D2"></c></row>` +
+				`<row r="4"><c r="AA4"><v>2</v></c></row>`)),
+			want: [][]string{nil, {"", "", "1"}, nil, append(make([]string, 26), "2")},
+		},
+		{
+			name:  "missing workbook relationships",
+			parts: []part{workbookParts[0], sheet(`<row><c><v>1</v></c></row>`)},
+			want:  [][]string{{"1"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := read(pack(t, tc.parts...))
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Read = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		sheet string
+		want  string
+	}{
+		{"rows out of order", `<row r="2"></row><row r="1"></row>`, "rows out of order"},
+		{"repeated row", `<row r="1"></row><row r="1"></row>`, "rows out of order"},
+		{"cells out of order", `<row r="1"><c r="B1"><v>1</v></c><c r="A1"><v>2</v></c></row>`, "cells out of order"},
+		{"lowercase reference", `<row r="1"><c r="a1"><v>1</v></c></row>`, `invalid cell reference "a1"`},
+		{"reference without column", `<row r="1"><c r="12"><v>1</v></c></row>`, `invalid cell reference "12"`},
+		{"reference beyond the last column", `<row r="1"><c r="XFE1"><v>1</v></c></row>`, `invalid cell reference "XFE1"`},
+		{"unknown shared string", `<row r="1"><c r="A1" t="s"><v>0</v></c></row>`, `unknown shared string "0"`},
+		{"malformed sheet", `<row r="1"><c>`, "sheet1.xml"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := read(pack(t, withWorkbook(sheet(tc.sheet))...))
+			if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Read = %v, want ErrInvalid about %s", err, tc.want)
+			}
+		})
+	}
+
+	t.Run("not a zip file", func(t *testing.T) {
+		if _, err := read([]byte("username,email\n")); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Read = %v, want ErrInvalid", err)
+		}
+	})
+	t.Run("no workbook", func(t *testing.T) {
+		if _, err := read(pack(t, sheet(""))); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Read = %v, want ErrInvalid", err)
+		}
+	})
+	t.Run("missing worksheet", func(t *testing.T) {
+		if _, err := read(pack(t, workbookParts...)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Read = %v, want ErrInvalid", err)
+		}
+	})
+}
+
+func TestColumnIndex(t *testing.T) {
+	for ref, want := range map[string]int{"A1": 0, "Z9": 25, "AA10": 26, "AB12": 27, "ZZ1": 701, "XFD1048576": 1<<14 - 1, "B": 1} {
+		if got, err := columnIndex(ref); err != nil || got != want {
+			t.Errorf("columnIndex(%q) = %d, %v, want %d", ref, got, err, want)
+		}
+		if name := columnName(want); !strings.HasPrefix(ref, name) || strings.ContainsAny(ref[len(name):], "ABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+			t.Errorf("columnName(%d) = %q, want the letters of %q", want, name, ref)
+		}
+	}
+	for _, ref := range []string{"", "1", "a1", "$A$1", "XFE1", "AAAAAAAAAAAAAAAAAAAAAAAA1"} {
+		if _, err := columnIndex(ref); !errors.Is(err, ErrInvalid) {
+			t.Errorf("columnIndex(%q) = %v, want ErrInvalid", ref, err)
+		}
+	}
+}
+
+func TestFirstSheet(t *testing.T) {
+	workbook := part{"xl/workbook.xml", `<workbook xmlns="` + spreadsheetNS + `" xmlns:r="` + relationshipsNS + `">` +
+		`<sheets><sheet name="Users" sheetId="2" r:id="rId3"/><sheet name="Other" sheetId="1" r:id="rId1"/></sheets></workbook>`}
+	rels := func(target string) part {
+		return part{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="` + packageRelsNS + `">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId3" Target="` + target + `"/></Relationships>`}
+	}
+
+	tests := []struct {
+		name  string
+		parts []part
+		want  string
+	}{
+		{"relative target", []part{workbook, rels("worksheets/users.xml")}, "xl/worksheets/users.xml"},
+		{"relative target with dot segments", []part{workbook, rels("./sheets/../worksheets/users.xml")}, "xl/worksheets/users.xml"},
+		{"absolute target", []part{workbook, rels("/xl/worksheets/users.xml")}, "xl/worksheets/users.xml"},
+		{"unknown relationship", []part{workbook, {"xl/_rels/workbook.xml.rels", `<Relationships xmlns="` + packageRelsNS + `"/>`}}, "xl/worksheets/sheet1.xml"},
+		{"no relationships", []part{workbook}, "xl/worksheets/sheet1.xml"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data := pack(t, tc.parts...)
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("opening package: %v", err)
+			}
+			files := map[string]*zip.File{}
+			for _, f := range zr.File {
+				files[f.Name] = f
+			}
+			got, err := firstSheet(files)
+			if err != nil || got != tc.want {
+				t.Errorf("firstSheet = %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+
+	// The first sheet of the workbook is read, not the first relationship
+	data := pack(t, workbook, rels("/xl/worksheets/users.xml"),
+		part{"xl/worksheets/sheet1.xml", `<worksheet><sheetData><row><c><v>other</v></c></row></sheetData></worksheet>`},
+		part{"xl/worksheets/users.xml", `<worksheet><sheetData><row><c><v>users</v></c></row></sheetData></worksheet>`})
+	if got, err := read(data); err != nil || !reflect.DeepEqual(got, [][]string{{"users"}}) {
+		t.Errorf("Read = %q, %v, want the users sheet", got, err)
+	}
+}
+
+func TestReadLargePart(t *testing.T) {
+	// The part is valid XML, but its padding takes it past the limit
+	content := `<worksheet><sheetData><row><c><v>1</v></c></row></sheetData>` +
+		strings.Repeat(" ", maxPartSize) + `</worksheet>`
+	data := pack(t, withWorkbook(part{"xl/worksheets/sheet1.xml", content})...)
+	if len(data) > 1<<20 {
+		t.Fatalf("package is %d bytes, want a small file expanding past the limit", len(data))
+	}
+	_, err := read(data)
+	if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Read = %v, want ErrInvalid for a part that is too large", err)
+	}
+}
+
+func TestReadZipBomb(t *testing.T) {
+	// The part claims to be small but expands far beyond its declared size
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		t.Fatalf("creating compressor: %v", err)
+	}
+	content := []byte(`<worksheet><sheetData>` + strings.Repeat(`<row></row>`, 1<<20) + `</sheetData></worksheet>`)
+	if _, err := fw.Write(content); err != nil {
+		t.Fatalf("compressing: %v", err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("compressing: %v", err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, p := range workbookParts {
+		w, err := zw.Create(p.name)
+		if err != nil {
+			t.Fatalf("creating %s: %v", p.name, err)
+		}
+		if _, err := io.WriteString(w, p.content); err != nil {
+			t.Fatalf("writing %s: %v", p.name, err)
+		}
+	}
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "xl/worksheets/sheet1.xml",
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE(content),
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: 64,
+	})
+	if err != nil {
+		t.Fatalf("creating the sheet: %v", err)
+	}
+	if _, err := w.Write(compressed.Bytes()); err != nil {
+		t.Fatalf("writing the sheet: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing package: %v", err)
+	}
+
+	if _, err := read(buf.Bytes()); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Read = %v, want ErrInvalid", err)
+	}
+}